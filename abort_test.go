@@ -692,6 +692,63 @@ func TestEventTarget_AddEventListenerWithSignal(t *testing.T) {
 	}
 }
 
+func TestEventTarget_ListenerOptions(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const et = new EventTarget();
+
+    // once: removed before it runs, even if it re-dispatches.
+    let once = 0;
+    et.addEventListener('once', () => { once++; et.dispatchEvent(new Event('once')); }, { once: true });
+    et.dispatchEvent(new Event('once'));
+    et.dispatchEvent(new Event('once'));
+
+    // A signal that is already aborted never registers the listener.
+    let preAborted = 0;
+    et.addEventListener('pre', () => preAborted++, { signal: AbortSignal.abort() });
+    et.dispatchEvent(new Event('pre'));
+
+    // Registering the same callback twice is a no-op.
+    let dup = 0;
+    const dupFn = () => dup++;
+    et.addEventListener('dup', dupFn);
+    et.addEventListener('dup', dupFn);
+    et.dispatchEvent(new Event('dup'));
+
+    // Aborting mid-dispatch removes a listener that has not run yet.
+    const ac = new AbortController();
+    let late = 0;
+    et.addEventListener('mid', () => ac.abort());
+    et.addEventListener('mid', () => late++, { signal: ac.signal });
+    et.dispatchEvent(new Event('mid'));
+
+    // handleEvent objects are accepted.
+    let handled = 0;
+    et.addEventListener('obj', { handleEvent() { handled++; } }, { once: true });
+    et.dispatchEvent(new Event('obj'));
+    et.dispatchEvent(new Event('obj'));
+
+    return Response.json({ once, preAborted, dup, late, handled });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]int
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"once": 1, "preAborted": 0, "dup": 1, "late": 0, "handled": 1}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %d, want %d", k, data[k], v)
+		}
+	}
+}
+
 func TestEventTarget_SymbolToStringTag(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -2,6 +2,9 @@ package worker
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
@@ -68,6 +71,16 @@ func (m *mockCacheStore) Delete(cacheName, url string) (bool, error) {
 	return false, nil
 }
 
+func (m *mockCacheStore) DeleteCache(cacheName string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.items[cacheName]; ok {
+		delete(m.items, cacheName)
+		return len(c) > 0, nil
+	}
+	return false, nil
+}
+
 // count returns the number of entries for a given cacheName and url (0 or 1).
 func (m *mockCacheStore) count(cacheName, url string) int {
 	m.mu.Lock()
@@ -779,6 +792,55 @@ func TestCacheStorage_Delete(t *testing.T) {
 	}
 }
 
+func TestCacheStorage_DeleteDropsEntries(t *testing.T) {
+	e := newTestEngine(t)
+	env := cacheEnv()
+	store := env.Cache.(*mockCacheStore)
+
+	source := `export default {
+  async fetch(request, env) {
+    var url = 'https://example.com/versioned';
+    var v1 = await caches.open('v1');
+    await v1.put(url, new Response('v1-data'));
+    await caches.default.put(url, new Response('default-data'));
+
+    var deleted = await caches.delete('v1');
+    var reopened = await caches.open('v1');
+    var afterDelete = await reopened.match(url);
+    var fromDefault = await caches.default.match(url);
+    return Response.json({
+      deleted,
+      afterDelete: afterDelete !== undefined,
+      defaultBody: fromDefault ? await fromDefault.text() : null,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, env, getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Deleted     bool    `json:"deleted"`
+		AfterDelete bool    `json:"afterDelete"`
+		DefaultBody *string `json:"defaultBody"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatal(err)
+	}
+	if !data.Deleted {
+		t.Error("caches.delete('v1') should return true")
+	}
+	if data.AfterDelete {
+		t.Error("entries of a deleted cache should not match after reopening it")
+	}
+	if data.DefaultBody == nil || *data.DefaultBody != "default-data" {
+		t.Errorf("default cache body = %v, want 'default-data'", data.DefaultBody)
+	}
+	if n := store.count("v1", "https://example.com/versioned"); n != 0 {
+		t.Errorf("store still holds %d v1 entries", n)
+	}
+}
+
 func TestCacheStorage_Keys(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -887,3 +949,196 @@ func TestCache_MatchNullRequest(t *testing.T) {
 		t.Error("match(null) should return undefined, not a hit")
 	}
 }
+
+func TestCache_FetchCacheTtl(t *testing.T) {
+	disableFetchSSRF(t)
+
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = fmt.Fprintf(w, "%s #%d", r.URL.Path, n)
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const opts = { cf: { cacheTtl: 60, cacheEverything: true, cacheTtlByStatus: { "404": -1 } } };
+    const out = {};
+    for (const path of ["/data", "/missing"]) {
+      const first = await fetch("%[1]s" + path, opts);
+      const second = await fetch("%[1]s" + path, opts);
+      out[path] = {
+        first: await first.text(), firstStatus: first.headers.get("cf-cache-status"),
+        second: await second.text(), secondStatus: second.headers.get("cf-cache-status"),
+        code: second.status,
+      };
+    }
+    const plain = await fetch("%[1]s/data");
+    out.plain = await plain.text();
+    return Response.json(out);
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, cacheEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	type result struct {
+		First        string `json:"first"`
+		FirstStatus  string `json:"firstStatus"`
+		Second       string `json:"second"`
+		SecondStatus string `json:"secondStatus"`
+		Code         int    `json:"code"`
+	}
+	var data struct {
+		Data    result `json:"/data"`
+		Missing result `json:"/missing"`
+		Plain   string `json:"plain"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if data.Data.First != "/data #1" || data.Data.FirstStatus != "MISS" {
+		t.Errorf("first fetch = %q (%s), want origin response marked MISS", data.Data.First, data.Data.FirstStatus)
+	}
+	if data.Data.Second != "/data #1" || data.Data.SecondStatus != "HIT" {
+		t.Errorf("second fetch = %q (%s), want cached response marked HIT", data.Data.Second, data.Data.SecondStatus)
+	}
+	if data.Missing.Second != "/missing #2" || data.Missing.Code != 404 {
+		t.Errorf("404 with cacheTtlByStatus -1 = %q (%d), want a fresh origin response", data.Missing.Second, data.Missing.Code)
+	}
+	if data.Plain != "/data #2" {
+		t.Errorf("fetch without cf = %q, want origin response", data.Plain)
+	}
+}
+
+func TestCache_FetchCacheSkipsPrivateResponses(t *testing.T) {
+	disableFetchSSRF(t)
+
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/cookie":
+			w.Header().Set("Set-Cookie", fmt.Sprintf("session=%d", n))
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/vary":
+			w.Header().Set("Vary", "Cookie")
+		}
+		_, _ = fmt.Fprintf(w, "%s #%d", r.URL.Path, n)
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const out = {};
+    const twice = async (path, cf) => {
+      await fetch("%[1]s" + path, { cf });
+      const resp = await fetch("%[1]s" + path, { cf });
+      return (await resp.text()) + " " + resp.headers.get("cf-cache-status");
+    };
+    for (const path of ["/cookie", "/private", "/no-store", "/vary"]) {
+      out[path] = await twice(path, { cacheTtl: 60 });
+    }
+    out.everything = await twice("/cookie", { cacheTtl: 60, cacheEverything: true });
+    out.inDefault = (await caches.default.match("%[1]s/cookie")) !== undefined;
+    return Response.json(out);
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, cacheEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for path, want := range map[string]string{
+		"/cookie":    "/cookie #2 MISS",
+		"/private":   "/private #2 MISS",
+		"/no-store":  "/no-store #2 MISS",
+		"/vary":      "/vary #2 MISS",
+		"everything": "/cookie #3 HIT",
+	} {
+		if data[path] != want {
+			t.Errorf("%s = %v, want %q", path, data[path], want)
+		}
+	}
+	if data["inDefault"] != false {
+		t.Error("caches.default saw a fetch subrequest entry")
+	}
+}
+
+func TestCache_FetchRequestCacheMode(t *testing.T) {
+	disableFetchSSRF(t)
+
+	var mu sync.Mutex
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		n := hits
+		mu.Unlock()
+		_, _ = fmt.Fprintf(w, "#%d", n)
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const cf = { cacheTtl: 60 };
+    const get = async (init) => {
+      const resp = await fetch(new Request("%[1]s/data", init), { cf });
+      return (await resp.text()) + " " + resp.headers.get("cf-cache-status");
+    };
+    const out = {};
+    out.noStore = await get({ cache: "no-store" });
+    out.primed = await get({});
+    out.hit = await get({});
+    out.noStoreAfter = await get({ cache: "no-store" });
+    out.reload = await get({ cache: "reload" });
+    out.afterReload = await get({});
+    try { new Request("%[1]s/data", { cache: "bogus" }); out.invalid = "accepted"; }
+    catch (e) { out.invalid = e.constructor.name; }
+    return Response.json(out);
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, cacheEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"noStore":      "#1 null",
+		"primed":       "#2 MISS",
+		"hit":          "#2 HIT",
+		"noStoreAfter": "#3 null",
+		"reload":       "#4 MISS",
+		"afterReload":  "#4 HIT",
+		"invalid":      "TypeError",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %q, want %q", k, data[k], v)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package worker
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
 	"encoding/json"
+	"io"
 	"testing"
 )
 
@@ -215,6 +219,90 @@ func TestCompression_DeflateRawRoundTrip(t *testing.T) {
 	}
 }
 
+func TestCompression_BrowserDeflateSamples(t *testing.T) {
+	e := newTestEngine(t)
+
+	// Output of CompressionStream("deflate") and ("deflate-raw") in a
+	// browser for the same input: the former carries the zlib header and
+	// Adler-32 trailer, the latter is bare DEFLATE data.
+	source := `export default {
+  async fetch(request, env) {
+    const zlibSample = new Uint8Array([120, 156, 243, 72, 205, 201, 201, 87, 72, 43, 202, 207, 85, 40, 201, 72,
+      85, 72, 42, 202, 47, 47, 78, 45, 82, 84, 240, 192, 46, 14, 0, 151, 144, 16, 253]);
+    const rawSample = new Uint8Array([243, 72, 205, 201, 201, 87, 72, 43, 202, 207, 85, 40, 201, 72,
+      85, 72, 42, 202, 47, 47, 78, 45, 82, 84, 240, 192, 46, 14, 0]);
+
+    async function run(stream, data) {
+      const collected = new Response(stream.readable).arrayBuffer();
+      const writer = stream.writable.getWriter();
+      await writer.write(data);
+      await writer.close();
+      return new Uint8Array(await collected);
+    }
+    async function inflate(format, data) {
+      try {
+        return new TextDecoder().decode(await run(new DecompressionStream(format), data));
+      } catch (e) {
+        return "error";
+      }
+    }
+    const b64 = (u8) => btoa(String.fromCharCode(...u8));
+    const input = new TextEncoder().encode("Hello from the worker! Hello from the worker!");
+
+    return Response.json({
+      deflate: await inflate("deflate", zlibSample),
+      deflateRaw: await inflate("deflate-raw", rawSample),
+      rawAsDeflate: await inflate("deflate", rawSample),
+      zlibAsRaw: await inflate("deflate-raw", zlibSample),
+      compressedDeflate: b64(await run(new CompressionStream("deflate"), input)),
+      compressedRaw: b64(await run(new CompressionStream("deflate-raw"), input)),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Deflate           string `json:"deflate"`
+		DeflateRaw        string `json:"deflateRaw"`
+		RawAsDeflate      string `json:"rawAsDeflate"`
+		ZlibAsRaw         string `json:"zlibAsRaw"`
+		CompressedDeflate []byte `json:"compressedDeflate"`
+		CompressedRaw     []byte `json:"compressedRaw"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	const want = "Hello from the browser! Hello from the browser!"
+	if data.Deflate != want {
+		t.Errorf("deflate sample = %q, want %q", data.Deflate, want)
+	}
+	if data.DeflateRaw != want {
+		t.Errorf("deflate-raw sample = %q, want %q", data.DeflateRaw, want)
+	}
+	if data.RawAsDeflate == want {
+		t.Error("raw DEFLATE data should not decode as zlib-wrapped deflate")
+	}
+	if data.ZlibAsRaw == want {
+		t.Error("zlib-wrapped data should not decode as deflate-raw")
+	}
+
+	const input = "Hello from the worker! Hello from the worker!"
+	zr, err := zlib.NewReader(bytes.NewReader(data.CompressedDeflate))
+	if err != nil {
+		t.Fatalf("deflate output is not zlib-wrapped: %v", err)
+	}
+	if out, err := io.ReadAll(zr); err != nil || string(out) != input {
+		t.Errorf("zlib decode of deflate output = %q, %v", out, err)
+	}
+	out, err := io.ReadAll(flate.NewReader(bytes.NewReader(data.CompressedRaw)))
+	if err != nil || string(out) != input {
+		t.Errorf("flate decode of deflate-raw output = %q, %v", out, err)
+	}
+}
+
 func TestCompression_UnsupportedFormat(t *testing.T) {
 	e := newTestEngine(t)
 
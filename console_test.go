@@ -70,6 +70,45 @@ func TestConsole_ObjectStringification(t *testing.T) {
 	}
 }
 
+func TestConsole_ErrorWithCauseChain(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const root = new TypeError("socket closed");
+    const inner = new Error("query failed", { cause: root });
+    console.error("request failed:", new Error("handler crashed", { cause: inner }));
+    return new Response("ok");
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	if len(r.Logs) == 0 {
+		t.Fatal("no logs captured")
+	}
+	msg := r.Logs[0].Message
+	if r.Logs[0].Level != "error" {
+		t.Errorf("level = %q, want error", r.Logs[0].Level)
+	}
+	for _, want := range []string{
+		"request failed: Error: handler crashed",
+		"Caused by: Error: query failed",
+		"Caused by: TypeError: socket closed",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q does not contain %q", msg, want)
+		}
+	}
+	if strings.Contains(msg, "[object") {
+		t.Errorf("message %q contains an unformatted object", msg)
+	}
+	if strings.Index(msg, "query failed") > strings.Index(msg, "socket closed") {
+		t.Errorf("cause chain out of order: %q", msg)
+	}
+}
+
 func TestConsole_AllLevels(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -288,3 +327,108 @@ func TestConsoleLog_LimitConstants(t *testing.T) {
 		t.Errorf("maxLogMessageSize = %d, want 1KB-100KB", maxLogMessageSize)
 	}
 }
+
+func TestConsole_LogEntriesTaggedWithSite(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env, ctx) {
+    console.warn("disk", "almost full");
+    ctx.waitUntil(scheduler.wait(20).then(() => console.log("later")));
+    return new Response("ok");
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if len(r.Logs) != 1 {
+		t.Fatalf("logs = %v, want 1 entry", r.Logs)
+	}
+	entry := r.Logs[0]
+	siteID := "test-" + t.Name()
+	if entry.SiteID != siteID || entry.DeployKey != "deploy1" {
+		t.Errorf("entry site/deploy = %q/%q, want %q/deploy1", entry.SiteID, entry.DeployKey, siteID)
+	}
+	if entry.Message != "disk almost full" {
+		t.Errorf("message = %q, want it untouched", entry.Message)
+	}
+
+	// An entry encodes as a structured record for log aggregation.
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var rec struct {
+		Level     string `json:"level"`
+		Message   string `json:"message"`
+		Time      string `json:"time"`
+		SiteID    string `json:"siteId"`
+		DeployKey string `json:"deployKey"`
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	if rec.Level != "warn" || rec.Message != "disk almost full" || rec.Time == "" ||
+		rec.SiteID != siteID || rec.DeployKey != "deploy1" {
+		t.Errorf("record = %+v, want level, message, time, siteId and deployKey set", rec)
+	}
+
+	// Logs from waitUntil work are tagged too.
+	if r.WaitUntil == nil {
+		t.Fatal("expected pending waitUntil work")
+	}
+	wu := <-r.WaitUntil
+	if len(wu.Logs) != 1 || wu.Logs[0].Message != "later" || wu.Logs[0].SiteID != siteID {
+		t.Errorf("waitUntil logs = %+v, want one entry tagged with site", wu.Logs)
+	}
+}
+
+func TestConsole_JSONLogFormat(t *testing.T) {
+	cfg := testCfg()
+	cfg.LogFormat = LogFormatJSON
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  fetch(request, env, ctx) {
+    console.warn("disk", "almost full");
+    ctx.waitUntil(scheduler.wait(20).then(() => console.log("later")));
+    return new Response("ok");
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if r.WaitUntil == nil {
+		t.Fatal("expected pending waitUntil work")
+	}
+	wu := <-r.WaitUntil
+	logs := append(r.Logs, wu.Logs...)
+	if len(logs) != 2 {
+		t.Fatalf("logs = %v, want 2 entries", logs)
+	}
+
+	siteID := "test-" + t.Name()
+	for i, want := range []struct{ level, message string }{
+		{"warn", "disk almost full"},
+		{"log", "later"},
+	} {
+		var rec struct {
+			Level     string `json:"level"`
+			Message   string `json:"message"`
+			Time      string `json:"time"`
+			SiteID    string `json:"siteId"`
+			DeployKey string `json:"deployKey"`
+		}
+		if err := json.Unmarshal([]byte(logs[i].Message), &rec); err != nil {
+			t.Fatalf("message %q is not a JSON record: %v", logs[i].Message, err)
+		}
+		if rec.Level != want.level || rec.Message != want.message || rec.Time == "" ||
+			rec.SiteID != siteID || rec.DeployKey != "deploy1" {
+			t.Errorf("record %d = %+v, want level %q, message %q, time, siteId and deployKey set", i, rec, want.level, want.message)
+		}
+		if logs[i].Level != want.level || logs[i].SiteID != siteID {
+			t.Errorf("entry %d = %+v, want level and site kept on the entry", i, logs[i])
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package worker
 
 import (
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"testing"
 )
@@ -527,3 +531,150 @@ func TestCrypto_DeriveBitsDirectErrors(t *testing.T) {
 		t.Error("PBKDF2 deriveBits should work")
 	}
 }
+
+func TestCrypto_HKDFNullLength(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const ikm = new TextEncoder().encode("input keying material");
+    const key = await crypto.subtle.importKey("raw", ikm, { name: "HKDF" }, false, ["deriveBits"]);
+    const params = { name: "HKDF", hash: "SHA-256", salt: new Uint8Array(16), info: new Uint8Array(0) };
+    const full = new Uint8Array(await crypto.subtle.deriveBits(params, key, null));
+    const explicit = new Uint8Array(await crypto.subtle.deriveBits(params, key, 256));
+    let same = full.length === explicit.length;
+    for (let i = 0; same && i < full.length; i++) same = full[i] === explicit[i];
+    return Response.json({ length: full.length, same });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Length int  `json:"length"`
+		Same   bool `json:"same"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if data.Length != 32 {
+		t.Errorf("HKDF null-length output = %d bytes, want 32", data.Length)
+	}
+	if !data.Same {
+		t.Error("null-length output should match an explicit 256-bit derivation")
+	}
+}
+
+func TestCrypto_DeriveFromEmptyAndLargeKeyMaterial(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const toHex = (buf) => Array.from(new Uint8Array(buf), b => b.toString(16).padStart(2, '0')).join('');
+    const salt = new TextEncoder().encode("salt");
+
+    const password = await crypto.subtle.importKey("raw", new Uint8Array(0), "PBKDF2", false, ["deriveBits"]);
+    const pbkdf2 = await crypto.subtle.deriveBits(
+      { name: "PBKDF2", hash: "SHA-256", salt, iterations: 1000 }, password, 256
+    );
+
+    const ikm = new Uint8Array(1 << 20);
+    for (let i = 0; i < ikm.length; i++) ikm[i] = i & 0xff;
+    const big = await crypto.subtle.importKey("raw", ikm, "HKDF", false, ["deriveBits"]);
+    const hkdf = await crypto.subtle.deriveBits(
+      { name: "HKDF", hash: "SHA-256", salt, info: new Uint8Array(0) }, big, 256
+    );
+
+    const empty = await crypto.subtle.importKey("raw", new ArrayBuffer(0), "HKDF", false, ["deriveBits"]);
+    const hkdfEmpty = await crypto.subtle.deriveBits(
+      { name: "HKDF", hash: "SHA-256", salt, info: new Uint8Array(0) }, empty, 256
+    );
+    return Response.json({ pbkdf2: toHex(pbkdf2), hkdf: toHex(hkdf), hkdfEmpty: toHex(hkdfEmpty) });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		PBKDF2    string `json:"pbkdf2"`
+		HKDF      string `json:"hkdf"`
+		HKDFEmpty string `json:"hkdfEmpty"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	salt := []byte("salt")
+	wantPBKDF2, err := pbkdf2.Key(sha256.New, "", salt, 1000, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.PBKDF2 != hex.EncodeToString(wantPBKDF2) {
+		t.Errorf("PBKDF2 with empty password = %s, want %x", data.PBKDF2, wantPBKDF2)
+	}
+
+	ikm := make([]byte, 1<<20)
+	for i := range ikm {
+		ikm[i] = byte(i)
+	}
+	wantHKDF, err := hkdf.Key(sha256.New, ikm, salt, "", 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.HKDF != hex.EncodeToString(wantHKDF) {
+		t.Errorf("HKDF with 1MB IKM = %s, want %x", data.HKDF, wantHKDF)
+	}
+
+	wantEmpty, err := hkdf.Key(sha256.New, nil, salt, "", 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.HKDFEmpty != hex.EncodeToString(wantEmpty) {
+		t.Errorf("HKDF with empty IKM = %s, want %x", data.HKDFEmpty, wantEmpty)
+	}
+}
+
+func TestCrypto_DeriveBitsZeroLength(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const secret = new TextEncoder().encode("input keying material");
+    const hkdfKey = await crypto.subtle.importKey("raw", secret, { name: "HKDF" }, false, ["deriveBits"]);
+    const pbkdfKey = await crypto.subtle.importKey("raw", secret, { name: "PBKDF2" }, false, ["deriveBits"]);
+    const hkdf = { name: "HKDF", hash: "SHA-256", salt: new Uint8Array(16), info: new Uint8Array(0) };
+    const pbkdf2 = { name: "PBKDF2", hash: "SHA-256", salt: new Uint8Array(16), iterations: 1000 };
+    const attempt = async (fn) => {
+      try { return (await fn()).byteLength; } catch (e) { return e.name; }
+    };
+    return Response.json({
+      hkdfZero: await attempt(() => crypto.subtle.deriveBits(hkdf, hkdfKey, 0)),
+      hkdfUndefined: await attempt(() => crypto.subtle.deriveBits(hkdf, hkdfKey)),
+      pbkdf2Zero: await attempt(() => crypto.subtle.deriveBits(pbkdf2, pbkdfKey, 0)),
+      pbkdf2Null: await attempt(() => crypto.subtle.deriveBits(pbkdf2, pbkdfKey, null)),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]any{
+		"hkdfZero":      float64(0),
+		"hkdfUndefined": float64(32),
+		"pbkdf2Zero":    float64(0),
+		"pbkdf2Null":    "OperationError",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %v, want %v", k, data[k], v)
+		}
+	}
+}
@@ -264,3 +264,51 @@ func TestDigestStream_InvalidAlgorithm(t *testing.T) {
 		t.Errorf("message = %q, want it to contain 'unsupported'", data.Message)
 	}
 }
+
+func TestDigestStream_SubtleDigestReadableStream(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const chunks = [];
+    for (let i = 0; i < 8; i++) {
+      const c = new Uint8Array(10000 + i);
+      for (let j = 0; j < c.length; j++) c[j] = (i * 31 + j) & 0xff;
+      chunks.push(c);
+    }
+    const total = chunks.reduce((n, c) => n + c.length, 0);
+    const all = new Uint8Array(total);
+    let off = 0;
+    for (const c of chunks) { all.set(c, off); off += c.length; }
+
+    let i = 0;
+    const stream = new ReadableStream({
+      pull(controller) {
+        if (i < chunks.length) controller.enqueue(chunks[i++]);
+        else controller.close();
+      }
+    });
+    const hex = buf => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, '0')).join('');
+    const streamed = hex(await crypto.subtle.digest("SHA-256", stream));
+    const oneShot = hex(await crypto.subtle.digest("SHA-256", all));
+    return Response.json({ streamed, oneShot });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Streamed string `json:"streamed"`
+		OneShot  string `json:"oneShot"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(data.Streamed) != 64 {
+		t.Fatalf("streamed digest = %q, want a SHA-256 hex digest", data.Streamed)
+	}
+	if data.Streamed != data.OneShot {
+		t.Errorf("streamed digest %s != one-shot digest %s", data.Streamed, data.OneShot)
+	}
+}
@@ -1,7 +1,10 @@
 package worker
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"testing"
 )
 
@@ -103,6 +106,62 @@ func TestCrypto_Ed25519ImportExportRaw(t *testing.T) {
 	}
 }
 
+func TestCrypto_Ed25519ImportRawPrivateSeed(t *testing.T) {
+	e := newTestEngine(t)
+
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	pub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const b64 = (s) => Uint8Array.from(atob(s), c => c.charCodeAt(0));
+    const seed = b64(%q);
+    const priv = await crypto.subtle.importKey("raw", seed, { name: "Ed25519" }, true, ["sign"]);
+    const pub = await crypto.subtle.importKey("raw", b64(%q), { name: "Ed25519" }, true, ["verify"]);
+    const msg = new TextEncoder().encode("raw seed round trip");
+    const sig = await crypto.subtle.sign("Ed25519", priv, msg);
+    const exported = new Uint8Array(await crypto.subtle.exportKey("raw", priv));
+    return Response.json({
+      privType: priv.type,
+      pubType: pub.type,
+      valid: await crypto.subtle.verify("Ed25519", pub, sig, msg),
+      sig: btoa(String.fromCharCode(...new Uint8Array(sig))),
+      seedRoundTrip: exported.length === seed.length && exported.every((b, i) => b === seed[i]),
+    });
+  },
+};`, base64.StdEncoding.EncodeToString(seed), base64.StdEncoding.EncodeToString(pub))
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		PrivType      string `json:"privType"`
+		PubType       string `json:"pubType"`
+		Valid         bool   `json:"valid"`
+		Sig           string `json:"sig"`
+		SeedRoundTrip bool   `json:"seedRoundTrip"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.PrivType != "private" || data.PubType != "public" {
+		t.Errorf("key types = %q/%q, want private/public", data.PrivType, data.PubType)
+	}
+	if !data.Valid {
+		t.Error("signature from the imported seed should verify with its public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(data.Sig)
+	if err != nil || !ed25519.Verify(pub, []byte("raw seed round trip"), sig) {
+		t.Error("signature should verify with Go's ed25519 for the same seed")
+	}
+	if !data.SeedRoundTrip {
+		t.Error("raw export of the private key should return the imported seed")
+	}
+}
+
 func TestCrypto_Ed25519ImportExportJWK(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -870,3 +870,60 @@ func TestCryptoEdge_ECDHJWKRoundTrip(t *testing.T) {
 		t.Errorf("ECDH deriveBits(128) length = %d, want 16", data.DerivedLen)
 	}
 }
+
+// TestCryptoEdge_NonExtractableExportRejected verifies that exportKey throws
+// InvalidAccessError for a non-extractable key of every algorithm and format,
+// and that the extractable flag cannot be flipped afterwards.
+func TestCryptoEdge_NonExtractableExportRejected(t *testing.T) {
+	e := newTestEngine(t)
+	source := `export default {
+  async fetch(request, env) {
+    const subtle = crypto.subtle;
+    const keys = {
+      hmac: await subtle.importKey("raw", new Uint8Array(32), { name: "HMAC", hash: "SHA-256" }, false, ["sign"]),
+      aes: await subtle.generateKey({ name: "AES-GCM", length: 256 }, false, ["encrypt", "decrypt"]),
+      rsa: (await subtle.generateKey(
+        { name: "RSASSA-PKCS1-v1_5", hash: "SHA-256", modulusLength: 2048, publicExponent: new Uint8Array([1, 0, 1]) },
+        false, ["sign", "verify"])).privateKey,
+      ec: (await subtle.generateKey({ name: "ECDSA", namedCurve: "P-256" }, false, ["sign", "verify"])).privateKey,
+    };
+    const formats = {
+      hmac: ["raw", "jwk"],
+      aes: ["raw", "jwk"],
+      rsa: ["pkcs8", "jwk"],
+      ec: ["pkcs8", "jwk"],
+    };
+    const results = {};
+    for (const [name, key] of Object.entries(keys)) {
+      for (const format of formats[name]) {
+        try {
+          await subtle.exportKey(format, key);
+          results[name + ":" + format] = "exported";
+        } catch (e) {
+          results[name + ":" + format] = e.name;
+        }
+      }
+    }
+    try { keys.hmac.extractable = true; } catch (e) {}
+    try {
+      await subtle.exportKey("raw", keys.hmac);
+      results["hmac:flipped"] = "exported";
+    } catch (e) {
+      results["hmac:flipped"] = e.name;
+    }
+    return Response.json(results);
+  },
+};`
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, k := range []string{"hmac:raw", "hmac:jwk", "aes:raw", "aes:jwk", "rsa:pkcs8", "rsa:jwk", "ec:pkcs8", "ec:jwk", "hmac:flipped"} {
+		if data[k] != "InvalidAccessError" {
+			t.Errorf("%s: got %q, want InvalidAccessError", k, data[k])
+		}
+	}
+}
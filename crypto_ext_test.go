@@ -1,7 +1,15 @@
 package worker
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"math/rand/v2"
+	"strings"
 	"testing"
 )
 
@@ -62,10 +70,172 @@ func TestCryptoExt_JWK_HMAC_ImportExport(t *testing.T) {
 	}
 }
 
+func TestCryptoExt_JWK_HMAC_AlgSetsHash(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const jwk = { kty: "oct", k: "bXktc2VjcmV0LWtleQ", alg: "HS512" };
+    let conflict = "";
+    try {
+      await crypto.subtle.importKey("jwk", jwk, { name: "HMAC", hash: "SHA-256" }, true, ["sign"]);
+    } catch (e) {
+      conflict = e.message;
+    }
+
+    // With no hash in the import algorithm, the JWK alg supplies it.
+    const key = await crypto.subtle.importKey("jwk", jwk, { name: "HMAC" }, true, ["sign"]);
+    const sig = await crypto.subtle.sign("HMAC", key, new TextEncoder().encode("test"));
+    const exported = await crypto.subtle.exportKey("jwk", key);
+
+    const matching = await crypto.subtle.importKey("jwk", jwk, { name: "HMAC", hash: "SHA-512" }, true, ["sign"]);
+    return Response.json({
+      conflict,
+      hash: key.algorithm.hash && key.algorithm.hash.name,
+      sigLen: sig.byteLength,
+      exportedAlg: exported.alg,
+      matchingHash: matching.algorithm.hash,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Conflict     string `json:"conflict"`
+		Hash         string `json:"hash"`
+		SigLen       int    `json:"sigLen"`
+		ExportedAlg  string `json:"exportedAlg"`
+		MatchingHash string `json:"matchingHash"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !strings.Contains(data.Conflict, "HS512") {
+		t.Errorf("importing an HS512 JWK as SHA-256 should throw, got %q", data.Conflict)
+	}
+	if data.Hash != "SHA-512" || data.SigLen != 64 || data.ExportedAlg != "HS512" {
+		t.Errorf("hash = %q, sigLen = %d, exported alg = %q; want SHA-512, 64, HS512", data.Hash, data.SigLen, data.ExportedAlg)
+	}
+	if data.MatchingHash != "SHA-512" {
+		t.Errorf("matching import hash = %q, want SHA-512", data.MatchingHash)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Security Fixes - H7, M6, M11
 // ---------------------------------------------------------------------------
 
+func TestCryptoExt_JWK_AESImportValidation(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const k16 = "AAECAwQFBgcICQoLDA0ODw"; // 16 bytes
+    const tryImport = async (jwk, name) => {
+      try {
+        await crypto.subtle.importKey("jwk", jwk, { name }, true, ["encrypt", "decrypt"]);
+        return "ok";
+      } catch (e) {
+        return e.message;
+      }
+    };
+    return Response.json({
+      matching: await tryImport({ kty: "oct", k: k16, alg: "A128GCM" }, "AES-GCM"),
+      noAlg: await tryImport({ kty: "oct", k: k16 }, "AES-GCM"),
+      wrongSize: await tryImport({ kty: "oct", k: k16, alg: "A256GCM" }, "AES-GCM"),
+      wrongMode: await tryImport({ kty: "oct", k: k16, alg: "A128CBC" }, "AES-GCM"),
+      badLength: await tryImport({ kty: "oct", k: "AAECAwQFBgc" }, "AES-GCM"),
+      badUse: await tryImport({ kty: "oct", k: k16, use: "sig" }, "AES-CBC"),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, k := range []string{"matching", "noAlg"} {
+		if data[k] != "ok" {
+			t.Errorf("%s: import failed: %s", k, data[k])
+		}
+	}
+	for _, k := range []string{"wrongSize", "wrongMode", "badLength", "badUse"} {
+		if data[k] == "ok" {
+			t.Errorf("%s: import should have thrown", k)
+		}
+	}
+	if !strings.Contains(data["wrongSize"], "A256GCM") {
+		t.Errorf("wrongSize error = %q, want it to name the alg", data["wrongSize"])
+	}
+}
+
+func TestCryptoExt_JWK_AESKWAndCTRRoundTrip(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const hex = (buf) => Array.from(new Uint8Array(buf), b => b.toString(16).padStart(2, "0")).join("");
+
+    // AES-KW: export the KEK as JWK, reimport it and unwrap with the copy.
+    const kek = await crypto.subtle.generateKey({ name: "AES-KW", length: 256 }, true, ["wrapKey", "unwrapKey"]);
+    const kwJWK = await crypto.subtle.exportKey("jwk", kek);
+    const kek2 = await crypto.subtle.importKey("jwk", kwJWK, { name: "AES-KW" }, true, ["wrapKey", "unwrapKey"]);
+    const secret = await crypto.subtle.importKey("raw", new Uint8Array(16).fill(7), { name: "AES-GCM" }, true, ["encrypt"]);
+    const wrapped = await crypto.subtle.wrapKey("raw", secret, kek, { name: "AES-KW" });
+    const unwrapped = await crypto.subtle.unwrapKey("raw", wrapped, kek2, { name: "AES-KW" }, { name: "AES-GCM" }, true, ["encrypt"]);
+    const kw128 = await crypto.subtle.generateKey({ name: "AES-KW", length: 128 }, true, ["wrapKey"]);
+
+    // AES-CTR: a reimported JWK key decrypts what the original encrypted.
+    const ctrKey = await crypto.subtle.generateKey({ name: "AES-CTR", length: 256 }, true, ["encrypt", "decrypt"]);
+    const ctrJWK = await crypto.subtle.exportKey("jwk", ctrKey);
+    const ctrKey2 = await crypto.subtle.importKey("jwk", ctrJWK, { name: "AES-CTR" }, true, ["encrypt", "decrypt"]);
+    const counter = new Uint8Array(16);
+    const ct = await crypto.subtle.encrypt({ name: "AES-CTR", counter, length: 64 }, ctrKey, new TextEncoder().encode("counter mode"));
+    const pt = await crypto.subtle.decrypt({ name: "AES-CTR", counter, length: 64 }, ctrKey2, ct);
+    const ctr128 = await crypto.subtle.generateKey({ name: "AES-CTR", length: 128 }, true, ["encrypt"]);
+
+    return Response.json({
+      kwAlg: kwJWK.alg,
+      kwKty: kwJWK.kty,
+      kw128Alg: (await crypto.subtle.exportKey("jwk", kw128)).alg,
+      unwrapped: hex(await crypto.subtle.exportKey("raw", unwrapped)),
+      ctrAlg: ctrJWK.alg,
+      ctr128Alg: (await crypto.subtle.exportKey("jwk", ctr128)).alg,
+      plaintext: new TextDecoder().decode(pt),
+      sameKey: hex(await crypto.subtle.exportKey("raw", ctrKey)) === hex(await crypto.subtle.exportKey("raw", ctrKey2)),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]any{
+		"kwAlg":     "A256KW",
+		"kwKty":     "oct",
+		"kw128Alg":  "A128KW",
+		"unwrapped": strings.Repeat("07", 16),
+		"ctrAlg":    "A256CTR",
+		"ctr128Alg": "A128CTR",
+		"plaintext": "counter mode",
+		"sameKey":   true,
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %v, want %v", k, data[k], v)
+		}
+	}
+}
+
 func TestAESCBC_PaddingValidation(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -117,6 +287,210 @@ func TestAESCBC_PaddingValidation(t *testing.T) {
 	}
 }
 
+func TestAESCBC_IVLengthAndWrongKey(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const subtle = crypto.subtle;
+    const importKey = (fill) => subtle.importKey("raw", new Uint8Array(32).fill(fill), "AES-CBC", false, ["encrypt", "decrypt"]);
+    const key = await importKey(1);
+    const wrongKey = await importKey(2);
+    const iv = new Uint8Array(16).fill(3);
+    const pt = new TextEncoder().encode("attack at dawn, bring snacks");
+    const ct = await subtle.encrypt({ name: "AES-CBC", iv }, key, pt);
+    const outcome = (p) => p.then(() => "ok", (e) => e.name);
+    return Response.json({
+      shortIVEncrypt: await outcome(subtle.encrypt({ name: "AES-CBC", iv: new Uint8Array(8) }, key, pt)),
+      shortIVDecrypt: await outcome(subtle.decrypt({ name: "AES-CBC", iv: new Uint8Array(8) }, key, ct)),
+      missingIV: await outcome(subtle.encrypt("AES-CBC", key, pt)),
+      wrongKey: await outcome(subtle.decrypt({ name: "AES-CBC", iv }, wrongKey, ct)),
+      partialBlock: await outcome(subtle.decrypt({ name: "AES-CBC", iv }, key, new Uint8Array(ct).slice(0, 20))),
+      empty: await outcome(subtle.decrypt({ name: "AES-CBC", iv }, key, new Uint8Array(0))),
+      roundTrip: new TextDecoder().decode(await subtle.decrypt({ name: "AES-CBC", iv }, key, ct)),
+    });
+  },
+};`
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, k := range []string{"shortIVEncrypt", "shortIVDecrypt", "missingIV", "wrongKey", "partialBlock", "empty"} {
+		if data[k] != "OperationError" {
+			t.Errorf("%s = %q, want OperationError", k, data[k])
+		}
+	}
+	if data["roundTrip"] != "attack at dawn, bring snacks" {
+		t.Errorf("roundTrip = %q", data["roundTrip"])
+	}
+}
+
+// aesGCMLargeSource encrypts an 8MB payload with a fixed key and IV, large
+// enough to take the binary bridge rather than base64.
+const aesGCMLargeSource = `export default {
+  async fetch(request, env) {
+    const keyBytes = new Uint8Array(32);
+    for (let i = 0; i < 32; i++) keyBytes[i] = i;
+    const key = await crypto.subtle.importKey("raw", keyBytes, "AES-GCM", true, ["encrypt", "decrypt"]);
+    const iv = new Uint8Array(12).fill(7);
+    const aad = new TextEncoder().encode("large payload");
+
+    const chunk = new Uint8Array(65536);
+    for (let i = 0; i < chunk.length; i++) chunk[i] = i & 0xff;
+    const pt = new Uint8Array(8 * 1024 * 1024);
+    for (let off = 0; off < pt.length; off += chunk.length) pt.set(chunk, off);
+
+    const ct = await crypto.subtle.encrypt({ name: "AES-GCM", iv, additionalData: aad }, key, pt);
+    if (new URL(request.url).pathname === "/bench") return new Response(String(ct.byteLength));
+
+    const b64 = globalThis.__bufferSourceToB64;
+    const ptB64 = b64(pt);
+    const decrypted = await crypto.subtle.decrypt({ name: "AES-GCM", iv, additionalData: aad }, key, ct);
+    const headers = { "x-round-trip": String(b64(decrypted) === ptB64) };
+
+    // The base64 path must produce byte-identical ciphertext.
+    const oneShot = __cryptoEncrypt("AES-GCM", key._id, ptB64, b64(iv), b64(aad));
+    headers["x-matches-one-shot"] = String(oneShot === b64(ct));
+
+    const tampered = new Uint8Array(ct).slice();
+    tampered[tampered.length - 1] ^= 1;
+    try {
+      await crypto.subtle.decrypt({ name: "AES-GCM", iv, additionalData: aad }, key, tampered);
+      headers["x-tamper-rejected"] = "false";
+    } catch (e) {
+      headers["x-tamper-rejected"] = "true";
+    }
+    return new Response(ct, { headers });
+  },
+};`
+
+func TestAESGCM_LargePayloadRoundTrip(t *testing.T) {
+	e := newTestEngine(t)
+	r := execJS(t, e, aesGCMLargeSource, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	iv := []byte{7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7}
+	pt := make([]byte, 8*1024*1024)
+	for i := range pt {
+		pt[i] = byte(i)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gcm.Seal(nil, iv, pt, []byte("large payload"))
+
+	if !bytes.Equal(r.Response.Body, want) {
+		t.Errorf("ciphertext (%d bytes) does not match Go's AES-GCM output (%d bytes)", len(r.Response.Body), len(want))
+	}
+	for _, h := range []string{"x-round-trip", "x-matches-one-shot", "x-tamper-rejected"} {
+		if got := r.Response.Headers[h]; got != "true" {
+			t.Errorf("%s = %q, want true", h, got)
+		}
+	}
+}
+
+func BenchmarkAESGCM_Encrypt8MB(b *testing.B) {
+	e := NewEngine(testCfg(), nilSourceLoader{})
+	defer e.Shutdown()
+	if _, err := e.CompileAndCache("bench-aesgcm", "deploy1", aesGCMLargeSource); err != nil {
+		b.Fatalf("CompileAndCache: %v", err)
+	}
+	b.SetBytes(8 * 1024 * 1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := e.Execute("bench-aesgcm", "deploy1", defaultEnv(), getReq("http://localhost/bench"))
+		if r.Error != nil {
+			b.Fatalf("Execute: %v", r.Error)
+		}
+	}
+}
+
+func TestAESGCM_DetachedTag(t *testing.T) {
+	e := newTestEngine(t)
+	source := `export default {
+  async fetch(request, env) {
+    const key = await crypto.subtle.generateKey(
+      { name: "AES-GCM", length: 256 }, true, ["encrypt", "decrypt"]
+    );
+    const iv = new Uint8Array(12).fill(3);
+    const aad = new TextEncoder().encode("header");
+    const pt = new TextEncoder().encode("detached tag payload");
+    const hex = (buf) => [...new Uint8Array(buf)].map(b => b.toString(16).padStart(2, "0")).join("");
+
+    const joined = await crypto.subtle.encrypt({ name: "AES-GCM", iv, additionalData: aad }, key, pt);
+    const parts = await crypto.subtle.encrypt({ name: "AES-GCM", iv, additionalData: aad, detachedTag: true }, key, pt);
+    const split = joined.byteLength - 16;
+
+    const decrypted = await crypto.subtle.decrypt(
+      { name: "AES-GCM", iv, additionalData: aad, tag: parts.tag }, key, parts.ciphertext
+    );
+
+    const badTag = new Uint8Array(parts.tag).slice();
+    badTag[0] ^= 1;
+    let tamperRejected = false;
+    try {
+      await crypto.subtle.decrypt({ name: "AES-GCM", iv, additionalData: aad, tag: badTag }, key, parts.ciphertext);
+    } catch (e) {
+      tamperRejected = true;
+    }
+    let shortTagRejected = false;
+    try {
+      await crypto.subtle.decrypt({ name: "AES-GCM", iv, additionalData: aad, tag: new Uint8Array(8) }, key, parts.ciphertext);
+    } catch (e) {
+      shortTagRejected = e.name === "OperationError";
+    }
+
+    return Response.json({
+      ctMatches: hex(parts.ciphertext) === hex(joined.slice(0, split)),
+      tagMatches: hex(parts.tag) === hex(joined.slice(split)),
+      tagLen: parts.tag.byteLength,
+      roundTrip: new TextDecoder().decode(decrypted),
+      tamperRejected,
+      shortTagRejected,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		CtMatches        bool   `json:"ctMatches"`
+		TagMatches       bool   `json:"tagMatches"`
+		TagLen           int    `json:"tagLen"`
+		RoundTrip        string `json:"roundTrip"`
+		TamperRejected   bool   `json:"tamperRejected"`
+		ShortTagRejected bool   `json:"shortTagRejected"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !data.CtMatches || !data.TagMatches || data.TagLen != 16 {
+		t.Errorf("detached output does not split the appended-tag ciphertext: %+v", data)
+	}
+	if data.RoundTrip != "detached tag payload" {
+		t.Errorf("roundTrip = %q", data.RoundTrip)
+	}
+	if !data.TamperRejected {
+		t.Error("decrypt with a modified detached tag should fail")
+	}
+	if !data.ShortTagRejected {
+		t.Error("decrypt with a short detached tag should fail with OperationError")
+	}
+}
+
 func TestAESGCM_WithAAD(t *testing.T) {
 	e := newTestEngine(t)
 	source := `export default {
@@ -213,3 +587,282 @@ func TestAES_GenerateKey_128bit(t *testing.T) {
 		t.Errorf("256-bit key raw length = %d, want 32", data.Len256)
 	}
 }
+
+func TestCryptoExt_SeededEntropyIsReproducible(t *testing.T) {
+	source := `export default {
+  async fetch(request, env) {
+    const hex = (buf) => Array.from(new Uint8Array(buf), b => b.toString(16).padStart(2, "0")).join("");
+    const key = await crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, true, ["encrypt"]);
+    const kw = await crypto.subtle.generateKey({ name: "AES-KW", length: 128 }, true, ["wrapKey"]);
+    const ed = await crypto.subtle.generateKey({ name: "Ed25519" }, true, ["sign", "verify"]);
+    const x = await crypto.subtle.generateKey({ name: "X25519" }, true, ["deriveBits"]);
+    return Response.json({
+      key: hex(await crypto.subtle.exportKey("raw", key)),
+      kw: hex(await crypto.subtle.exportKey("raw", kw)),
+      ed25519: hex(await crypto.subtle.exportKey("raw", ed.publicKey)),
+      x25519: hex(await crypto.subtle.exportKey("raw", x.publicKey)),
+      iv: hex(crypto.getRandomValues(new Uint8Array(12))),
+      uuid: crypto.randomUUID(),
+      random: String(Math.random()),
+    });
+  },
+};`
+
+	run := func(seed byte) map[string]string {
+		t.Helper()
+		cfg := testCfg()
+		cfg.PoolSize = 1
+		cfg.CryptoRand = rand.NewChaCha8([32]byte{seed})
+		e := NewEngine(cfg, nilSourceLoader{})
+		defer e.Shutdown()
+
+		r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+		var data map[string]string
+		if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return data
+	}
+
+	first, second, other := run(1), run(1), run(2)
+	for _, k := range []string{"key", "kw", "ed25519", "x25519", "iv", "uuid", "random"} {
+		if first[k] == "" || first[k] != second[k] {
+			t.Errorf("%s differs under the same seed: %q vs %q", k, first[k], second[k])
+		}
+		if first[k] == other[k] {
+			t.Errorf("%s is the same under different seeds: %q", k, first[k])
+		}
+	}
+	if len(first["key"]) != 64 {
+		t.Errorf("key = %q, want 32 bytes", first["key"])
+	}
+}
+
+func TestCryptoExt_HMAC_ImportWithLength(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const keyData = new Uint8Array(32);
+    for (let i = 0; i < keyData.length; i++) keyData[i] = i + 1;
+    const key = await crypto.subtle.importKey(
+      "raw", keyData, { name: "HMAC", hash: "SHA-256", length: 128 }, true, ["sign"]
+    );
+    const sig = new Uint8Array(await crypto.subtle.sign("HMAC", key, new TextEncoder().encode("payload")));
+    const exported = new Uint8Array(await crypto.subtle.exportKey("raw", key));
+    const hex = Array.from(sig).map(b => b.toString(16).padStart(2, "0")).join("");
+
+    let tooLong = null;
+    try {
+      await crypto.subtle.importKey("raw", keyData, { name: "HMAC", hash: "SHA-256", length: 512 }, false, ["sign"]);
+    } catch (e) {
+      tooLong = e.name;
+    }
+    return Response.json({ hex, exportedLength: exported.length, tooLong });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Hex            string `json:"hex"`
+		ExportedLength int    `json:"exportedLength"`
+		TooLong        string `json:"tooLong"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	key := make([]byte, 16)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("payload"))
+	if want := hex.EncodeToString(mac.Sum(nil)); data.Hex != want {
+		t.Errorf("signature = %s, want %s", data.Hex, want)
+	}
+	if data.ExportedLength != 16 {
+		t.Errorf("exported key length = %d, want 16", data.ExportedLength)
+	}
+	if data.TooLong != "DataError" {
+		t.Errorf("length beyond key data: error = %q, want DataError", data.TooLong)
+	}
+}
+
+func TestCryptoExt_GenerateKeyNonExtractable(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const subtle = crypto.subtle;
+    const data = new TextEncoder().encode("payload");
+    const refuses = async (key, formats) => {
+      for (const f of formats) {
+        try { await subtle.exportKey(f, key); return "exported as " + f; }
+        catch (e) { if (e.name !== "InvalidAccessError") return f + ": " + e.name; }
+      }
+      return "refused";
+    };
+    const roundTrip = async (algo, key) => {
+      const ct = await subtle.encrypt(algo, key, data);
+      return new TextDecoder().decode(await subtle.decrypt(algo, key, ct)) === "payload";
+    };
+    const signVerify = async (algo, priv, pub) =>
+      subtle.verify(algo, pub, await subtle.sign(algo, priv, data), data);
+    const out = {};
+
+    const hmac = await subtle.generateKey({ name: "HMAC", hash: "SHA-256" }, false, ["sign", "verify"]);
+    out.HMAC = { works: await signVerify("HMAC", hmac, hmac), export: await refuses(hmac, ["raw", "jwk"]) };
+
+    // Falsy non-boolean flags are coerced rather than reaching the Go side as-is.
+    for (const flag of [undefined, 0, null]) {
+      const k = await subtle.generateKey({ name: "HMAC", hash: "SHA-256" }, flag, ["sign", "verify"]);
+      out["HMAC/" + flag] = { works: await signVerify("HMAC", k, k), export: await refuses(k, ["raw"]) };
+    }
+
+    const iv = crypto.getRandomValues(new Uint8Array(16));
+    for (const [name, algo] of [
+      ["AES-GCM", { name: "AES-GCM", iv: iv.slice(0, 12) }],
+      ["AES-CBC", { name: "AES-CBC", iv }],
+      ["AES-CTR", { name: "AES-CTR", counter: iv, length: 64 }],
+    ]) {
+      const key = await subtle.generateKey({ name, length: 256 }, false, ["encrypt", "decrypt"]);
+      out[name] = { works: await roundTrip(algo, key), export: await refuses(key, ["raw", "jwk"]) };
+    }
+
+    const kw = await subtle.generateKey({ name: "AES-KW", length: 256 }, false, ["wrapKey", "unwrapKey"]);
+    const inner = await subtle.generateKey({ name: "AES-GCM", length: 128 }, true, ["encrypt"]);
+    const wrapped = await subtle.wrapKey("raw", inner, kw, "AES-KW");
+    const unwrapped = await subtle.unwrapKey("raw", wrapped, kw, "AES-KW", "AES-GCM", true, ["encrypt"]);
+    out["AES-KW"] = { works: unwrapped.algorithm.name === "AES-GCM", export: await refuses(kw, ["raw", "jwk"]) };
+
+    const ec = await subtle.generateKey({ name: "ECDSA", namedCurve: "P-256" }, false, ["sign", "verify"]);
+    out.ECDSA = {
+      works: await signVerify({ name: "ECDSA", hash: "SHA-256" }, ec.privateKey, ec.publicKey),
+      export: await refuses(ec.privateKey, ["jwk", "pkcs8"]),
+    };
+
+    const rsa = await subtle.generateKey({ name: "RSASSA-PKCS1-v1_5", modulusLength: 2048,
+      publicExponent: new Uint8Array([1, 0, 1]), hash: "SHA-256" }, false, ["sign", "verify"]);
+    out.RSA = {
+      works: await signVerify("RSASSA-PKCS1-v1_5", rsa.privateKey, rsa.publicKey),
+      export: await refuses(rsa.privateKey, ["pkcs8", "jwk"]),
+    };
+
+    const ed = await subtle.generateKey({ name: "Ed25519" }, false, ["sign", "verify"]);
+    out.Ed25519 = {
+      works: await signVerify("Ed25519", ed.privateKey, ed.publicKey),
+      export: await refuses(ed.privateKey, ["pkcs8", "jwk"]),
+    };
+
+    const a = await subtle.generateKey({ name: "ECDH", namedCurve: "P-256" }, false, ["deriveBits"]);
+    const b = await subtle.generateKey({ name: "ECDH", namedCurve: "P-256" }, true, ["deriveBits"]);
+    const ab = await subtle.deriveBits({ name: "ECDH", public: b.publicKey }, a.privateKey, 256);
+    const ba = await subtle.deriveBits({ name: "ECDH", public: a.publicKey }, b.privateKey, 256);
+    out.ECDH = {
+      works: new Uint8Array(ab).join() === new Uint8Array(ba).join(),
+      export: await refuses(a.privateKey, ["pkcs8", "jwk"]),
+    };
+
+    const x = await subtle.generateKey({ name: "X25519" }, false, ["deriveBits"]);
+    const y = await subtle.generateKey({ name: "X25519" }, true, ["deriveBits"]);
+    const xy = await subtle.deriveBits({ name: "X25519", public: y.publicKey }, x.privateKey, 256);
+    const yx = await subtle.deriveBits({ name: "X25519", public: x.publicKey }, y.privateKey, 256);
+    out.X25519 = {
+      works: new Uint8Array(xy).join() === new Uint8Array(yx).join(),
+      export: await refuses(x.privateKey, ["pkcs8", "raw"]),
+    };
+
+    return Response.json(out);
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]struct {
+		Works  bool   `json:"works"`
+		Export string `json:"export"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, algo := range []string{"HMAC", "HMAC/undefined", "HMAC/0", "HMAC/null", "AES-GCM", "AES-CBC", "AES-CTR", "AES-KW", "ECDSA", "RSA", "Ed25519", "ECDH", "X25519"} {
+		res, ok := data[algo]
+		if !ok {
+			t.Errorf("%s: no result", algo)
+			continue
+		}
+		if !res.Works {
+			t.Errorf("%s: non-extractable generated key failed its usage", algo)
+		}
+		if res.Export != "refused" {
+			t.Errorf("%s: export = %q, want InvalidAccessError for every format", algo, res.Export)
+		}
+	}
+}
+
+func TestCryptoExt_UnwrapKeyNonExtractable(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const subtle = crypto.subtle;
+    const data = new TextEncoder().encode("payload");
+    const hmac = { name: "HMAC", hash: "SHA-256" };
+    const original = await subtle.importKey("raw", new Uint8Array(32).fill(7), hmac, true, ["sign"]);
+    const want = new Uint8Array(await subtle.sign("HMAC", original, data)).join();
+
+    const check = async (key) => {
+      let exportErr = "none", rawErr = "none";
+      try { await subtle.exportKey("raw", key); } catch (e) { exportErr = e.name; }
+      try { __cryptoExportKey(key._id); } catch (e) { rawErr = "threw"; }
+      const sig = new Uint8Array(await subtle.sign("HMAC", key, data)).join();
+      return { extractable: key.extractable, exportErr, rawErr, signs: sig === want };
+    };
+
+    const kw = await subtle.generateKey({ name: "AES-KW", length: 256 }, false, ["wrapKey", "unwrapKey"]);
+    const kwWrapped = await subtle.wrapKey("raw", original, kw, "AES-KW");
+    const viaKW = await subtle.unwrapKey("raw", kwWrapped, kw, "AES-KW", hmac, false, ["sign"]);
+
+    const gcm = await subtle.generateKey({ name: "AES-GCM", length: 256 }, false,
+      ["encrypt", "decrypt", "wrapKey", "unwrapKey"]);
+    const iv = new Uint8Array(12);
+    const gcmWrapped = await subtle.wrapKey("jwk", original, gcm, { name: "AES-GCM", iv });
+    const viaGCM = await subtle.unwrapKey("jwk", gcmWrapped, gcm, { name: "AES-GCM", iv }, hmac, false, ["sign"]);
+
+    return Response.json({ kw: await check(viaKW), gcm: await check(viaGCM) });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]struct {
+		Extractable bool   `json:"extractable"`
+		ExportErr   string `json:"exportErr"`
+		RawErr      string `json:"rawErr"`
+		Signs       bool   `json:"signs"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, via := range []string{"kw", "gcm"} {
+		res := data[via]
+		if res.Extractable {
+			t.Errorf("%s: unwrapped key is extractable", via)
+		}
+		if res.ExportErr != "InvalidAccessError" {
+			t.Errorf("%s: exportKey error = %q, want InvalidAccessError", via, res.ExportErr)
+		}
+		if res.RawErr != "threw" {
+			t.Errorf("%s: key material was exportable behind the JS check", via)
+		}
+		if !res.Signs {
+			t.Errorf("%s: unwrapped key did not sign like the original", via)
+		}
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/cryguy/worker/v2/internal/webapi"
 )
 
 func TestCrypto_RSAOAEP_EncryptDecrypt(t *testing.T) {
@@ -940,3 +943,80 @@ func TestRSA_RejectsCustomPublicExponent(t *testing.T) {
 		t.Error("custom publicExponent (3) should be rejected")
 	}
 }
+
+// rsaGenerateSource generates n RSA key pairs and returns their SPKI
+// exports, so callers can check every pair is distinct.
+const rsaGenerateSource = `export default {
+  async fetch(request, env) {
+    const n = Number(new URL(request.url).searchParams.get("n") || "1");
+    const spkis = [];
+    for (let i = 0; i < n; i++) {
+      const pair = await crypto.subtle.generateKey(
+        { name: "RSASSA-PKCS1-v1_5", modulusLength: 2048, publicExponent: new Uint8Array([1, 0, 1]), hash: "SHA-256" },
+        true, ["sign", "verify"]
+      );
+      const data = new TextEncoder().encode("payload");
+      const sig = await crypto.subtle.sign("RSASSA-PKCS1-v1_5", pair.privateKey, data);
+      if (!await crypto.subtle.verify("RSASSA-PKCS1-v1_5", pair.publicKey, sig, data)) {
+        throw new Error("pooled key failed to verify its own signature");
+      }
+      const spki = new Uint8Array(await crypto.subtle.exportKey("spki", pair.publicKey));
+      spkis.push(btoa(String.fromCharCode(...spki)));
+    }
+    return Response.json(spkis);
+  },
+};`
+
+func TestCrypto_RSA_GenerateKeyFromPool(t *testing.T) {
+	cfg := testCfg()
+	cfg.RSAKeyPoolSize = 2
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	// Drawing more keys than the pool holds falls back to on-demand
+	// generation; every key must still be unique.
+	r := execJS(t, e, rsaGenerateSource, defaultEnv(), getReq("http://localhost/?n=4"))
+	assertOK(t, r)
+
+	var spkis []string
+	if err := json.Unmarshal(r.Response.Body, &spkis); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(spkis) != 4 {
+		t.Fatalf("got %d keys, want 4", len(spkis))
+	}
+	seen := make(map[string]bool)
+	for i, k := range spkis {
+		if seen[k] {
+			t.Errorf("key %d was handed out twice", i)
+		}
+		seen[k] = true
+	}
+}
+
+// BenchmarkRSAKeyPool_Get2048 compares on-demand 2048-bit generation with
+// drawing from a pool that was filled before timing started. Once the pool
+// drains, the pooled case measures Get racing the background warmer.
+func BenchmarkRSAKeyPool_Get2048(b *testing.B) {
+	b.Run("OnDemand", func(b *testing.B) {
+		var p *webapi.RSAKeyPool
+		for i := 0; i < b.N; i++ {
+			if _, err := p.Get(2048); err != nil {
+				b.Fatalf("Get: %v", err)
+			}
+		}
+	})
+	b.Run("Pooled", func(b *testing.B) {
+		p := webapi.NewRSAKeyPool(16, 2048)
+		defer p.Close()
+		for p.Len() < 16 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := p.Get(2048); err != nil {
+				b.Fatalf("Get: %v", err)
+			}
+		}
+	})
+}
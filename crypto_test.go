@@ -1,7 +1,14 @@
 package worker
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -40,6 +47,58 @@ func TestCrypto_GetRandomValues(t *testing.T) {
 	}
 }
 
+func TestCrypto_GetRandomValuesQuota(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const attempt = (arr) => {
+      try {
+        crypto.getRandomValues(arr);
+        return "ok";
+      } catch (e) {
+        return e.name + (e instanceof DOMException ? ":dom:" + e.code : "");
+      }
+    };
+    const wide = new Uint32Array(16384);
+    crypto.getRandomValues(wide);
+    return Response.json({
+      over: attempt(new Uint8Array(70000)),
+      wideOver: attempt(new Uint32Array(16385)),
+      atLimit: attempt(new Uint8Array(65536)),
+      empty: attempt(new Uint8Array(0)),
+      wideHighBytes: wide.some((v) => v > 0xff),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Over          string `json:"over"`
+		WideOver      string `json:"wideOver"`
+		AtLimit       string `json:"atLimit"`
+		Empty         string `json:"empty"`
+		WideHighBytes bool   `json:"wideHighBytes"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Over != "QuotaExceededError:dom:22" {
+		t.Errorf("70000 bytes: got %q, want QuotaExceededError DOMException", data.Over)
+	}
+	if data.WideOver != "QuotaExceededError:dom:22" {
+		t.Errorf("Uint32Array(16385): got %q, want QuotaExceededError DOMException", data.WideOver)
+	}
+	if data.AtLimit != "ok" || data.Empty != "ok" {
+		t.Errorf("atLimit = %q, empty = %q, want ok", data.AtLimit, data.Empty)
+	}
+	if !data.WideHighBytes {
+		t.Error("Uint32Array elements should be filled across all four bytes")
+	}
+}
+
 func TestCrypto_RandomUUID(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -271,6 +330,97 @@ func TestCrypto_DigestDataWithNullBytes(t *testing.T) {
 	}
 }
 
+func TestCrypto_DigestBatchMatchesDigest(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const enc = new TextEncoder();
+    const inputs = [];
+    for (let i = 0; i < 1000; i++) inputs.push(enc.encode("leaf-" + i));
+    inputs.push(new Uint8Array(0));
+    const toHex = (buf) => [...new Uint8Array(buf)].map(b => b.toString(16).padStart(2, '0')).join('');
+    const out = {};
+    for (const algo of ["SHA-1", "SHA-256", "SHA-384", "SHA-512"]) {
+      const batch = await crypto.digestBatch(algo, inputs);
+      let mismatches = 0;
+      for (let i = 0; i < inputs.length; i++) {
+        const single = await crypto.subtle.digest(algo, inputs[i]);
+        if (toHex(batch[i]) !== toHex(single)) mismatches++;
+      }
+      out[algo] = { count: batch.length, mismatches, first: toHex(batch[0]) };
+    }
+    let unsupported = "";
+    try { await crypto.digestBatch("MD5", inputs); } catch (e) { unsupported = String(e.message || e); }
+    return Response.json({ out, unsupported });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Out map[string]struct {
+			Count      int    `json:"count"`
+			Mismatches int    `json:"mismatches"`
+			First      string `json:"first"`
+		} `json:"out"`
+		Unsupported string `json:"unsupported"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for algo, res := range data.Out {
+		if res.Count != 1001 {
+			t.Errorf("%s: batch returned %d results, want 1001", algo, res.Count)
+		}
+		if res.Mismatches != 0 {
+			t.Errorf("%s: %d batch results differ from crypto.subtle.digest", algo, res.Mismatches)
+		}
+	}
+	sum := sha256.Sum256([]byte("leaf-0"))
+	if got := data.Out["SHA-256"].First; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA-256 leaf-0 = %q, want %q", got, hex.EncodeToString(sum[:]))
+	}
+	if !strings.Contains(data.Unsupported, "unsupported algorithm") {
+		t.Errorf("MD5 error = %q, want unsupported algorithm", data.Unsupported)
+	}
+}
+
+const digestBenchSource = `export default {
+  async fetch(request, env) {
+    const batch = new URL(request.url).pathname === "/batch";
+    const enc = new TextEncoder();
+    const inputs = [];
+    for (let i = 0; i < 1000; i++) inputs.push(enc.encode("leaf-" + i));
+    if (batch) {
+      await crypto.digestBatch("SHA-256", inputs);
+    } else {
+      for (const d of inputs) await crypto.subtle.digest("SHA-256", d);
+    }
+    return new Response("ok");
+  },
+};`
+
+func benchmarkDigest1000(b *testing.B, path string) {
+	e := NewEngine(testCfg(), nilSourceLoader{})
+	defer e.Shutdown()
+	if _, err := e.CompileAndCache("bench-digest", "deploy1", digestBenchSource); err != nil {
+		b.Fatalf("CompileAndCache: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := e.Execute("bench-digest", "deploy1", defaultEnv(), getReq("http://localhost"+path))
+		if r.Error != nil {
+			b.Fatalf("Execute: %v", r.Error)
+		}
+	}
+}
+
+func BenchmarkDigest1000_Individual(b *testing.B) { benchmarkDigest1000(b, "/single") }
+
+func BenchmarkDigest1000_Batch(b *testing.B) { benchmarkDigest1000(b, "/batch") }
+
 func TestCrypto_SubtleHMACSignVerify(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -420,6 +570,85 @@ func TestCrypto_HMACWithNullBytesInKey(t *testing.T) {
 	}
 }
 
+func TestCrypto_SubtleAcceptsAnyBufferSource(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const hex = (buf) => Array.from(new Uint8Array(buf), b => b.toString(16).padStart(2, "0")).join("");
+    const enc = new TextEncoder();
+    const key = await crypto.subtle.importKey(
+      "raw", enc.encode("0123456789abcdef0123456789abcdef"), { name: "HMAC", hash: "SHA-256" }, false, ["sign", "verify"]
+    );
+    const msg = enc.encode("sixteen byte msg");
+
+    // The message sits in the middle of a larger buffer.
+    const padded = new Uint8Array(24).fill(0xff);
+    padded.set(msg, 4);
+    const view = new DataView(padded.buffer, 4, 16);
+    const floats = new Float64Array(padded.buffer.slice(4, 20));
+    const shared = new SharedArrayBuffer(16);
+    new Uint8Array(shared).set(msg);
+
+    const sign = async (data) => hex(await crypto.subtle.sign("HMAC", key, data));
+    const sig = await crypto.subtle.sign("HMAC", key, view);
+
+    const aesKey = await crypto.subtle.importKey("raw", new Uint8Array(16), "AES-GCM", false, ["encrypt", "decrypt"]);
+    const iv = new DataView(new ArrayBuffer(12));
+    const ct = await crypto.subtle.encrypt({ name: "AES-GCM", iv }, aesKey, view);
+    const pt = await crypto.subtle.decrypt({ name: "AES-GCM", iv: new Uint16Array(6) }, aesKey, new DataView(ct));
+
+    return Response.json({
+      dataView: hex(sig),
+      uint8: await sign(msg),
+      float64: await sign(floats),
+      shared: await crypto.subtle.sign("HMAC", key, shared).then(() => "ok", (e) => e.name),
+      sharedView: await crypto.subtle.sign("HMAC", key, new DataView(shared)).then(() => "ok", (e) => e.name),
+      emptyView: await sign(new DataView(padded.buffer, 4, 0)),
+      empty: await sign(new Uint8Array(0)),
+      verified: await crypto.subtle.verify("HMAC", key, new DataView(sig), floats),
+      digest: hex(await crypto.subtle.digest("SHA-256", view)),
+      decrypted: new TextDecoder().decode(pt),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte("0123456789abcdef0123456789abcdef"))
+	mac.Write([]byte("sixteen byte msg"))
+	wantSig := hex.EncodeToString(mac.Sum(nil))
+	digest := sha256.Sum256([]byte("sixteen byte msg"))
+
+	for _, k := range []string{"dataView", "uint8", "float64"} {
+		if data[k] != wantSig {
+			t.Errorf("%s signature = %v, want %s", k, data[k], wantSig)
+		}
+	}
+	for _, k := range []string{"shared", "sharedView"} {
+		if data[k] != "TypeError" {
+			t.Errorf("%s = %v, want TypeError", k, data[k])
+		}
+	}
+	if data["emptyView"] != data["empty"] {
+		t.Errorf("empty DataView signature = %v, want the empty-message signature %v", data["emptyView"], data["empty"])
+	}
+	if data["verified"] != true {
+		t.Error("verify with a DataView signature over Float64Array data should succeed")
+	}
+	if data["digest"] != hex.EncodeToString(digest[:]) {
+		t.Errorf("digest = %v", data["digest"])
+	}
+	if data["decrypted"] != "sixteen byte msg" {
+		t.Errorf("decrypted = %v", data["decrypted"])
+	}
+}
+
 func TestCrypto_SubtleAESGCMEncryptDecrypt(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -469,6 +698,70 @@ func TestCrypto_SubtleAESGCMEncryptDecrypt(t *testing.T) {
 	}
 }
 
+func TestCrypto_AESGCM16ByteIV(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const toHex = (buf) => Array.from(new Uint8Array(buf), b => b.toString(16).padStart(2, '0')).join('');
+    const keyData = new Uint8Array(16).map((_, i) => i);
+    const key = await crypto.subtle.importKey("raw", keyData, "AES-GCM", false, ["encrypt", "decrypt"]);
+    const iv = new Uint8Array(16).map((_, i) => 0xf0 + i);
+    const plaintext = new TextEncoder().encode("interop partner payload");
+    const ciphertext = await crypto.subtle.encrypt({ name: "AES-GCM", iv }, key, plaintext);
+    const decrypted = await crypto.subtle.decrypt({ name: "AES-GCM", iv }, key, ciphertext);
+    let emptyIV = "resolved";
+    try {
+      await crypto.subtle.encrypt({ name: "AES-GCM", iv: new Uint8Array(0) }, key, plaintext);
+    } catch (e) {
+      emptyIV = String(e.message || e);
+    }
+    return Response.json({
+      ciphertext: toHex(ciphertext),
+      decrypted: new TextDecoder().decode(decrypted),
+      emptyIV,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Ciphertext string `json:"ciphertext"`
+		Decrypted  string `json:"decrypted"`
+		EmptyIV    string `json:"emptyIV"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	key := make([]byte, 16)
+	iv := make([]byte, 16)
+	for i := range key {
+		key[i] = byte(i)
+		iv[i] = byte(0xf0 + i)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := hex.EncodeToString(gcm.Seal(nil, iv, []byte("interop partner payload"), nil))
+	if data.Ciphertext != want {
+		t.Errorf("ciphertext = %s, want %s", data.Ciphertext, want)
+	}
+	if data.Decrypted != "interop partner payload" {
+		t.Errorf("decrypted = %q", data.Decrypted)
+	}
+	if !strings.Contains(data.EmptyIV, "IV must not be empty") {
+		t.Errorf("empty IV: %q, want rejection", data.EmptyIV)
+	}
+}
+
 // TestCrypto_AESGCMWithNullBytesInKeyAndIV is a deterministic regression test
 // for the null-byte truncation bug. Uses a fixed key and IV with embedded 0x00
 // bytes to guarantee the exact scenario that previously failed.
@@ -565,7 +858,7 @@ func TestCrypto_AESGCMAllZeroKey(t *testing.T) {
 	}
 }
 
-func TestCrypto_AESGCMRejectsInvalidIVLength(t *testing.T) {
+func TestCrypto_AESGCMRejectsEmptyIV(t *testing.T) {
 	e := newTestEngine(t)
 
 	source := `export default {
@@ -575,9 +868,8 @@ func TestCrypto_AESGCMRejectsInvalidIVLength(t *testing.T) {
     const key = await crypto.subtle.importKey(
       "raw", keyData, { name: "AES-GCM" }, false, ["encrypt", "decrypt"]
     );
-    // Wrong IV length: 8 bytes instead of 12.
-    const badIV = new Uint8Array(8);
-    crypto.getRandomValues(badIV);
+    // Any non-empty IV length is allowed; an empty one is not.
+    const badIV = new Uint8Array(0);
     try {
       await crypto.subtle.encrypt({ name: "AES-GCM", iv: badIV }, key, new Uint8Array([1,2,3]));
       return Response.json({ error: false });
@@ -599,7 +891,7 @@ func TestCrypto_AESGCMRejectsInvalidIVLength(t *testing.T) {
 	}
 
 	if !data.Error {
-		t.Error("AES-GCM encrypt should reject non-12-byte IV")
+		t.Error("AES-GCM encrypt should reject an empty IV")
 	}
 }
 
@@ -884,6 +1176,41 @@ func TestCrypto_RandomUUIDUniqueness(t *testing.T) {
 	}
 }
 
+func TestCrypto_MathRandomSeededPerIsolate(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const values = [];
+    for (let i = 0; i < 8; i++) values.push(Math.random());
+    return Response.json(values);
+  },
+};`
+
+	// Each site gets its own pool, so the two sequences come from two
+	// freshly created runtimes.
+	var seqs [2][]float64
+	for i := range seqs {
+		siteID := fmt.Sprintf("math-random-%d", i)
+		if _, err := e.CompileAndCache(siteID, "deploy1", source); err != nil {
+			t.Fatalf("CompileAndCache: %v", err)
+		}
+		r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+		if err := json.Unmarshal(r.Response.Body, &seqs[i]); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		for _, v := range seqs[i] {
+			if v < 0 || v >= 1 {
+				t.Errorf("Math.random() = %v, want a value in [0, 1)", v)
+			}
+		}
+	}
+	if fmt.Sprint(seqs[0]) == fmt.Sprint(seqs[1]) {
+		t.Errorf("two fresh runtimes produced the same Math.random sequence: %v", seqs[0])
+	}
+}
+
 func TestCrypto_RSAGenerateKeyAndSign(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -1851,7 +2178,7 @@ func TestCrypto_DirectGoCallbackMoreErrors(t *testing.T) {
 func TestCrypto_AESGCMBadIVErrors(t *testing.T) {
 	e := newTestEngine(t)
 
-	// Test AES-GCM encrypt/decrypt with bad IV (wrong length, bad base64).
+	// Test AES-GCM encrypt/decrypt with bad IV (empty, bad base64).
 	source := `export default {
   async fetch(request, env) {
     const results = {};
@@ -1866,16 +2193,16 @@ func TestCrypto_AESGCMBadIVErrors(t *testing.T) {
     try { __cryptoEncrypt("AES-GCM", keyID, btoa("plaintext"), "bad-iv!!!", ""); results.encBadIVB64 = false; }
     catch(e) { results.encBadIVB64 = true; }
 
-    // Encrypt with wrong IV length (5 bytes instead of 12).
-    try { __cryptoEncrypt("AES-GCM", keyID, btoa("plaintext"), btoa("short"), ""); results.encBadIVLen = false; }
+    // Encrypt with an empty IV.
+    try { __cryptoEncrypt("AES-GCM", keyID, btoa("plaintext"), "", ""); results.encBadIVLen = false; }
     catch(e) { results.encBadIVLen = true; }
 
     // Decrypt with bad IV base64.
     try { __cryptoDecrypt("AES-GCM", keyID, btoa("ciphertext"), "bad-iv!!!", ""); results.decBadIVB64 = false; }
     catch(e) { results.decBadIVB64 = true; }
 
-    // Decrypt with wrong IV length.
-    try { __cryptoDecrypt("AES-GCM", keyID, btoa("ciphertext"), btoa("short"), ""); results.decBadIVLen = false; }
+    // Decrypt with an empty IV.
+    try { __cryptoDecrypt("AES-GCM", keyID, btoa("ciphertext"), "", ""); results.decBadIVLen = false; }
     catch(e) { results.decBadIVLen = true; }
 
     // Decrypt with correct IV length but corrupt ciphertext.
@@ -3832,3 +4159,44 @@ func TestCrypto_AESKWWrapUnwrapWithAESCTRKey(t *testing.T) {
 		t.Errorf("decoded = %q, want 'wrap me!'", data.Decoded)
 	}
 }
+
+func TestCrypto_TimingSafeEqual(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const enc = new TextEncoder();
+    const eq = crypto.subtle.timingSafeEqual;
+    const mac = new Uint8Array([1, 2, 3, 4, 5, 6, 7, 8]);
+    return Response.json({
+      equal: eq(enc.encode("signature"), enc.encode("signature")),
+      unequal: eq(enc.encode("signature"), enc.encode("signaturf")),
+      prefix: eq(enc.encode("sig"), enc.encode("signature")),
+      empty: eq(new Uint8Array(0), new ArrayBuffer(0)),
+      mixedViews: eq(mac.buffer, new DataView(mac.buffer)),
+      subarray: eq(mac.subarray(2, 4), new Uint8Array([3, 4])),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]bool
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]bool{
+		"equal":      true,
+		"unequal":    false,
+		"prefix":     false,
+		"empty":      true,
+		"mixedViews": true,
+		"subarray":   true,
+	}
+	for k, v := range want {
+		if got, ok := data[k]; !ok || got != v {
+			t.Errorf("%s = %v, want %v", k, got, v)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"testing"
 )
@@ -325,3 +326,154 @@ func TestEncoding_Emoji(t *testing.T) {
 		t.Errorf("body = %q, want %q", r.Response.Body, want)
 	}
 }
+
+func TestEncoding_InvalidCharacterErrors(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    function capture(fn) {
+      try {
+        fn();
+        return { threw: false };
+      } catch (e) {
+        return { threw: true, name: e.name, code: e.code, isDOMException: e instanceof DOMException };
+      }
+    }
+    return Response.json({
+      btoaEmoji: capture(() => btoa("\u{1F600}")),
+      atobBadChar: capture(() => atob("not*base64")),
+      atobMidPad: capture(() => atob("ab=c")),
+      atobWhitespace: atob(" aGVs\tbG8=\n"),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	type caught struct {
+		Threw          bool   `json:"threw"`
+		Name           string `json:"name"`
+		Code           int    `json:"code"`
+		IsDOMException bool   `json:"isDOMException"`
+	}
+	var data struct {
+		BtoaEmoji      caught `json:"btoaEmoji"`
+		AtobBadChar    caught `json:"atobBadChar"`
+		AtobMidPad     caught `json:"atobMidPad"`
+		AtobWhitespace string `json:"atobWhitespace"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for name, c := range map[string]caught{
+		"btoa(emoji)":      data.BtoaEmoji,
+		"atob(not*base64)": data.AtobBadChar,
+		"atob(ab=c)":       data.AtobMidPad,
+	} {
+		if !c.Threw {
+			t.Errorf("%s should throw", name)
+			continue
+		}
+		if !c.IsDOMException || c.Name != "InvalidCharacterError" || c.Code != 5 {
+			t.Errorf("%s threw %s (code %d, DOMException=%v), want InvalidCharacterError DOMException", name, c.Name, c.Code, c.IsDOMException)
+		}
+	}
+	if data.AtobWhitespace != "hello" {
+		t.Errorf("atob with whitespace = %q, want hello", data.AtobWhitespace)
+	}
+}
+
+func TestEncoding_Base64urlRoundTripWithNulls(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const results = [];
+    // Every length mod 3, with NULs at the start, middle and end.
+    const inputs = [[0], [0, 0], [0, 251, 0], [0, 255, 0, 254], [255, 0, 0, 0, 63], [0, 0, 0, 0, 0, 0]];
+    for (const arr of inputs) {
+      const bytes = new Uint8Array(arr);
+      const url = bytes.toBase64({ alphabet: "base64url", omitPadding: true });
+      const padded = bytes.toBase64({ alphabet: "base64url" });
+      results.push({
+        url,
+        padded,
+        std: bytes.toBase64(),
+        fromUrl: Array.from(Uint8Array.fromBase64(url, { alphabet: "base64url" })),
+        fromPadded: Array.from(Uint8Array.fromBase64(padded, { alphabet: "base64url" })),
+        global: Array.from(base64urlDecode(url)),
+        globalEnc: base64urlEncode(bytes),
+      });
+    }
+    const errors = {};
+    const attempt = (name, fn) => { try { fn(); errors[name] = "ok"; } catch (e) { errors[name] = e.name; } };
+    attempt("strictUnpadded", () => Uint8Array.fromBase64("AA", { alphabet: "base64url", lastChunkHandling: "strict" }));
+    attempt("urlCharsInStd", () => Uint8Array.fromBase64("-_8"));
+    attempt("badAlphabet", () => Uint8Array.fromBase64("AA", { alphabet: "hex" }));
+    const partial = Array.from(Uint8Array.fromBase64("AAAA_w", { alphabet: "base64url", lastChunkHandling: "stop-before-partial" }));
+    return Response.json({ results, errors, partial });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Results []struct {
+			URL        string `json:"url"`
+			Padded     string `json:"padded"`
+			Std        string `json:"std"`
+			FromURL    []int  `json:"fromUrl"`
+			FromPadded []int  `json:"fromPadded"`
+			Global     []int  `json:"global"`
+			GlobalEnc  string `json:"globalEnc"`
+		} `json:"results"`
+		Errors  map[string]string `json:"errors"`
+		Partial []int             `json:"partial"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	inputs := [][]byte{{0}, {0, 0}, {0, 251, 0}, {0, 255, 0, 254}, {255, 0, 0, 0, 63}, {0, 0, 0, 0, 0, 0}}
+	if len(data.Results) != len(inputs) {
+		t.Fatalf("got %d results, want %d", len(data.Results), len(inputs))
+	}
+	for i, in := range inputs {
+		got := data.Results[i]
+		wantURL := base64.RawURLEncoding.EncodeToString(in)
+		if got.URL != wantURL || got.GlobalEnc != wantURL {
+			t.Errorf("input %v: url = %q, base64urlEncode = %q, want %q", in, got.URL, got.GlobalEnc, wantURL)
+		}
+		if want := base64.URLEncoding.EncodeToString(in); got.Padded != want {
+			t.Errorf("input %v: padded = %q, want %q", in, got.Padded, want)
+		}
+		if want := base64.StdEncoding.EncodeToString(in); got.Std != want {
+			t.Errorf("input %v: std = %q, want %q", in, got.Std, want)
+		}
+		for name, dec := range map[string][]int{"fromBase64": got.FromURL, "fromBase64 padded": got.FromPadded, "base64urlDecode": got.Global} {
+			if len(dec) != len(in) {
+				t.Errorf("input %v: %s = %v", in, name, dec)
+				continue
+			}
+			for j := range in {
+				if dec[j] != int(in[j]) {
+					t.Errorf("input %v: %s = %v", in, name, dec)
+					break
+				}
+			}
+		}
+	}
+
+	wantErrors := map[string]string{"strictUnpadded": "SyntaxError", "urlCharsInStd": "SyntaxError", "badAlphabet": "TypeError"}
+	for name, want := range wantErrors {
+		if data.Errors[name] != want {
+			t.Errorf("%s = %q, want %q", name, data.Errors[name], want)
+		}
+	}
+	if len(data.Partial) != 3 || data.Partial[0] != 0 || data.Partial[2] != 0 {
+		t.Errorf("stop-before-partial = %v, want [0 0 0]", data.Partial)
+	}
+}
@@ -430,3 +430,38 @@ export default {
 		t.Errorf("first=%v second=%v, want 10 20", data.First, data.Second)
 	}
 }
+
+// TestESM_ServiceWorkerFetchListener verifies that a service-worker-style
+// script with no exports is served through addEventListener("fetch").
+func TestESM_ServiceWorkerFetchListener(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `addEventListener("fetch", event => {
+  if (!(event instanceof FetchEvent)) throw new Error("not a FetchEvent");
+  event.waitUntil(Promise.resolve());
+  event.respondWith(new Response("sw"));
+});`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if string(r.Response.Body) != "sw" {
+		t.Errorf("body = %q, want 'sw'", r.Response.Body)
+	}
+
+	// The request is exposed on the event and respondWith accepts a promise.
+	source = `addEventListener("fetch", event => {
+  event.respondWith((async () => new Response(event.request.method + " " + new URL(event.request.url).pathname))());
+});`
+	r = execJS(t, e, source, defaultEnv(), getReq("http://localhost/path"))
+	assertOK(t, r)
+	if string(r.Response.Body) != "GET /path" {
+		t.Errorf("body = %q, want 'GET /path'", r.Response.Body)
+	}
+
+	// A listener that never responds is an error rather than an empty reply.
+	source = `addEventListener("fetch", event => {});`
+	r = execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	if r.Error == nil || !strings.Contains(r.Error.Error(), "respondWith") {
+		t.Errorf("error = %v, want respondWith error", r.Error)
+	}
+}
@@ -7,21 +7,29 @@ import "github.com/cryguy/worker/v2/internal/core"
 // the internal package directly.
 
 type WorkerRequest = core.WorkerRequest
+type RequestContext = core.RequestContext
 type WorkerResponse = core.WorkerResponse
 type WorkerResult = core.WorkerResult
+type WaitUntilResult = core.WaitUntilResult
+type PoolStats = core.PoolStats
 type LogEntry = core.LogEntry
 type TailEvent = core.TailEvent
 type Env = core.Env
 type EngineConfig = core.EngineConfig
 type SourceLoader = core.SourceLoader
+type ContextSourceLoader = core.ContextSourceLoader
+type SourceMeta = core.SourceMeta
 type WorkerDispatcher = core.WorkerDispatcher
 type KVStore = core.KVStore
+type ContextKVStore = core.ContextKVStore
 type CacheStore = core.CacheStore
 type CacheEntry = core.CacheEntry
+type CacheNamespaceStore = core.CacheNamespaceStore
 type DurableObjectStore = core.DurableObjectStore
 type QueueSender = core.QueueSender
 type R2Store = core.R2Store
 type D1Store = core.D1Store
+type ContextD1Store = core.ContextD1Store
 type EnvBindingFunc = core.EnvBindingFunc
 type ServiceBindingConfig = core.ServiceBindingConfig
 type AssetsFetcher = core.AssetsFetcher
@@ -41,7 +49,12 @@ type WebSocketBridger = core.WebSocketBridger
 
 // Constants re-exported from core.
 const MaxKVValueSize = core.MaxKVValueSize
+const (
+	LogFormatText = core.LogFormatText
+	LogFormatJSON = core.LogFormatJSON
+)
 
 // Functions re-exported from core.
 var DecodeCursor = core.DecodeCursor
 var EncodeCursor = core.EncodeCursor
+var HashSource = core.HashSource
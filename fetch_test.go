@@ -1,6 +1,10 @@
 package worker
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,6 +12,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -782,6 +788,242 @@ func TestFetch_BinaryBody(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Request bodies: FormData and Blob
+// ---------------------------------------------------------------------------
+
+func TestFetch_FormDataBody(t *testing.T) {
+	disableFetchSSRF(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out := map[string]string{
+			"name":    r.FormValue("name"),
+			"emoji":   r.FormValue("emoji"),
+			"tags":    strings.Join(r.MultipartForm.Value["tag"], ","),
+			"quoted":  r.FormValue(`a%22b`), // browsers percent-encode quotes in names
+			"isMulti": fmt.Sprint(strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data; boundary=")),
+		}
+		if f, hdr, err := r.FormFile("upload"); err == nil {
+			data, _ := io.ReadAll(f)
+			out["file"] = string(data)
+			out["filename"] = hdr.Filename
+			out["fileType"] = hdr.Header.Get("Content-Type")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const fd = new FormData();
+    fd.append("name", "worker");
+    fd.append("emoji", "héllo ✓");
+    fd.append("tag", "a");
+    fd.append("tag", "b");
+    fd.append('a"b', "escaped");
+    fd.append("upload", new Blob(["file contents"], { type: "text/plain" }), "notes.txt");
+    const resp = await fetch("%s/form", { method: "POST", body: fd });
+    return new Response(await resp.text(), { status: resp.status });
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if r.Response.StatusCode != 200 {
+		t.Fatalf("status = %d, body = %s", r.Response.StatusCode, r.Response.Body)
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"name":     "worker",
+		"emoji":    "héllo ✓",
+		"tags":     "a,b",
+		"quoted":   "escaped",
+		"isMulti":  "true",
+		"file":     "file contents",
+		"filename": "notes.txt",
+		"fileType": "text/plain",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %q, want %q", k, data[k], v)
+		}
+	}
+}
+
+func TestFetch_BlobBody(t *testing.T) {
+	disableFetchSSRF(t)
+
+	var gotType, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotType = r.Header.Get("Content-Type")
+		gotBody = string(body)
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const blob = new Blob(['{"ok":', "true}"], { type: "application/json" });
+    await fetch("%[1]s/blob", { method: "POST", body: blob });
+    return new Response("done");
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if gotType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", gotType)
+	}
+	if gotBody != `{"ok":true}` {
+		t.Errorf("body = %q, want {\"ok\":true}", gotBody)
+	}
+}
+
+func TestFetch_BinaryBlobAndMultipartBodies(t *testing.T) {
+	disableFetchSSRF(t)
+
+	want := make([]byte, 256)
+	for i := range want {
+		want[i] = byte(i)
+	}
+	var blobBody, fileBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blob" {
+			blobBody, _ = io.ReadAll(r.Body)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f, _, err := r.FormFile("bin"); err == nil {
+			fileBody, _ = io.ReadAll(f)
+		}
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const bytes = new Uint8Array(256);
+    for (let i = 0; i < 256; i++) bytes[i] = i;
+    const blob = new Blob([bytes], { type: "application/octet-stream" });
+    await fetch("%[1]s/blob", { method: "POST", body: blob });
+    const fd = new FormData();
+    fd.append("bin", blob, "bytes.bin");
+    const resp = await fetch("%[1]s/form", { method: "POST", body: fd });
+    const back = new Uint8Array(await blob.arrayBuffer());
+    let same = back.length === 256;
+    for (let i = 0; same && i < 256; i++) same = back[i] === i;
+    return Response.json({ status: resp.status, same, size: blob.size });
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Status int  `json:"status"`
+		Same   bool `json:"same"`
+		Size   int  `json:"size"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Status != 200 || !data.Same || data.Size != 256 {
+		t.Errorf("status = %d, arrayBuffer round trip = %v, size = %d", data.Status, data.Same, data.Size)
+	}
+	if string(blobBody) != string(want) {
+		t.Errorf("blob body = %x, want bytes 00..ff", blobBody)
+	}
+	if string(fileBody) != string(want) {
+		t.Errorf("multipart file = %x, want bytes 00..ff", fileBody)
+	}
+}
+
+func TestFetch_StreamingRequestBody(t *testing.T) {
+	disableFetchSSRF(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Transfer-Encoding", strings.Join(r.TransferEncoding, ","))
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    function generated() {
+      let i = 0;
+      return new ReadableStream({
+        async pull(controller) {
+          await new Promise(r => setTimeout(r, 1));
+          if (i === 5) { controller.close(); return; }
+          controller.enqueue(new TextEncoder().encode("chunk" + i++ + ";"));
+        }
+      });
+    }
+    const resp = await fetch("%[1]s/echo", { method: "POST", body: generated(), duplex: "half" });
+    const echoed = await resp.text();
+
+    const req = new Request("%[1]s/echo", { method: "POST", body: generated(), duplex: "half" });
+    const viaRequest = await (await fetch(req)).text();
+
+    let fetchErr = "", requestErr = "";
+    try { await fetch("%[1]s/echo", { method: "POST", body: generated() }); }
+    catch (e) { fetchErr = e.constructor.name; }
+    try { new Request("%[1]s/echo", { method: "POST", body: generated() }); }
+    catch (e) { requestErr = e.constructor.name; }
+
+    return new Response(echoed, { headers: {
+      "x-te": resp.headers.get("x-transfer-encoding"),
+      "x-via-request": viaRequest,
+      "x-duplex": req.duplex,
+      "x-fetch-err": fetchErr,
+      "x-request-err": requestErr,
+    }});
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	want := "chunk0;chunk1;chunk2;chunk3;chunk4;"
+	if got := string(r.Response.Body); got != want {
+		t.Errorf("echoed body = %q, want %q", got, want)
+	}
+	if got := r.Response.Headers["x-te"]; got != "chunked" {
+		t.Errorf("upstream Transfer-Encoding = %q, want chunked", got)
+	}
+	if got := r.Response.Headers["x-via-request"]; got != want {
+		t.Errorf("body via Request = %q, want %q", got, want)
+	}
+	if got := r.Response.Headers["x-duplex"]; got != "half" {
+		t.Errorf("Request.duplex = %q, want half", got)
+	}
+	if got := r.Response.Headers["x-fetch-err"]; got != "TypeError" {
+		t.Errorf("fetch without duplex threw %q, want TypeError", got)
+	}
+	if got := r.Response.Headers["x-request-err"]; got != "TypeError" {
+		t.Errorf("new Request without duplex threw %q, want TypeError", got)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Bug 2: AbortSignal.timeout should abort a slow fetch
 // ---------------------------------------------------------------------------
@@ -842,3 +1084,1151 @@ func TestFetch_AbortSignalTimeout(t *testing.T) {
 		t.Errorf("elapsed = %dms, expected abort within ~2000ms", data.Elapsed)
 	}
 }
+
+func TestFetch_AbortWithCustomReason(t *testing.T) {
+	disableFetchSSRF(t)
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const reason = new Error("custom abort");
+    const results = {};
+
+    const inflight = new AbortController();
+    const p = fetch("%s/slow", { signal: inflight.signal });
+    setTimeout(() => inflight.abort(reason), 20);
+    try { await p; results.inflight = "resolved"; } catch (e) { results.inflight = e === reason; }
+
+    const early = new AbortController();
+    early.abort(reason);
+    try { await fetch("%s/slow", { signal: early.signal }); results.early = "resolved"; }
+    catch (e) { results.early = e === reason; }
+
+    const plain = new AbortController();
+    const q = fetch("%s/slow", { signal: plain.signal });
+    plain.abort();
+    try { await q; results.plain = "resolved"; }
+    catch (e) { results.plain = e instanceof DOMException && e.name === "AbortError"; }
+
+    const waiter = new AbortController();
+    const w = scheduler.wait(10000, { signal: waiter.signal });
+    waiter.abort(reason);
+    try { await w; results.wait = "resolved"; } catch (e) { results.wait = e === reason; }
+
+    return Response.json(results);
+  },
+};`, srv.URL, srv.URL, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, k := range []string{"inflight", "early", "plain", "wait"} {
+		if data[k] != true {
+			t.Errorf("%s: got %v, want rejection with the abort reason", k, data[k])
+		}
+	}
+}
+
+func TestFetch_HeadRequest(t *testing.T) {
+	disableFetchSSRF(t)
+
+	var gotMethod string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "11")
+		w.Header().Set("X-Custom", "kept")
+		if r.Method != http.MethodHead {
+			_, _ = w.Write([]byte("hello world"))
+		}
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const resp = await fetch("%s/resource", { method: "HEAD" });
+    const text = await resp.text();
+    return Response.json({
+      status: resp.status,
+      text,
+      bodyNull: resp.body === null,
+      contentLength: resp.headers.get("content-length"),
+      custom: resp.headers.get("x-custom"),
+    });
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Status        int    `json:"status"`
+		Text          string `json:"text"`
+		BodyNull      bool   `json:"bodyNull"`
+		ContentLength string `json:"contentLength"`
+		Custom        string `json:"custom"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if gotMethod != http.MethodHead {
+		t.Errorf("server saw method %q, want HEAD", gotMethod)
+	}
+	if data.Status != 200 {
+		t.Errorf("status = %d, want 200", data.Status)
+	}
+	if data.Text != "" || !data.BodyNull {
+		t.Errorf("body = %q (null %v), want empty null body", data.Text, data.BodyNull)
+	}
+	if data.ContentLength != "11" {
+		t.Errorf("content-length = %q, want 11", data.ContentLength)
+	}
+	if data.Custom != "kept" {
+		t.Errorf("x-custom = %q, want kept", data.Custom)
+	}
+}
+
+func TestFetch_ResponseTrailers(t *testing.T) {
+	disableFetchSSRF(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/none" {
+			_, _ = io.WriteString(w, "no trailers")
+			return
+		}
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "payload")
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "OK")
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const resp = await fetch(%q);
+    const body = await resp.text();
+    const trailers = await resp.trailers;
+    const plain = await (await fetch(%q + "/none")).trailers;
+    return Response.json({
+      body,
+      isHeaders: trailers instanceof Headers,
+      status: trailers.get("grpc-status"),
+      message: trailers.get("Grpc-Message"),
+      inHeaders: resp.headers.has("grpc-status"),
+      emptyCount: [...plain].length,
+    });
+  },
+};`, srv.URL, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Body       string `json:"body"`
+		IsHeaders  bool   `json:"isHeaders"`
+		Status     string `json:"status"`
+		Message    string `json:"message"`
+		InHeaders  bool   `json:"inHeaders"`
+		EmptyCount int    `json:"emptyCount"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Body != "payload" {
+		t.Errorf("body = %q, want payload", data.Body)
+	}
+	if !data.IsHeaders || data.Status != "0" || data.Message != "OK" {
+		t.Errorf("trailers = %+v, want Headers with grpc-status 0 and grpc-message OK", data)
+	}
+	if data.InHeaders {
+		t.Error("trailers should not appear in the response headers")
+	}
+	if data.EmptyCount != 0 {
+		t.Errorf("response without trailers has %d trailer entries, want 0", data.EmptyCount)
+	}
+}
+
+func TestFetch_ReferrerPolicy(t *testing.T) {
+	disableFetchSSRF(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("Referer"))
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const target = %q;
+    const get = async (input, init) => (await fetch(input, init)).text();
+    return Response.json({
+      origin: await get(new Request(target, {
+        referrer: "https://app.example.com/account/settings?tab=1#top",
+        referrerPolicy: "origin",
+      })),
+      unsafe: await get(target, {
+        referrer: "https://user:pw@app.example.com/account/settings?tab=1#top",
+        referrerPolicy: "unsafe-url",
+      }),
+      none: await get(target, { referrerPolicy: "no-referrer" }),
+      empty: await get(target, { referrer: "" }),
+      client: await get(target),
+      downgrade: await get(target, { referrer: "https://app.example.com/", referrerPolicy: "strict-origin" }),
+      explicit: await get(target, { headers: { Referer: "https://set.example/" } }),
+      invalid: await fetch(target, { referrerPolicy: "bogus" }).then(() => "resolved", e => e.name),
+    });
+  },
+};`, srv.URL+"/path")
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://handler.example.com/some/page?q=1"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"origin":    "https://app.example.com/",
+		"unsafe":    "https://app.example.com/account/settings?tab=1",
+		"none":      "",
+		"empty":     "",
+		"client":    "http://handler.example.com/",
+		"downgrade": "",
+		"explicit":  "https://set.example/",
+		"invalid":   "TypeError",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s: Referer = %q, want %q", k, data[k], v)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Connection reuse
+// ---------------------------------------------------------------------------
+
+// BenchmarkFetch_SequentialSameHost issues sequential fetches to one
+// upstream and checks, via the server's count of new connections, that they
+// share kept-alive connections across requests and executions.
+func BenchmarkFetch_SequentialSameHost(b *testing.B) {
+	var newConns atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	// Keep the shared transport's pooling settings but dial loopback
+	// directly, as the SSRF-safe dialer refuses it.
+	origSSRF, origTransport := webapi.FetchSSRFEnabled, webapi.FetchTransport
+	transport := origTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{}).DialContext
+	webapi.FetchSSRFEnabled, webapi.FetchTransport = false, transport
+	defer func() { webapi.FetchSSRFEnabled, webapi.FetchTransport = origSSRF, origTransport }()
+
+	cfg := testCfg()
+	cfg.MaxFetchRequests = 100
+	cfg.FetchMaxIdleConnsPerHost = 4
+	e := NewEngine(cfg, nilSourceLoader{})
+	defer e.Shutdown()
+
+	const fetchesPerOp = 10
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    for (let i = 0; i < %d; i++) {
+      const resp = await fetch(%q);
+      await resp.text();
+    }
+    return new Response("done");
+  },
+};`, fetchesPerOp, srv.URL)
+	if _, err := e.CompileAndCache("bench-fetch-reuse", "deploy1", source); err != nil {
+		b.Fatalf("CompileAndCache: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := e.Execute("bench-fetch-reuse", "deploy1", defaultEnv(), getReq("http://localhost/"))
+		if r.Error != nil {
+			b.Fatalf("Execute: %v", r.Error)
+		}
+	}
+	b.StopTimer()
+
+	conns := newConns.Load()
+	b.ReportMetric(float64(conns)/float64(b.N*fetchesPerOp), "conns/fetch")
+	if conns > int64(cfg.FetchMaxIdleConnsPerHost) {
+		b.Errorf("%d fetches opened %d connections, want at most %d", b.N*fetchesPerOp, conns, cfg.FetchMaxIdleConnsPerHost)
+	}
+}
+
+// countingResolver resolves every host in addrs to its address and fails
+// for anything else, counting lookups per host.
+type countingResolver struct {
+	addrs map[string]string
+	delay time.Duration
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (r *countingResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	r.mu.Lock()
+	r.calls[host]++
+	r.mu.Unlock()
+	time.Sleep(r.delay)
+	if addr, ok := r.addrs[host]; ok {
+		return []net.IPAddr{{IP: net.ParseIP(addr)}}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r *countingResolver) count(host string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[host]
+}
+
+func TestFetch_DNSCacheReusesLookup(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	// Without keep-alive every fetch dials, and so resolves, again.
+	srv.Config.SetKeepAlivesEnabled(false)
+	srv.Start()
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	resolver := &countingResolver{addrs: map[string]string{"cached.test": "127.0.0.1"}, calls: map[string]int{}}
+	origSSRF, origResolver := webapi.FetchSSRFEnabled, webapi.FetchResolver
+	webapi.FetchSSRFEnabled, webapi.FetchResolver = false, resolver
+	t.Cleanup(func() { webapi.FetchSSRFEnabled, webapi.FetchResolver = origSSRF, origResolver })
+
+	cfg := testCfg()
+	cfg.FetchDNSCacheTTL = 60
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const get = (url) => fetch(url).then(r => r.text(), e => e.name);
+    return Response.json([
+      await get("http://cached.test:%[1]s/a"),
+      await get("http://cached.test:%[1]s/b"),
+      await get("http://missing.test:%[1]s/"),
+      await get("http://missing.test:%[1]s/"),
+    ]);
+  },
+};`, port)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	if got := string(r.Response.Body); got != `["ok","ok","TypeError","TypeError"]` {
+		t.Errorf("body = %s", got)
+	}
+	if n := resolver.count("cached.test"); n != 1 {
+		t.Errorf("cached.test resolved %d times, want 1", n)
+	}
+	// Failed lookups are not cached.
+	if n := resolver.count("missing.test"); n != 2 {
+		t.Errorf("missing.test resolved %d times, want 2", n)
+	}
+}
+
+func TestFetch_ReplacedTransportClosesIdleClones(t *testing.T) {
+	var closed atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	origSSRF, origTransport := webapi.FetchSSRFEnabled, webapi.FetchTransport
+	t.Cleanup(func() { webapi.FetchSSRFEnabled, webapi.FetchTransport = origSSRF, origTransport })
+	webapi.FetchSSRFEnabled = false
+
+	// A non-default idle limit makes each engine fetch through a clone.
+	cfg := testCfg()
+	cfg.FetchMaxIdleConnsPerHost = 7
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    return new Response(await (await fetch(%q)).text());
+  },
+};`, srv.URL)
+
+	for i := range 2 {
+		webapi.FetchTransport = &http.Transport{}
+		r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+		if i == 0 && closed.Load() != 0 {
+			t.Fatalf("connection closed before the transport was replaced")
+		}
+	}
+
+	// The clone of the first transport was evicted with its idle connection.
+	deadline := time.Now().Add(2 * time.Second)
+	for closed.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if closed.Load() == 0 {
+		t.Error("idle connection of the replaced transport's clone was never closed")
+	}
+}
+
+func TestFetch_DNSCacheKeepsCustomDialer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	var mu sync.Mutex
+	var dialed []string
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			dialed = append(dialed, addr)
+			mu.Unlock()
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	resolver := &countingResolver{addrs: map[string]string{"custom.test": "127.0.0.1"}, calls: map[string]int{}}
+	origSSRF, origTransport, origResolver := webapi.FetchSSRFEnabled, webapi.FetchTransport, webapi.FetchResolver
+	webapi.FetchSSRFEnabled, webapi.FetchTransport, webapi.FetchResolver = false, transport, resolver
+	t.Cleanup(func() {
+		webapi.FetchSSRFEnabled, webapi.FetchTransport, webapi.FetchResolver = origSSRF, origTransport, origResolver
+	})
+
+	cfg := testCfg()
+	cfg.FetchDNSCacheTTL = 60
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    return new Response(await (await fetch("http://custom.test:%s/")).text());
+  },
+};`, port)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if got := string(r.Response.Body); got != "ok" {
+		t.Errorf("body = %q, want %q", got, "ok")
+	}
+
+	// The cache resolves the host and the transport's own dialer connects.
+	mu.Lock()
+	defer mu.Unlock()
+	if want := "127.0.0.1:" + port; len(dialed) != 1 || dialed[0] != want {
+		t.Errorf("custom dialer saw %v, want [%s]", dialed, want)
+	}
+	if n := resolver.count("custom.test"); n != 1 {
+		t.Errorf("custom.test resolved %d times, want 1", n)
+	}
+}
+
+func TestFetch_DNSCacheSharesConcurrentLookups(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	srv.Config.SetKeepAlivesEnabled(false)
+	srv.Start()
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	resolver := &countingResolver{
+		addrs: map[string]string{"burst.test": "127.0.0.1"},
+		delay: 100 * time.Millisecond,
+		calls: map[string]int{},
+	}
+	origSSRF, origResolver := webapi.FetchSSRFEnabled, webapi.FetchResolver
+	webapi.FetchSSRFEnabled, webapi.FetchResolver = false, resolver
+	t.Cleanup(func() { webapi.FetchSSRFEnabled, webapi.FetchResolver = origSSRF, origResolver })
+
+	cfg := testCfg()
+	cfg.FetchDNSCacheTTL = 60
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const urls = [1, 2, 3, 4].map(i => "http://burst.test:%s/" + i);
+    const bodies = await Promise.all(urls.map(u => fetch(u).then(r => r.text())));
+    return new Response(bodies.join(","));
+  },
+};`, port)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if got := string(r.Response.Body); got != "ok,ok,ok,ok" {
+		t.Errorf("body = %q", got)
+	}
+	if n := resolver.count("burst.test"); n != 1 {
+		t.Errorf("burst.test resolved %d times for concurrent fetches, want 1", n)
+	}
+}
+
+func TestFetch_ExpectContinue(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	// A raw upstream, so the test can see exactly which bytes the client
+	// sends after the request headers.
+	var rejectedBodyBytes atomic.Int64
+	rejectedBodyBytes.Store(-1)
+	var sawExpect atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				req, err := http.ReadRequest(br)
+				if err != nil {
+					return
+				}
+				if req.Header.Get("Expect") == "100-continue" {
+					sawExpect.Add(1)
+				}
+				if req.URL.Path == "/reject" {
+					_, _ = io.WriteString(conn, "HTTP/1.1 417 Expectation Failed\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+					_ = conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+					n, _ := io.Copy(io.Discard, br)
+					rejectedBodyBytes.Store(n)
+					return
+				}
+				_, _ = io.WriteString(conn, "HTTP/1.1 100 Continue\r\n\r\n")
+				body, _ := io.ReadAll(req.Body)
+				reply := fmt.Sprintf("received %d", len(body))
+				_, _ = fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(reply), reply)
+			}(conn)
+		}
+	}()
+
+	origSSRF := webapi.FetchSSRFEnabled
+	webapi.FetchSSRFEnabled = false
+	t.Cleanup(func() { webapi.FetchSSRFEnabled = origSSRF })
+
+	e := newTestEngine(t)
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const base = %q;
+    const body = "x".repeat(256 * 1024);
+    const init = { method: "PUT", body, headers: { "Expect": "100-continue" } };
+    const accepted = await fetch(base + "/upload", init);
+    const rejected = await fetch(base + "/reject", init);
+    return Response.json({
+      acceptedStatus: accepted.status,
+      acceptedBody: await accepted.text(),
+      rejectedStatus: rejected.status,
+    });
+  },
+};`, "http://"+ln.Addr().String())
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data["acceptedStatus"] != float64(200) || data["acceptedBody"] != "received 262144" {
+		t.Errorf("accepted upload = %v %v, want 200 received 262144", data["acceptedStatus"], data["acceptedBody"])
+	}
+	if data["rejectedStatus"] != float64(417) {
+		t.Errorf("rejected status = %v, want 417", data["rejectedStatus"])
+	}
+	if n := sawExpect.Load(); n != 2 {
+		t.Errorf("upstream saw Expect: 100-continue on %d requests, want 2", n)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for rejectedBodyBytes.Load() < 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := rejectedBodyBytes.Load(); n != 0 {
+		t.Errorf("client sent %d body bytes after a 417, want 0", n)
+	}
+}
+
+func TestFetch_DefaultUserAgentAndHeaders(t *testing.T) {
+	disableFetchSSRF(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"ua":   r.Header.Get("User-Agent"),
+			"team": r.Header.Get("X-Team"),
+			"env":  r.Header.Get("X-Env"),
+		})
+	}))
+	defer srv.Close()
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const get = async (init) => (await fetch(%q, init)).json();
+    return Response.json({
+      plain: await get(),
+      custom: await get({ headers: { "user-agent": "my-bot/2.0", "x-team": "edge" } }),
+    });
+  },
+};`, srv.URL)
+
+	type seen struct {
+		UA   string `json:"ua"`
+		Team string `json:"team"`
+		Env  string `json:"env"`
+	}
+	run := func(cfg EngineConfig) (plain, custom seen) {
+		t.Helper()
+		e := NewEngine(cfg, nilSourceLoader{})
+		defer e.Shutdown()
+		r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+		var data struct {
+			Plain  seen `json:"plain"`
+			Custom seen `json:"custom"`
+		}
+		if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return data.Plain, data.Custom
+	}
+
+	plain, custom := run(testCfg())
+	if plain.UA != webapi.DefaultFetchUserAgent {
+		t.Errorf("default User-Agent = %q, want %q", plain.UA, webapi.DefaultFetchUserAgent)
+	}
+	if custom.UA != "my-bot/2.0" {
+		t.Errorf("worker User-Agent = %q, want my-bot/2.0", custom.UA)
+	}
+
+	cfg := testCfg()
+	cfg.FetchUserAgent = "acme-edge/3"
+	cfg.FetchDefaultHeaders = map[string]string{"X-Team": "platform", "X-Env": "prod"}
+	plain, custom = run(cfg)
+	if plain != (seen{UA: "acme-edge/3", Team: "platform", Env: "prod"}) {
+		t.Errorf("plain fetch sent %+v", plain)
+	}
+	if custom != (seen{UA: "my-bot/2.0", Team: "edge", Env: "prod"}) {
+		t.Errorf("fetch with worker headers sent %+v", custom)
+	}
+}
+
+func TestFetch_Integrity(t *testing.T) {
+	disableFetchSSRF(t)
+
+	const payload = "console.log('pinned');"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, payload)
+	}))
+	defer srv.Close()
+
+	sum := sha512.Sum384([]byte(payload))
+	good := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	bad := "sha384-" + base64.StdEncoding.EncodeToString(make([]byte, len(sum)))
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const target = %q;
+    const outcome = (init) => fetch(target, init).then(r => r.text(), e => e.name + ": " + e.message);
+    return Response.json({
+      good: await outcome({ integrity: %q }),
+      bad: await outcome({ integrity: %q }),
+      strongest: await outcome({ integrity: "sha256-AAAA " + %q }),
+      unknown: await outcome({ integrity: "md5-AAAA" }),
+      fromRequest: await fetch(new Request(target, { integrity: %q })).then(() => "resolved", e => e.name),
+    });
+  },
+};`, srv.URL, good, bad, good, bad)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data["good"] != payload {
+		t.Errorf("good = %q, want body", data["good"])
+	}
+	if !strings.Contains(data["bad"], "TypeError") || !strings.Contains(data["bad"], "integrity") {
+		t.Errorf("bad = %q, want integrity TypeError", data["bad"])
+	}
+	if data["strongest"] != payload {
+		t.Errorf("strongest = %q, want weaker sha256 entry ignored", data["strongest"])
+	}
+	if data["unknown"] != payload {
+		t.Errorf("unknown = %q, want unsupported algorithm ignored", data["unknown"])
+	}
+	if data["fromRequest"] != "TypeError" {
+		t.Errorf("fromRequest = %q, want TypeError", data["fromRequest"])
+	}
+}
+
+func TestFetch_KeepaliveOutlivesRequest(t *testing.T) {
+	disableFetchSSRF(t)
+
+	completed := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices a dropped connection once the body is read.
+		_, _ = io.ReadAll(r.Body)
+		select {
+		case <-time.After(300 * time.Millisecond):
+			completed <- r.URL.Path
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	// The execution timeout ends the request before the upstream answers.
+	cfg := testCfg()
+	cfg.ExecutionTimeout = 100
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := fmt.Sprintf(`export default {
+  fetch(request, env) {
+    fetch(%q + "/keep", { method: "POST", body: "bye", keepalive: true }).catch(() => {});
+    fetch(%q + "/drop", { method: "POST", body: "bye" }).catch(() => {});
+    return new Response("sent");
+  },
+};`, srv.URL, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var got []string
+	timeout := time.After(3 * time.Second)
+	for len(got) == 0 || got[len(got)-1] != "/keep" {
+		select {
+		case path := <-completed:
+			got = append(got, path)
+		case <-timeout:
+			t.Fatalf("keepalive fetch did not finish after its request ended; completed %v", got)
+		}
+	}
+	select {
+	case path := <-completed:
+		got = append(got, path)
+	case <-time.After(500 * time.Millisecond):
+	}
+	for _, path := range got {
+		if path == "/drop" {
+			t.Errorf("plain fetch finished after its request ended; completed %v", got)
+		}
+	}
+}
+
+func TestFetch_ResponseSizeCapStopsReading(t *testing.T) {
+	disableFetchSSRF(t)
+
+	const limit = 64 * 1024
+	const total = 32 * 1024 * 1024
+	var written atomic.Int64
+	done := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/declared" {
+			w.Header().Set("Content-Length", fmt.Sprint(limit+1))
+			_, _ = w.Write(make([]byte, limit+1))
+			return
+		}
+		defer func() { done <- struct{}{} }()
+		chunk := make([]byte, 4096)
+		flusher := w.(http.Flusher)
+		for written.Load() < total {
+			n, err := w.Write(chunk)
+			written.Add(int64(n))
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testCfg()
+	cfg.MaxResponseBytes = limit
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const outcome = (path) => fetch(%q + path).then(r => "resolved " + r.status, e => e.message);
+    return Response.json({ streamed: await outcome("/stream"), declared: await outcome("/declared") });
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, k := range []string{"streamed", "declared"} {
+		if !strings.Contains(data[k], "response body too large") {
+			t.Errorf("%s = %q, want a response body too large rejection", k, data[k])
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("upstream handler kept writing after the fetch was rejected")
+	}
+	if n := written.Load(); n >= total {
+		t.Errorf("upstream wrote the whole %d byte body; the download was not cut off", n)
+	}
+}
+
+func TestFetch_BodyByMethod(t *testing.T) {
+	disableFetchSSRF(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, "%s %s", r.Method, b)
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const target = %q;
+    const construct = (init) => {
+      try { new Request(target, init); return "ok"; } catch (e) { return e.name; }
+    };
+    const send = (init) => fetch(target, init).then(r => r.text(), e => e.name);
+    const put = new Request(target, { method: "PUT", body: "put-body" });
+    return Response.json({
+      putText: await put.text(),
+      put: await send({ method: "PUT", body: "p" }),
+      patch: await send({ method: "PATCH", body: "q" }),
+      del: await send({ method: "DELETE", body: "r" }),
+      forwarded: await fetch(new Request(target, { method: "PUT", body: "s" })).then(r => r.text()),
+      headRequest: construct({ method: "HEAD", body: "x" }),
+      getRequest: construct({ method: "get", body: "x" }),
+      headNullBody: construct({ method: "HEAD", body: null }),
+      headFetch: await send({ method: "HEAD", body: "x" }),
+      getFetch: await send({ body: "x" }),
+      getFromPut: (() => { try { new Request(put, { method: "GET" }); return "ok"; } catch (e) { return e.name; } })(),
+    });
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"putText":      "put-body",
+		"put":          "PUT p",
+		"patch":        "PATCH q",
+		"del":          "DELETE r",
+		"forwarded":    "PUT s",
+		"headRequest":  "TypeError",
+		"getRequest":   "TypeError",
+		"headNullBody": "ok",
+		"headFetch":    "TypeError",
+		"getFetch":     "TypeError",
+		"getFromPut":   "TypeError",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %q, want %q", k, data[k], v)
+		}
+	}
+}
+
+func TestFetch_InitEnumValidation(t *testing.T) {
+	disableFetchSSRF(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const target = %q;
+    const outcome = (p) => p.then(r => r.text(), e => e.name + ": " + e.message);
+    const construct = (init) => {
+      try { new Request(target, init); return "ok"; } catch (e) { return e.name + ": " + e.message; }
+    };
+    return Response.json({
+      priority: await outcome(fetch(target, { priority: "high", futureOption: true })),
+      badRedirect: await outcome(fetch(target, { redirect: "bogus" })),
+      badPriority: await outcome(fetch(target, { priority: "urgent" })),
+      requestPriority: construct({ priority: "low", futureOption: 1 }),
+      requestBadRedirect: construct({ redirect: "sometimes" }),
+      requestBadCredentials: construct({ credentials: "always" }),
+      requestBadMode: construct({ mode: "open" }),
+    });
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"priority":              "ok",
+		"badRedirect":           "TypeError: fetch: invalid redirect mode: bogus",
+		"badPriority":           "TypeError: fetch: invalid priority: urgent",
+		"requestPriority":       "ok",
+		"requestBadRedirect":    "TypeError: Request: invalid redirect mode: sometimes",
+		"requestBadCredentials": "TypeError: Request: invalid credentials mode: always",
+		"requestBadMode":        "TypeError: Request: invalid mode: open",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %q, want %q", k, data[k], v)
+		}
+	}
+}
+
+func TestFetch_RetryIdempotentWithBackoff(t *testing.T) {
+	disableFetchSSRF(t)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "third time")
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const resp = await fetch(%q, { retry: { attempts: 3, backoffMs: 10 } });
+    return Response.json({ status: resp.status, text: await resp.text() });
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Status int    `json:"status"`
+		Text   string `json:"text"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Status != 200 || data.Text != "third time" {
+		t.Errorf("got %d %q, want 200 \"third time\"", data.Status, data.Text)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("server hits = %d, want 3", n)
+	}
+
+	// POST is not idempotent, so a 5xx is returned without retrying.
+	hits.Store(0)
+	source = fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const resp = await fetch(%q, { method: "POST", body: "x", retry: { attempts: 3, backoffMs: 10 } });
+    return Response.json({ status: resp.status, text: await resp.text() });
+  },
+};`, srv.URL)
+	r = execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Status != http.StatusServiceUnavailable {
+		t.Errorf("POST status = %d, want 503", data.Status)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("POST server hits = %d, want 1", n)
+	}
+
+	// A backoff too large for time.Duration is capped rather than wrapping
+	// around to a negative wait, so the next attempt would pass the fetch
+	// timeout and the 5xx comes back after one try.
+	hits.Store(0)
+	source = fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const resp = await fetch(%q, { retry: { attempts: 3, backoffMs: 1e13 } });
+    return Response.json({ status: resp.status, text: await resp.text() });
+  },
+};`, srv.URL)
+	r = execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Status != http.StatusServiceUnavailable {
+		t.Errorf("huge backoff status = %d, want 503", data.Status)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("huge backoff server hits = %d, want 1", n)
+	}
+}
+
+func TestFetch_ProxyResponseBody(t *testing.T) {
+	disableFetchSSRF(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Upstream", "origin")
+		_, _ = io.WriteString(w, "proxied body")
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const upstream = await fetch(%q);
+    const headers = new Headers(upstream.headers);
+    headers.set("x-proxy", "worker");
+    headers.delete("x-upstream");
+
+    // A stream that was already read from cannot become another body.
+    const used = new Response("used").body;
+    const reader = used.getReader();
+    await reader.read();
+    reader.releaseLock();
+    let reuse = "no error";
+    try { new Response(used); } catch (e) { reuse = e.constructor.name; }
+    headers.set("x-reuse", reuse);
+
+    return new Response(upstream.body, { status: 203, headers });
+  },
+};`, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	if r.Response.StatusCode != 203 {
+		t.Errorf("status = %d, want 203", r.Response.StatusCode)
+	}
+	if string(r.Response.Body) != "proxied body" {
+		t.Errorf("body = %q, want %q", r.Response.Body, "proxied body")
+	}
+	if got := r.Response.Headers["x-proxy"]; got != "worker" {
+		t.Errorf("x-proxy = %q, want worker", got)
+	}
+	if _, ok := r.Response.Headers["x-upstream"]; ok {
+		t.Error("x-upstream should have been removed")
+	}
+	if got := r.Response.Headers["content-type"]; got != "text/plain" {
+		t.Errorf("content-type = %q, want text/plain", got)
+	}
+	if got := r.Response.Headers["x-reuse"]; got != "TypeError" {
+		t.Errorf("reusing a disturbed stream = %q, want TypeError", got)
+	}
+}
+
+func TestFetch_ResponseCloneReadsBothCopies(t *testing.T) {
+	disableFetchSSRF(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte("upstream payload"))
+	}))
+	defer srv.Close()
+
+	e := newTestEngine(t)
+	source := fmt.Sprintf(`export default {
+  async fetch(request, env) {
+    const r = await fetch(%q);
+    const copy = r.clone();
+    const first = await r.text();
+    const second = await copy.text();
+
+    // Once the body has been turned into a stream, clone tees it.
+    const s = await fetch(%q);
+    const stream = s.body;
+    const streamCopy = s.clone();
+    const fromStream = await new Response(s.body).text();
+    const fromCopy = await streamCopy.text();
+    const sameStream = stream === streamCopy.body;
+
+    let consumed = "";
+    try { r.clone(); } catch (e) { consumed = e.name; }
+    return Response.json({ first, second, fromStream, fromCopy, sameStream, consumed, url: copy.url === r.url });
+  },
+};`, srv.URL, srv.URL)
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		First      string `json:"first"`
+		Second     string `json:"second"`
+		FromStream string `json:"fromStream"`
+		FromCopy   string `json:"fromCopy"`
+		SameStream bool   `json:"sameStream"`
+		Consumed   string `json:"consumed"`
+		URL        bool   `json:"url"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for name, got := range map[string]string{"first": data.First, "second": data.Second, "fromStream": data.FromStream, "fromCopy": data.FromCopy} {
+		if got != "upstream payload" {
+			t.Errorf("%s = %q, want %q", name, got, "upstream payload")
+		}
+	}
+	if data.SameStream {
+		t.Error("clone shares the original's body stream")
+	}
+	if data.Consumed != "TypeError" {
+		t.Errorf("cloning a consumed response threw %q, want TypeError", data.Consumed)
+	}
+	if !data.URL {
+		t.Error("clone lost the response URL")
+	}
+}
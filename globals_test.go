@@ -2,6 +2,7 @@ package worker
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 )
 
@@ -193,6 +194,56 @@ func TestGlobals_Navigator(t *testing.T) {
 	}
 }
 
+func TestGlobals_SelfAndWindowAliases(t *testing.T) {
+	source := `globalThis.atLoad = self === globalThis;
+export default {
+  fetch(request, env) {
+    return Response.json({
+      atLoad: globalThis.atLoad,
+      self: self === globalThis,
+      crypto: self.crypto === globalThis.crypto,
+      fetch: typeof self.fetch === 'function',
+      windowType: typeof window,
+      windowIsGlobal: typeof window !== 'undefined' && window === globalThis,
+    });
+  },
+};`
+
+	type result struct {
+		AtLoad         bool   `json:"atLoad"`
+		Self           bool   `json:"self"`
+		Crypto         bool   `json:"crypto"`
+		Fetch          bool   `json:"fetch"`
+		WindowType     string `json:"windowType"`
+		WindowIsGlobal bool   `json:"windowIsGlobal"`
+	}
+	run := func(t *testing.T, e *Engine) result {
+		t.Helper()
+		r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+		var data result
+		if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if !data.AtLoad || !data.Self || !data.Crypto || !data.Fetch {
+			t.Errorf("self should alias globalThis with its built-ins: %+v", data)
+		}
+		return data
+	}
+
+	if data := run(t, newTestEngine(t)); data.WindowType != "undefined" {
+		t.Errorf("typeof window = %q by default, want undefined", data.WindowType)
+	}
+
+	cfg := testCfg()
+	cfg.DefineWindow = true
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+	if data := run(t, e); !data.WindowIsGlobal {
+		t.Error("window should alias globalThis when DefineWindow is set")
+	}
+}
+
 func TestGlobals_StructuredCloneRejectsUndefined(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -574,6 +625,76 @@ func TestGlobals_StructuredCloneTypedArray(t *testing.T) {
 	}
 }
 
+func TestGlobals_StructuredCloneSubarrayView(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const orig = new Uint8Array([0, 1, 2, 3, 4, 5, 6, 7]);
+    const view = orig.subarray(2, 6);
+    const cloned = structuredClone(view);
+    orig[3] = 99;
+    cloned[0] = 42;
+    const pair = structuredClone({ a: view, b: orig.subarray(4) });
+    let detached = "unsupported";
+    if (typeof ArrayBuffer.prototype.transfer === "function") {
+      const buf = new ArrayBuffer(4);
+      const v = new Uint8Array(buf);
+      buf.transfer();
+      try { structuredClone(v); detached = "no error"; } catch (e) { detached = e.name; }
+    }
+    return Response.json({
+      isUint8Array: cloned instanceof Uint8Array,
+      freshBuffer: cloned.buffer !== orig.buffer,
+      byteOffset: cloned.byteOffset,
+      length: cloned.length,
+      bufferLength: cloned.buffer.byteLength,
+      contents: Array.from(cloned),
+      origView: Array.from(view),
+      sharedClone: pair.a.buffer === pair.b.buffer,
+      detached,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		IsUint8Array bool   `json:"isUint8Array"`
+		FreshBuffer  bool   `json:"freshBuffer"`
+		ByteOffset   int    `json:"byteOffset"`
+		Length       int    `json:"length"`
+		BufferLength int    `json:"bufferLength"`
+		Contents     []int  `json:"contents"`
+		OrigView     []int  `json:"origView"`
+		SharedClone  bool   `json:"sharedClone"`
+		Detached     string `json:"detached"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if !data.IsUint8Array || !data.FreshBuffer {
+		t.Errorf("clone should be a Uint8Array over a new buffer: %+v", data)
+	}
+	if data.ByteOffset != 2 || data.Length != 4 || data.BufferLength != 8 {
+		t.Errorf("byteOffset/length/buffer = %d/%d/%d, want 2/4/8", data.ByteOffset, data.Length, data.BufferLength)
+	}
+	if fmt.Sprint(data.Contents) != "[42 3 4 5]" {
+		t.Errorf("clone contents = %v, want [42 3 4 5]", data.Contents)
+	}
+	if fmt.Sprint(data.OrigView) != "[2 99 4 5]" {
+		t.Errorf("original view = %v, want [2 99 4 5]", data.OrigView)
+	}
+	if !data.SharedClone {
+		t.Error("views over one buffer should share the cloned buffer")
+	}
+	if data.Detached != "unsupported" && data.Detached != "DataCloneError" {
+		t.Errorf("cloning a view over a detached buffer: got %q, want DataCloneError", data.Detached)
+	}
+}
+
 func TestGlobals_StructuredCloneArrayBuffer(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -981,3 +1102,127 @@ func TestGlobals_StructuredCloneFloat64Array(t *testing.T) {
 		t.Error("cloned Float64Array should be independent of original")
 	}
 }
+
+func TestGlobals_StructuredCloneBigInt(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const orig = { n: 10n, list: [1n, -2n], big: 2n ** 70n, boxed: Object(5n) };
+    const cloned = structuredClone(orig);
+    const m = structuredClone(new Map([[1n, 3n]]));
+    return Response.json({
+      type: typeof cloned.n,
+      n: cloned.n.toString(),
+      list: cloned.list.map(String),
+      big: cloned.big.toString(),
+      boxedType: typeof cloned.boxed,
+      boxed: cloned.boxed.valueOf().toString(),
+      boxedDistinct: cloned.boxed !== orig.boxed,
+      mapVal: String(m.get(1n)),
+      top: String(structuredClone(7n)),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Type          string   `json:"type"`
+		N             string   `json:"n"`
+		List          []string `json:"list"`
+		Big           string   `json:"big"`
+		BoxedType     string   `json:"boxedType"`
+		Boxed         string   `json:"boxed"`
+		BoxedDistinct bool     `json:"boxedDistinct"`
+		MapVal        string   `json:"mapVal"`
+		Top           string   `json:"top"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Type != "bigint" || data.N != "10" {
+		t.Errorf("cloned.n = %s (%s), want 10 (bigint)", data.N, data.Type)
+	}
+	if len(data.List) != 2 || data.List[0] != "1" || data.List[1] != "-2" {
+		t.Errorf("cloned.list = %v, want [1 -2]", data.List)
+	}
+	if data.Big != "1180591620717411303424" {
+		t.Errorf("cloned.big = %s, want 2^70", data.Big)
+	}
+	if data.BoxedType != "object" || data.Boxed != "5" || !data.BoxedDistinct {
+		t.Errorf("boxed BigInt clone = %s (%s, distinct=%v), want new object wrapping 5", data.Boxed, data.BoxedType, data.BoxedDistinct)
+	}
+	if data.MapVal != "3" {
+		t.Errorf("map value = %s, want 3", data.MapVal)
+	}
+	if data.Top != "7" {
+		t.Errorf("structuredClone(7n) = %s, want 7", data.Top)
+	}
+}
+
+func TestGlobals_StructuredCloneError(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const orig = new TypeError("bad input", { cause: { code: 42 } });
+    const clone = structuredClone(orig);
+
+    class ValidationError extends Error {
+      constructor(m) { super(m); this.name = "ValidationError"; }
+    }
+    const custom = structuredClone(new ValidationError("nope"));
+    const dom = structuredClone(new DOMException("stop", "AbortError"));
+    const nested = structuredClone({ errors: [orig, orig] });
+
+    const { port1, port2 } = new MessageChannel();
+    const received = new Promise((resolve) => { port2.onmessage = (ev) => resolve(ev.data); });
+    port1.postMessage(new RangeError("out of range"));
+    const posted = await received;
+
+    return Response.json({
+      isTypeError: clone instanceof TypeError,
+      distinct: clone !== orig,
+      name: clone.name,
+      message: clone.message,
+      sameStack: clone.stack === orig.stack,
+      cause: clone.cause.code,
+      causeDistinct: clone.cause !== orig.cause,
+      customIsError: custom instanceof Error && custom.constructor === Error,
+      customMessage: custom.message,
+      domName: dom instanceof DOMException ? dom.name : "not a DOMException",
+      nestedShared: nested.errors[0] === nested.errors[1] && nested.errors[0] instanceof TypeError,
+      posted: posted instanceof RangeError ? posted.message : "not a RangeError",
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"isTypeError":   true,
+		"distinct":      true,
+		"name":          "TypeError",
+		"message":       "bad input",
+		"sameStack":     true,
+		"cause":         float64(42),
+		"causeDistinct": true,
+		"customIsError": true,
+		"customMessage": "nope",
+		"domName":       "AbortError",
+		"nestedShared":  true,
+		"posted":        "out of range",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %v, want %v", k, data[k], v)
+		}
+	}
+}
@@ -1,17 +1,23 @@
 package core
 
+import "context"
+
 // EngineBackend is the interface that engine implementations (QuickJS, V8)
 // must satisfy. The root worker.Engine facade delegates to one of these
 // based on build tags.
 type EngineBackend interface {
 	Execute(siteID, deployKey string, env *Env, req *WorkerRequest) *WorkerResult
-	ExecuteScheduled(siteID, deployKey string, env *Env, cron string) *WorkerResult
+	ExecuteScheduled(siteID, deployKey string, env *Env, cron string, cf map[string]any) *WorkerResult
 	ExecuteTail(siteID, deployKey string, env *Env, events []TailEvent) *WorkerResult
 	ExecuteFunction(siteID, deployKey string, env *Env, fnName string, args ...any) *WorkerResult
 	EnsureSource(siteID, deployKey string) error
+	Warm(siteID, deployKey string) error
+	RefreshSource(ctx context.Context, siteID, deployKey string) (bool, error)
 	CompileAndCache(siteID, deployKey string, source string) ([]byte, error)
+	SourceMeta(siteID, deployKey string) (SourceMeta, bool)
 	InvalidatePool(siteID, deployKey string)
 	Shutdown()
 	SetDispatcher(d WorkerDispatcher)
 	MaxResponseBytes() int
+	Stats() []PoolStats
 }
@@ -1,12 +1,50 @@
 package core
 
+import "io"
+
 // EngineConfig holds runtime configuration for the worker engine.
 type EngineConfig struct {
-	PoolSize         int // number of JS runtime instances per site pool
-	MemoryLimitMB    int // per-runtime memory limit
-	ExecutionTimeout int // milliseconds before worker is terminated
-	MaxFetchRequests int // max outbound fetches per request
-	FetchTimeoutSec  int // per-fetch timeout in seconds
-	MaxResponseBytes int // max response body size
-	MaxScriptSizeKB  int // max bundled script size
+	PoolSize                 int    // number of JS runtime instances per site pool
+	MaxPoolSize              int    // grow up to this many instances under load (0 = fixed at PoolSize)
+	PoolIdleTimeout          int    // milliseconds an extra instance may sit idle before it is reclaimed (0 = 60s)
+	MemoryLimitMB            int    // per-runtime memory limit
+	ExecutionTimeout         int    // milliseconds before worker is terminated
+	WaitUntilTimeout         int    // milliseconds ctx.waitUntil promises may keep running after the response (0 = ExecutionTimeout)
+	MaxFetchRequests         int    // max outbound fetches per request
+	FetchTimeoutSec          int    // per-fetch timeout in seconds
+	FetchMaxIdleConnsPerHost int    // idle keep-alive connections kept per upstream host for fetch (0 = 16)
+	FetchDNSCacheTTL         int    // seconds fetch reuses a successful DNS lookup for a host (0 = no caching)
+	FetchDNSCacheEntries     int    // max hosts held in the fetch DNS cache (0 = 1024)
+	FetchUserAgent           string // User-Agent sent on fetches that don't set one ("" = "hostedat-worker/1.0")
+	MaxResponseBytes         int    // max response body size, also enforced on fetch() downloads (0 = unlimited for worker responses, 10 MiB for fetch)
+	MaxRequestBytes          int    // max incoming request body size (0 = unlimited)
+	MaxHeaderCount           int    // max headers on an incoming request or a worker response (0 = unlimited)
+	MaxHeaderBytes           int    // max total bytes of header names and values on a request or response (0 = unlimited)
+	MaxArrayBufferBytes      int    // largest single ArrayBuffer or typed array a worker may allocate (0 = unlimited; set it on V8, whose heap limit does not cover buffer contents)
+	MaxAllocationBytes       int    // total ArrayBuffer and typed array bytes a single request may allocate (0 = unlimited)
+	MaxScriptSizeKB          int    // max bundled script size
+	MaxPendingTimers         int    // max setTimeout/setInterval timers pending at once per runtime (0 = 10000)
+	RSAKeyPoolSize           int    // 2048-bit RSA keys pre-generated in the background for generateKey (0 = disabled)
+	MaxServiceBindingDepth   int    // nested service binding calls allowed in one request chain (0 = 16)
+	LogFormat                string // "text" (default) keeps console messages as-is; "json" captures each LogEntry.Message as the entry encoded as a single-line JSON record
+	DefineWindow             bool   // also expose the global scope as window for browser-oriented libraries (default: window is undefined, as on Workers)
+
+	// DisabledGlobals lists globals withheld from workers, as dotted paths
+	// such as "fetch", "crypto.subtle" or "WebSocket". Each is removed once
+	// the runtime is set up, along with the internal bridges behind it, so
+	// it reads as undefined to the worker. The list applies to every worker
+	// the engine runs; there is no per-request override, so hosts with
+	// differing policies need one Engine per policy.
+	DisabledGlobals []string
+
+	// FetchDefaultHeaders are added to every outbound fetch. A header the
+	// worker sets itself replaces the default of the same name.
+	FetchDefaultHeaders map[string]string
+
+	// CryptoRand replaces crypto/rand as the entropy source for
+	// getRandomValues, randomUUID and AES/HMAC/Ed25519/X25519 generateKey,
+	// and seeds Math.random from it, so golden-file tests of crypto flows
+	// are reproducible. TEST ONLY: leave it nil in production. RSA, ECDSA
+	// and ECDH key generation still use crypto/rand.
+	CryptoRand io.Reader
 }
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"runtime"
+	"time"
+)
+
+// CPUTimer measures the CPU time consumed by the calling goroutine while it
+// runs JavaScript. The goroutine is pinned to its OS thread only while the
+// timer is running, so the thread's CPU clock advances for this execution
+// alone. The event loop pauses the timer, and with it releases the thread,
+// whenever it waits on timers or fetches, so that waiting neither counts nor
+// holds an OS thread.
+type CPUTimer struct {
+	start   time.Duration
+	ok      bool
+	running bool
+	stopped bool
+	elapsed time.Duration
+}
+
+// StartCPUTimer locks the calling goroutine to its OS thread and records the
+// thread's CPU clock. Pause, Resume and Stop must be called on the same
+// goroutine.
+func StartCPUTimer() *CPUTimer {
+	t := &CPUTimer{ok: true}
+	t.Resume()
+	return t
+}
+
+// Pause adds the CPU time used since the timer last started and unlocks the
+// thread. It is a no-op on a nil, paused or stopped timer.
+func (t *CPUTimer) Pause() {
+	if t == nil || !t.running {
+		return
+	}
+	t.running = false
+	if t.ok {
+		if now, ok := threadCPUTime(); ok && now > t.start {
+			t.elapsed += now - t.start
+		}
+	}
+	runtime.UnlockOSThread()
+}
+
+// Resume locks the thread again and restarts the measurement. It is a no-op
+// on a nil, running or stopped timer.
+func (t *CPUTimer) Resume() {
+	if t == nil || t.running || t.stopped {
+		return
+	}
+	runtime.LockOSThread()
+	t.running = true
+	t.start, t.ok = threadCPUTime()
+}
+
+// Stop returns the CPU time used while the timer ran and unlocks the thread.
+// It returns 0 on platforms without a per-thread CPU clock. Calling Stop
+// more than once returns the first measurement.
+func (t *CPUTimer) Stop() time.Duration {
+	if t.stopped {
+		return t.elapsed
+	}
+	t.Pause()
+	t.stopped = true
+	if !t.ok {
+		t.elapsed = 0
+	}
+	return t.elapsed
+}
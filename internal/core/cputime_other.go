@@ -0,0 +1,10 @@
+//go:build !linux
+
+package core
+
+import "time"
+
+// threadCPUTime is unavailable on this platform; CPU time is reported as 0.
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
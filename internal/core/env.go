@@ -37,6 +37,12 @@ type Env struct {
 	Dispatcher WorkerDispatcher // set by Engine before execution
 	SiteID     string           // site isolation key
 
+	// ServiceBindingDepth counts the service binding calls that led to this
+	// execution (0 for a request from outside). The env handed to a
+	// WorkerDispatcher already carries the incremented depth; a dispatcher
+	// that builds its own env for the target must copy it across.
+	ServiceBindingDepth int
+
 	// initOnce guards the one-time initialization of Dispatcher and SiteID
 	// so concurrent Execute calls sharing the same Env are race-free.
 	initOnce sync.Once
@@ -56,6 +62,10 @@ func (env *Env) InitRuntime(dispatcher WorkerDispatcher, siteID string) {
 }
 
 // AssetsFetcher is implemented by the static pipeline to handle env.ASSETS.fetch().
+// The request carries the caller's headers with lower-cased names, including
+// range, if-none-match and if-modified-since, so a fetcher may answer with
+// 206 Partial Content or 304 Not Modified. The status is passed through to
+// the worker as-is; the body of a 204, 205 or 304 response is ignored.
 type AssetsFetcher interface {
 	Fetch(req *WorkerRequest) (*WorkerResponse, error)
 }
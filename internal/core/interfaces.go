@@ -1,12 +1,40 @@
 package core
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // SourceLoader retrieves worker JS source code.
 type SourceLoader interface {
 	GetWorkerScript(siteID, deployKey string) (string, error)
 }
 
+// ContextSourceLoader is optionally implemented by a SourceLoader that can
+// honour a context and describe the script it returns. Engines use it in
+// preference to GetWorkerScript when it is available.
+type ContextSourceLoader interface {
+	LoadWorkerScript(ctx context.Context, siteID, deployKey string) (string, SourceMeta, error)
+}
+
+// SourceMeta describes a worker script returned by a ContextSourceLoader.
+type SourceMeta struct {
+	// Hash identifies the script's content. It should be HashSource of the
+	// script so that it compares equal to hashes the engine computes; when
+	// empty the engine computes it.
+	Hash string
+	// HasBytecode reports that the loader also holds compiled bytecode for
+	// this script. The engines compile from source, so it is only recorded
+	// and reported back by Engine.SourceMeta, for hosts that decide what to
+	// precompile.
+	HasBytecode bool
+	// LastModified is when the script last changed, or zero if unknown.
+	// When both the cached and the loaded script carry one, RefreshSource
+	// keeps the cached script unless the loaded one is newer; see
+	// SourceUnchanged.
+	LastModified time.Time
+}
+
 // WorkerDispatcher executes a worker (used by service bindings to dispatch
 // to other workers without a direct Engine dependency).
 type WorkerDispatcher interface {
@@ -22,6 +50,17 @@ type KVStore interface {
 	List(prefix string, limit int, cursor string) (*KVListResult, error)
 }
 
+// ContextKVStore is optionally implemented by a KVStore that needs the
+// request's context. The KV binding uses it in preference to the KVStore
+// methods.
+type ContextKVStore interface {
+	GetContext(rc RequestContext, key string) (*string, error)
+	GetWithMetadataContext(rc RequestContext, key string) (*KVValueWithMetadata, error)
+	PutContext(rc RequestContext, key, value string, metadata *string, ttl *int) error
+	DeleteContext(rc RequestContext, key string) error
+	ListContext(rc RequestContext, prefix string, limit int, cursor string) (*KVListResult, error)
+}
+
 // CacheStore backs the Cache API (site-scoped).
 type CacheStore interface {
 	Match(cacheName, url string) (*CacheEntry, error)
@@ -29,6 +68,12 @@ type CacheStore interface {
 	Delete(cacheName, url string) (bool, error)
 }
 
+// CacheNamespaceStore is optionally implemented by a CacheStore that can
+// drop every entry of a named cache, backing caches.delete(name).
+type CacheNamespaceStore interface {
+	DeleteCache(cacheName string) (bool, error)
+}
+
 // DurableObjectStore backs Durable Object storage.
 type DurableObjectStore interface {
 	Get(namespace, objectID, key string) (string, error)
@@ -53,6 +98,12 @@ type D1Store interface {
 	Close() error
 }
 
+// ContextD1Store is optionally implemented by a D1Store that needs the
+// request's context. The D1 binding uses it in preference to Exec.
+type ContextD1Store interface {
+	ExecContext(rc RequestContext, sql string, bindings []interface{}) (*D1ExecResult, error)
+}
+
 // R2Store backs R2-compatible object storage for a single bucket.
 type R2Store interface {
 	Get(key string) ([]byte, *R2Object, error)
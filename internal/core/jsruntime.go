@@ -31,6 +31,26 @@ type JSRuntime interface {
 	RunMicrotasks()
 }
 
+// PromiseRejectionTracker is an optional interface for runtimes whose engine
+// reports promise rejections to the host. QuickJS implements it with
+// JS_SetHostPromiseRejectionTracker; v8go does not expose V8's
+// SetPromiseRejectCallback, so the V8 runtime does not.
+type PromiseRejectionTracker interface {
+	// TrackPromiseRejections makes the engine call the global
+	// __hostPromiseRejection(promise, reason, handled) when a promise
+	// rejects with no handler (handled false) and when such a promise gets
+	// its first handler (handled true).
+	TrackPromiseRejections() error
+}
+
+// Interrupter is an optional interface for runtimes that can abort the
+// script currently running, e.g. when a Go callback sees a resource limit
+// crossed. QuickJS uses VM.Interrupt, V8 Isolate.TerminateExecution.
+type Interrupter interface {
+	// Interrupt makes the running script stop with an uncatchable error.
+	Interrupt()
+}
+
 // BinaryTransferer is an optional interface that JSRuntime implementations
 // can provide for efficient binary data transfer between Go and JS.
 // V8 implements this using SharedArrayBuffer; QuickJS uses direct ArrayBuffer
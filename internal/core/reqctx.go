@@ -0,0 +1,52 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// RequestContext carries a request's context and caller-supplied metadata
+// to bindings that implement one of the Context* interfaces. Only KV
+// (ContextKVStore) and D1 (ContextD1Store) receive it; R2, Durable
+// Objects, Queues and the Cache API call their stores without a context.
+type RequestContext struct {
+	// Ctx is derived from WorkerRequest.Context. While the handler runs it
+	// carries the execution deadline; during ctx.waitUntil work it is
+	// detached from the caller's cancellation and carries the waitUntil
+	// deadline instead.
+	Ctx context.Context
+
+	// Metadata holds the WorkerRequest's Metadata, such as a trace ID or
+	// tenant. It may be nil.
+	Metadata map[string]string
+}
+
+// NewRequestContext builds the RequestContext for req, bounded by deadline.
+// A nil request or one without a Context derives from context.Background().
+// The caller must call the returned cancel function when the handler
+// returns.
+func NewRequestContext(req *WorkerRequest, deadline time.Time) (RequestContext, context.CancelFunc) {
+	parent := context.Background()
+	var rc RequestContext
+	if req != nil {
+		if req.Context != nil {
+			parent = req.Context
+		}
+		rc.Metadata = req.Metadata
+	}
+	var cancel context.CancelFunc
+	rc.Ctx, cancel = context.WithDeadline(parent, deadline)
+	return rc, cancel
+}
+
+// Detach returns a copy of rc for background (ctx.waitUntil) work. The copy
+// keeps rc's values and metadata but not its cancellation or deadline, so it
+// outlives the response, and is bounded by deadline instead.
+func (rc RequestContext) Detach(deadline time.Time) (RequestContext, context.CancelFunc) {
+	parent := rc.Ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(parent), deadline)
+	return RequestContext{Ctx: ctx, Metadata: rc.Metadata}, cancel
+}
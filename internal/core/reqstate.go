@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"hash"
 	"net"
@@ -50,8 +51,20 @@ type RequestState struct {
 	NextTCPSocketID int64
 
 	// In-flight fetch cancellation: maps fetchID -> cancel function.
-	FetchCancels map[string]context.CancelFunc
-	NextFetchID  int64
+	// Fetches in keepaliveFetches are not cancelled when the request ends.
+	FetchCancels     map[string]context.CancelFunc
+	NextFetchID      int64
+	keepaliveFetches map[string]bool
+
+	// Context and metadata of the WorkerRequest, for bindings. Set with
+	// SetRequestContext; the zero value reads as context.Background().
+	reqCtx RequestContext
+
+	// Site and deploy key of the execution, recorded on every LogEntry,
+	// and the LogFormat entries are captured in. Set with SetRequestSite.
+	siteID    string
+	deployKey string
+	logFormat string
 
 	// Extension storage for webapi packages. Each package stores its own
 	// typed state using well-known string keys (e.g. "eventSources",
@@ -81,6 +94,24 @@ func (rs *RequestState) GetExt(key string) any {
 	return rs.ext[key]
 }
 
+// SetRequestContext records the context bindings receive for this request.
+func (rs *RequestState) SetRequestContext(rc RequestContext) {
+	rs.extMu.Lock()
+	rs.reqCtx = rc
+	rs.extMu.Unlock()
+}
+
+// RequestContext returns the context recorded by SetRequestContext, or one
+// with context.Background() if none was.
+func (rs *RequestState) RequestContext() RequestContext {
+	rs.extMu.Lock()
+	defer rs.extMu.Unlock()
+	if rs.reqCtx.Ctx == nil {
+		return RequestContext{Ctx: context.Background()}
+	}
+	return rs.reqCtx
+}
+
 // RegisterCleanup adds a cleanup function to be called when the request state
 // is cleared. Cleanups are called in reverse registration order.
 func (rs *RequestState) RegisterCleanup(fn func()) {
@@ -104,6 +135,19 @@ func NewRequestState(maxFetches int, env *Env) uint64 {
 	return id
 }
 
+// SetRequestSite records the site and deploy key that logs captured for the
+// request identified by id are tagged with, and the LogFormat they are
+// captured in.
+func SetRequestSite(id uint64, siteID, deployKey, logFormat string) {
+	if state := GetRequestState(id); state != nil {
+		state.extMu.Lock()
+		state.siteID = siteID
+		state.deployKey = deployKey
+		state.logFormat = logFormat
+		state.extMu.Unlock()
+	}
+}
+
 // GetRequestState returns the state for the given request ID, or nil.
 func GetRequestState(id uint64) *RequestState {
 	v, ok := requestStates.Load(id)
@@ -139,11 +183,14 @@ func ClearRequestState(id uint64) *RequestState {
 	}
 	state.TcpSockets = nil
 
-	// Cancel in-flight fetches.
-	for _, cancel := range state.FetchCancels {
-		cancel()
+	// Cancel in-flight fetches, except keepalive ones.
+	for id, cancel := range state.FetchCancels {
+		if !state.keepaliveFetches[id] {
+			cancel()
+		}
 	}
 	state.FetchCancels = nil
+	state.keepaliveFetches = nil
 
 	return state
 }
@@ -202,11 +249,33 @@ func AddLog(id uint64, level, message string) {
 	if len(message) > MaxLogMessageSize {
 		message = message[:MaxLogMessageSize] + "...(truncated)"
 	}
-	state.Logs = append(state.Logs, LogEntry{
-		Level:   level,
-		Message: message,
-		Time:    time.Now(),
-	})
+	state.extMu.Lock()
+	siteID, deployKey, format := state.siteID, state.deployKey, state.logFormat
+	state.extMu.Unlock()
+	entry := LogEntry{
+		Level:     level,
+		Message:   message,
+		Time:      time.Now(),
+		SiteID:    siteID,
+		DeployKey: deployKey,
+	}
+	if format == LogFormatJSON {
+		if data, err := json.Marshal(entry); err == nil {
+			entry.Message = string(data)
+		}
+	}
+	state.Logs = append(state.Logs, entry)
+}
+
+// NewFetchID allocates a fetchID for a request without registering a cancel
+// function, for fetches that settle without going to the network.
+func NewFetchID(reqID uint64) string {
+	state := GetRequestState(reqID)
+	if state == nil {
+		return ""
+	}
+	state.NextFetchID++
+	return strconv.FormatInt(state.NextFetchID, 10)
 }
 
 // RegisterFetchCancel stores a cancel function for an in-flight fetch and
@@ -216,8 +285,7 @@ func RegisterFetchCancel(reqID uint64, cancel context.CancelFunc) string {
 	if state == nil {
 		return ""
 	}
-	state.NextFetchID++
-	id := strconv.FormatInt(state.NextFetchID, 10)
+	id := NewFetchID(reqID)
 	if state.FetchCancels == nil {
 		state.FetchCancels = make(map[string]context.CancelFunc)
 	}
@@ -225,6 +293,20 @@ func RegisterFetchCancel(reqID uint64, cancel context.CancelFunc) string {
 	return id
 }
 
+// KeepFetchAlive exempts a fetch from cancellation when its request ends, so
+// a keepalive fetch can finish after the response is sent. It can still be
+// aborted while the request runs.
+func KeepFetchAlive(reqID uint64, fetchID string) {
+	state := GetRequestState(reqID)
+	if state == nil {
+		return
+	}
+	if state.keepaliveFetches == nil {
+		state.keepaliveFetches = make(map[string]bool)
+	}
+	state.keepaliveFetches[fetchID] = true
+}
+
 // RemoveFetchCancel removes and returns the cancel function for a fetch.
 func RemoveFetchCancel(reqID uint64, fetchID string) context.CancelFunc {
 	state := GetRequestState(reqID)
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashSource returns the hex-encoded SHA-256 of a worker script. Engines
+// record it for every cached source so callers can use it as a
+// content-addressed deploy key.
+func HashSource(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadSource fetches a worker script through loader, using
+// LoadWorkerScript when the loader implements ContextSourceLoader and
+// GetWorkerScript otherwise. The returned metadata always carries a hash.
+func LoadSource(ctx context.Context, loader SourceLoader, siteID, deployKey string) (string, SourceMeta, error) {
+	if cl, ok := loader.(ContextSourceLoader); ok {
+		source, meta, err := cl.LoadWorkerScript(ctx, siteID, deployKey)
+		if err != nil {
+			return "", SourceMeta{}, err
+		}
+		if meta.Hash == "" {
+			meta.Hash = HashSource(source)
+		}
+		return source, meta, nil
+	}
+	source, err := loader.GetWorkerScript(siteID, deployKey)
+	if err != nil {
+		return "", SourceMeta{}, err
+	}
+	return source, SourceMeta{Hash: HashSource(source)}, nil
+}
+
+// SourceUnchanged reports whether a freshly loaded script described by
+// loaded can be skipped in favour of the cached one described by cached:
+// their hashes match, or both carry a LastModified and loaded is not newer.
+// The second case keeps a loader that briefly serves a stale copy from
+// rolling a deploy back.
+func SourceUnchanged(cached, loaded SourceMeta) bool {
+	if cached.Hash == loaded.Hash {
+		return true
+	}
+	if cached.LastModified.IsZero() || loaded.LastModified.IsZero() {
+		return false
+	}
+	return !loaded.LastModified.After(cached.LastModified)
+}
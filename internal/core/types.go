@@ -20,12 +20,24 @@ type WorkerRequest struct {
 	URL     string
 	Headers map[string]string
 	Body    []byte
+
+	// Context and Metadata are optional. Bindings that implement a
+	// Context* interface, such as ContextKVStore, receive them as a
+	// RequestContext for per-request auth, tracing and deadlines.
+	Context  context.Context
+	Metadata map[string]string
 }
 
 // WorkerResponse represents the HTTP response from a worker.
 type WorkerResponse struct {
-	StatusCode   int
-	Headers      map[string]string
+	StatusCode int
+	Headers    map[string]string // repeated values joined with ", "
+
+	// HeaderList holds every header as a (name, value) pair in the order the
+	// worker added them. Repeated headers such as Set-Cookie appear once per
+	// value instead of being joined as in Headers.
+	HeaderList [][2]string
+
 	Body         []byte
 	HasWebSocket bool // true when status is 101 and webSocket was set
 }
@@ -36,17 +48,42 @@ type WorkerResult struct {
 	Logs      []LogEntry
 	Error     error
 	Duration  time.Duration
+	CPUTime   time.Duration // CPU time spent running the handler; 0 where unsupported
 	WebSocket WebSocketBridger // engine-specific WebSocket handler
 	Data      string // JSON-serialized return value from ExecuteFunction
+
+	// WaitUntil is set when a fetch handler registered ctx.waitUntil()
+	// promises. The response is returned as soon as the handler resolves;
+	// the promises keep running afterwards and the channel delivers exactly
+	// one WaitUntilResult once they settle or WaitUntilTimeout passes.
+	WaitUntil <-chan WaitUntilResult
+}
+
+// WaitUntilResult reports how the ctx.waitUntil() promises of a fetch
+// execution finished after its response was returned.
+type WaitUntilResult struct {
+	Logs     []LogEntry    // console output produced after the response
+	Error    error         // rejected promises, the background timeout or a panic
+	Duration time.Duration // time spent settling the promises
 }
 
-// LogEntry is a single console.log/warn/error captured from a worker.
+// LogEntry is a single console.log/warn/error captured from a worker,
+// tagged with the site and deploy key that produced it. It encodes to a
+// structured JSON record for log aggregation; see LogFormatJSON.
 type LogEntry struct {
-	Level   string    `json:"level"`
-	Message string    `json:"message"`
-	Time    time.Time `json:"time"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+	SiteID    string    `json:"siteId,omitempty"`
+	DeployKey string    `json:"deployKey,omitempty"`
 }
 
+// Log formats accepted by EngineConfig.LogFormat.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
 // TailEvent represents a log event forwarded to a tail worker.
 type TailEvent struct {
 	ScriptName string     `json:"scriptName"`
@@ -55,3 +92,14 @@ type TailEvent struct {
 	Outcome    string     `json:"outcome"`
 	Timestamp  time.Time  `json:"timestamp"`
 }
+
+// PoolStats is a point-in-time snapshot of one site's worker pool.
+type PoolStats struct {
+	SiteID    string
+	DeployKey string
+	Size      int           // configured number of workers
+	Live      int           // workers allocated, including extras created under load
+	InUse     int           // workers currently checked out
+	Gets      uint64        // total workers acquired from the pool
+	AvgWait   time.Duration // mean time spent waiting to acquire a worker
+}
@@ -12,13 +12,14 @@ import (
 // The fetch goroutine reads the response body, serializes headers, and encodes
 // the body as base64 before sending — so the event loop only passes strings to JS.
 type FetchResult struct {
-	Status      int
-	StatusText  string
-	HeadersJSON string
-	BodyB64     string
-	Redirected  bool
-	FinalURL    string
-	Err         error
+	Status       int
+	StatusText   string
+	HeadersJSON  string
+	BodyB64      string
+	Redirected   bool
+	FinalURL     string
+	TrailersJSON string // JSON object of response trailers; empty if none
+	Err          error
 }
 
 // PendingFetch represents an in-flight HTTP request whose result will be
@@ -36,6 +37,7 @@ type timerEntry struct {
 	interval time.Duration // 0 for setTimeout, >0 for setInterval
 	id       int
 	cleared  bool
+	internal bool // scheduled by a runtime API rather than the worker
 }
 
 // EventLoop manages Go-backed timers for setTimeout/setInterval and
@@ -46,25 +48,73 @@ type EventLoop struct {
 	timers         map[int]*timerEntry
 	nextID         int
 	pendingFetches []*PendingFetch
+	maxTimers      int
+	userTimers     int   // pending timers scheduled by setTimeout/setInterval
+	internalTimers int   // pending timers scheduled by runtime APIs
+	err            error // set once a resource limit is exceeded
+	rejections     bool  // promise rejections await the next checkpoint
+	cpu            *core.CPUTimer
 }
 
+// DefaultMaxTimers is the number of timers that may be pending at once when
+// EngineConfig.MaxPendingTimers is unset.
+const DefaultMaxTimers = 10000
+
 // New creates a new EventLoop.
 func New() *EventLoop {
 	return &EventLoop{
-		timers: make(map[int]*timerEntry),
+		timers:    make(map[int]*timerEntry),
+		maxTimers: DefaultMaxTimers,
+	}
+}
+
+// SetMaxTimers sets how many timers may be pending at once; n <= 0 restores
+// DefaultMaxTimers.
+func (el *EventLoop) SetMaxTimers(n int) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if n <= 0 {
+		n = DefaultMaxTimers
 	}
+	el.maxTimers = n
 }
 
 // RegisterTimer creates a timer entry and returns its ID.
 // The actual JS callback is stored in globalThis.__timerCallbacks[id].
-func (el *EventLoop) RegisterTimer(delay time.Duration, isInterval bool) int {
+// Exceeding the pending timer cap fails the registration and marks the
+// loop as failed; see Err.
+func (el *EventLoop) RegisterTimer(delay time.Duration, isInterval bool) (int, error) {
+	return el.registerTimer(delay, isInterval, false)
+}
+
+// RegisterInternalTimer creates a one-shot timer for a runtime API such as
+// AbortSignal.timeout() or scheduler.wait(). Internal timers do not count
+// against the worker's setTimeout/setInterval cap; they are capped
+// separately at DefaultMaxTimers.
+func (el *EventLoop) RegisterInternalTimer(delay time.Duration) (int, error) {
+	return el.registerTimer(delay, false, true)
+}
+
+func (el *EventLoop) registerTimer(delay time.Duration, isInterval, internal bool) (int, error) {
 	el.mu.Lock()
 	defer el.mu.Unlock()
+	count, limit := &el.userTimers, el.maxTimers
+	if internal {
+		count, limit = &el.internalTimers, DefaultMaxTimers
+	}
+	if *count >= limit {
+		if el.err == nil {
+			el.err = fmt.Errorf("exceeded maximum pending timers (%d)", limit)
+		}
+		return 0, el.err
+	}
+	*count++
 	el.nextID++
 	id := el.nextID
 	entry := &timerEntry{
 		deadline: time.Now().Add(delay),
 		id:       id,
+		internal: internal,
 	}
 	if isInterval {
 		if delay < 10*time.Millisecond {
@@ -73,7 +123,25 @@ func (el *EventLoop) RegisterTimer(delay time.Duration, isInterval bool) int {
 		entry.interval = delay
 	}
 	el.timers[id] = entry
-	return id
+	return id, nil
+}
+
+// Err returns the resource limit error that terminated the loop, if any.
+// Once set, Drain stops running tasks.
+func (el *EventLoop) Err() error {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	return el.err
+}
+
+// Fail marks the loop as failed by a resource limit enforced outside the
+// loop; see Err. The first failure wins.
+func (el *EventLoop) Fail(err error) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if el.err == nil {
+		el.err = err
+	}
 }
 
 // ClearTimer cancels a timer by ID.
@@ -82,10 +150,44 @@ func (el *EventLoop) ClearTimer(id int) {
 	defer el.mu.Unlock()
 	if t, ok := el.timers[id]; ok {
 		t.cleared = true
-		delete(el.timers, id)
+		el.removeTimer(t)
 	}
 }
 
+// removeTimer drops t from the pending set. el.mu must be held.
+func (el *EventLoop) removeTimer(t *timerEntry) {
+	delete(el.timers, t.id)
+	if t.internal {
+		el.internalTimers--
+	} else {
+		el.userTimers--
+	}
+}
+
+// NotePendingRejection records that a promise rejected without a handler,
+// so the next microtask checkpoint reports it; see Checkpoint.
+func (el *EventLoop) NotePendingRejection() {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.rejections = true
+}
+
+// Checkpoint performs a microtask checkpoint: it drains the microtask queue
+// and then, as the HTML event loop does, dispatches "unhandledrejection" for
+// promises that rejected since the last checkpoint and are still unhandled.
+func (el *EventLoop) Checkpoint(rt core.JSRuntime) {
+	rt.RunMicrotasks()
+	el.mu.Lock()
+	pending := el.rejections
+	el.rejections = false
+	el.mu.Unlock()
+	if !pending {
+		return
+	}
+	_ = rt.Eval(`if (typeof globalThis.__dispatchRejections === 'function') globalThis.__dispatchRejections();`)
+	rt.RunMicrotasks()
+}
+
 // AddPendingFetch registers a pending fetch whose result will be delivered
 // to JS when the HTTP response arrives.
 func (el *EventLoop) AddPendingFetch(pf *PendingFetch) {
@@ -118,14 +220,14 @@ func (el *EventLoop) DrainPendingFetches(rt core.JSRuntime) bool {
 					pf.FetchID, result.Err.Error())
 				_ = rt.Eval(js)
 			} else {
-				js := fmt.Sprintf(`globalThis.__fetchResolve(%q, %d, %q, %q, %q, %v, %q)`,
+				js := fmt.Sprintf(`globalThis.__fetchResolve(%q, %d, %q, %q, %q, %v, %q, %q)`,
 					pf.FetchID, result.Status, result.StatusText,
 					result.HeadersJSON, result.BodyB64,
-					result.Redirected, result.FinalURL)
+					result.Redirected, result.FinalURL, result.TrailersJSON)
 				_ = rt.Eval(js)
 			}
 			// Microtask checkpoint after each fetch resolution.
-			rt.RunMicrotasks()
+			el.Checkpoint(rt)
 			didWork = true
 		default:
 			remaining = append(remaining, pf)
@@ -141,21 +243,35 @@ func (el *EventLoop) DrainPendingFetches(rt core.JSRuntime) bool {
 }
 
 // fireTimer fires a timer callback by invoking the JS-side callback map.
+// An exception escaping the callback is reported as a global "error" event.
 func (el *EventLoop) fireTimer(rt core.JSRuntime, id int) {
 	js := fmt.Sprintf(`(function() {
 		var entry = globalThis.__timerCallbacks[%d];
 		if (!entry) return;
 		if (!entry.interval) delete globalThis.__timerCallbacks[%d];
-		entry.fn.apply(null, entry.args || []);
+		try {
+			entry.fn.apply(null, entry.args || []);
+		} catch (e) {
+			if (typeof globalThis.reportError === 'function') globalThis.reportError(e);
+		}
 	})()`, id, id)
 	_ = rt.Eval(js)
 }
 
 // Drain fires all pending timers and resolves pending fetches until none remain
-// or the deadline is reached.
+// or the deadline is reached. As in the HTML event loop, the microtask queue
+// is fully drained before each task (timer callback or fetch resolution) is
+// picked, so promise continuations queued earlier always run first.
 // Must be called on the runtime's goroutine (JS engines are single-threaded).
 func (el *EventLoop) Drain(rt core.JSRuntime, deadline time.Time) {
 	for {
+		if el.Err() != nil {
+			return
+		}
+
+		// Microtask checkpoint before choosing the next task.
+		el.Checkpoint(rt)
+
 		// Always try to drain pending fetches first.
 		if el.DrainPendingFetches(rt) {
 			continue
@@ -192,7 +308,7 @@ func (el *EventLoop) Drain(rt core.JSRuntime, deadline time.Time) {
 			if time.Now().After(deadline) {
 				return
 			}
-			time.Sleep(1 * time.Millisecond)
+			el.sleep(1 * time.Millisecond)
 			continue
 		}
 
@@ -209,7 +325,7 @@ func (el *EventLoop) Drain(rt core.JSRuntime, deadline time.Time) {
 						if next.cleared {
 							break
 						}
-						time.Sleep(1 * time.Millisecond)
+						el.sleep(1 * time.Millisecond)
 					}
 				}
 				return
@@ -230,10 +346,10 @@ func (el *EventLoop) Drain(rt core.JSRuntime, deadline time.Time) {
 					if remaining > 1*time.Millisecond {
 						remaining = 1 * time.Millisecond
 					}
-					time.Sleep(remaining)
+					el.sleep(remaining)
 				}
 			} else {
-				time.Sleep(wait)
+				el.sleep(wait)
 			}
 		}
 
@@ -251,15 +367,34 @@ func (el *EventLoop) Drain(rt core.JSRuntime, deadline time.Time) {
 		if next.interval > 0 {
 			next.deadline = time.Now().Add(next.interval)
 		} else {
-			delete(el.timers, next.id)
+			el.removeTimer(next)
 		}
 		el.mu.Unlock()
 
 		el.fireTimer(rt, timerID)
-		rt.RunMicrotasks()
+		el.Checkpoint(rt)
 	}
 }
 
+// SetCPUTimer makes the loop pause t while it waits for timers or fetches,
+// so only time spent running JavaScript is measured and the OS thread is
+// not held while idle. Reset clears it.
+func (el *EventLoop) SetCPUTimer(t *core.CPUTimer) {
+	el.mu.Lock()
+	el.cpu = t
+	el.mu.Unlock()
+}
+
+// sleep waits for d with the CPU timer paused.
+func (el *EventLoop) sleep(d time.Duration) {
+	el.mu.Lock()
+	cpu := el.cpu
+	el.mu.Unlock()
+	cpu.Pause()
+	time.Sleep(d)
+	cpu.Resume()
+}
+
 // HasPending returns true if there are any active timers or pending fetches.
 func (el *EventLoop) HasPending() bool {
 	el.mu.Lock()
@@ -273,6 +408,11 @@ func (el *EventLoop) Reset() {
 	el.mu.Lock()
 	defer el.mu.Unlock()
 	el.timers = make(map[int]*timerEntry)
+	el.userTimers = 0
+	el.internalTimers = 0
 	el.nextID = 0
 	el.pendingFetches = nil
+	el.err = nil
+	el.rejections = false
+	el.cpu = nil
 }
@@ -3,10 +3,13 @@
 package quickjs
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"runtime"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -27,9 +30,17 @@ type poolKey struct {
 	DeployKey string
 }
 
-// sitePool wraps a qjsPool with an invalidation flag.
+// cachedSource is a worker script together with its metadata.
+type cachedSource struct {
+	source string
+	meta   core.SourceMeta
+}
+
+// sitePool wraps a qjsPool with an invalidation flag and the hash of the
+// source its workers were loaded with.
 type sitePool struct {
 	pool    *qjsPool
+	hash    string
 	invalid bool
 	mu      sync.RWMutex
 }
@@ -54,14 +65,19 @@ type Engine struct {
 	config       core.EngineConfig
 	sourceLoader core.SourceLoader
 	poolMu       sync.Mutex
+	rsaKeys      *webapi.RSAKeyPool // nil unless RSAKeyPoolSize > 0
 }
 
 // NewEngine creates an Engine with the given configuration and source loader.
 func NewEngine(cfg core.EngineConfig, sourceLoader core.SourceLoader) *Engine {
-	return &Engine{
+	e := &Engine{
 		config:       cfg,
 		sourceLoader: sourceLoader,
 	}
+	if cfg.RSAKeyPoolSize > 0 {
+		e.rsaKeys = webapi.NewRSAKeyPool(cfg.RSAKeyPoolSize, 2048)
+	}
+	return e
 }
 
 // SetDispatcher sets the worker dispatcher for service binding support.
@@ -81,15 +97,57 @@ func (e *Engine) EnsureSource(siteID string, deployKey string) error {
 		return fmt.Errorf("source loader not set")
 	}
 
-	source, err := e.sourceLoader.GetWorkerScript(siteID, deployKey)
+	source, meta, err := core.LoadSource(context.Background(), e.sourceLoader, siteID, deployKey)
 	if err != nil {
 		return fmt.Errorf("no source for site %s deploy %s: %w", siteID, deployKey, err)
 	}
 
-	e.sources.Store(key, source)
+	e.sources.Store(key, cachedSource{source: source, meta: meta})
 	return nil
 }
 
+// RefreshSource asks the source loader for the current script. When
+// core.SourceUnchanged finds it matches the cached source nothing changes
+// and the existing pool keeps serving; otherwise the new source is cached
+// and the pool is rebuilt on next use. It reports whether the source
+// changed.
+func (e *Engine) RefreshSource(ctx context.Context, siteID string, deployKey string) (bool, error) {
+	if e.sourceLoader == nil {
+		return false, fmt.Errorf("source loader not set")
+	}
+	source, meta, err := core.LoadSource(ctx, e.sourceLoader, siteID, deployKey)
+	if err != nil {
+		return false, fmt.Errorf("no source for site %s deploy %s: %w", siteID, deployKey, err)
+	}
+
+	key := poolKey{SiteID: siteID, DeployKey: deployKey}
+	if val, ok := e.sources.Load(key); ok && core.SourceUnchanged(val.(cachedSource).meta, meta) {
+		return false, nil
+	}
+	e.sources.Store(key, cachedSource{source: source, meta: meta})
+	return true, nil
+}
+
+// Warm loads the source for the given site/deploy and builds its pool, so
+// every worker has evaluated the module before the first request arrives.
+func (e *Engine) Warm(siteID string, deployKey string) error {
+	if err := e.EnsureSource(siteID, deployKey); err != nil {
+		return err
+	}
+	_, err := e.getOrCreatePool(siteID, deployKey)
+	return err
+}
+
+// SourceMeta returns the metadata of the cached source for the given
+// site/deploy, or false if no source is cached.
+func (e *Engine) SourceMeta(siteID string, deployKey string) (core.SourceMeta, bool) {
+	val, ok := e.sources.Load(poolKey{SiteID: siteID, DeployKey: deployKey})
+	if !ok {
+		return core.SourceMeta{}, false
+	}
+	return val.(cachedSource).meta, true
+}
+
 // CompileAndCache validates that a worker script compiles and stores the source.
 func (e *Engine) CompileAndCache(siteID string, deployKey string, source string) ([]byte, error) {
 	key := poolKey{SiteID: siteID, DeployKey: deployKey}
@@ -104,7 +162,7 @@ func (e *Engine) CompileAndCache(siteID string, deployKey string, source string)
 	// don't fail — QuickJS has no compile-only API, so EvalValue executes the script.
 	rt := &qjsRuntime{vm: vm}
 	el := eventloop.New()
-	for _, setup := range buildSetupFuncs(e.config) {
+	for _, setup := range buildSetupFuncs(e.config, e.rsaKeys) {
 		if err := setup(rt, el); err != nil {
 			return nil, fmt.Errorf("validation setup: %w", err)
 		}
@@ -123,17 +181,25 @@ func (e *Engine) CompileAndCache(siteID string, deployKey string, source string)
 	if val, ok := e.pools.Load(key); ok {
 		val.(*sitePool).markInvalid()
 	}
-	e.sources.Store(key, source)
+	e.sources.Store(key, cachedSource{source: source, meta: core.SourceMeta{Hash: core.HashSource(source)}})
 	return []byte(source), nil
 }
 
 // getOrCreatePool returns the worker pool for the given site/deploy.
+//
+// A pool whose workers were loaded from a source other than the one now
+// cached is rebuilt, even if it was never marked invalid; this covers a
+// pool created from the old source while CompileAndCache was replacing it.
 func (e *Engine) getOrCreatePool(siteID string, deployKey string) (*qjsPool, error) {
 	key := poolKey{SiteID: siteID, DeployKey: deployKey}
 
+	srcVal, ok := e.sources.Load(key)
+	if !ok {
+		return nil, fmt.Errorf("no source for site %s deploy %s", siteID, deployKey)
+	}
 	if val, ok := e.pools.Load(key); ok {
 		sp := val.(*sitePool)
-		if sp.isValid() {
+		if sp.isValid() && sp.hash == srcVal.(cachedSource).meta.Hash {
 			return sp.pool, nil
 		}
 	}
@@ -141,29 +207,30 @@ func (e *Engine) getOrCreatePool(siteID string, deployKey string) (*qjsPool, err
 	e.poolMu.Lock()
 	defer e.poolMu.Unlock()
 
+	if srcVal, ok = e.sources.Load(key); !ok {
+		return nil, fmt.Errorf("no source for site %s deploy %s", siteID, deployKey)
+	}
+	cached := srcVal.(cachedSource)
+	source := cached.source
+
 	if val, ok := e.pools.Load(key); ok {
 		sp := val.(*sitePool)
-		if sp.isValid() {
+		if sp.isValid() && sp.hash == cached.meta.Hash {
 			return sp.pool, nil
 		}
 		e.pools.Delete(key)
 		sp.pool.dispose()
 	}
 
-	srcVal, ok := e.sources.Load(key)
-	if !ok {
-		return nil, fmt.Errorf("no source for site %s deploy %s", siteID, deployKey)
-	}
-	source := srcVal.(string)
-
-	setupFns := buildSetupFuncs(e.config)
+	setupFns := buildSetupFuncs(e.config, e.rsaKeys)
 
-	pool, err := newQJSPool(e.config.PoolSize, source, setupFns, e.config.MemoryLimitMB)
+	idleTTL := time.Duration(e.config.PoolIdleTimeout) * time.Millisecond
+	pool, err := newQJSPool(e.config.PoolSize, source, setupFns, e.config.MemoryLimitMB, e.config.MaxPoolSize, idleTTL)
 	if err != nil {
 		return nil, fmt.Errorf("creating worker pool: %w", err)
 	}
 
-	sp := &sitePool{pool: pool}
+	sp := &sitePool{pool: pool, hash: cached.meta.Hash}
 	e.pools.Store(key, sp)
 	return pool, nil
 }
@@ -179,6 +246,18 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 		return result
 	}
 
+	if err := webapi.CheckRequestBodySize(req, e.config.MaxRequestBytes); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	if err := webapi.CheckRequestHeaders(req, e.config.MaxHeaderCount, e.config.MaxHeaderBytes); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
 	env.InitRuntime(e, siteID)
 
 	if err := e.EnsureSource(siteID, deployKey); err != nil {
@@ -201,6 +280,9 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 		return result
 	}
 
+	cpu := core.StartCPUTimer()
+	w.eventLoop.SetCPUTimer(cpu)
+
 	var keepWorker bool
 	var timedOut atomic.Bool
 	var vmMu sync.Mutex
@@ -223,14 +305,18 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 				result.Error = fmt.Errorf("worker panic: %v", r)
 			}
 		}
+		result.CPUTime = cpu.Stop()
 		result.Duration = time.Since(start)
 		if keepWorker {
 			return
 		}
-		if stopped && !timedOut.Load() && !panicked {
+		// An error return can leave ctx.waitUntil promises and their
+		// timers behind; they must not run during the next request. A
+		// runtime interrupted by a resource limit is not reused either.
+		if stopped && !timedOut.Load() && !panicked && w.eventLoop.Err() == nil && !webapi.HasWaitUntil(w.rt) {
 			pool.put(w)
 		} else {
-			log.Printf("worker: discarding worker for site %s deploy %s (timed out or panicked)", siteID, deployKey)
+			log.Printf("worker: discarding worker for site %s deploy %s (timed out, panicked, hit a resource limit or left waitUntil work pending)", siteID, deployKey)
 			vmMu.Lock()
 			w.vm.Close()
 			vmMu.Unlock()
@@ -246,6 +332,11 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 
 	// Set up per-request state.
 	reqID := core.NewRequestState(e.config.MaxFetchRequests, env)
+	core.SetRequestSite(reqID, siteID, deployKey, e.config.LogFormat)
+	// Bindings see the caller's context bounded by the execution deadline.
+	rc, cancelCtx := core.NewRequestContext(req, start.Add(timeout))
+	defer cancelCtx()
+	core.GetRequestState(reqID).SetRequestContext(rc)
 	if err := rt.SetGlobal("__requestID", strconv.FormatUint(reqID, 10)); err != nil {
 		core.ClearRequestState(reqID)
 		result.Error = fmt.Errorf("setting request ID: %w", err)
@@ -284,7 +375,7 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 			if (!mod || typeof mod.fetch !== 'function') {
 				throw new Error('worker module has no fetch handler');
 			}
-			return mod.fetch(globalThis.__req, globalThis.__env, globalThis.__ctx);
+			return __callHandler(function() { return mod.fetch(globalThis.__req, globalThis.__env, globalThis.__ctx); });
 		})()
 	`, quickjs.EvalGlobal)
 	if err != nil {
@@ -294,6 +385,8 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 		}
 		if timedOut.Load() {
 			result.Error = fmt.Errorf("worker execution timed out (limit: %v)", timeout)
+		} else if limitErr := w.eventLoop.Err(); limitErr != nil {
+			result.Error = limitErr
 		} else {
 			result.Error = fmt.Errorf("invoking worker fetch: %w", err)
 		}
@@ -314,7 +407,9 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 	rt.RunMicrotasks()
 
 	deadline := start.Add(timeout)
-	if w.eventLoop.HasPending() {
+	// With waitUntil work registered, only pump the loop until the
+	// response settles; the rest runs after the response is returned.
+	if w.eventLoop.HasPending() && !webapi.HasWaitUntil(rt) {
 		w.eventLoop.Drain(rt, deadline)
 	}
 
@@ -323,12 +418,21 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 		if state != nil {
 			result.Logs = state.Logs
 		}
-		result.Error = fmt.Errorf("awaiting worker response: %w", err)
+		result.Error = awaitError(err, timeout, &timedOut, "awaiting worker response")
 		return result
 	}
 
 	_ = rt.Eval("globalThis.__result = globalThis.__call_result; delete globalThis.__call_result;")
 
+	if err := webapi.DrainResponseStream(rt, deadline, w.eventLoop, e.config.MaxResponseBytes); err != nil {
+		state := core.ClearRequestState(reqID)
+		if state != nil {
+			result.Logs = state.Logs
+		}
+		result.Error = awaitError(err, timeout, &timedOut, "reading worker response body")
+		return result
+	}
+
 	resp, err := webapi.JsResponseToGo(rt)
 	if err != nil {
 		state := core.ClearRequestState(reqID)
@@ -339,10 +443,36 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 		return result
 	}
 
-	webapi.DrainWaitUntil(rt, deadline)
+	if err := webapi.CheckResponseBodySize(resp, e.config.MaxResponseBytes); err != nil {
+		state := core.ClearRequestState(reqID)
+		if state != nil {
+			result.Logs = state.Logs
+		}
+		result.Error = err
+		return result
+	}
+
+	if err := webapi.CheckResponseHeaders(resp, e.config.MaxHeaderCount, e.config.MaxHeaderBytes); err != nil {
+		state := core.ClearRequestState(reqID)
+		if state != nil {
+			result.Logs = state.Logs
+		}
+		result.Error = err
+		return result
+	}
+
+	if err := webapi.CheckAllocationLimit(core.GetRequestState(reqID), e.config.MaxAllocationBytes); err != nil {
+		state := core.ClearRequestState(reqID)
+		if state != nil {
+			result.Logs = state.Logs
+		}
+		result.Error = err
+		return result
+	}
 
 	// WebSocket upgrade handling.
 	if resp.HasWebSocket && resp.StatusCode == 101 {
+		webapi.DrainWaitUntil(rt, deadline)
 		_ = rt.Eval(`
 			if (globalThis.__ws_check_resp && globalThis.__ws_check_resp._peer) {
 				globalThis.__ws_active_server = globalThis.__ws_check_resp._peer;
@@ -370,6 +500,20 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 		return result
 	}
 
+	// The response is ready: hand it back now and let the waitUntil
+	// promises finish on the worker in the background.
+	if webapi.HasWaitUntil(rt) {
+		var logOffset int
+		if state := core.GetRequestState(reqID); state != nil {
+			result.Logs = append([]core.LogEntry(nil), state.Logs...)
+			logOffset = len(state.Logs)
+		}
+		keepWorker = true
+		result.Response = resp
+		result.WaitUntil = e.awaitWaitUntil(pool, w, siteID, deployKey, reqID, logOffset)
+		return result
+	}
+
 	state := core.ClearRequestState(reqID)
 	if state != nil {
 		result.Logs = state.Logs
@@ -378,8 +522,9 @@ func (e *Engine) Execute(siteID string, deployKey string, env *core.Env, req *co
 	return result
 }
 
-// ExecuteScheduled runs the worker's scheduled handler.
-func (e *Engine) ExecuteScheduled(siteID string, deployKey string, env *core.Env, cron string) (result *core.WorkerResult) {
+// ExecuteScheduled runs the worker's scheduled handler. cf, which may be
+// nil, becomes the event's cf object.
+func (e *Engine) ExecuteScheduled(siteID string, deployKey string, env *core.Env, cron string, cf map[string]any) (result *core.WorkerResult) {
 	start := time.Now()
 	result = &core.WorkerResult{}
 
@@ -411,6 +556,9 @@ func (e *Engine) ExecuteScheduled(siteID string, deployKey string, env *core.Env
 		return result
 	}
 
+	cpu := core.StartCPUTimer()
+	w.eventLoop.SetCPUTimer(cpu)
+
 	var timedOut atomic.Bool
 	var vmMu sync.Mutex
 	timeout := time.Duration(e.config.ExecutionTimeout) * time.Millisecond
@@ -432,11 +580,12 @@ func (e *Engine) ExecuteScheduled(siteID string, deployKey string, env *core.Env
 				result.Error = fmt.Errorf("worker panic: %v", r)
 			}
 		}
+		result.CPUTime = cpu.Stop()
 		result.Duration = time.Since(start)
-		if stopped && !timedOut.Load() && !panicked {
+		if stopped && !timedOut.Load() && !panicked && w.eventLoop.Err() == nil && !webapi.HasWaitUntil(w.rt) {
 			pool.put(w)
 		} else {
-			log.Printf("worker: discarding scheduled worker for site %s deploy %s (timed out or panicked)", siteID, deployKey)
+			log.Printf("worker: discarding scheduled worker for site %s deploy %s (timed out, panicked, hit a resource limit or left waitUntil work pending)", siteID, deployKey)
 			vmMu.Lock()
 			w.vm.Close()
 			vmMu.Unlock()
@@ -451,10 +600,17 @@ func (e *Engine) ExecuteScheduled(siteID string, deployKey string, env *core.Env
 	rt := w.rt
 
 	reqID := core.NewRequestState(e.config.MaxFetchRequests, env)
+	core.SetRequestSite(reqID, siteID, deployKey, e.config.LogFormat)
 	_ = rt.SetGlobal("__requestID", strconv.FormatUint(reqID, 10))
 
+	cfJSON, err := json.Marshal(cf)
+	if err != nil {
+		core.ClearRequestState(reqID)
+		result.Error = fmt.Errorf("encoding scheduled event cf: %w", err)
+		return result
+	}
 	scheduledTimeMs := float64(time.Now().UnixMilli())
-	eventScript := fmt.Sprintf(`globalThis.__sched_event = new ScheduledEvent(%f, %q)`, scheduledTimeMs, cron)
+	eventScript := fmt.Sprintf(`globalThis.__sched_event = new ScheduledEvent(%f, %q, %s)`, scheduledTimeMs, cron, cfJSON)
 	if err := rt.Eval(eventScript); err != nil {
 		core.ClearRequestState(reqID)
 		result.Error = fmt.Errorf("creating ScheduledEvent: %w", err)
@@ -485,7 +641,7 @@ func (e *Engine) ExecuteScheduled(siteID string, deployKey string, env *core.Env
 			if (!mod || typeof mod.scheduled !== 'function') {
 				throw new Error('worker module has no scheduled handler');
 			}
-			return mod.scheduled(globalThis.__sched_event, globalThis.__env, globalThis.__ctx);
+			return __callHandler(function() { return mod.scheduled(globalThis.__sched_event, globalThis.__env, globalThis.__ctx); });
 		})()
 	`, quickjs.EvalGlobal)
 	if err != nil {
@@ -493,7 +649,11 @@ func (e *Engine) ExecuteScheduled(siteID string, deployKey string, env *core.Env
 		if state != nil {
 			result.Logs = state.Logs
 		}
-		result.Error = fmt.Errorf("invoking worker scheduled: %w", err)
+		if limitErr := w.eventLoop.Err(); limitErr != nil {
+			result.Error = limitErr
+		} else {
+			result.Error = fmt.Errorf("invoking worker scheduled: %w", err)
+		}
 		return result
 	}
 	if err := rt.SetGlobal("__call_result", callResult); err == nil {
@@ -513,7 +673,7 @@ func (e *Engine) ExecuteScheduled(siteID string, deployKey string, env *core.Env
 			if state != nil {
 				result.Logs = state.Logs
 			}
-			result.Error = fmt.Errorf("awaiting scheduled handler: %w", err)
+			result.Error = awaitError(err, timeout, &timedOut, "awaiting scheduled handler")
 			return result
 		}
 	}
@@ -526,6 +686,7 @@ func (e *Engine) ExecuteScheduled(siteID string, deployKey string, env *core.Env
 	if state != nil {
 		result.Logs = state.Logs
 	}
+	result.Error = webapi.CheckAllocationLimit(state, e.config.MaxAllocationBytes)
 	return result
 }
 
@@ -562,6 +723,9 @@ func (e *Engine) ExecuteTail(siteID string, deployKey string, env *core.Env, eve
 		return result
 	}
 
+	cpu := core.StartCPUTimer()
+	w.eventLoop.SetCPUTimer(cpu)
+
 	var timedOut atomic.Bool
 	var vmMu sync.Mutex
 	timeout := time.Duration(e.config.ExecutionTimeout) * time.Millisecond
@@ -583,11 +747,12 @@ func (e *Engine) ExecuteTail(siteID string, deployKey string, env *core.Env, eve
 				result.Error = fmt.Errorf("worker panic: %v", r)
 			}
 		}
+		result.CPUTime = cpu.Stop()
 		result.Duration = time.Since(start)
-		if stopped && !timedOut.Load() && !panicked {
+		if stopped && !timedOut.Load() && !panicked && w.eventLoop.Err() == nil && !webapi.HasWaitUntil(w.rt) {
 			pool.put(w)
 		} else {
-			log.Printf("worker: discarding tail worker for site %s deploy %s (timed out or panicked)", siteID, deployKey)
+			log.Printf("worker: discarding tail worker for site %s deploy %s (timed out, panicked, hit a resource limit or left waitUntil work pending)", siteID, deployKey)
 			vmMu.Lock()
 			w.vm.Close()
 			vmMu.Unlock()
@@ -602,6 +767,7 @@ func (e *Engine) ExecuteTail(siteID string, deployKey string, env *core.Env, eve
 	rt := w.rt
 
 	reqID := core.NewRequestState(e.config.MaxFetchRequests, env)
+	core.SetRequestSite(reqID, siteID, deployKey, e.config.LogFormat)
 	_ = rt.SetGlobal("__requestID", strconv.FormatUint(reqID, 10))
 
 	eventsJSON, err := json.Marshal(events)
@@ -649,7 +815,7 @@ func (e *Engine) ExecuteTail(siteID string, deployKey string, env *core.Env, eve
 			if (!mod || typeof mod.tail !== 'function') {
 				throw new Error('worker module has no tail handler');
 			}
-			return mod.tail(globalThis.__tail_events, globalThis.__env, globalThis.__ctx);
+			return __callHandler(function() { return mod.tail(globalThis.__tail_events, globalThis.__env, globalThis.__ctx); });
 		})()
 	`, quickjs.EvalGlobal)
 	if err != nil {
@@ -660,7 +826,11 @@ func (e *Engine) ExecuteTail(siteID string, deployKey string, env *core.Env, eve
 		if timedOut.Load() {
 			result.Error = fmt.Errorf("worker execution timed out (limit: %v)", timeout)
 		} else {
-			result.Error = fmt.Errorf("invoking worker tail: %w", err)
+			if limitErr := w.eventLoop.Err(); limitErr != nil {
+				result.Error = limitErr
+			} else {
+				result.Error = fmt.Errorf("invoking worker tail: %w", err)
+			}
 		}
 		return result
 	}
@@ -681,7 +851,7 @@ func (e *Engine) ExecuteTail(siteID string, deployKey string, env *core.Env, eve
 			if state != nil {
 				result.Logs = state.Logs
 			}
-			result.Error = fmt.Errorf("awaiting tail handler: %w", err)
+			result.Error = awaitError(err, timeout, &timedOut, "awaiting tail handler")
 			return result
 		}
 	}
@@ -694,6 +864,7 @@ func (e *Engine) ExecuteTail(siteID string, deployKey string, env *core.Env, eve
 	if state != nil {
 		result.Logs = state.Logs
 	}
+	result.Error = webapi.CheckAllocationLimit(state, e.config.MaxAllocationBytes)
 	return result
 }
 
@@ -730,6 +901,9 @@ func (e *Engine) ExecuteFunction(siteID string, deployKey string, env *core.Env,
 		return result
 	}
 
+	cpu := core.StartCPUTimer()
+	w.eventLoop.SetCPUTimer(cpu)
+
 	var timedOut atomic.Bool
 	var vmMu sync.Mutex
 	timeout := time.Duration(e.config.ExecutionTimeout) * time.Millisecond
@@ -751,11 +925,12 @@ func (e *Engine) ExecuteFunction(siteID string, deployKey string, env *core.Env,
 				result.Error = fmt.Errorf("worker panic: %v", r)
 			}
 		}
+		result.CPUTime = cpu.Stop()
 		result.Duration = time.Since(start)
-		if stopped && !timedOut.Load() && !panicked {
+		if stopped && !timedOut.Load() && !panicked && w.eventLoop.Err() == nil && !webapi.HasWaitUntil(w.rt) {
 			pool.put(w)
 		} else {
-			log.Printf("worker: discarding worker for site %s deploy %s (timed out or panicked)", siteID, deployKey)
+			log.Printf("worker: discarding worker for site %s deploy %s (timed out, panicked, hit a resource limit or left waitUntil work pending)", siteID, deployKey)
 			vmMu.Lock()
 			w.vm.Close()
 			vmMu.Unlock()
@@ -770,6 +945,7 @@ func (e *Engine) ExecuteFunction(siteID string, deployKey string, env *core.Env,
 	rt := w.rt
 
 	reqID := core.NewRequestState(e.config.MaxFetchRequests, env)
+	core.SetRequestSite(reqID, siteID, deployKey, e.config.LogFormat)
 	if err := rt.SetGlobal("__requestID", strconv.FormatUint(reqID, 10)); err != nil {
 		core.ClearRequestState(reqID)
 		result.Error = fmt.Errorf("setting request ID: %w", err)
@@ -827,7 +1003,7 @@ func (e *Engine) ExecuteFunction(siteID string, deployKey string, env *core.Env,
 			if (!mod || typeof mod[%q] !== 'function') {
 				throw new Error('worker module has no "' + %q + '" function');
 			}
-			return mod[%q](%s);
+			return __callHandler(function() { return mod[%q](%s); });
 		})()
 	`, fnName, fnName, fnName, argsJS)
 
@@ -840,7 +1016,11 @@ func (e *Engine) ExecuteFunction(siteID string, deployKey string, env *core.Env,
 		if timedOut.Load() {
 			result.Error = fmt.Errorf("worker execution timed out (limit: %v)", timeout)
 		} else {
-			result.Error = fmt.Errorf("invoking worker %q: %w", fnName, err)
+			if limitErr := w.eventLoop.Err(); limitErr != nil {
+				result.Error = limitErr
+			} else {
+				result.Error = fmt.Errorf("invoking worker %q: %w", fnName, err)
+			}
 		}
 		return result
 	}
@@ -859,7 +1039,7 @@ func (e *Engine) ExecuteFunction(siteID string, deployKey string, env *core.Env,
 		if state != nil {
 			result.Logs = state.Logs
 		}
-		result.Error = fmt.Errorf("awaiting worker %q: %w", fnName, err)
+		result.Error = awaitError(err, timeout, &timedOut, fmt.Sprintf("awaiting worker %q", fnName))
 		return result
 	}
 
@@ -891,6 +1071,7 @@ func (e *Engine) ExecuteFunction(siteID string, deployKey string, env *core.Env,
 	if state != nil {
 		result.Logs = state.Logs
 	}
+	result.Error = webapi.CheckAllocationLimit(state, e.config.MaxAllocationBytes)
 	return result
 }
 
@@ -918,6 +1099,32 @@ func (e *Engine) Shutdown() {
 		e.sources.Delete(key)
 		return true
 	})
+	e.rsaKeys.Close()
+}
+
+// Stats returns a usage snapshot for every live site pool, ordered by site
+// and deploy key.
+func (e *Engine) Stats() []core.PoolStats {
+	var out []core.PoolStats
+	e.pools.Range(func(k, val any) bool {
+		sp := val.(*sitePool)
+		if !sp.isValid() {
+			return true
+		}
+		key := k.(poolKey)
+		st := sp.pool.stats()
+		st.SiteID = key.SiteID
+		st.DeployKey = key.DeployKey
+		out = append(out, st)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].SiteID != out[j].SiteID {
+			return out[i].SiteID < out[j].SiteID
+		}
+		return out[i].DeployKey < out[j].DeployKey
+	})
+	return out
 }
 
 // MaxResponseBytes returns the configured maximum response body size.
@@ -937,3 +1144,87 @@ func awaitValue(rt core.JSRuntime, globalVar string, deadline time.Time) error {
 
 // Ensure unused imports don't cause errors.
 var _ = runtime.Gosched
+
+// awaitWaitUntil settles the ctx.waitUntil promises of a fetch execution on
+// a new goroutine after its response has been returned, bounded by
+// WaitUntilTimeout. The worker stays checked out until then; it goes back
+// to the pool afterwards, or is discarded if the promises overran. Logs
+// from before logOffset were already returned with the response.
+func (e *Engine) awaitWaitUntil(pool *qjsPool, w *qjsWorker, siteID, deployKey string, reqID uint64, logOffset int) <-chan core.WaitUntilResult {
+	done := make(chan core.WaitUntilResult, 1)
+	timeout := time.Duration(e.config.WaitUntilTimeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = time.Duration(e.config.ExecutionTimeout) * time.Millisecond
+	}
+
+	// The response has been returned, so the caller may cancel its context;
+	// background work keeps the context's values under its own deadline.
+	cancelCtx := func() {}
+	if state := core.GetRequestState(reqID); state != nil {
+		var rc core.RequestContext
+		rc, cancelCtx = state.RequestContext().Detach(time.Now().Add(timeout))
+		state.SetRequestContext(rc)
+	}
+
+	go func() {
+		defer cancelCtx()
+		start := time.Now()
+		var res core.WaitUntilResult
+		var timedOut atomic.Bool
+		var vmMu sync.Mutex
+		watchdog := time.AfterFunc(timeout, func() {
+			timedOut.Store(true)
+			vmMu.Lock()
+			defer vmMu.Unlock()
+			w.vm.Interrupt()
+		})
+
+		var panicked bool
+		defer func() {
+			stopped := watchdog.Stop()
+			if r := recover(); r != nil {
+				panicked = true
+				res.Error = fmt.Errorf("worker panic in waitUntil: %v", r)
+			}
+			if timedOut.Load() || errors.Is(res.Error, webapi.ErrWaitUntilTimeout) {
+				timedOut.Store(true)
+				res.Error = fmt.Errorf("waitUntil timed out (limit: %v)", timeout)
+			}
+			if state := core.ClearRequestState(reqID); state != nil && len(state.Logs) > logOffset {
+				res.Logs = state.Logs[logOffset:]
+			}
+			res.Duration = time.Since(start)
+			if stopped && !timedOut.Load() && !panicked && w.eventLoop.Err() == nil {
+				pool.put(w)
+			} else {
+				log.Printf("worker: discarding worker for site %s deploy %s (waitUntil timed out, panicked or hit a resource limit)", siteID, deployKey)
+				vmMu.Lock()
+				w.vm.Close()
+				vmMu.Unlock()
+				key := poolKey{SiteID: siteID, DeployKey: deployKey}
+				if val, ok := e.pools.Load(key); ok {
+					sp := val.(*sitePool)
+					sp.markInvalid()
+				}
+			}
+			done <- res
+		}()
+
+		res.Error = webapi.AwaitWaitUntil(w.rt, start.Add(timeout), w.eventLoop)
+	}()
+
+	return done
+}
+
+// awaitError builds the result error for a failed webapi.AwaitValue. A
+// deadline that passes while the handler's promise is still pending is an
+// execution timeout, whether AwaitValue noticed it first or the watchdog
+// interrupted the pump. It sets timedOut so the worker is discarded rather
+// than returned to the pool with work still queued.
+func awaitError(err error, timeout time.Duration, timedOut *atomic.Bool, what string) error {
+	if timedOut.Load() || errors.Is(err, webapi.ErrAwaitTimeout) {
+		timedOut.Store(true)
+		return fmt.Errorf("worker execution timed out (limit: %v)", timeout)
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
@@ -4,7 +4,10 @@ package quickjs
 
 import (
 	"fmt"
+	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cryguy/worker/v2/internal/core"
 	"github.com/cryguy/worker/v2/internal/eventloop"
@@ -17,22 +20,50 @@ type qjsWorker struct {
 	vm        *quickjs.VM
 	rt        *qjsRuntime
 	eventLoop *eventloop.EventLoop
+	idleSince time.Time // when the worker was last returned to the pool
 }
 
-// qjsPool manages a fixed-size pool of pre-warmed QuickJS workers.
+// qjsPool manages a pool of pre-warmed QuickJS workers. It always keeps size
+// workers; when maxSize is larger it creates extra workers while every
+// worker is busy and reclaims them once they have sat idle for idleTTL.
 type qjsPool struct {
 	workers chan *qjsWorker
 	size    int
+	maxSize int
+	idleTTL time.Duration
 	mu      sync.Mutex
+
+	// Inputs for creating extra workers on demand.
+	source        string
+	setupFns      []setupFunc
+	memoryLimitMB int
+
+	live   atomic.Int64 // allocated workers, idle or checked out
+	closed atomic.Bool
+	stop   chan struct{}
+
+	// Usage counters reported by stats().
+	inUse     atomic.Int64
+	gets      atomic.Uint64
+	waitNanos atomic.Int64
 }
 
+// defaultPoolIdleTTL is how long an extra worker may sit idle before it is
+// reclaimed when EngineConfig.PoolIdleTimeout is unset.
+const defaultPoolIdleTTL = 60 * time.Second
+
 // setupFunc configures a QuickJS VM with Web APIs, crypto, console, etc.
 type setupFunc func(rt core.JSRuntime, el *eventloop.EventLoop) error
 
-// globalThisCleanupJS removes per-request state and user-set globals from
-// globalThis before a worker is returned to the pool.
+// globalThisCleanupJS restores the globals recorded by webapi.SnapshotGlobals,
+// reseeds Math.random and removes per-request state from globalThis before a
+// worker is returned to the pool. It evaluates to the globals that could not
+// be restored, comma-separated; a worker with any, or whose cleanup throws,
+// is discarded.
 const globalThisCleanupJS = `
 (function() {
+	var stuck = typeof globalThis.__resetGlobals === 'function' ? globalThis.__resetGlobals() : [];
+	if (typeof globalThis.__reseedMathRandom === 'function') globalThis.__reseedMathRandom();
 	var perRequest = ['__requestID', '__ws_active_server',
 		'__await_input', '__awaited_result', '__awaited_state',
 		'__fn_result', '__req', '__env', '__ctx', '__result',
@@ -53,26 +84,54 @@ const globalThisCleanupJS = `
 			try { delete globalThis[n]; } catch(e) {}
 		}
 	}
+	return stuck.join(', ');
 })();
 `
 
-// buildSetupFuncs returns the list of Web API setup functions for pool workers.
-func buildSetupFuncs(cfg core.EngineConfig) []setupFunc {
+// buildSetupFuncs returns the list of Web API setup functions for pool
+// workers. rsaKeys may be nil.
+func buildSetupFuncs(cfg core.EngineConfig, rsaKeys *webapi.RSAKeyPool) []setupFunc {
+	entropy := webapi.CryptoRand(cfg)
 	return []setupFunc{
 		webapi.SetupWebAPIs,
 		webapi.SetupURLSearchParamsExt,
 		webapi.SetupGlobals,
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			if !cfg.DefineWindow {
+				return nil
+			}
+			return webapi.SetupWindowAlias(rt, el)
+		},
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			return webapi.SetupArrayBufferLimit(rt, cfg, el)
+		},
 		webapi.SetupEncoding,
-		webapi.SetupTimers,
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			el.SetMaxTimers(cfg.MaxPendingTimers)
+			return webapi.SetupTimers(rt, el)
+		},
 		webapi.SetupAbort,
 		webapi.SetupReportError,
-		webapi.SetupCrypto,
-		webapi.SetupCryptoExt,
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			return webapi.SetupCrypto(rt, el, entropy)
+		},
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			return webapi.SetupCryptoExt(rt, el, entropy)
+		},
 		webapi.SetupCryptoDerive,
-		webapi.SetupCryptoRSA,
-		webapi.SetupCryptoEd25519,
-		webapi.SetupCryptoAesCtrKw,
-		webapi.SetupCryptoECDH,
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			return webapi.SetupCryptoRSAWithKeyPool(rt, el, rsaKeys)
+		},
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			return webapi.SetupCryptoEd25519(rt, el, entropy)
+		},
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			return webapi.SetupCryptoAesCtrKw(rt, el, entropy)
+		},
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			return webapi.SetupCryptoECDH(rt, el, entropy)
+		},
+		webapi.SetupJWT,
 		webapi.SetupURLPattern,
 		webapi.SetupStreams,
 		webapi.SetupTextStreams,
@@ -99,18 +158,36 @@ func buildSetupFuncs(cfg core.EngineConfig) []setupFunc {
 		webapi.SetupQueues,
 		webapi.SetupD1,
 		webapi.SetupDurableObjects,
-		webapi.SetupServiceBindings,
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			return webapi.SetupServiceBindings(rt, cfg, el)
+		},
 		webapi.SetupAssets,
 		webapi.SetupCache,
+		func(rt core.JSRuntime, el *eventloop.EventLoop) error {
+			return webapi.SetupDisabledGlobals(rt, cfg, el)
+		},
 	}
 }
 
-// newQJSPool creates a pool of QuickJS VMs, each configured with the given
-// setup functions and loaded with the worker script.
-func newQJSPool(size int, source string, setupFns []setupFunc, memoryLimitMB int) (*qjsPool, error) {
+// newQJSPool creates a pool of size QuickJS VMs, each configured with the
+// given setup functions and loaded with the worker script. A maxSize above
+// size lets the pool grow under load; see qjsPool.
+func newQJSPool(size int, source string, setupFns []setupFunc, memoryLimitMB int, maxSize int, idleTTL time.Duration) (*qjsPool, error) {
+	if maxSize < size {
+		maxSize = size
+	}
+	if idleTTL <= 0 {
+		idleTTL = defaultPoolIdleTTL
+	}
 	pool := &qjsPool{
-		workers: make(chan *qjsWorker, size),
-		size:    size,
+		workers:       make(chan *qjsWorker, maxSize),
+		size:          size,
+		maxSize:       maxSize,
+		idleTTL:       idleTTL,
+		source:        source,
+		setupFns:      setupFns,
+		memoryLimitMB: memoryLimitMB,
+		stop:          make(chan struct{}),
 	}
 
 	for i := 0; i < size; i++ {
@@ -119,9 +196,13 @@ func newQJSPool(size int, source string, setupFns []setupFunc, memoryLimitMB int
 			pool.dispose()
 			return nil, fmt.Errorf("creating pool worker %d: %w", i, err)
 		}
+		pool.live.Add(1)
 		pool.workers <- w
 	}
 
+	if maxSize > size {
+		go pool.reclaimLoop()
+	}
 	return pool, nil
 }
 
@@ -171,37 +252,147 @@ func newQJSWorker(source string, setupFns []setupFunc, memoryLimitMB int) (*qjsW
 		return nil, fmt.Errorf("worker script did not export a default module")
 	}
 
+	if err := webapi.SnapshotGlobals(rt); err != nil {
+		vm.Close()
+		return nil, err
+	}
+
 	return &qjsWorker{vm: vm, rt: rt, eventLoop: el}, nil
 }
 
-// get acquires a worker from the pool. Blocks until one is available.
+// get acquires a worker from the pool. If every worker is busy it grows the
+// pool when below maxSize, otherwise it blocks until one is available.
 func (p *qjsPool) get() (*qjsWorker, error) {
-	w, ok := <-p.workers
-	if !ok {
-		return nil, fmt.Errorf("worker pool is closed")
+	start := time.Now()
+	var w *qjsWorker
+	select {
+	case w = <-p.workers:
+	default:
+		if w = p.grow(); w == nil {
+			var ok bool
+			if w, ok = <-p.workers; !ok {
+				return nil, fmt.Errorf("worker pool is closed")
+			}
+		}
 	}
+	p.waitNanos.Add(int64(time.Since(start)))
+	p.gets.Add(1)
+	p.inUse.Add(1)
 	return w, nil
 }
 
 // put returns a worker to the pool after resetting its event loop.
 func (p *qjsPool) put(w *qjsWorker) {
-	_ = w.rt.Eval(globalThisCleanupJS)
+	p.inUse.Add(-1)
+	stuck, err := w.rt.EvalString(globalThisCleanupJS)
+	if err != nil {
+		stuck = "cleanup failed: " + err.Error()
+	}
+	if stuck != "" {
+		log.Printf("worker: discarding worker: could not restore globals: %s", stuck)
+	}
 	w.eventLoop.Reset()
-	select {
-	case p.workers <- w:
-	default:
+	w.idleSince = time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed.Load() && stuck == "" {
+		select {
+		case p.workers <- w:
+			return
+		default:
+		}
+	}
+	w.vm.Close()
+	p.live.Add(-1)
+}
+
+// grow creates an extra worker if the pool is below maxSize. It returns nil
+// when the pool is at capacity or the worker could not be created.
+func (p *qjsPool) grow() *qjsWorker {
+	for {
+		n := p.live.Load()
+		if n >= int64(p.maxSize) || p.closed.Load() {
+			return nil
+		}
+		if p.live.CompareAndSwap(n, n+1) {
+			break
+		}
+	}
+	w, err := newQJSWorker(p.source, p.setupFns, p.memoryLimitMB)
+	if err != nil {
+		p.live.Add(-1)
+		log.Printf("worker: growing pool: %v", err)
+		return nil
+	}
+	return w
+}
+
+// reclaimLoop periodically closes extra workers that have gone idle until
+// the pool is disposed.
+func (p *qjsPool) reclaimLoop() {
+	interval := p.idleTTL / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.reclaimIdle()
+		}
+	}
+}
+
+// reclaimIdle closes workers that have been idle for at least idleTTL,
+// never shrinking the pool below size.
+func (p *qjsPool) reclaimIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for n := len(p.workers); n > 0 && p.live.Load() > int64(p.size); n-- {
+		var w *qjsWorker
+		select {
+		case w = <-p.workers:
+		default:
+			return
+		}
+		if time.Since(w.idleSince) < p.idleTTL {
+			p.workers <- w
+			continue
+		}
 		w.vm.Close()
+		p.live.Add(-1)
 	}
 }
 
+// stats returns a snapshot of the pool's usage counters.
+func (p *qjsPool) stats() core.PoolStats {
+	st := core.PoolStats{
+		Size:  p.size,
+		Live:  int(p.live.Load()),
+		InUse: int(p.inUse.Load()),
+		Gets:  p.gets.Load(),
+	}
+	if st.Gets > 0 {
+		st.AvgWait = time.Duration(p.waitNanos.Load() / int64(st.Gets))
+	}
+	return st
+}
+
 // dispose closes all workers in the pool.
 func (p *qjsPool) dispose() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if p.closed.CompareAndSwap(false, true) {
+		close(p.stop)
+	}
 	for {
 		select {
 		case w := <-p.workers:
 			w.vm.Close()
+			p.live.Add(-1)
 		default:
 			return
 		}
@@ -0,0 +1,76 @@
+//go:build !v8
+
+package quickjs
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/cryguy/worker/v2/internal/core"
+	"modernc.org/libc"
+	lib "modernc.org/libquickjs"
+)
+
+var _ core.PromiseRejectionTracker = (*qjsRuntime)(nil)
+
+// TrackPromiseRejections installs promiseRejectionTracker as the runtime's
+// host promise rejection tracker.
+func (r *qjsRuntime) TrackPromiseRejections() error {
+	rt, tls, ok := extractRuntime(r.vm)
+	if !ok {
+		return fmt.Errorf("QuickJS runtime internals unavailable")
+	}
+	lib.XJS_SetHostPromiseRejectionTracker(tls, rt, cFuncPtr(promiseRejectionTracker), 0)
+	return nil
+}
+
+// promiseRejectionTracker is the JSHostPromiseRejectionTracker callback.
+// QuickJS calls it when a promise rejects with no handler and again, with
+// isHandled set, when a handler is attached to it later. It forwards both to
+// globalThis.__hostPromiseRejection.
+func promiseRejectionTracker(tls *libc.TLS, ctx uintptr, promise, reason lib.TJSValue, isHandled int32, _ uintptr) {
+	// Calling into JS would replace an exception that is being thrown.
+	if lib.XJS_HasException(tls, ctx) != 0 {
+		return
+	}
+	cName, err := libc.CString("__hostPromiseRejection")
+	if err != nil {
+		return
+	}
+	glob := lib.XJS_GetGlobalObject(tls, ctx)
+	fn := lib.XJS_GetPropertyStr(tls, ctx, glob, cName)
+	lib.XFreeValue(tls, ctx, glob)
+	libc.Xfree(tls, cName)
+	defer lib.XFreeValue(tls, ctx, fn)
+	if lib.XJS_IsFunction(tls, ctx, fn) == 0 {
+		if fn.Ftag == lib.EJS_TAG_EXCEPTION {
+			lib.XFreeValue(tls, ctx, lib.XJS_GetException(tls, ctx))
+		}
+		return
+	}
+
+	handled := lib.TJSValue{Ftag: lib.EJS_TAG_BOOL}
+	if isHandled != 0 {
+		handled.Fu.Fint321 = 1
+	}
+	size := unsafe.Sizeof(lib.TJSValue{})
+	argv := tls.Alloc(int(3 * size))
+	defer tls.Free(int(3 * size))
+	args := unsafe.Slice((*lib.TJSValue)(unsafe.Pointer(argv)), 3)
+	args[0], args[1], args[2] = promise, reason, handled
+
+	ret := lib.XJS_Call(tls, ctx, fn, lib.TJSValue{Ftag: lib.EJS_TAG_UNDEFINED}, 3, argv)
+	if ret.Ftag == lib.EJS_TAG_EXCEPTION {
+		lib.XFreeValue(tls, ctx, lib.XJS_GetException(tls, ctx))
+		return
+	}
+	lib.XFreeValue(tls, ctx, ret)
+}
+
+// cFuncPtr converts a Go function to the function pointer form the
+// transpiled C code calls through, as modernc.org/quickjs does for its own
+// callbacks. f must be a top-level function so that it is never collected.
+func cFuncPtr(f any) uintptr {
+	type iface [2]uintptr
+	return (*iface)(unsafe.Pointer(&f))[1]
+}
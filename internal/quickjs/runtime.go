@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"reflect"
+	"runtime"
 	"unsafe"
 
 	"github.com/cryguy/worker/v2/internal/core"
@@ -32,6 +33,7 @@ const btChunkSize = 196608 // 192 KB raw → 256 KB base64
 
 var _ core.JSRuntime = (*qjsRuntime)(nil)
 var _ core.BinaryTransferer = (*qjsRuntime)(nil)
+var _ core.Interrupter = (*qjsRuntime)(nil)
 
 // Eval evaluates JavaScript and discards the result.
 func (r *qjsRuntime) Eval(js string) error {
@@ -119,6 +121,11 @@ func (r *qjsRuntime) SetGlobal(name string, value any) error {
 	return glob.SetProperty(atom, value)
 }
 
+// Interrupt stops the running script at its next interrupt check.
+func (r *qjsRuntime) Interrupt() {
+	r.vm.Interrupt()
+}
+
 // RunMicrotasks pumps the QuickJS microtask queue.
 func (r *qjsRuntime) RunMicrotasks() {
 	executePendingJobs(r.vm)
@@ -197,9 +204,12 @@ func (r *qjsRuntime) WriteBinaryToJS(globalName string, data []byte) error {
 		return r.writeBinaryFallback(globalName, data)
 	}
 
-	// Create ArrayBuffer with copy of data via C API — single memcpy.
+	// Create ArrayBuffer with copy of data via C API — single memcpy. The
+	// pointer is passed as a uintptr, so keep data reachable until the copy
+	// is done or the GC may free it mid-copy.
 	bufPtr := uintptr(unsafe.Pointer(&data[0]))
 	jsVal := lib.XJS_NewArrayBufferCopy(r.tls, r.ctx, bufPtr, lib.Tsize_t(len(data)))
+	runtime.KeepAlive(data)
 
 	// Set as globalThis[globalName].
 	cName, err := libc.CString(globalName)
@@ -239,9 +249,13 @@ func (r *qjsRuntime) ReadBinaryFromJS(globalName string) ([]byte, error) {
 	lib.XFreeValue(r.tls, r.ctx, glob)
 	libc.Xfree(r.tls, cName)
 
-	// Get ArrayBuffer data pointer and size.
-	var size lib.Tsize_t
-	dataPtr := lib.XJS_GetArrayBuffer(r.tls, r.ctx, uintptr(unsafe.Pointer(&size)), jsVal)
+	// Get ArrayBuffer data pointer and size. The size out-parameter lives in
+	// TLS memory: a Go stack variable could move while the call runs.
+	sizeBytes := int(unsafe.Sizeof(lib.Tsize_t(0)))
+	sizePtr := r.tls.Alloc(sizeBytes)
+	dataPtr := lib.XJS_GetArrayBuffer(r.tls, r.ctx, sizePtr, jsVal)
+	size := *(*lib.Tsize_t)(unsafe.Pointer(sizePtr))
+	r.tls.Free(sizeBytes)
 
 	if dataPtr == 0 || size == 0 {
 		lib.XFreeValue(r.tls, r.ctx, jsVal)
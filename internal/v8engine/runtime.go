@@ -20,6 +20,7 @@ type v8Runtime struct {
 
 var _ core.JSRuntime = (*v8Runtime)(nil)
 var _ core.BinaryTransferer = (*v8Runtime)(nil)
+var _ core.Interrupter = (*v8Runtime)(nil)
 
 // Eval evaluates JavaScript and discards the result.
 func (r *v8Runtime) Eval(js string) error {
@@ -137,6 +138,11 @@ func (r *v8Runtime) SetGlobal(name string, value any) error {
 	return r.ctx.Global().Set(name, jsVal)
 }
 
+// Interrupt terminates the script running on the isolate.
+func (r *v8Runtime) Interrupt() {
+	r.iso.TerminateExecution()
+}
+
 // RunMicrotasks pumps the V8 microtask queue.
 func (r *v8Runtime) RunMicrotasks() {
 	r.ctx.PerformMicrotaskCheckpoint()
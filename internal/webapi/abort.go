@@ -8,7 +8,7 @@ import (
 )
 
 // abortJS defines EventTarget, Event, AbortSignal, AbortController,
-// DOMException, ScheduledEvent, and CustomEvent as pure JS polyfills.
+// DOMException, ScheduledEvent, FetchEvent, and CustomEvent as pure JS polyfills.
 const abortJS = `
 class Event {
 	constructor(type, options) {
@@ -43,30 +43,49 @@ class EventTarget {
 	addEventListener(type, callback, options) {
 		if (!callback) return;
 		if (!this._listeners) this._listeners = {};
+		const opts = typeof options === 'object' && options !== null ? options : { capture: !!options };
+		const signal = opts.signal;
+		if (signal && signal.aborted) return;
+		const capture = !!opts.capture;
 		if (!this._listeners[type]) this._listeners[type] = [];
-		const opts = typeof options === 'object' ? options : { capture: !!options };
-		const entry = { callback, once: !!opts.once, capture: !!opts.capture };
-		this._listeners[type].push(entry);
-		if (opts.signal) {
-			opts.signal.addEventListener('abort', () => {
-				this.removeEventListener(type, callback, options);
-			});
+		const list = this._listeners[type];
+		for (const l of list) {
+			if (l.callback === callback && l.capture === capture) return;
+		}
+		const entry = { callback, once: !!opts.once, capture, removed: false };
+		list.push(entry);
+		if (signal) {
+			signal.addEventListener('abort', () => this._removeEntry(type, entry), { once: true });
 		}
 	}
 	removeEventListener(type, callback, options) {
 		if (!this._listeners || !this._listeners[type]) return;
-		const capture = typeof options === 'object' ? !!options.capture : !!options;
-		this._listeners[type] = this._listeners[type].filter(
-			l => !(l.callback === callback && l.capture === capture)
-		);
+		const capture = typeof options === 'object' && options !== null ? !!options.capture : !!options;
+		for (const l of this._listeners[type]) {
+			if (l.callback === callback && l.capture === capture) this._removeEntry(type, l);
+		}
+	}
+	// _removeEntry drops one registration. It is also flagged as removed so
+	// a dispatch already in progress skips it.
+	_removeEntry(type, entry) {
+		entry.removed = true;
+		if (!this._listeners || !this._listeners[type]) return;
+		this._listeners[type] = this._listeners[type].filter(l => l !== entry);
 	}
 	dispatchEvent(event) {
 		event.target = this;
 		if (!this._listeners || !this._listeners[event.type]) return true;
 		const listeners = [...this._listeners[event.type]];
 		for (const l of listeners) {
-			l.callback.call(this, event);
-			if (l.once) this.removeEventListener(event.type, l.callback, { capture: l.capture });
+			if (l.removed) continue;
+			// A once listener is removed before it runs, so dispatching the
+			// same event type from inside it does not call it again.
+			if (l.once) this._removeEntry(event.type, l);
+			if (typeof l.callback === 'function') {
+				l.callback.call(this, event);
+			} else if (l.callback && typeof l.callback.handleEvent === 'function') {
+				l.callback.handleEvent(event);
+			}
 		}
 		return !event.defaultPrevented;
 	}
@@ -93,7 +112,7 @@ class AbortSignal extends EventTarget {
 	}
 	static timeout(ms) {
 		const signal = new AbortSignal();
-		setTimeout(function() {
+		__internalSetTimeout(function() {
 			signal._aborted = true;
 			signal._reason = new DOMException('The operation timed out.', 'TimeoutError');
 			var ev = new Event('abort');
@@ -162,10 +181,12 @@ class DOMException extends Error {
 }
 
 class ScheduledEvent extends Event {
-	constructor(scheduledTime, cron) {
+	constructor(scheduledTime, cron, cf) {
 		super('scheduled');
 		this.scheduledTime = scheduledTime;
 		this.cron = cron || '';
+		// Metadata about the trigger, such as colo or region, like request.cf.
+		this.cf = cf || {};
 		this._waitUntilPromises = [];
 		this.noRetry = function() {};
 	}
@@ -174,6 +195,54 @@ class ScheduledEvent extends Event {
 	}
 }
 
+class FetchEvent extends Event {
+	constructor(type, init) {
+		super(type, init);
+		if (!init || !(init.request instanceof Request)) {
+			throw new TypeError("FetchEvent: init.request must be a Request");
+		}
+		this.request = init.request;
+		this._response = null;
+		this._respondWithCalled = false;
+		this._ctx = null;
+		this._waitUntilPromises = [];
+	}
+	respondWith(response) {
+		if (this._respondWithCalled) {
+			throw new DOMException('respondWith() has already been called', 'InvalidStateError');
+		}
+		this._respondWithCalled = true;
+		this._response = Promise.resolve(response);
+	}
+	waitUntil(promise) {
+		if (this._ctx) this._ctx.waitUntil(promise);
+		else this._waitUntilPromises.push(Promise.resolve(promise));
+	}
+	passThroughOnException() {
+		if (this._ctx) this._ctx.passThroughOnException();
+	}
+}
+
+// __serviceWorkerModule adapts a service-worker-style script, which
+// registers addEventListener('fetch', ...) instead of exporting a module,
+// into a module object with a fetch handler. It returns undefined when no
+// fetch listener was registered.
+globalThis.__serviceWorkerModule = function() {
+	var ls = globalThis._listeners;
+	if (!ls || !ls.fetch || ls.fetch.length === 0) return undefined;
+	return {
+		fetch: function(request, env, ctx) {
+			var ev = new FetchEvent('fetch', { request: request });
+			ev._ctx = ctx;
+			globalThis.dispatchEvent(ev);
+			if (!ev._respondWithCalled) {
+				throw new Error('fetch event listener did not call respondWith()');
+			}
+			return ev._response;
+		}
+	};
+};
+
 class CustomEvent extends Event {
 	constructor(type, init) {
 		super(type, init);
@@ -187,11 +256,12 @@ globalThis.AbortSignal = AbortSignal;
 globalThis.AbortController = AbortController;
 globalThis.DOMException = DOMException;
 globalThis.ScheduledEvent = ScheduledEvent;
+globalThis.FetchEvent = FetchEvent;
 globalThis.CustomEvent = CustomEvent;
 `
 
 // SetupAbort evaluates Event, EventTarget, AbortSignal, AbortController,
-// DOMException, ScheduledEvent, and CustomEvent polyfills.
+// DOMException, ScheduledEvent, FetchEvent, and CustomEvent polyfills.
 func SetupAbort(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	if err := rt.Eval(abortJS); err != nil {
 		return fmt.Errorf("evaluating abort.js: %w", err)
@@ -57,11 +57,14 @@ func SetupAssets(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	assetsFactoryJS := `
 globalThis.__makeAssets = function() {
 	return {
-		fetch: function(input) {
+		fetch: function(input, init) {
 			var reqID = String(globalThis.__requestID);
 			return new Promise(function(resolve, reject) {
 				try {
 					var url = '', method = 'GET', headers = {}, body = null;
+					if (init !== undefined || input instanceof URL) {
+						input = new Request(input, init);
+					}
 					if (typeof input === 'string') {
 						url = input;
 					} else if (input && typeof input === 'object') {
@@ -85,7 +88,10 @@ globalThis.__makeAssets = function() {
 					if (respData.headers) {
 						for (var k in respData.headers) h.set(k, respData.headers[k]);
 					}
-					resolve(new Response(respData.body, { status: respData.status, headers: h }));
+					// 304 Not Modified and other null-body statuses carry no
+					// payload; a HEAD request never does.
+					var nullBody = __isNullBodyStatus(respData.status) || method.toUpperCase() === 'HEAD';
+					resolve(new Response(nullBody ? null : respData.body, { status: respData.status, headers: h }));
 				} catch(e) {
 					reject(e);
 				}
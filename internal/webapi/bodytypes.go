@@ -27,7 +27,7 @@ function bodyToString(body) {
 		return s2;
 	}
 	if (body instanceof Blob) {
-		return body._parts.join('');
+		return new TextDecoder().decode(__blobBytes(body));
 	}
 	if (body instanceof URLSearchParams) {
 		return body.toString();
@@ -45,7 +45,7 @@ function bodyToString(body) {
 				result += 'Content-Disposition: form-data; name="' + name + '"; filename="' + fname + '"\r\n';
 				if (value.type) result += 'Content-Type: ' + value.type + '\r\n';
 				result += '\r\n';
-				result += value._parts.join('') + '\r\n';
+				result += new TextDecoder().decode(__blobBytes(value)) + '\r\n';
 			}
 		});
 		result += '--' + boundary + '--\r\n';
@@ -120,7 +120,15 @@ async function __readStreamBytes(stream) {
 	return merged;
 }
 
+// consumeBody marks a body as read, failing if it already was. A null
+// body has nothing to consume and can be read any number of times.
+function consumeBody(self) {
+	if (self.bodyUsed) throw new TypeError('body already consumed');
+	if (self._body !== null && self._body !== undefined) self._bodyUsed = true;
+}
+
 Request.prototype.text = async function() {
+	consumeBody(this);
 	if (this._body instanceof ReadableStream) {
 		var bytes = await __readStreamBytes(this._body);
 		return new TextDecoder().decode(bytes);
@@ -129,6 +137,7 @@ Request.prototype.text = async function() {
 };
 
 Response.prototype.text = async function() {
+	consumeBody(this);
 	if (this._body instanceof ReadableStream) {
 		var bytes = await __readStreamBytes(this._body);
 		return new TextDecoder().decode(bytes);
@@ -137,50 +146,81 @@ Response.prototype.text = async function() {
 };
 
 Request.prototype.arrayBuffer = async function() {
+	consumeBody(this);
 	if (this._body instanceof ArrayBuffer) return this._body;
 	if (ArrayBuffer.isView(this._body)) return this._body.buffer.slice(this._body.byteOffset, this._body.byteOffset + this._body.byteLength);
 	if (this._body instanceof ReadableStream) {
 		var bytes = await __readStreamBytes(this._body);
 		return bytes.buffer;
 	}
+	if (this._body instanceof Blob) return __blobBytes(this._body).buffer;
 	var t = bodyToString(this._body);
 	var enc = new TextEncoder();
 	return enc.encode(t).buffer;
 };
 
 Response.prototype.arrayBuffer = async function() {
+	consumeBody(this);
 	if (this._body instanceof ArrayBuffer) return this._body;
 	if (ArrayBuffer.isView(this._body)) return this._body.buffer.slice(this._body.byteOffset, this._body.byteOffset + this._body.byteLength);
 	if (this._body instanceof ReadableStream) {
 		var bytes = await __readStreamBytes(this._body);
 		return bytes.buffer;
 	}
+	if (this._body instanceof Blob) return __blobBytes(this._body).buffer;
 	var t = bodyToString(this._body);
 	var enc = new TextEncoder();
 	return enc.encode(t).buffer;
 };
 
-Request.prototype.json = async function() {
-	var t = await this.text();
+Request.prototype.bytes = async function() {
+	return new Uint8Array(await this.arrayBuffer());
+};
+
+Response.prototype.bytes = async function() {
+	return new Uint8Array(await this.arrayBuffer());
+};
+
+// parseJSONBody reads a body for json(). Byte bodies, Blobs included, are
+// decoded with the charset declared in content-type (UTF-8 when absent or
+// unknown), and a leading BOM is dropped before parsing. String,
+// URLSearchParams and FormData bodies are already text, so their charset
+// has nothing to apply to.
+async function parseJSONBody(self) {
+	var b = self._body;
+	if (b instanceof ArrayBuffer || ArrayBuffer.isView(b) || b instanceof ReadableStream || b instanceof Blob) {
+		var bytes = new Uint8Array(await self.arrayBuffer());
+		var m = /;\s*charset\s*=\s*"?([^";\s]+)/i.exec(self.headers.get('content-type') || '');
+		var decoder;
+		try { decoder = new TextDecoder(m ? m[1] : 'utf-8'); }
+		catch (e) { decoder = new TextDecoder('utf-8'); }
+		return JSON.parse(decoder.decode(bytes));
+	}
+	var t = await self.text();
+	if (t.charCodeAt(0) === 0xFEFF) t = t.slice(1);
 	return JSON.parse(t);
+}
+
+Request.prototype.json = async function() {
+	return parseJSONBody(this);
 };
 
 Response.prototype.json = async function() {
-	var t = await this.text();
-	return JSON.parse(t);
+	return parseJSONBody(this);
 };
 
 Request.prototype.blob = async function() {
-	var text = await this.text();
-	return new Blob([text], { type: this.headers.get('content-type') || '' });
+	var buf = await this.arrayBuffer();
+	return new Blob([buf], { type: this.headers.get('content-type') || '' });
 };
 
 Response.prototype.blob = async function() {
-	var text = await this.text();
-	return new Blob([text], { type: this.headers.get('content-type') || '' });
+	var buf = await this.arrayBuffer();
+	return new Blob([buf], { type: this.headers.get('content-type') || '' });
 };
 
 Request.prototype.formData = async function() {
+	consumeBody(this);
 	var ct = this.headers.get('content-type') || '';
 	var text = bodyToString(this._body);
 	if (ct.indexOf('application/x-www-form-urlencoded') !== -1) {
@@ -196,6 +236,7 @@ Request.prototype.formData = async function() {
 };
 
 Response.prototype.formData = async function() {
+	consumeBody(this);
 	var ct = this.headers.get('content-type') || '';
 	var text = bodyToString(this._body);
 	if (ct.indexOf('application/x-www-form-urlencoded') !== -1) {
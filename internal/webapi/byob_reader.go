@@ -88,6 +88,7 @@ class ReadableStreamBYOBReader {
 		if (view.byteLength === 0) {
 			return Promise.reject(new TypeError('view must have non-zero byteLength'));
 		}
+		stream._disturbed = true;
 		if (stream._errored) {
 			return Promise.reject(stream._error);
 		}
@@ -133,7 +134,10 @@ class ReadableStreamBYOBReader {
 	}
 
 	cancel(reason) {
-		return this._stream.cancel(reason);
+		if (!this._stream || this._stream._reader !== this) {
+			return Promise.reject(new TypeError('Cannot cancel a stream using a released reader'));
+		}
+		return this._stream._cancelInternal(reason);
 	}
 }
 
@@ -144,6 +148,9 @@ globalThis.ReadableStream = function ReadableStream(underlyingSource, strategy)
 	if (underlyingSource && underlyingSource.type === 'bytes') {
 		const stream = new OrigReadableStream(undefined, strategy);
 		stream._byteStream = true;
+		// Byte streams default to a high-water mark of 0, so pull only runs
+		// on demand.
+		if (!strategy || strategy.highWaterMark === undefined) stream._highWaterMark = 0;
 		stream._byobReads = [];
 		stream._controller = new ReadableByteStreamController(stream);
 		if (typeof underlyingSource.pull === 'function') {
@@ -36,7 +36,7 @@ class Cache {
 		try {
 			var parsed = JSON.parse(result);
 			var hdrs = new Headers(parsed.headers || {});
-			var resp = new Response(parsed.body, {
+			var resp = new Response(__isNullBodyStatus(parsed.status) ? null : parsed.body, {
 				status: parsed.status,
 				headers: hdrs,
 			});
@@ -77,7 +77,7 @@ class Cache {
 		var hdrs = {};
 		if (response.headers) {
 			if (typeof response.headers.forEach === 'function') {
-				response.headers.forEach(function(v, k) { hdrs[k] = v; });
+				response.headers.forEach(function(v, k) { hdrs[k] = k in hdrs ? hdrs[k] + ', ' + v : v; });
 			} else if (response.headers._map) {
 				var m = response.headers._map;
 				for (var k in m) { if (m.hasOwnProperty(k)) hdrs[k] = Array.isArray(m[k]) ? m[k].join(', ') : String(m[k]); }
@@ -166,11 +166,11 @@ class CacheStorage {
 	}
 
 	async delete(cacheName) {
-		if (cacheName in this._caches) {
-			delete this._caches[cacheName];
-			return true;
-		}
-		return false;
+		var known = cacheName in this._caches;
+		delete this._caches[cacheName];
+		var reqID = String(globalThis.__requestID);
+		var dropped = __cache_delete_all(reqID, String(cacheName)) === 'true';
+		return known || dropped;
 	}
 
 	async keys() {
@@ -195,7 +195,7 @@ globalThis.caches = new CacheStorage();
 // SetupCache registers the Cache API JS classes and Go-backed functions.
 func SetupCache(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	// __cache_match(reqIDStr, cacheName, url) -> JSON string or "null"
-	if err := rt.RegisterFunc("__cache_match", func(reqIDStr, cacheName, url string) (string, error) {
+	if err := registerBridge(rt, "caches", "__cache_match", func(reqIDStr, cacheName, url string) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil || state.Env == nil || state.Env.Cache == nil {
@@ -227,7 +227,7 @@ func SetupCache(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cache_put(reqIDStr, cacheName, url, status, headersJSON, body, ttl)
-	if err := rt.RegisterFunc("__cache_put", func(reqIDStr, cacheName, url string, status int, headersJSON, body string, ttl int) (string, error) {
+	if err := registerBridge(rt, "caches", "__cache_put", func(reqIDStr, cacheName, url string, status int, headersJSON, body string, ttl int) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil || state.Env == nil || state.Env.Cache == nil {
@@ -246,7 +246,7 @@ func SetupCache(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cache_delete(reqIDStr, cacheName, url) -> "true" or "false"
-	if err := rt.RegisterFunc("__cache_delete", func(reqIDStr, cacheName, url string) (string, error) {
+	if err := registerBridge(rt, "caches", "__cache_delete", func(reqIDStr, cacheName, url string) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil || state.Env == nil || state.Env.Cache == nil {
@@ -262,5 +262,26 @@ func SetupCache(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		return fmt.Errorf("registering __cache_delete: %w", err)
 	}
 
+	// __cache_delete_all(reqIDStr, cacheName) -> "true" or "false"
+	if err := registerBridge(rt, "caches", "__cache_delete_all", func(reqIDStr, cacheName string) (string, error) {
+		reqID := core.ParseReqID(reqIDStr)
+		state := core.GetRequestState(reqID)
+		if state == nil || state.Env == nil || state.Env.Cache == nil {
+			return "false", nil
+		}
+		ns, ok := state.Env.Cache.(core.CacheNamespaceStore)
+		if !ok {
+			return "false", nil
+		}
+
+		deleted, err := ns.DeleteCache(cacheName)
+		if err != nil || !deleted {
+			return "false", nil
+		}
+		return "true", nil
+	}); err != nil {
+		return fmt.Errorf("registering __cache_delete_all: %w", err)
+	}
+
 	return rt.Eval(cacheJS)
 }
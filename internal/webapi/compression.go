@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -167,7 +168,9 @@ func newCompressWriter(buf *bytes.Buffer, format string) (io.WriteCloser, error)
 	switch format {
 	case "gzip":
 		return gzip.NewWriter(buf), nil
-	case "deflate", "deflate-raw":
+	case "deflate":
+		return zlib.NewWriter(buf), nil
+	case "deflate-raw":
 		return flate.NewWriter(buf, flate.DefaultCompression)
 	case "br":
 		return brotli.NewWriter(buf), nil
@@ -176,6 +179,24 @@ func newCompressWriter(buf *bytes.Buffer, format string) (io.WriteCloser, error)
 	}
 }
 
+// newDecompressReader wraps r with a decompressor for the given format.
+// "deflate" is the zlib-wrapped stream (RFC 1950) and "deflate-raw" is bare
+// DEFLATE data (RFC 1951), matching the Compression Streams spec.
+func newDecompressReader(r io.Reader, format string) (io.ReadCloser, error) {
+	switch format {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	case "deflate-raw":
+		return flate.NewReader(r), nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
 // SetupCompression registers Go-backed streaming compress/decompress functions
 // and evaluates the JS classes. Must run after SetupStreams and SetupEncoding.
 func SetupCompression(rt core.JSRuntime, _ *eventloop.EventLoop) error {
@@ -213,42 +234,17 @@ func SetupCompression(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			return "", fmt.Errorf("decompress: invalid base64")
 		}
 
-		var result []byte
-		switch format {
-		case "gzip":
-			r, err := gzip.NewReader(bytes.NewReader(data))
-			if err != nil {
-				return "", fmt.Errorf("decompress: %w", err)
-			}
-			result, err = io.ReadAll(io.LimitReader(r, int64(maxDecompressedSize)+1))
-			if err != nil {
-				return "", fmt.Errorf("decompress: %w", err)
-			}
-			if len(result) > maxDecompressedSize {
-				return "", fmt.Errorf("decompress: output exceeds maximum allowed size")
-			}
-			_ = r.Close()
-		case "deflate", "deflate-raw":
-			r := flate.NewReader(bytes.NewReader(data))
-			result, err = io.ReadAll(io.LimitReader(r, int64(maxDecompressedSize)+1))
-			if err != nil {
-				return "", fmt.Errorf("decompress: %w", err)
-			}
-			if len(result) > maxDecompressedSize {
-				return "", fmt.Errorf("decompress: output exceeds maximum allowed size")
-			}
-			_ = r.Close()
-		case "br":
-			r := brotli.NewReader(bytes.NewReader(data))
-			result, err = io.ReadAll(io.LimitReader(r, int64(maxDecompressedSize)+1))
-			if err != nil {
-				return "", fmt.Errorf("decompress: %w", err)
-			}
-			if len(result) > maxDecompressedSize {
-				return "", fmt.Errorf("decompress: output exceeds maximum allowed size")
-			}
-		default:
-			return "", fmt.Errorf("decompress: unsupported format %q", format)
+		r, err := newDecompressReader(bytes.NewReader(data), format)
+		if err != nil {
+			return "", fmt.Errorf("decompress: %w", err)
+		}
+		result, err := io.ReadAll(io.LimitReader(r, int64(maxDecompressedSize)+1))
+		_ = r.Close()
+		if err != nil {
+			return "", fmt.Errorf("decompress: %w", err)
+		}
+		if len(result) > maxDecompressedSize {
+			return "", fmt.Errorf("decompress: output exceeds maximum allowed size")
 		}
 
 		return base64.StdEncoding.EncodeToString(result), nil
@@ -366,24 +362,10 @@ func SetupCompression(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			defer close(ss.decompDone)
 			defer func() { _ = pr.Close() }()
 
-			var reader io.ReadCloser
-			switch format {
-			case "gzip":
-				r, err := gzip.NewReader(pr)
-				if err != nil {
-					ss.decompMu.Lock()
-					ss.decompErr = err
-					ss.decompMu.Unlock()
-					return
-				}
-				reader = r
-			case "deflate", "deflate-raw":
-				reader = flate.NewReader(pr)
-			case "br":
-				reader = io.NopCloser(brotli.NewReader(pr))
-			default:
+			reader, err := newDecompressReader(pr, format)
+			if err != nil {
 				ss.decompMu.Lock()
-				ss.decompErr = fmt.Errorf("unsupported format %q", format)
+				ss.decompErr = err
 				ss.decompMu.Unlock()
 				return
 			}
@@ -24,6 +24,42 @@ func SetupConsole(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	// Build console object in JS that calls __console.
 	consoleJS := `
 (function() {
+	// formatError renders an Error as its name, message and stack followed
+	// by its cause chain. QuickJS stacks hold only the frames while V8's
+	// start with the "Name: message" line, so the header is added when
+	// missing.
+	function formatError(err, seen) {
+		seen.push(err);
+		var name = err.name === undefined ? 'Error' : String(err.name);
+		var msg = err.message === undefined ? '' : String(err.message);
+		var head = msg ? name + ': ' + msg : name;
+		var out = head;
+		if (typeof err.stack === 'string' && err.stack) {
+			var stack = err.stack.replace(/\s+$/, '');
+			out = stack.indexOf(head) === 0 ? stack : head + '\n' + stack;
+		}
+		if ('cause' in err) {
+			var cause = err.cause;
+			if (seen.indexOf(cause) !== -1) {
+				out += '\nCaused by: [Circular]';
+			} else if (isError(cause)) {
+				out += '\nCaused by: ' + formatError(cause, seen);
+			} else {
+				out += '\nCaused by: ' + formatValue(cause);
+			}
+		}
+		return out;
+	}
+	function isError(v) {
+		return v instanceof Error || Object.prototype.toString.call(v) === '[object Error]';
+	}
+	function formatValue(v) {
+		if (typeof v === 'object' && v !== null) {
+			return isError(v) ? formatError(v, []) : '[object Object]';
+		}
+		return String(v);
+	}
+
 	var levels = ['log', 'info', 'warn', 'error', 'debug'];
 	var con = {};
 	for (var i = 0; i < levels.length; i++) {
@@ -31,12 +67,7 @@ func SetupConsole(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			con[lvl] = function() {
 				var parts = [];
 				for (var j = 0; j < arguments.length; j++) {
-					var arg = arguments[j];
-					if (typeof arg === 'object' && arg !== null) {
-						parts.push('[object Object]');
-					} else {
-						parts.push(String(arg));
-					}
+					parts.push(formatValue(arguments[j]));
 				}
 				var reqID = globalThis.__requestID || '';
 				__console(reqID, lvl, parts.join(' '));
@@ -5,9 +5,13 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	cryptosubtle "crypto/subtle"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"hash"
+	"io"
+	"sync"
 
 	"github.com/cryguy/worker/v2/internal/core"
 	"github.com/cryguy/worker/v2/internal/eventloop"
@@ -26,21 +30,32 @@ const cryptoJS = `
 	for (let i = 0; i < _b64e.length; i++) _b64d[_b64e.charCodeAt(i)] = i;
 
 	const crypto = {};
+	// Held here rather than looked up on each call: Math.random reseeds
+	// through getRandomValues between requests, and must keep working when
+	// a host disables crypto and the bridge global is withdrawn.
+	const getRandomBytes = __cryptoGetRandomBytes;
 
 	crypto.getRandomValues = function(typedArray) {
-		if (!typedArray || typeof typedArray.length !== 'number') {
+		if (!typedArray || !ArrayBuffer.isView(typedArray) || typedArray instanceof DataView) {
 			throw new TypeError('getRandomValues requires a TypedArray');
 		}
-		const b64 = __cryptoGetRandomBytes(typedArray.length);
+		// The quota is on bytes, so a Uint32Array is limited to 16384 elements.
+		if (typedArray.byteLength > 65536) {
+			throw new DOMException("Failed to execute 'getRandomValues' on 'Crypto': The ArrayBufferView's byte length (" +
+				typedArray.byteLength + ") exceeds the number of bytes of entropy available via this API (65536).", 'QuotaExceededError');
+		}
+		if (typedArray.byteLength === 0) return typedArray;
+		const bytes = new Uint8Array(typedArray.buffer, typedArray.byteOffset, typedArray.byteLength);
+		const b64 = getRandomBytes(bytes.length);
 		let j = 0;
 		for (let i = 0; i < b64.length; i += 4) {
 			const a = _b64d[b64.charCodeAt(i)];
 			const b = _b64d[b64.charCodeAt(i + 1)];
 			const c = _b64d[b64.charCodeAt(i + 2)];
 			const d = _b64d[b64.charCodeAt(i + 3)];
-			if (j < typedArray.length) typedArray[j++] = (a << 2) | (b >> 4);
-			if (j < typedArray.length) typedArray[j++] = ((b & 15) << 4) | (c >> 2);
-			if (j < typedArray.length) typedArray[j++] = ((c & 3) << 6) | d;
+			if (j < bytes.length) bytes[j++] = (a << 2) | (b >> 4);
+			if (j < bytes.length) bytes[j++] = ((b & 15) << 4) | (c >> 2);
+			if (j < bytes.length) bytes[j++] = ((c & 3) << 6) | d;
 		}
 		return typedArray;
 	};
@@ -59,12 +74,31 @@ const cryptoJS = `
 		return __b64ToBuffer(resultB64);
 	};
 
+	// crypto.digestBatch(algorithm, inputs) hashes every BufferSource in
+	// inputs with a single Go call and resolves to an array of ArrayBuffers,
+	// one per input in order. Useful when hashing many small values (e.g.
+	// Merkle leaves) where a crossing per digest would dominate.
+	crypto.digestBatch = async function(algorithm, inputs) {
+		const algo = typeof algorithm === 'string' ? algorithm : algorithm.name;
+		if (inputs == null || typeof inputs[Symbol.iterator] !== 'function') {
+			throw new TypeError('digestBatch: inputs must be an iterable of BufferSource');
+		}
+		const b64s = [];
+		for (const data of inputs) b64s.push(__bufferSourceToB64(data));
+		const results = JSON.parse(__cryptoDigestBatch(algo, JSON.stringify(b64s)));
+		const out = new Array(results.length);
+		for (let i = 0; i < results.length; i++) out[i] = __b64ToBuffer(results[i]);
+		return out;
+	};
+
 	class CryptoKey {
 		constructor(id, algorithm, type, extractable, usages) {
 			this._id = id;
 			this.algorithm = algorithm;
 			this.type = type;
-			this.extractable = extractable;
+			// extractable is read-only so a worker cannot flip it to export a
+			// key that was created as non-extractable.
+			Object.defineProperty(this, 'extractable', { value: !!extractable, enumerable: true });
 			this.usages = usages;
 		}
 	}
@@ -98,6 +132,12 @@ const cryptoJS = `
 		return __b64ToBuffer(resultB64);
 	};
 
+	// Non-standard: constant-time comparison of two BufferSources, for
+	// workers that verify MACs by hand. Unequal lengths compare false.
+	subtle.timingSafeEqual = function(a, b) {
+		return !!__cryptoTimingSafeEqual(__bufferSourceToB64(a), __bufferSourceToB64(b));
+	};
+
 	subtle.verify = async function(algorithm, key, signature, data) {
 		if (key.usages && !key.usages.includes('verify')) {
 			throw new TypeError('key usages do not permit this operation');
@@ -144,19 +184,35 @@ const cryptoJS = `
 		return __b64ToBuffer(resultB64);
 	};
 
-	// Helper: convert any BufferSource or TypedArray to base64.
-	function __bufferSourceToB64(data) {
-		let arr;
+	// Helper: view the raw bytes of any BufferSource as a Uint8Array. Typed
+	// arrays of any element type and DataViews contribute exactly the bytes
+	// they cover; plain array-likes are copied element by element. Every
+	// subtle operation normalizes its data through this. BufferSource does
+	// not allow shared memory, so a SharedArrayBuffer or a view over one is
+	// a TypeError as in browsers.
+	function __isShared(buf) {
+		return typeof SharedArrayBuffer === 'function' && buf instanceof SharedArrayBuffer;
+	}
+	function __bufferSourceBytes(data) {
+		if (ArrayBuffer.isView(data)) {
+			if (__isShared(data.buffer)) throw new TypeError('BufferSource must not be backed by a SharedArrayBuffer');
+			return new Uint8Array(data.buffer, data.byteOffset, data.byteLength);
+		}
+		if (__isShared(data)) throw new TypeError('BufferSource must not be a SharedArrayBuffer');
 		if (data instanceof ArrayBuffer) {
-			arr = new Uint8Array(data);
-		} else if (data && data.buffer instanceof ArrayBuffer) {
-			arr = new Uint8Array(data.buffer, data.byteOffset || 0, data.byteLength || data.length);
-		} else if (data && typeof data.length === 'number') {
-			arr = new Uint8Array(data.length);
+			return new Uint8Array(data);
+		}
+		if (data && typeof data.length === 'number') {
+			const arr = new Uint8Array(data.length);
 			for (let i = 0; i < data.length; i++) arr[i] = data[i];
-		} else {
-			throw new TypeError('expected BufferSource');
+			return arr;
 		}
+		throw new TypeError('expected BufferSource');
+	}
+
+	// Helper: convert any BufferSource or TypedArray to base64.
+	function __bufferSourceToB64(data) {
+		const arr = __bufferSourceBytes(data);
 		const len = arr.length;
 		const parts = [];
 		for (let i = 0; i < len; i += 3) {
@@ -198,20 +254,91 @@ const cryptoJS = `
 	globalThis.crypto = crypto;
 	globalThis.CryptoKey = CryptoKey;
 	// Expose helpers globally so crypto_ext.js can use them.
+	globalThis.__bufferSourceBytes = __bufferSourceBytes;
 	globalThis.__bufferSourceToB64 = __bufferSourceToB64;
 	globalThis.__b64ToBuffer = __b64ToBuffer;
 })();
 `
 
+// mathRandomJS replaces Math.random with xoshiro128** seeded from
+// crypto.getRandomValues. The engines' built-in generators are seeded from
+// the clock (QuickJS) or once per isolate (V8), so pooled runtimes created
+// together could otherwise share a predictable stream. __reseedMathRandom
+// draws a fresh seed; pools call it between requests.
+const mathRandomJS = `
+(function() {
+	var getRandomValues = crypto.getRandomValues;
+	var s0, s1, s2, s3;
+
+	function reseed() {
+		var b = getRandomValues(new Uint8Array(16));
+		s0 = b[0] | b[1] << 8 | b[2] << 16 | b[3] << 24;
+		s1 = b[4] | b[5] << 8 | b[6] << 16 | b[7] << 24;
+		s2 = b[8] | b[9] << 8 | b[10] << 16 | b[11] << 24;
+		s3 = b[12] | b[13] << 8 | b[14] << 16 | b[15] << 24;
+		if ((s0 | s1 | s2 | s3) === 0) s0 = 1;
+	}
+
+	function next() {
+		var m = Math.imul(s1, 5);
+		var r = Math.imul(m << 7 | m >>> 25, 9) >>> 0;
+		var t = s1 << 9;
+		s2 ^= s0;
+		s3 ^= s1;
+		s1 ^= s2;
+		s0 ^= s3;
+		s2 ^= t;
+		s3 = s3 << 11 | s3 >>> 21;
+		return r;
+	}
+
+	reseed();
+	Object.defineProperty(Math, 'random', {
+		value: function random() {
+			// 53 random bits: 27 from one output and 26 from the next.
+			return ((next() >>> 5) * 67108864 + (next() >>> 6)) / 9007199254740992;
+		},
+		writable: true,
+		configurable: true,
+	});
+	Object.defineProperty(globalThis, '__reseedMathRandom', { value: reseed });
+})();
+`
+
+// CryptoRand returns the entropy source for getRandomValues, randomUUID and
+// secret key generation: crypto/rand, or cfg.CryptoRand when a test has set
+// one. The test reader is shared by every runtime, so reads are serialized.
+func CryptoRand(cfg core.EngineConfig) io.Reader {
+	if cfg.CryptoRand == nil {
+		return rand.Reader
+	}
+	return &lockedReader{r: cfg.CryptoRand}
+}
+
+// cryptoRandMu serializes reads from test entropy sources. It is shared
+// rather than per reader because each pool wraps the configured reader.
+var cryptoRandMu sync.Mutex
+
+type lockedReader struct {
+	r io.Reader
+}
+
+func (l *lockedReader) Read(p []byte) (int, error) {
+	cryptoRandMu.Lock()
+	defer cryptoRandMu.Unlock()
+	return l.r.Read(p)
+}
+
 // SetupCrypto registers Go-backed crypto helpers and evaluates the JS wrapper.
-func SetupCrypto(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+// entropy supplies getRandomValues and randomUUID; see CryptoRand.
+func SetupCrypto(rt core.JSRuntime, _ *eventloop.EventLoop, entropy io.Reader) error {
 	// __cryptoGetRandomBytes(n) -> base64 string of n random bytes.
-	if err := rt.RegisterFunc("__cryptoGetRandomBytes", func(n int) (string, error) {
+	if err := registerBridge(rt, "crypto.getRandomValues", "__cryptoGetRandomBytes", func(n int) (string, error) {
 		if n <= 0 || n > 65536 {
 			return "", fmt.Errorf("getRandomValues: byte length must be 1-65536")
 		}
 		buf := make([]byte, n)
-		if _, err := rand.Read(buf); err != nil {
+		if _, err := io.ReadFull(entropy, buf); err != nil {
 			return "", fmt.Errorf("crypto/rand: %v", err)
 		}
 		return base64.StdEncoding.EncodeToString(buf), nil
@@ -220,9 +347,9 @@ func SetupCrypto(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoRandomUUID() -> UUID v4 string.
-	if err := rt.RegisterFunc("__cryptoRandomUUID", func() (string, error) {
+	if err := registerBridge(rt, "crypto.randomUUID", "__cryptoRandomUUID", func() (string, error) {
 		var uuid [16]byte
-		if _, err := rand.Read(uuid[:]); err != nil {
+		if _, err := io.ReadFull(entropy, uuid[:]); err != nil {
 			return "", fmt.Errorf("crypto/rand: %v", err)
 		}
 		uuid[6] = (uuid[6] & 0x0f) | 0x40
@@ -235,7 +362,7 @@ func SetupCrypto(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoDigest(algorithm, dataBase64) -> resultBase64
-	if err := rt.RegisterFunc("__cryptoDigest", func(algo string, dataB64 string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoDigest", func(algo string, dataB64 string) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("digest: invalid base64 data")
@@ -259,6 +386,48 @@ func SetupCrypto(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		return err
 	}
 
+	// __cryptoDigestBatch(algorithm, inputsJSON) -> JSON array of resultBase64
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoDigestBatch", func(algo string, inputsJSON string) (string, error) {
+		var inputs []string
+		if err := json.Unmarshal([]byte(inputsJSON), &inputs); err != nil {
+			return "", fmt.Errorf("digestBatch: invalid inputs")
+		}
+		hashFn := HashFuncFromAlgo(algo)
+		if algo == "" || hashFn == nil {
+			return "", fmt.Errorf("digestBatch: unsupported algorithm %q", algo)
+		}
+		h := hashFn()
+		results := make([]string, len(inputs))
+		for i, dataB64 := range inputs {
+			data, err := base64.StdEncoding.DecodeString(dataB64)
+			if err != nil {
+				return "", fmt.Errorf("digestBatch: invalid base64 data at index %d", i)
+			}
+			h.Reset()
+			h.Write(data)
+			results[i] = base64.StdEncoding.EncodeToString(h.Sum(nil))
+		}
+		out, _ := json.Marshal(results)
+		return string(out), nil
+	}); err != nil {
+		return err
+	}
+
+	// __cryptoTimingSafeEqual(aBase64, bBase64) -> 1 if equal, else 0
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoTimingSafeEqual", func(aB64, bB64 string) (int, error) {
+		a, err := base64.StdEncoding.DecodeString(aB64)
+		if err != nil {
+			return 0, fmt.Errorf("timingSafeEqual: invalid base64 data")
+		}
+		b, err := base64.StdEncoding.DecodeString(bB64)
+		if err != nil {
+			return 0, fmt.Errorf("timingSafeEqual: invalid base64 data")
+		}
+		return timingSafeEqual(a, b), nil
+	}); err != nil {
+		return err
+	}
+
 	// Note: __cryptoExportKey is registered by SetupCryptoExt (not here)
 	// to handle both simple keys and ECDSA EC keys.
 	// __cryptoImportKey, __cryptoSign, __cryptoVerify, __cryptoEncrypt,
@@ -270,6 +439,10 @@ func SetupCrypto(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		return fmt.Errorf("evaluating crypto.js: %w", err)
 	}
 
+	if err := rt.Eval(mathRandomJS); err != nil {
+		return fmt.Errorf("evaluating math_random.js: %w", err)
+	}
+
 	// Override __bufferSourceToB64 with a Go-backed hybrid when BinaryTransferer
 	// is available: small buffers (<=64KB) use fast pure-JS btoa, large buffers
 	// use the binary bridge with Go's base64.StdEncoding.EncodeToString.
@@ -287,17 +460,7 @@ func SetupCrypto(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		}
 
 		if err := rt.Eval(`globalThis.__bufferSourceToB64 = function(data) {
-			var arr;
-			if (data instanceof ArrayBuffer) {
-				arr = new Uint8Array(data);
-			} else if (data && data.buffer instanceof ArrayBuffer) {
-				arr = new Uint8Array(data.buffer, data.byteOffset || 0, data.byteLength || data.length);
-			} else if (data && typeof data.length === 'number') {
-				arr = new Uint8Array(data.length);
-				for (var i = 0; i < data.length; i++) arr[i] = data[i];
-			} else {
-				throw new TypeError('expected BufferSource');
-			}
+			var arr = __bufferSourceBytes(data);
 			if (arr.byteLength <= 65536) {
 				var _parts = [];
 				for (var _i = 0; _i < arr.length; _i += 8192) {
@@ -318,6 +481,15 @@ func SetupCrypto(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	return nil
 }
 
+// timingSafeEqual returns 1 if a and b hold the same bytes, else 0. The
+// shared prefix is always compared in full, so inputs of different lengths
+// take time proportional to the shorter one rather than returning early.
+func timingSafeEqual(a, b []byte) int {
+	n := min(len(a), len(b))
+	eq := cryptosubtle.ConstantTimeCompare(a[:n], b[:n])
+	return eq & cryptosubtle.ConstantTimeEq(int32(len(a)), int32(len(b)))
+}
+
 // HashFuncFromAlgo returns the hash.Hash constructor for the given algorithm name.
 func HashFuncFromAlgo(algo string) func() hash.Hash {
 	switch NormalizeAlgo(algo) {
@@ -94,6 +94,17 @@ subtle.deriveBits = async function(algorithm, baseKey, length) {
 	var saltB64 = algo.salt ? __bufferSourceToB64(algo.salt) : '';
 	var infoB64 = algo.info ? __bufferSourceToB64(algo.info) : '';
 	var iterations = algo.iterations || 0;
+	// A null length asks HKDF for the full hash-length output (signalled to
+	// Go as -1); PBKDF2 has no natural length and requires one. A length of
+	// 0 derives an empty result for both.
+	if (length === null || length === undefined) {
+		if (String(algo.name).toUpperCase() !== 'HKDF') {
+			throw new DOMException('deriveBits: length is required for ' + algo.name, 'OperationError');
+		}
+		length = -1;
+	} else {
+		length = length >>> 0;
+	}
 	var resultB64 = __cryptoDeriveBits(algo.name, baseKey._id, length, hashName, saltB64, infoB64, iterations);
 	return __b64ToBuffer(resultB64);
 };
@@ -127,7 +138,7 @@ subtle.deriveKey = async function(algorithm, baseKey, derivedKeyAlgorithm, extra
 // SetupCryptoDerive registers HKDF and PBKDF2 deriveBits/deriveKey.
 // Must run after SetupCryptoExt.
 func SetupCryptoDerive(rt core.JSRuntime, _ *eventloop.EventLoop) error {
-	if err := rt.RegisterFunc("__cryptoDeriveBits", func(algoName string, keyID int, lengthBits int, hashName, saltB64, infoB64 string, iterations int) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoDeriveBits", func(algoName string, keyID int, lengthBits int, hashName, saltB64, infoB64 string, iterations int) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		entry := core.GetCryptoKey(reqID, keyID)
 		if entry == nil {
@@ -149,6 +160,9 @@ func SetupCryptoDerive(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			if err != nil {
 				return "", fmt.Errorf("deriveBits: invalid info base64")
 			}
+			if lengthBits < 0 {
+				lengthBits = hashFn().Size() * 8
+			}
 			result, err := hkdfDeriveBits(hashFn, entry.Data, salt, infoBytes, lengthBits)
 			if err != nil {
 				return "", fmt.Errorf("deriveBits: %s", err.Error())
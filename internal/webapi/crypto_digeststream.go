@@ -22,8 +22,7 @@ const digestStreamJS = `
 	for (let i = 0; i < _b64e.length; i++) _b64d[_b64e.charCodeAt(i)] = i;
 
 	function bufToB64(arr) {
-		if (arr instanceof ArrayBuffer) arr = new Uint8Array(arr);
-		else if (arr.buffer instanceof ArrayBuffer) arr = new Uint8Array(arr.buffer, arr.byteOffset || 0, arr.byteLength || arr.length);
+		arr = __bufferSourceBytes(arr);
 		const len = arr.length;
 		let r = '';
 		for (let i = 0; i < len; i += 3) {
@@ -96,6 +95,19 @@ const digestStreamJS = `
 		globalThis.crypto.DigestStream = DigestStream;
 	}
 	globalThis.DigestStream = DigestStream;
+
+	// subtle.digest also accepts a ReadableStream. Its chunks are hashed
+	// incrementally on the Go side instead of being buffered first.
+	const subtle = globalThis.crypto && globalThis.crypto.subtle;
+	if (subtle) {
+		const oneShotDigest = subtle.digest;
+		subtle.digest = async function(algorithm, data) {
+			if (!(data instanceof ReadableStream)) return oneShotDigest.call(this, algorithm, data);
+			const ds = new DigestStream(algorithm);
+			await data.pipeTo(ds);
+			return ds.digest;
+		};
+	}
 })();
 `
 
@@ -119,7 +131,7 @@ func newDigestHash(algo string) (hash.Hash, error) {
 // the JS wrapper.
 func SetupDigestStream(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	// __cryptoDigestStreamCreate(requestID, algorithm) -> streamID string
-	if err := rt.RegisterFunc("__cryptoDigestStreamCreate", func(reqIDStr, algo string) (string, error) {
+	if err := registerBridge(rt, "crypto.DigestStream", "__cryptoDigestStreamCreate", func(reqIDStr, algo string) (string, error) {
 		reqID, _ := strconv.ParseUint(reqIDStr, 10, 64)
 
 		h, err := newDigestHash(algo)
@@ -145,7 +157,7 @@ func SetupDigestStream(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoDigestStreamWrite(requestID, streamID, base64data)
-	if err := rt.RegisterFunc("__cryptoDigestStreamWrite", func(reqIDStr, streamID, dataB64 string) error {
+	if err := registerBridge(rt, "crypto.DigestStream", "__cryptoDigestStreamWrite", func(reqIDStr, streamID, dataB64 string) error {
 		reqID, _ := strconv.ParseUint(reqIDStr, 10, 64)
 
 		data, err := base64.StdEncoding.DecodeString(dataB64)
@@ -170,7 +182,7 @@ func SetupDigestStream(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoDigestStreamFinish(requestID, streamID) -> base64 hash
-	if err := rt.RegisterFunc("__cryptoDigestStreamFinish", func(reqIDStr, streamID string) (string, error) {
+	if err := registerBridge(rt, "crypto.DigestStream", "__cryptoDigestStreamFinish", func(reqIDStr, streamID string) (string, error) {
 		reqID, _ := strconv.ParseUint(reqIDStr, 10, 64)
 
 		state := core.GetRequestState(reqID)
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/cryguy/worker/v2/internal/core"
 	"github.com/cryguy/worker/v2/internal/eventloop"
@@ -44,7 +45,7 @@ subtle.generateKey = async function(algorithm, extractable, usages) {
 	var algo = typeof algorithm === 'string' ? { name: algorithm } : algorithm;
 	if (algo.name === 'ECDH') {
 		var curve = algo.namedCurve || 'P-256';
-		var resultJSON = __cryptoGenerateECDH(curve, extractable);
+		var resultJSON = __cryptoGenerateECDH(curve, !!extractable);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
 		return {
@@ -54,7 +55,7 @@ subtle.generateKey = async function(algorithm, extractable, usages) {
 		};
 	}
 	if (algo.name === 'X25519') {
-		var resultJSON = __cryptoGenerateX25519(extractable);
+		var resultJSON = __cryptoGenerateX25519(!!extractable);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
 		return {
@@ -120,7 +121,7 @@ subtle.importKey = async function(format, keyData, algorithm, extractable, usage
 		} else {
 			dataStr = __bufferSourceToB64(keyData);
 		}
-		var resultJSON = __cryptoImportECDH(format, dataStr, curve, extractable);
+		var resultJSON = __cryptoImportECDH(format, dataStr, curve, !!extractable);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
 		return new CK(result.keyId, { name: 'ECDH', namedCurve: curve }, result.keyType, extractable, usages);
@@ -131,7 +132,7 @@ subtle.importKey = async function(format, keyData, algorithm, extractable, usage
 		if (usages && (usages.indexOf('deriveBits') >= 0 || usages.indexOf('deriveKey') >= 0)) {
 			keyType = 'private';
 		}
-		var resultJSON = __cryptoImportX25519(format, dataStr, keyType, extractable);
+		var resultJSON = __cryptoImportX25519(format, dataStr, keyType, !!extractable);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
 		return new CK(result.keyId, { name: 'X25519' }, result.keyType, extractable, usages);
@@ -161,9 +162,12 @@ subtle.exportKey = async function(format, key) {
 
 // SetupCryptoECDH registers ECDH and X25519 key agreement operations.
 // Must run after SetupCryptoDerive.
-func SetupCryptoECDH(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+// entropy supplies X25519 key generation; see CryptoRand. The NIST curves
+// draw from crypto/rand, which the standard library no longer lets callers
+// replace.
+func SetupCryptoECDH(rt core.JSRuntime, _ *eventloop.EventLoop, entropy io.Reader) error {
 	// __cryptoGenerateECDH(curve, extractable) -> JSON { privateKeyId, publicKeyId }
-	if err := rt.RegisterFunc("__cryptoGenerateECDH", func(curveName string, extractableVal bool) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoGenerateECDH", func(curveName string, extractableVal bool) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
@@ -192,7 +196,7 @@ func SetupCryptoECDH(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoDeriveECDH(privateKeyID, publicKeyID, lengthBits) -> base64 shared secret
-	if err := rt.RegisterFunc("__cryptoDeriveECDH", func(privKeyID, pubKeyID int, lengthBits int) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoDeriveECDH", func(privKeyID, pubKeyID int, lengthBits int) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		privEntry := core.GetCryptoKey(reqID, privKeyID)
 		if privEntry == nil {
@@ -229,7 +233,7 @@ func SetupCryptoECDH(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoImportECDH(format, dataB64, curve, extractable) -> JSON { keyId, keyType }
-	if err := rt.RegisterFunc("__cryptoImportECDH", func(format, dataStr, curveName string, extractableVal bool) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoImportECDH", func(format, dataStr, curveName string, extractableVal bool) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
@@ -267,7 +271,7 @@ func SetupCryptoECDH(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoExportECDH(keyID, format) -> base64 or JSON string
-	if err := rt.RegisterFunc("__cryptoExportECDH", func(keyID int, format string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoExportECDH", func(keyID int, format string) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		entry := core.GetCryptoKey(reqID, keyID)
 		if entry == nil {
@@ -302,13 +306,17 @@ func SetupCryptoECDH(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	// --- X25519 callbacks ---
 
 	// __cryptoGenerateX25519(extractable) -> JSON { privateKeyId, publicKeyId }
-	if err := rt.RegisterFunc("__cryptoGenerateX25519", func(extractableVal bool) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoGenerateX25519", func(extractableVal bool) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
 		}
 
-		privKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+		seed := make([]byte, 32)
+		if _, err := io.ReadFull(entropy, seed); err != nil {
+			return fmt.Sprintf(`{"error":"key generation failed: %s"}`, err.Error()), nil
+		}
+		privKey, err := ecdh.X25519().NewPrivateKey(seed)
 		if err != nil {
 			return fmt.Sprintf(`{"error":"key generation failed: %s"}`, err.Error()), nil
 		}
@@ -326,7 +334,7 @@ func SetupCryptoECDH(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoDeriveX25519(privateKeyID, publicKeyID, lengthBits) -> base64 shared secret
-	if err := rt.RegisterFunc("__cryptoDeriveX25519", func(privKeyID, pubKeyID int, lengthBits int) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoDeriveX25519", func(privKeyID, pubKeyID int, lengthBits int) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		privEntry := core.GetCryptoKey(reqID, privKeyID)
 		if privEntry == nil {
@@ -363,7 +371,7 @@ func SetupCryptoECDH(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoImportX25519(format, dataB64, keyType, extractable) -> JSON { keyId, keyType }
-	if err := rt.RegisterFunc("__cryptoImportX25519", func(format, dataStr, keyType string, extractableVal bool) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoImportX25519", func(format, dataStr, keyType string, extractableVal bool) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
@@ -407,7 +415,7 @@ func SetupCryptoECDH(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoExportX25519(keyID, format) -> base64
-	if err := rt.RegisterFunc("__cryptoExportX25519", func(keyID int, format string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoExportX25519", func(keyID int, format string) (string, error) {
 		if format != "raw" {
 			return "", fmt.Errorf("exportX25519: only raw format supported, got %q", format)
 		}
@@ -2,10 +2,10 @@ package webapi
 
 import (
 	"crypto/ed25519"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/cryguy/worker/v2/internal/core"
 	"github.com/cryguy/worker/v2/internal/eventloop"
@@ -50,7 +50,10 @@ subtle.importKey = async function(format, keyData, algorithm, extractable, usage
 		} else {
 			dataStr = __bufferSourceToB64(keyData);
 		}
-		var resultJSON = __cryptoImportKeyEd25519(format, dataStr, extractable);
+		// 32 raw bytes are either a public key or a private key seed; a
+		// key imported for signing is the latter.
+		var rawPrivate = format === 'raw' && (usages || []).indexOf('sign') !== -1;
+		var resultJSON = __cryptoImportKeyEd25519(format, dataStr, !!extractable, rawPrivate);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
 		return new CK(result.keyId, { name: 'Ed25519' }, result.keyType, extractable, usages);
@@ -73,7 +76,7 @@ subtle.exportKey = async function(format, key) {
 subtle.generateKey = async function(algorithm, extractable, usages) {
 	var algo = typeof algorithm === 'string' ? { name: algorithm } : algorithm;
 	if (algo.name === 'Ed25519') {
-		var resultJSON = __cryptoGenerateKeyEd25519(extractable);
+		var resultJSON = __cryptoGenerateKeyEd25519(!!extractable);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
 		return {
@@ -91,9 +94,10 @@ subtle.generateKey = async function(algorithm, extractable, usages) {
 
 // SetupCryptoEd25519 registers Ed25519 sign/verify/import/export/generate.
 // Must run after SetupCryptoExt.
-func SetupCryptoEd25519(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+// entropy supplies the key generation seed; see CryptoRand.
+func SetupCryptoEd25519(rt core.JSRuntime, _ *eventloop.EventLoop, entropy io.Reader) error {
 	// __cryptoSignEd25519(keyID, dataB64) -> sigB64
-	if err := rt.RegisterFunc("__cryptoSignEd25519", func(keyID int, dataB64 string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoSignEd25519", func(keyID int, dataB64 string) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("signEd25519: invalid base64")
@@ -117,7 +121,7 @@ func SetupCryptoEd25519(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoVerifyEd25519(keyID, sigB64, dataB64) -> bool
-	if err := rt.RegisterFunc("__cryptoVerifyEd25519", func(keyID int, sigB64, dataB64 string) (int, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoVerifyEd25519", func(keyID int, sigB64, dataB64 string) (int, error) {
 		sig, err := base64.StdEncoding.DecodeString(sigB64)
 		if err != nil {
 			return 0, fmt.Errorf("verifyEd25519: invalid signature base64")
@@ -149,13 +153,13 @@ func SetupCryptoEd25519(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoGenerateKeyEd25519(extractable) -> JSON { privateKeyId, publicKeyId }
-	if err := rt.RegisterFunc("__cryptoGenerateKeyEd25519", func(extractableVal bool) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoGenerateKeyEd25519", func(extractableVal bool) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
 		}
 
-		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		pubKey, privKey, err := ed25519.GenerateKey(entropy)
 		if err != nil {
 			return fmt.Sprintf(`{"error":"key generation failed: %s"}`, err.Error()), nil
 		}
@@ -172,8 +176,9 @@ func SetupCryptoEd25519(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		return err
 	}
 
-	// __cryptoImportKeyEd25519(format, dataStr, extractable) -> JSON { keyId, keyType }
-	if err := rt.RegisterFunc("__cryptoImportKeyEd25519", func(format, dataStr string, extractableVal bool) (string, error) {
+	// __cryptoImportKeyEd25519(format, dataStr, extractable, rawPrivate) -> JSON { keyId, keyType }
+	// rawPrivate marks a 32-byte raw key as a private key seed rather than a public key.
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoImportKeyEd25519", func(format, dataStr string, extractableVal, rawPrivate bool) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
@@ -185,7 +190,7 @@ func SetupCryptoEd25519(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			if err != nil {
 				return `{"error":"invalid base64"}`, nil
 			}
-			if len(keyData) == ed25519.PublicKeySize {
+			if len(keyData) == ed25519.PublicKeySize && !rawPrivate {
 				id := core.ImportCryptoKeyFull(reqID, &core.CryptoKeyEntry{
 					AlgoName: "Ed25519", KeyType: "public",
 					EcKey: ed25519.PublicKey(keyData), Extractable: extractableVal,
@@ -252,7 +257,7 @@ func SetupCryptoEd25519(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoExportKeyEd25519(keyID, format) -> base64 or JSON string
-	if err := rt.RegisterFunc("__cryptoExportKeyEd25519", func(keyID int, format string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoExportKeyEd25519", func(keyID int, format string) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		entry := core.GetCryptoKey(reqID, keyID)
 		if entry == nil {
@@ -11,13 +11,76 @@ import (
 	cryptosubtle "crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 
 	"github.com/cryguy/worker/v2/internal/core"
 	"github.com/cryguy/worker/v2/internal/eventloop"
 )
 
+// aesJWKAlgSuffix maps AES algorithms to the suffix of their JWK "alg"
+// values, e.g. AES-GCM with a 128-bit key is "A128GCM".
+var aesJWKAlgSuffix = map[string]string{
+	"AES-GCM": "GCM",
+	"AES-CBC": "CBC",
+	"AES-CTR": "CTR",
+	"AES-KW":  "KW",
+}
+
+// validateAESJWK checks an oct JWK imported for an AES algorithm: k must be a
+// valid AES key length, and alg and use, when present, must agree with the
+// algorithm and the key size. Non-AES algorithms are not checked.
+func validateAESJWK(algoName string, jwk map[string]interface{}, keyData []byte) error {
+	suffix, ok := aesJWKAlgSuffix[algoName]
+	if !ok {
+		return nil
+	}
+	bits := len(keyData) * 8
+	if bits != 128 && bits != 192 && bits != 256 {
+		return fmt.Errorf("importKey: invalid %s key length %d bits", algoName, bits)
+	}
+	if alg, ok := jwk["alg"].(string); ok && alg != "" {
+		if want := fmt.Sprintf("A%d%s", bits, suffix); alg != want {
+			return fmt.Errorf("importKey: JWK alg %q does not match a %d-bit %s key (want %q)", alg, bits, algoName, want)
+		}
+	}
+	if use, ok := jwk["use"].(string); ok && use != "" && use != "enc" {
+		return fmt.Errorf("importKey: JWK use %q is not valid for %s", use, algoName)
+	}
+	return nil
+}
+
+// hmacJWKAlgHash maps the JWK "alg" values for HMAC to their hash.
+var hmacJWKAlgHash = map[string]string{
+	"HS1":   "SHA-1",
+	"HS256": "SHA-256",
+	"HS384": "SHA-384",
+	"HS512": "SHA-512",
+}
+
+// resolveHMACJWKHash reconciles the hash passed to importKey with the alg
+// of an oct JWK imported for HMAC. The alg supplies the hash when none was
+// given; when both are present they must agree.
+func resolveHMACJWKHash(hashAlgo string, jwk map[string]interface{}) (string, error) {
+	alg, _ := jwk["alg"].(string)
+	if alg == "" {
+		return hashAlgo, nil
+	}
+	algHash, ok := hmacJWKAlgHash[alg]
+	if !ok {
+		return "", fmt.Errorf("importKey: JWK alg %q is not valid for HMAC", alg)
+	}
+	if hashAlgo == "" {
+		return algHash, nil
+	}
+	if h := NormalizeAlgo(hashAlgo); h != algHash {
+		return "", fmt.Errorf("importKey: JWK alg %q does not match hash %s", alg, h)
+	}
+	return algHash, nil
+}
+
 // cryptoExtJS patches crypto.subtle with JWK import/export, ECDSA, generateKey,
 // and AES-CBC support. Must be evaluated AFTER the base cryptoJS.
 const cryptoExtJS = `
@@ -25,20 +88,41 @@ const cryptoExtJS = `
 var subtle = crypto.subtle;
 var CK = CryptoKey;
 
+// hmacTruncateKey keeps only the leading length bits of raw HMAC key data,
+// zeroing any unused bits in the final byte.
+function hmacTruncateKey(keyData, length) {
+	var bytes = __bufferSourceBytes(keyData);
+	if (typeof length !== 'number' || !(length > 0) || length !== Math.floor(length)) {
+		throw new DOMException('importKey: HMAC length must be a positive integer', 'DataError');
+	}
+	if (length > bytes.length * 8) {
+		throw new DOMException('importKey: HMAC length ' + length + ' exceeds key data (' + (bytes.length * 8) + ' bits)', 'DataError');
+	}
+	var out = bytes.slice(0, Math.ceil(length / 8));
+	if (length % 8 !== 0) {
+		out[out.length - 1] &= (0xff << (8 - length % 8)) & 0xff;
+	}
+	return out;
+}
+
 subtle.importKey = async function(format, keyData, algorithm, extractable, usages) {
 	var algo = typeof algorithm === 'string' ? { name: algorithm } : algorithm;
 	var hashName = algo.hash ? (typeof algo.hash === 'string' ? algo.hash : algo.hash.name) : '';
 	var namedCurve = algo.namedCurve || '';
 	if (format === 'raw') {
+		if (String(algo.name).toUpperCase() === 'HMAC' && algo.length !== undefined) {
+			keyData = hmacTruncateKey(keyData, algo.length);
+		}
 		var b64 = __bufferSourceToB64(keyData);
-		var id = __cryptoImportKey(algo.name, hashName, b64, namedCurve, extractable);
+		var id = __cryptoImportKey(algo.name, hashName, b64, namedCurve, !!extractable);
 		var keyType = (namedCurve && (algo.name === 'ECDSA' || algo.name === 'ECDH')) ? 'public' : 'secret';
 		return new CK(id, algo, keyType, extractable, usages);
 	} else if (format === 'jwk') {
 		var jwkJSON = JSON.stringify(keyData);
-		var resultJSON = __cryptoImportKeyJWK(algo.name, hashName, jwkJSON, namedCurve, extractable);
+		var resultJSON = __cryptoImportKeyJWK(algo.name, hashName, jwkJSON, namedCurve, !!extractable);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
+		if (result.hash && !hashName) algo = Object.assign({}, algo, { hash: { name: result.hash } });
 		return new CK(result.keyId, algo, result.keyType || 'secret', extractable, usages);
 	}
 	throw new TypeError('importKey: unsupported format "' + format + '"');
@@ -64,7 +148,7 @@ subtle.generateKey = async function(algorithm, extractable, usages) {
 	var hashName = algo.hash ? (typeof algo.hash === 'string' ? algo.hash : algo.hash.name) : '';
 	var namedCurve = algo.namedCurve || '';
 	var keyLength = algo.length || 0;
-	var resultJSON = __cryptoGenerateKey(algo.name, hashName, namedCurve, extractable, keyLength);
+	var resultJSON = __cryptoGenerateKey(algo.name, hashName, namedCurve, !!extractable, keyLength);
 	var result = JSON.parse(resultJSON);
 	if (result.error) throw new TypeError(result.error);
 	if (result.privateKeyId !== undefined) {
@@ -100,6 +184,108 @@ subtle.verify = async function(algorithm, key, signature, data) {
 	return !!__cryptoVerify(algo.name, key._id, sigB64, dataB64, hashName);
 };
 
+// Payloads above 64KB are handed to Go as raw bytes over the binary bridge
+// (when the runtime provides one) instead of being base64-encoded both ways.
+function aesGCMBinary(op, algorithm, key, data) {
+	if (key.usages && !key.usages.includes(op)) {
+		throw new TypeError('key usages do not permit this operation');
+	}
+	var algo = typeof algorithm === 'string' ? { name: algorithm } : algorithm;
+	var arr = __bufferSourceBytes(data);
+	var buf = globalThis.__binary_mode === 'sab' ? new SharedArrayBuffer(arr.byteLength) : new ArrayBuffer(arr.byteLength);
+	new Uint8Array(buf).set(arr);
+	var ivB64 = algo.iv ? __bufferSourceToB64(algo.iv) : '';
+	var aadB64 = algo.additionalData ? __bufferSourceToB64(algo.additionalData) : '';
+	globalThis.__tmp_crypto_in = buf;
+	try {
+		__cryptoAESGCMBinary(op, key._id, ivB64, aadB64);
+		return globalThis.__tmp_crypto_out;
+	} finally {
+		delete globalThis.__tmp_crypto_in;
+		delete globalThis.__tmp_crypto_out;
+	}
+}
+
+function useAESGCMBinary(algorithm, data) {
+	if (typeof __cryptoAESGCMBinary !== 'function') return false;
+	var name = typeof algorithm === 'string' ? algorithm : (algorithm && algorithm.name);
+	if (String(name).toUpperCase() !== 'AES-GCM') return false;
+	return (data instanceof ArrayBuffer || ArrayBuffer.isView(data)) && data.byteLength > 65536;
+}
+
+// Non-standard: AES-GCM with a detached tag, for formats such as COSE
+// that carry the tag apart from the ciphertext. Encrypting with
+// {detachedTag: true} resolves to {ciphertext, tag} instead of the two
+// joined; decrypting with a {tag} BufferSource appends it to data first.
+var GCM_TAG_BYTES = 16;
+
+function isAESGCM(algorithm) {
+	return !!algorithm && typeof algorithm === 'object' && String(algorithm.name).toUpperCase() === 'AES-GCM';
+}
+
+function toBytes(data) {
+	if (data instanceof ArrayBuffer || ArrayBuffer.isView(data)) return __bufferSourceBytes(data);
+	throw new TypeError('AES-GCM: data must be a BufferSource');
+}
+
+// AES-CBC failures are OperationErrors: an IV that is not one block long,
+// a ciphertext that is not whole blocks, or PKCS#7 padding that does not
+// check out once decrypted, which is how a wrong key usually shows up.
+var CBC_BLOCK_BYTES = 16;
+
+function checkAESCBCIV(algorithm) {
+	var name = typeof algorithm === 'string' ? algorithm : (algorithm && algorithm.name);
+	if (String(name).toUpperCase() !== 'AES-CBC') return false;
+	var iv = typeof algorithm === 'object' ? algorithm.iv : undefined;
+	if (!(iv instanceof ArrayBuffer || ArrayBuffer.isView(iv)) || iv.byteLength !== CBC_BLOCK_BYTES) {
+		throw new DOMException('AES-CBC: iv must be ' + CBC_BLOCK_BYTES + ' bytes', 'OperationError');
+	}
+	return true;
+}
+
+var _b64Encrypt = subtle.encrypt;
+subtle.encrypt = async function(algorithm, key, data) {
+	checkAESCBCIV(algorithm);
+	var out;
+	if (useAESGCMBinary(algorithm, data)) out = aesGCMBinary('encrypt', algorithm, key, data);
+	else out = await _b64Encrypt.call(this, algorithm, key, data);
+	if (!isAESGCM(algorithm) || !algorithm.detachedTag) return out;
+	var sealed = new Uint8Array(out);
+	var split = sealed.byteLength - GCM_TAG_BYTES;
+	return { ciphertext: sealed.slice(0, split).buffer, tag: sealed.slice(split).buffer };
+};
+
+var _b64Decrypt = subtle.decrypt;
+subtle.decrypt = async function(algorithm, key, data) {
+	if (isAESGCM(algorithm) && algorithm.tag !== undefined) {
+		var tag = toBytes(algorithm.tag);
+		if (tag.byteLength !== GCM_TAG_BYTES) {
+			throw new DOMException('AES-GCM: detached tag must be ' + GCM_TAG_BYTES + ' bytes', 'OperationError');
+		}
+		var ct = toBytes(data);
+		var joined = new Uint8Array(ct.byteLength + GCM_TAG_BYTES);
+		joined.set(ct);
+		joined.set(tag, ct.byteLength);
+		data = joined;
+	}
+	if (checkAESCBCIV(algorithm)) {
+		var n = data instanceof ArrayBuffer || ArrayBuffer.isView(data) ? data.byteLength : -1;
+		if (n === 0 || (n > 0 && n % CBC_BLOCK_BYTES !== 0)) {
+			throw new DOMException('AES-CBC: ciphertext must be a non-empty multiple of ' + CBC_BLOCK_BYTES + ' bytes', 'OperationError');
+		}
+		if (key.usages && !key.usages.includes('decrypt')) {
+			throw new TypeError('key usages do not permit this operation');
+		}
+		var result = JSON.parse(__cryptoDecryptAESCBC(key._id, __bufferSourceToB64(data), __bufferSourceToB64(algorithm.iv)));
+		if (result.code === 'padding') {
+			throw new DOMException('AES-CBC: decryption failed: invalid padding', result.error);
+		}
+		return __b64ToBuffer(result.data);
+	}
+	if (useAESGCMBinary(algorithm, data)) return aesGCMBinary('decrypt', algorithm, key, data);
+	return _b64Decrypt.call(this, algorithm, key, data);
+};
+
 subtle.wrapKey = async function(format, key, wrappingKey, wrapAlgorithm) {
 	var exported = await subtle.exportKey(format, key);
 	var data;
@@ -153,9 +339,10 @@ func PadBytes(b []byte, length int) []byte {
 
 // SetupCryptoExt registers extended crypto Go functions and evaluates the JS
 // patches for JWK, ECDSA, generateKey, and AES-CBC. Must run after SetupCrypto.
-func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+// entropy supplies HMAC and AES key generation; see CryptoRand.
+func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop, entropy io.Reader) error {
 	// Override __cryptoImportKey to accept namedCurve, extractable, and handle ECDSA raw keys.
-	if err := rt.RegisterFunc("__cryptoImportKey", func(algoName, hashAlgo, dataB64, namedCurve string, extractableVal bool) (int, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoImportKey", func(algoName, hashAlgo, dataB64, namedCurve string, extractableVal bool) (int, error) {
 		keyData, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return 0, fmt.Errorf("importKey: invalid base64")
@@ -198,7 +385,11 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			return id, nil
 		}
 
-		id := core.ImportCryptoKey(reqID, hashAlgo, keyData)
+		id := core.ImportCryptoKeyFull(reqID, &core.CryptoKeyEntry{
+			Data:        keyData,
+			HashAlgo:    hashAlgo,
+			Extractable: extractableVal,
+		})
 		if id < 0 {
 			return 0, fmt.Errorf("importKey: no active request state")
 		}
@@ -209,7 +400,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 
 	// Override __cryptoExportKey to handle ECDSA EC keys (which store key
 	// material in EcKey, not Data).
-	if err := rt.RegisterFunc("__cryptoExportKey", func(keyID int) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoExportKey", func(keyID int) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		entry := core.GetCryptoKey(reqID, keyID)
 		if entry == nil {
@@ -241,7 +432,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoImportKeyJWK(algoName, hashAlgo, jwkJSON, namedCurve, extractable) -> JSON result
-	if err := rt.RegisterFunc("__cryptoImportKeyJWK", func(algoName, hashAlgo, jwkJSON, namedCurve string, extractableVal bool) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoImportKeyJWK", func(algoName, hashAlgo, jwkJSON, namedCurve string, extractableVal bool) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
@@ -260,6 +451,14 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			if err != nil {
 				return `{"error":"invalid JWK k value"}`, nil
 			}
+			if err := validateAESJWK(NormalizeAlgo(algoName), jwk, keyData); err != nil {
+				return fmt.Sprintf(`{"error":%q}`, err.Error()), nil
+			}
+			if NormalizeAlgo(algoName) == "HMAC" {
+				if hashAlgo, err = resolveHMACJWKHash(hashAlgo, jwk); err != nil {
+					return fmt.Sprintf(`{"error":%q}`, err.Error()), nil
+				}
+			}
 			entry := &core.CryptoKeyEntry{
 				Data:        keyData,
 				HashAlgo:    hashAlgo,
@@ -268,7 +467,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 				Extractable: extractableVal,
 			}
 			id := core.ImportCryptoKeyFull(reqID, entry)
-			return fmt.Sprintf(`{"keyId":%d,"keyType":"secret"}`, id), nil
+			return fmt.Sprintf(`{"keyId":%d,"keyType":"secret","hash":%q}`, id, hashAlgo), nil
 
 		case "EC":
 			crv, _ := jwk["crv"].(string)
@@ -324,7 +523,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoExportKeyJWK(keyID, algoName, hashAlgo, namedCurve) -> JSON JWK
-	if err := rt.RegisterFunc("__cryptoExportKeyJWK", func(keyID int, algoName, hashAlgo, namedCurve string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoExportKeyJWK", func(keyID int, algoName, hashAlgo, namedCurve string) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		entry := core.GetCryptoKey(reqID, keyID)
 		if entry == nil {
@@ -373,12 +572,11 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			case "SHA-512":
 				jwk["alg"] = "HS512"
 			}
-		case "AES-GCM":
-			switch len(entry.Data) {
-			case 16:
-				jwk["alg"] = "A128GCM"
-			case 32:
-				jwk["alg"] = "A256GCM"
+		case "AES-GCM", "AES-CBC", "AES-CTR", "AES-KW":
+			// alg follows the key size, e.g. A128GCM or A256KW.
+			switch bits := len(entry.Data) * 8; bits {
+			case 128, 192, 256:
+				jwk["alg"] = fmt.Sprintf("A%d%s", bits, aesJWKAlgSuffix[algo])
 			}
 		}
 		data, _ := json.Marshal(jwk)
@@ -388,7 +586,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoGenerateKey(algoName, hashAlgo, namedCurve, extractable, length) -> JSON result
-	if err := rt.RegisterFunc("__cryptoGenerateKey", func(algoName, hashAlgo, namedCurve string, extractableVal bool, length int) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoGenerateKey", func(algoName, hashAlgo, namedCurve string, extractableVal bool, length int) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
@@ -425,7 +623,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 				keyLen = 20
 			}
 			keyData := make([]byte, keyLen)
-			if _, err := rand.Read(keyData); err != nil {
+			if _, err := io.ReadFull(entropy, keyData); err != nil {
 				return fmt.Sprintf(`{"error":"key generation failed: %s"}`, err.Error()), nil
 			}
 			id := core.ImportCryptoKeyFull(reqID, &core.CryptoKeyEntry{
@@ -444,7 +642,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 				return `{"error":"AES: length must be 128, 192, or 256"}`, nil
 			}
 			keyData := make([]byte, keyLen)
-			if _, err := rand.Read(keyData); err != nil {
+			if _, err := io.ReadFull(entropy, keyData); err != nil {
 				return fmt.Sprintf(`{"error":"key generation failed: %s"}`, err.Error()), nil
 			}
 			id := core.ImportCryptoKeyFull(reqID, &core.CryptoKeyEntry{
@@ -461,7 +659,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// Override __cryptoSign to support ECDSA + extra hash arg.
-	if err := rt.RegisterFunc("__cryptoSign", func(algo string, keyID int, dataB64, signHashAlgo string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoSign", func(algo string, keyID int, dataB64, signHashAlgo string) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("sign: invalid base64")
@@ -519,7 +717,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// Override __cryptoVerify to support ECDSA + extra hash arg.
-	if err := rt.RegisterFunc("__cryptoVerify", func(algo string, keyID int, sigB64, dataB64, verifyHashAlgo string) (int, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoVerify", func(algo string, keyID int, sigB64, dataB64, verifyHashAlgo string) (int, error) {
 		sig, err := base64.StdEncoding.DecodeString(sigB64)
 		if err != nil {
 			return 0, fmt.Errorf("verify: invalid signature base64")
@@ -584,7 +782,7 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// Override __cryptoEncrypt to add AES-CBC.
-	if err := rt.RegisterFunc("__cryptoEncrypt", func(algo string, keyID int, dataB64, ivB64, aadB64 string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoEncrypt", func(algo string, keyID int, dataB64, ivB64, aadB64 string) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("encrypt: invalid base64 data")
@@ -601,9 +799,6 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			if err != nil {
 				return "", fmt.Errorf("encrypt: invalid IV base64")
 			}
-			if len(iv) != 12 {
-				return "", fmt.Errorf("encrypt: AES-GCM IV must be exactly 12 bytes, got %d", len(iv))
-			}
 			var aad []byte
 			if aadB64 != "" {
 				aad, err = base64.StdEncoding.DecodeString(aadB64)
@@ -611,15 +806,10 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 					return "", fmt.Errorf("encrypt: invalid AAD base64")
 				}
 			}
-			block, err := aes.NewCipher(entry.Data)
-			if err != nil {
-				return "", fmt.Errorf("encrypt: %s", err.Error())
-			}
-			gcm, err := cipher.NewGCM(block)
+			ct, err := aesGCMCrypt("encrypt", entry.Data, iv, data, aad)
 			if err != nil {
-				return "", fmt.Errorf("encrypt: %s", err.Error())
+				return "", err
 			}
-			ct := gcm.Seal(nil, iv, data, aad)
 			return base64.StdEncoding.EncodeToString(ct), nil
 
 		case "AES-CBC":
@@ -652,8 +842,9 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		return err
 	}
 
-	// Override __cryptoDecrypt to add AES-CBC.
-	if err := rt.RegisterFunc("__cryptoDecrypt", func(algo string, keyID int, dataB64, ivB64, aadB64 string) (string, error) {
+	// Override __cryptoDecrypt. AES-CBC decryption goes through
+	// __cryptoDecryptAESCBC instead.
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoDecrypt", func(algo string, keyID int, dataB64, ivB64, aadB64 string) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("decrypt: invalid base64 data")
@@ -670,9 +861,6 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			if err != nil {
 				return "", fmt.Errorf("decrypt: invalid IV base64")
 			}
-			if len(iv) != 12 {
-				return "", fmt.Errorf("decrypt: AES-GCM IV must be exactly 12 bytes, got %d", len(iv))
-			}
 			var aad []byte
 			if aadB64 != "" {
 				aad, err = base64.StdEncoding.DecodeString(aadB64)
@@ -680,67 +868,86 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 					return "", fmt.Errorf("decrypt: invalid AAD base64")
 				}
 			}
-			block, err := aes.NewCipher(entry.Data)
-			if err != nil {
-				return "", fmt.Errorf("decrypt: %s", err.Error())
-			}
-			gcm, err := cipher.NewGCM(block)
+			pt, err := aesGCMCrypt("decrypt", entry.Data, iv, data, aad)
 			if err != nil {
-				return "", fmt.Errorf("decrypt: %s", err.Error())
-			}
-			pt, err := gcm.Open(nil, iv, data, aad)
-			if err != nil {
-				return "", fmt.Errorf("decrypt: %s", err.Error())
+				return "", err
 			}
 			return base64.StdEncoding.EncodeToString(pt), nil
 
-		case "AES-CBC":
-			iv, err := base64.StdEncoding.DecodeString(ivB64)
-			if err != nil {
-				return "", fmt.Errorf("decrypt: invalid IV base64")
+		default:
+			return "", fmt.Errorf("decrypt: unsupported algorithm %q", algo)
+		}
+	}); err != nil {
+		return err
+	}
+
+	// __cryptoDecryptAESCBC(keyID, dataB64, ivB64) -> JSON {data} on success,
+	// or {error, code} when the padding does not check out, so JS can map
+	// that case to an OperationError without matching on message text.
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoDecryptAESCBC", func(keyID int, dataB64, ivB64 string) (string, error) {
+		data, err := base64.StdEncoding.DecodeString(dataB64)
+		if err != nil {
+			return "", fmt.Errorf("decrypt: invalid base64 data")
+		}
+		iv, err := base64.StdEncoding.DecodeString(ivB64)
+		if err != nil {
+			return "", fmt.Errorf("decrypt: invalid IV base64")
+		}
+		entry := core.GetCryptoKey(GetReqIDFromJS(rt), keyID)
+		if entry == nil {
+			return "", fmt.Errorf("decrypt: key not found")
+		}
+		pt, err := aesCBCDecrypt(entry.Data, iv, data)
+		if errors.Is(err, errPKCS7Padding) {
+			return `{"error":"OperationError","code":"padding"}`, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(map[string]string{"data": base64.StdEncoding.EncodeToString(pt)})
+		return string(out), nil
+	}); err != nil {
+		return err
+	}
+
+	// Large AES-GCM payloads skip base64 entirely when the runtime can move
+	// bytes directly: JS stores the input in __tmp_crypto_in and reads the
+	// result back from __tmp_crypto_out.
+	if bt, ok := rt.(core.BinaryTransferer); ok {
+		if err := registerBridge(rt, "crypto.subtle", "__cryptoAESGCMBinary", func(op string, keyID int, ivB64, aadB64 string) (int, error) {
+			if op != "encrypt" && op != "decrypt" {
+				return 0, fmt.Errorf("unsupported AES-GCM operation %q", op)
 			}
-			if len(iv) != aes.BlockSize {
-				return "", fmt.Errorf("decrypt: AES-CBC IV must be exactly %d bytes", aes.BlockSize)
+			data, err := bt.ReadBinaryFromJS("__tmp_crypto_in")
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", op, err)
 			}
-			if len(data)%aes.BlockSize != 0 {
-				return "", fmt.Errorf("decrypt: ciphertext not a multiple of block size")
+			entry := core.GetCryptoKey(GetReqIDFromJS(rt), keyID)
+			if entry == nil {
+				return 0, fmt.Errorf("%s: key not found", op)
 			}
-			block, err := aes.NewCipher(entry.Data)
+			iv, err := base64.StdEncoding.DecodeString(ivB64)
 			if err != nil {
-				return "", fmt.Errorf("decrypt: %s", err.Error())
-			}
-			mode := cipher.NewCBCDecrypter(block, iv)
-			pt := make([]byte, len(data))
-			mode.CryptBlocks(pt, data)
-			if len(pt) == 0 {
-				return base64.StdEncoding.EncodeToString(pt), nil
-			}
-			// Constant-time PKCS7 padding validation
-			padLen := int(pt[len(pt)-1])
-			good := 1
-			// Check padLen is in range [1, aes.BlockSize]
-			if padLen < 1 || padLen > aes.BlockSize {
-				good = 0
+				return 0, fmt.Errorf("%s: invalid IV base64", op)
 			}
-			// Check all padding bytes in constant time
-			for i := 0; i < aes.BlockSize; i++ {
-				if i < padLen && good == 1 {
-					if cryptosubtle.ConstantTimeByteEq(pt[len(pt)-1-i], byte(padLen)) != 1 {
-						good = 0
-					}
+			var aad []byte
+			if aadB64 != "" {
+				aad, err = base64.StdEncoding.DecodeString(aadB64)
+				if err != nil {
+					return 0, fmt.Errorf("%s: invalid AAD base64", op)
 				}
 			}
-			if good != 1 {
-				return "", fmt.Errorf("decrypt: invalid PKCS7 padding")
+			out, err := aesGCMCrypt(op, entry.Data, iv, data, aad)
+			if err != nil {
+				return 0, err
 			}
-			pt = pt[:len(pt)-padLen]
-			return base64.StdEncoding.EncodeToString(pt), nil
-
-		default:
-			return "", fmt.Errorf("decrypt: unsupported algorithm %q", algo)
+			if err := bt.WriteBinaryToJS("__tmp_crypto_out", out); err != nil {
+				return 0, fmt.Errorf("%s: %w", op, err)
+			}
+			return len(out), nil
+		}); err != nil {
+			return err
 		}
-	}); err != nil {
-		return err
 	}
 
 	// Evaluate the JS patches.
@@ -750,3 +957,73 @@ func SetupCryptoExt(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 
 	return nil
 }
+
+// errPKCS7Padding reports an AES-CBC plaintext whose PKCS#7 padding is
+// malformed, which is usually the sign of a wrong key or tampered data.
+var errPKCS7Padding = errors.New("decrypt: invalid PKCS7 padding")
+
+// aesCBCDecrypt decrypts data with AES-CBC and strips its PKCS#7 padding,
+// checking the padding bytes in constant time.
+func aesCBCDecrypt(key, iv, data []byte) ([]byte, error) {
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("decrypt: AES-CBC IV must be exactly %d bytes", aes.BlockSize)
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("decrypt: ciphertext not a multiple of block size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %s", err.Error())
+	}
+	mode := cipher.NewCBCDecrypter(block, iv)
+	pt := make([]byte, len(data))
+	mode.CryptBlocks(pt, data)
+	padLen := int(pt[len(pt)-1])
+	good := 1
+	if padLen < 1 || padLen > aes.BlockSize {
+		good = 0
+	}
+	for i := 0; i < aes.BlockSize; i++ {
+		if i < padLen && good == 1 {
+			if cryptosubtle.ConstantTimeByteEq(pt[len(pt)-1-i], byte(padLen)) != 1 {
+				good = 0
+			}
+		}
+	}
+	if good != 1 {
+		return nil, errPKCS7Padding
+	}
+	return pt[:len(pt)-padLen], nil
+}
+
+// aesGCMCrypt seals (op "encrypt") or opens (op "decrypt") data with
+// AES-GCM. It backs both the base64 and binary-bridge entry points so the
+// two produce identical output. A 12-byte IV is recommended, but any
+// non-empty length is accepted as the spec allows; other lengths are
+// run through GHASH to form the initial counter.
+func aesGCMCrypt(op string, key, iv, data, aad []byte) ([]byte, error) {
+	if len(iv) == 0 {
+		return nil, fmt.Errorf("%s: AES-GCM IV must not be empty", op)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err.Error())
+	}
+	var gcm cipher.AEAD
+	if len(iv) == 12 {
+		gcm, err = cipher.NewGCM(block)
+	} else {
+		gcm, err = cipher.NewGCMWithNonceSize(block, len(iv))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err.Error())
+	}
+	if op == "encrypt" {
+		return gcm.Seal(nil, iv, data, aad), nil
+	}
+	pt, err := gcm.Open(nil, iv, data, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err.Error())
+	}
+	return pt, nil
+}
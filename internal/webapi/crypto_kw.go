@@ -3,10 +3,10 @@ package webapi
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
+	"io"
 
 	"github.com/cryguy/worker/v2/internal/core"
 	"github.com/cryguy/worker/v2/internal/eventloop"
@@ -165,7 +165,7 @@ subtle.generateKey = async function(algorithm, extractable, usages) {
 	var algo = typeof algorithm === 'string' ? { name: algorithm } : algorithm;
 	if (algo.name === 'AES-CTR' || algo.name === 'AES-KW') {
 		var length = algo.length || 256;
-		var resultJSON = __cryptoGenerateKeyAes(algo.name, length, extractable);
+		var resultJSON = __cryptoGenerateKeyAes(algo.name, length, !!extractable);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
 		return new CK(result.keyId, algo, 'secret', extractable, usages);
@@ -200,9 +200,10 @@ subtle.unwrapKey = async function(format, wrappedKey, unwrappingKey, unwrapAlgor
 
 // SetupCryptoAesCtrKw registers AES-CTR and AES-KW Go functions and evaluates
 // the JS patches. Must run after SetupCryptoRSA (or at least after SetupCryptoExt).
-func SetupCryptoAesCtrKw(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+// entropy supplies AES-CTR and AES-KW key generation; see CryptoRand.
+func SetupCryptoAesCtrKw(rt core.JSRuntime, _ *eventloop.EventLoop, entropy io.Reader) error {
 	// __cryptoEncryptAesCtr(keyID, dataB64, counterB64, length) -> resultB64
-	if err := rt.RegisterFunc("__cryptoEncryptAesCtr", func(keyID int, dataB64, counterB64 string, length int) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoEncryptAesCtr", func(keyID int, dataB64, counterB64 string, length int) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("encryptAesCtr: invalid base64 data")
@@ -236,7 +237,7 @@ func SetupCryptoAesCtrKw(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoDecryptAesCtr(keyID, dataB64, counterB64, length) -> resultB64
-	if err := rt.RegisterFunc("__cryptoDecryptAesCtr", func(keyID int, dataB64, counterB64 string, length int) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoDecryptAesCtr", func(keyID int, dataB64, counterB64 string, length int) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("decryptAesCtr: invalid base64 data")
@@ -270,7 +271,7 @@ func SetupCryptoAesCtrKw(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoGenerateKeyAes(algoName, length, extractable) -> JSON { keyId } or { error }
-	if err := rt.RegisterFunc("__cryptoGenerateKeyAes", func(algoName string, bitLength int, extractableVal bool) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoGenerateKeyAes", func(algoName string, bitLength int, extractableVal bool) (string, error) {
 		var byteLength int
 		switch bitLength {
 		case 128:
@@ -289,7 +290,7 @@ func SetupCryptoAesCtrKw(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		}
 
 		keyData := make([]byte, byteLength)
-		if _, err := rand.Read(keyData); err != nil {
+		if _, err := io.ReadFull(entropy, keyData); err != nil {
 			return fmt.Sprintf(`{"error":"key generation failed: %s"}`, err.Error()), nil
 		}
 
@@ -305,7 +306,7 @@ func SetupCryptoAesCtrKw(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoWrapKeyAESKW(wrappingKeyID, dataB64) -> wrappedB64
-	if err := rt.RegisterFunc("__cryptoWrapKeyAESKW", func(wrappingKeyID int, dataB64 string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoWrapKeyAESKW", func(wrappingKeyID int, dataB64 string) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("wrapKeyAESKW: invalid base64 data")
@@ -336,7 +337,7 @@ func SetupCryptoAesCtrKw(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoUnwrapKeyAESKW(unwrappingKeyID, wrappedB64) -> unwrappedB64
-	if err := rt.RegisterFunc("__cryptoUnwrapKeyAESKW", func(unwrappingKeyID int, wrappedB64 string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoUnwrapKeyAESKW", func(unwrappingKeyID int, wrappedB64 string) (string, error) {
 		wrappedData, err := base64.StdEncoding.DecodeString(wrappedB64)
 		if err != nil {
 			return "", fmt.Errorf("unwrapKeyAESKW: invalid base64 data")
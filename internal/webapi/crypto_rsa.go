@@ -149,7 +149,7 @@ subtle.importKey = async function(format, keyData, algorithm, extractable, usage
 		} else {
 			dataStr = __bufferSourceToB64(keyData);
 		}
-		var resultJSON = __cryptoImportKeyRSA(format, dataStr, algo.name, hashName, extractable);
+		var resultJSON = __cryptoImportKeyRSA(format, dataStr, algo.name, hashName, !!extractable);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
 		var keyAlgo = { name: algo.name, hash: { name: hashName } };
@@ -193,7 +193,7 @@ subtle.generateKey = async function(algorithm, extractable, usages) {
 				pubExp = (pubExp << 8) | pe[i];
 			}
 		}
-		var resultJSON = __cryptoGenerateKeyRSA(algo.name, modulusLength, hashName, pubExp, extractable);
+		var resultJSON = __cryptoGenerateKeyRSA(algo.name, modulusLength, hashName, pubExp, !!extractable);
 		var result = JSON.parse(resultJSON);
 		if (result.error) throw new TypeError(result.error);
 		var keyAlgo = { name: algo.name, hash: { name: hashName }, modulusLength: modulusLength };
@@ -214,9 +214,15 @@ subtle.generateKey = async function(algorithm, extractable, usages) {
 
 // SetupCryptoRSA registers RSA Go functions and evaluates the JS patches.
 // Must run after SetupCryptoExt.
-func SetupCryptoRSA(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+func SetupCryptoRSA(rt core.JSRuntime, el *eventloop.EventLoop) error {
+	return SetupCryptoRSAWithKeyPool(rt, el, nil)
+}
+
+// SetupCryptoRSAWithKeyPool is SetupCryptoRSA with generateKey drawing
+// pre-generated keys from keys when it is non-nil.
+func SetupCryptoRSAWithKeyPool(rt core.JSRuntime, _ *eventloop.EventLoop, keys *RSAKeyPool) error {
 	// __cryptoSignRSA(algoName, keyID, dataB64, hashAlgo, saltLength) -> sigB64
-	if err := rt.RegisterFunc("__cryptoSignRSA", func(algoName string, keyID int, dataB64, hashAlgo string, saltLength int) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoSignRSA", func(algoName string, keyID int, dataB64, hashAlgo string, saltLength int) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("signRSA: invalid base64")
@@ -265,7 +271,7 @@ func SetupCryptoRSA(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoVerifyRSA(algoName, keyID, sigB64, dataB64, hashAlgo, saltLength) -> bool
-	if err := rt.RegisterFunc("__cryptoVerifyRSA", func(algoName string, keyID int, sigB64, dataB64, hashAlgo string, saltLength int) (int, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoVerifyRSA", func(algoName string, keyID int, sigB64, dataB64, hashAlgo string, saltLength int) (int, error) {
 		sig, err := base64.StdEncoding.DecodeString(sigB64)
 		if err != nil {
 			return 0, fmt.Errorf("verifyRSA: invalid signature base64")
@@ -319,7 +325,7 @@ func SetupCryptoRSA(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoEncryptRSA(keyID, dataB64, labelB64) -> ctB64
-	if err := rt.RegisterFunc("__cryptoEncryptRSA", func(keyID int, dataB64, labelB64 string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoEncryptRSA", func(keyID int, dataB64, labelB64 string) (string, error) {
 		data, err := base64.StdEncoding.DecodeString(dataB64)
 		if err != nil {
 			return "", fmt.Errorf("encryptRSA: invalid base64")
@@ -368,7 +374,7 @@ func SetupCryptoRSA(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoDecryptRSA(keyID, ctB64, labelB64) -> ptB64
-	if err := rt.RegisterFunc("__cryptoDecryptRSA", func(keyID int, ctB64, labelB64 string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoDecryptRSA", func(keyID int, ctB64, labelB64 string) (string, error) {
 		ct, err := base64.StdEncoding.DecodeString(ctB64)
 		if err != nil {
 			return "", fmt.Errorf("decryptRSA: invalid base64")
@@ -412,7 +418,7 @@ func SetupCryptoRSA(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoGenerateKeyRSA(algoName, modulusLength, hashAlgo, publicExponent, extractable) -> JSON
-	if err := rt.RegisterFunc("__cryptoGenerateKeyRSA", func(algoName string, modulusLength int, hashAlgo string, pubExp int, extractableVal bool) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoGenerateKeyRSA", func(algoName string, modulusLength int, hashAlgo string, pubExp int, extractableVal bool) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
@@ -431,7 +437,7 @@ func SetupCryptoRSA(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			return `{"error":"modulusLength must be 2048, 3072, or 4096"}`, nil
 		}
 
-		privKey, err := rsa.GenerateKey(rand.Reader, modulusLength)
+		privKey, err := keys.Get(modulusLength)
 		if err != nil {
 			return fmt.Sprintf(`{"error":"key generation failed: %s"}`, err.Error()), nil
 		}
@@ -451,7 +457,7 @@ func SetupCryptoRSA(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoImportKeyRSA(format, dataStr, algoName, hashAlgo, extractable) -> JSON
-	if err := rt.RegisterFunc("__cryptoImportKeyRSA", func(format, dataStr, algoName, hashAlgo string, extractableVal bool) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoImportKeyRSA", func(format, dataStr, algoName, hashAlgo string, extractableVal bool) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		if core.GetRequestState(reqID) == nil {
 			return `{"error":"no active request state"}`, nil
@@ -472,7 +478,7 @@ func SetupCryptoRSA(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __cryptoExportKeyRSA(keyID, format, algoName, hashAlgo) -> base64 or JSON string
-	if err := rt.RegisterFunc("__cryptoExportKeyRSA", func(keyID int, format, algoName, hashAlgo string) (string, error) {
+	if err := registerBridge(rt, "crypto.subtle", "__cryptoExportKeyRSA", func(keyID int, format, algoName, hashAlgo string) (string, error) {
 		reqID := GetReqIDFromJS(rt)
 		entry := core.GetCryptoKey(reqID, keyID)
 		if entry == nil {
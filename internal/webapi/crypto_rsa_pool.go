@@ -0,0 +1,82 @@
+package webapi
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"log"
+	"sync"
+)
+
+// RSAKeyPool keeps RSA private keys of one modulus size generated ahead of
+// time by a background goroutine, so generateKey does not block the worker
+// on prime generation. Each key is handed out at most once. A nil pool, or a
+// request for another size, generates on demand.
+type RSAKeyPool struct {
+	bits      int
+	keys      chan *rsa.PrivateKey
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRSAKeyPool starts a pool that keeps up to size keys of the given
+// modulus length ready.
+func NewRSAKeyPool(size, bits int) *RSAKeyPool {
+	p := &RSAKeyPool{
+		bits: bits,
+		keys: make(chan *rsa.PrivateKey, size),
+		stop: make(chan struct{}),
+	}
+	go p.fill()
+	return p
+}
+
+// fill generates keys until the pool is closed, blocking while it is full.
+func (p *RSAKeyPool) fill() {
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+		key, err := rsa.GenerateKey(rand.Reader, p.bits)
+		if err != nil {
+			log.Printf("worker: pre-generating RSA key: %v", err)
+			return
+		}
+		select {
+		case p.keys <- key:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Get returns a pre-generated key when one of the requested size is ready,
+// otherwise a freshly generated one.
+func (p *RSAKeyPool) Get(bits int) (*rsa.PrivateKey, error) {
+	if p != nil && bits == p.bits {
+		select {
+		case key := <-p.keys:
+			return key, nil
+		default:
+		}
+	}
+	return rsa.GenerateKey(rand.Reader, bits)
+}
+
+// Len returns the number of keys ready to be handed out.
+func (p *RSAKeyPool) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.keys)
+}
+
+// Close stops the background generator. Keys already in the pool are still
+// handed out; after that Get generates on demand.
+func (p *RSAKeyPool) Close() {
+	if p == nil {
+		return
+	}
+	p.closeOnce.Do(func() { close(p.stop) })
+}
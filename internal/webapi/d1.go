@@ -54,7 +54,13 @@ func SetupD1(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			}
 		}
 
-		result, err := store.Exec(sqlStr, bindings)
+		var result *core.D1ExecResult
+		var err error
+		if cs, ok := store.(core.ContextD1Store); ok {
+			result, err = cs.ExecContext(state.RequestContext(), sqlStr, bindings)
+		} else {
+			result, err = store.Exec(sqlStr, bindings)
+		}
 		if err != nil {
 			errResult := map[string]string{"error": err.Error()}
 			data, _ := json.Marshal(errResult)
@@ -7,7 +7,11 @@ import (
 	"github.com/cryguy/worker/v2/internal/eventloop"
 )
 
-// encodingJS implements global atob() and btoa() as pure JavaScript.
+// encodingJS implements global atob() and btoa(), the non-standard
+// base64urlEncode() and base64urlDecode(), and Uint8Array.fromBase64() and
+// toBase64() as pure JavaScript.
+// Invalid input raises an InvalidCharacterError DOMException, and atob
+// ignores ASCII whitespace, as required by the HTML forgiving-base64 spec.
 const encodingJS = `
 (function() {
 	const _e = 'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/';
@@ -17,6 +21,13 @@ const encodingJS = `
 	for (let i = 0; i < _e.length; i++) _v[_e.charCodeAt(i)] = 1;
 	_v[61] = 1; // '='
 
+	// DOMException is installed by SetupAbort, which runs after this file,
+	// so resolve it at call time rather than capturing it here.
+	function invalidCharacter(msg) {
+		if (typeof DOMException === 'function') return new DOMException(msg, 'InvalidCharacterError');
+		return new Error(msg);
+	}
+
 	globalThis.btoa = function(data) {
 		if (arguments.length < 1) throw new TypeError("btoa requires at least 1 argument(s)");
 		const s = String(data);
@@ -25,7 +36,7 @@ const encodingJS = `
 		const bytes = new Uint8Array(len);
 		for (let i = 0; i < len; i++) {
 			const ch = s.charCodeAt(i);
-			if (ch > 255) throw new Error("btoa: string contains characters outside of the Latin1 range");
+			if (ch > 255) throw invalidCharacter("btoa: string contains characters outside of the Latin1 range");
 			bytes[i] = ch;
 		}
 		const out = [];
@@ -54,12 +65,12 @@ const encodingJS = `
 			}
 		}
 		if (b64.length % 4 === 1) {
-			throw new Error("atob: invalid base64 string");
+			throw invalidCharacter("atob: invalid base64 string");
 		}
 		for (let i = 0; i < b64.length; i++) {
 			const ch = b64.charCodeAt(i);
 			if (ch >= 128 || !_v[ch] || ch === 61) {
-				throw new Error("atob: invalid base64 string");
+				throw invalidCharacter("atob: invalid base64 string");
 			}
 		}
 		while (b64.length % 4 !== 0) b64 += '=';
@@ -86,10 +97,131 @@ const encodingJS = `
 		}
 		return result;
 	};
+
+	// Shared by base64urlEncode/base64urlDecode and the Uint8Array base64
+	// methods below. chars is the 64-character alphabet and table its
+	// reverse lookup.
+	const _u = 'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_';
+	const _ud = new Int8Array(128).fill(-1);
+	for (let i = 0; i < _u.length; i++) _ud[_u.charCodeAt(i)] = i;
+	const _sd = new Int8Array(128).fill(-1);
+	for (let i = 0; i < _e.length; i++) _sd[_e.charCodeAt(i)] = i;
+
+	function encodeBase64(bytes, chars, omitPadding) {
+		const len = bytes.length;
+		const out = [];
+		for (let i = 0; i < len; i += 3) {
+			const a = bytes[i];
+			const b = i + 1 < len ? bytes[i + 1] : 0;
+			const c = i + 2 < len ? bytes[i + 2] : 0;
+			out.push(chars[a >> 2], chars[((a & 3) << 4) | (b >> 4)]);
+			if (i + 1 < len) out.push(chars[((b & 15) << 2) | (c >> 6)]);
+			else if (!omitPadding) out.push('=');
+			if (i + 2 < len) out.push(chars[c & 63]);
+			else if (!omitPadding) out.push('=');
+		}
+		return out.join('');
+	}
+
+	// decodeBase64 decodes s with table, accepting it with or without its
+	// padding unless handling says otherwise. fail(reason) builds the error
+	// to throw.
+	function decodeBase64(s, table, handling, fail) {
+		const pad = s.length - s.replace(/=+$/, '').length;
+		s = s.slice(0, s.length - pad);
+		if (pad > 2 || s.indexOf('=') !== -1 || (pad > 0 && (s.length + pad) % 4 !== 0)) {
+			throw fail('invalid padding');
+		}
+		const rem = s.length % 4;
+		if (pad === 0 && rem !== 0) {
+			if (handling === 'strict') throw fail('missing padding');
+			if (handling === 'stop-before-partial') s = s.slice(0, s.length - rem);
+		}
+		if (s.length % 4 === 1) throw fail('invalid base64 string');
+		const bytes = new Uint8Array(Math.floor(s.length * 3 / 4));
+		let acc = 0, bits = 0, j = 0;
+		for (let i = 0; i < s.length; i++) {
+			const ch = s.charCodeAt(i);
+			const v = ch < 128 ? table[ch] : -1;
+			if (v < 0) throw fail('invalid character');
+			acc = ((acc << 6) | v) & 0xffffff;
+			bits += 6;
+			if (bits >= 8) {
+				bits -= 8;
+				bytes[j++] = (acc >> bits) & 255;
+			}
+		}
+		if (handling === 'strict' && (acc & ((1 << bits) - 1)) !== 0) {
+			throw fail('non-zero padding bits');
+		}
+		return bytes;
+	}
+
+	// Non-standard: base64url (RFC 4648 section 5) for JWT, WebPush and
+	// WebAuthn code, which atob/btoa cannot handle. Strings are encoded as
+	// UTF-8. Encoding omits the padding; decoding accepts it either way and
+	// returns a Uint8Array.
+	globalThis.base64urlEncode = function(data) {
+		if (arguments.length < 1) throw new TypeError("base64urlEncode requires at least 1 argument(s)");
+		const bytes = typeof data === 'string' ? new TextEncoder().encode(data) : __bufferSourceBytes(data);
+		return encodeBase64(bytes, _u, true);
+	};
+
+	globalThis.base64urlDecode = function(data) {
+		if (arguments.length < 1) throw new TypeError("base64urlDecode requires at least 1 argument(s)");
+		return decodeBase64(String(data), _ud, 'loose', function(reason) {
+			return invalidCharacter("base64urlDecode: " + reason);
+		});
+	};
+
+	// Uint8Array.fromBase64 and Uint8Array.prototype.toBase64 from the
+	// ECMAScript base64 proposal, installed where the engine lacks them.
+	// Both take an alphabet option of 'base64' (default) or 'base64url';
+	// toBase64 can omit the padding, and fromBase64's default 'loose'
+	// lastChunkHandling accepts input whose padding was dropped.
+	function base64Alphabet(caller, options) {
+		const alphabet = options && options.alphabet !== undefined ? options.alphabet : 'base64';
+		if (alphabet !== 'base64' && alphabet !== 'base64url') {
+			throw new TypeError(caller + ': alphabet must be "base64" or "base64url"');
+		}
+		return alphabet;
+	}
+
+	if (typeof Uint8Array.fromBase64 !== 'function') {
+		Object.defineProperty(Uint8Array, 'fromBase64', {
+			value: function fromBase64(string, options) {
+				const caller = 'Uint8Array.fromBase64';
+				if (typeof string !== 'string') throw new TypeError(caller + ': argument must be a string');
+				const table = base64Alphabet(caller, options) === 'base64url' ? _ud : _sd;
+				const handling = options && options.lastChunkHandling !== undefined ? options.lastChunkHandling : 'loose';
+				if (handling !== 'loose' && handling !== 'strict' && handling !== 'stop-before-partial') {
+					throw new TypeError(caller + ': invalid lastChunkHandling');
+				}
+				return decodeBase64(string.replace(/[\t\n\f\r ]/g, ''), table, handling, function(reason) {
+					return new SyntaxError(caller + ': ' + reason);
+				});
+			},
+			writable: true,
+			configurable: true,
+		});
+	}
+
+	if (typeof Uint8Array.prototype.toBase64 !== 'function') {
+		Object.defineProperty(Uint8Array.prototype, 'toBase64', {
+			value: function toBase64(options) {
+				const caller = 'Uint8Array.prototype.toBase64';
+				if (!(this instanceof Uint8Array)) throw new TypeError(caller + ': receiver must be a Uint8Array');
+				const chars = base64Alphabet(caller, options) === 'base64url' ? _u : _e;
+				return encodeBase64(this, chars, !!(options && options.omitPadding));
+			},
+			writable: true,
+			configurable: true,
+		});
+	}
 })();
 `
 
-// SetupEncoding evaluates the pure-JS atob/btoa implementations.
+// SetupEncoding evaluates the pure-JS base64 implementations.
 func SetupEncoding(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	if err := rt.Eval(encodingJS); err != nil {
 		return fmt.Errorf("evaluating encoding.js: %w", err)
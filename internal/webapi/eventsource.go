@@ -116,10 +116,10 @@ const eventSourceJS = `
 					}
 				} catch(e) {}
 				if (self._readyState !== CLOSED) {
-					self._pollTimer = setTimeout(poll, 50);
+					self._pollTimer = __internalSetTimeout(poll, 50);
 				}
 			}
-			self._pollTimer = setTimeout(poll, 10);
+			self._pollTimer = __internalSetTimeout(poll, 10);
 		}
 
 		get url() { return this._url; }
@@ -192,7 +192,7 @@ func getEventSourceMap(state *core.RequestState) *eventSourceMap {
 // evaluates the JS wrapper.
 func SetupEventSource(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	// __eventSourceConnect(reqIDStr, url) -> sourceID
-	if err := rt.RegisterFunc("__eventSourceConnect", func(reqIDStr, rawURL string) (string, error) {
+	if err := registerBridge(rt, "EventSource", "__eventSourceConnect", func(reqIDStr, rawURL string) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
 
 		if EventSourceSSRFEnabled && IsPrivateHostname(rawURL) {
@@ -283,7 +283,7 @@ func SetupEventSource(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __eventSourcePoll(reqIDStr, sourceID) -> JSON array of events
-	if err := rt.RegisterFunc("__eventSourcePoll", func(reqIDStr, sourceID string) (string, error) {
+	if err := registerBridge(rt, "EventSource", "__eventSourcePoll", func(reqIDStr, sourceID string) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil {
@@ -312,7 +312,7 @@ func SetupEventSource(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __eventSourceClose(reqIDStr, sourceID)
-	if err := rt.RegisterFunc("__eventSourceClose", func(reqIDStr, sourceID string) {
+	if err := registerBridge(rt, "EventSource", "__eventSourceClose", func(reqIDStr, sourceID string) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil {
@@ -5,10 +5,75 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/cryguy/worker/v2/internal/core"
+	"github.com/cryguy/worker/v2/internal/eventloop"
 )
 
+// CheckRequestBodySize rejects an incoming request whose body exceeds
+// limit bytes. A limit of 0 disables the check.
+func CheckRequestBodySize(req *core.WorkerRequest, limit int) error {
+	if limit > 0 && req != nil && len(req.Body) > limit {
+		return fmt.Errorf("request body too large: %d bytes exceeds limit of %d bytes", len(req.Body), limit)
+	}
+	return nil
+}
+
+// CheckResponseBodySize rejects a worker response whose body exceeds
+// limit bytes. A limit of 0 disables the check.
+func CheckResponseBodySize(resp *core.WorkerResponse, limit int) error {
+	if limit > 0 && resp != nil && len(resp.Body) > limit {
+		return fmt.Errorf("response body too large: %d bytes exceeds limit of %d bytes", len(resp.Body), limit)
+	}
+	return nil
+}
+
+// CheckRequestHeaders rejects an incoming request carrying more than
+// maxCount headers or more than maxBytes of header names and values. A
+// limit of 0 disables that check.
+func CheckRequestHeaders(req *core.WorkerRequest, maxCount, maxBytes int) error {
+	if req == nil {
+		return nil
+	}
+	size := 0
+	for k, v := range req.Headers {
+		size += len(k) + len(v)
+	}
+	return checkHeaderLimits("request", len(req.Headers), size, maxCount, maxBytes)
+}
+
+// CheckResponseHeaders rejects a worker response carrying more than
+// maxCount headers or more than maxBytes of header names and values. Each
+// value of a repeated header such as Set-Cookie counts separately. A limit
+// of 0 disables that check.
+func CheckResponseHeaders(resp *core.WorkerResponse, maxCount, maxBytes int) error {
+	if resp == nil {
+		return nil
+	}
+	count, size := len(resp.HeaderList), 0
+	for _, h := range resp.HeaderList {
+		size += len(h[0]) + len(h[1])
+	}
+	if resp.HeaderList == nil {
+		count = len(resp.Headers)
+		for k, v := range resp.Headers {
+			size += len(k) + len(v)
+		}
+	}
+	return checkHeaderLimits("response", count, size, maxCount, maxBytes)
+}
+
+func checkHeaderLimits(kind string, count, size, maxCount, maxBytes int) error {
+	if maxCount > 0 && count > maxCount {
+		return fmt.Errorf("%s headers too large: %d headers exceeds limit of %d", kind, count, maxCount)
+	}
+	if maxBytes > 0 && size > maxBytes {
+		return fmt.Errorf("%s headers too large: %d bytes exceeds limit of %d bytes", kind, size, maxBytes)
+	}
+	return nil
+}
+
 // GoRequestToJS converts a Go WorkerRequest into a JS Request object
 // stored in globalThis.__req.
 func GoRequestToJS(rt core.JSRuntime, req *core.WorkerRequest) error {
@@ -22,8 +87,10 @@ func GoRequestToJS(rt core.JSRuntime, req *core.WorkerRequest) error {
 	_ = rt.SetGlobal("__tmp_method", req.Method)
 	_ = rt.SetGlobal("__tmp_headers_json", string(headersJSON))
 
+	// GET and HEAD requests cannot carry a body in the Fetch API, so one
+	// sent by the client is dropped rather than failing the Request.
 	var bodyScript string
-	if len(req.Body) > 0 {
+	if len(req.Body) > 0 && !strings.EqualFold(req.Method, "GET") && !strings.EqualFold(req.Method, "HEAD") {
 		_ = rt.SetGlobal("__tmp_body", string(req.Body))
 		bodyScript = "init.body = globalThis.__tmp_body;"
 	}
@@ -44,6 +111,54 @@ func GoRequestToJS(rt core.JSRuntime, req *core.WorkerRequest) error {
 	return rt.Eval(script)
 }
 
+// DrainResponseStream reads a pull-based ReadableStream body of the JS
+// Response in globalThis.__result to the end, leaving every chunk queued for
+// JsResponseToGo. Such a stream only produces chunks on demand, so without
+// this just the first high-water mark's worth would be sent. Streams fed by
+// enqueue() from elsewhere are left as they are. With limit > 0 reading stops,
+// and the stream is cancelled, as soon as the body passes limit bytes.
+func DrainResponseStream(rt core.JSRuntime, deadline time.Time, el *eventloop.EventLoop, limit int) error {
+	if err := rt.Eval(fmt.Sprintf(`(function(limit) {
+		var r = globalThis.__result;
+		var s = r && r._body;
+		if (!(s instanceof ReadableStream) || !s._pullFn || s._closed || s._locked) return;
+		var reader = s.getReader();
+		var chunks = [], total = 0;
+		function byteLength(c) {
+			if (typeof c === 'string') return new TextEncoder().encode(c).length;
+			if (c instanceof ArrayBuffer || ArrayBuffer.isView(c)) return c.byteLength;
+			return String(c).length;
+		}
+		globalThis.__tmp_body_drain = (function next() {
+			return reader.read().then(function(res) {
+				if (res.done) {
+					reader.releaseLock();
+					s._queue = chunks;
+					return;
+				}
+				chunks.push(res.value);
+				total += byteLength(res.value);
+				if (limit > 0 && total > limit) {
+					globalThis.__tmp_body_over = total;
+					reader.cancel(new RangeError('response body too large')).catch(function() {});
+					return;
+				}
+				return next();
+			});
+		})();
+	})(%d)`, limit)); err != nil {
+		return err
+	}
+	defer func() { _ = rt.Eval("delete globalThis.__tmp_body_drain; delete globalThis.__tmp_body_over;") }()
+	if err := AwaitValue(rt, "__tmp_body_drain", deadline, el); err != nil {
+		return err
+	}
+	if over, _ := rt.EvalString("String(globalThis.__tmp_body_over || '')"); over != "" {
+		return fmt.Errorf("response body too large: %s bytes read exceeds limit of %d bytes", over, limit)
+	}
+	return nil
+}
+
 // JsResponseToGo extracts a Go WorkerResponse from the JS Response
 // in globalThis.__result.
 func JsResponseToGo(rt core.JSRuntime) (*core.WorkerResponse, error) {
@@ -58,11 +173,15 @@ func JsResponseToGo(rt core.JSRuntime) (*core.WorkerResponse, error) {
 		delete globalThis.__result;
 		if (r === null || r === undefined) return JSON.stringify({error: "null response"});
 		var headers = {};
+		var headerList = [];
 		if (r.headers && r.headers._map) {
 			var m = r.headers._map;
 			for (var k in m) {
-				if (m.hasOwnProperty(k)) headers[k] = Array.isArray(m[k]) ? m[k].join(', ') : m[k];
+				if (!m.hasOwnProperty(k)) continue;
+				headers[k] = Array.isArray(m[k]) ? m[k].join(', ') : String(m[k]);
 			}
+			var l = r.headers._list || [];
+			for (var li = 0; li < l.length; li++) headerList.push([l[li][0], String(l[li][1])]);
 		}
 		var hasWebSocket = !!(r.webSocket);
 		if (hasWebSocket) {
@@ -126,6 +245,7 @@ func JsResponseToGo(rt core.JSRuntime) (*core.WorkerResponse, error) {
 		return JSON.stringify({
 			status: r.status || 200,
 			headers: headers,
+			headerList: headerList,
 			body: body,
 			bodyType: bodyType,
 			hasWebSocket: hasWebSocket,
@@ -138,6 +258,7 @@ func JsResponseToGo(rt core.JSRuntime) (*core.WorkerResponse, error) {
 	var resp struct {
 		Status       int               `json:"status"`
 		Headers      map[string]string `json:"headers"`
+		HeaderList   [][2]string       `json:"headerList"`
 		Body         string            `json:"body"`
 		BodyType     string            `json:"bodyType"`
 		HasWebSocket bool              `json:"hasWebSocket"`
@@ -177,6 +298,7 @@ func JsResponseToGo(rt core.JSRuntime) (*core.WorkerResponse, error) {
 	return &core.WorkerResponse{
 		StatusCode:   resp.Status,
 		Headers:      resp.Headers,
+		HeaderList:   resp.HeaderList,
 		Body:         body,
 		HasWebSocket: resp.HasWebSocket,
 	}, nil
@@ -184,6 +306,8 @@ func JsResponseToGo(rt core.JSRuntime) (*core.WorkerResponse, error) {
 
 // BuildEnvObject creates the globalThis.__env object with vars, secrets,
 // and binding namespaces (KV, R2, D1, DO, Queues, Service Bindings, Assets).
+// Every var and binding is an enumerable own property so Object.keys(env)
+// lists them; secrets are non-enumerable.
 func BuildEnvObject(rt core.JSRuntime, env *core.Env, reqID uint64) error {
 	if err := rt.Eval("globalThis.__env = {};"); err != nil {
 		return fmt.Errorf("creating env object: %w", err)
@@ -199,10 +323,13 @@ func BuildEnvObject(rt core.JSRuntime, env *core.Env, reqID uint64) error {
 		}
 	}
 
-	// Add secrets.
+	// Add secrets. They are readable by name but not enumerable, so code
+	// that walks env to discover bindings (Object.keys, JSON.stringify,
+	// for...in) never sees their values.
 	if env.Secrets != nil {
 		for k, v := range env.Secrets {
-			js := fmt.Sprintf("globalThis.__env[%s] = %s;", core.JsEscape(k), core.JsEscape(v))
+			js := fmt.Sprintf("Object.defineProperty(globalThis.__env, %s, {value: %s, writable: true, enumerable: false, configurable: true});",
+				core.JsEscape(k), core.JsEscape(v))
 			if err := rt.Eval(js); err != nil {
 				return fmt.Errorf("setting secret %q: %w", k, err)
 			}
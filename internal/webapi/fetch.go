@@ -2,14 +2,20 @@ package webapi
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cryguy/worker/v2/internal/core"
@@ -37,9 +43,91 @@ var ForbiddenFetchHeaders = map[string]bool{
 	"x-real-ip":           true,
 }
 
-// FetchTransport is the http.RoundTripper used by fetch. Tests can override it.
+// DefaultFetchMaxIdleConnsPerHost is the number of idle keep-alive
+// connections fetch keeps per upstream host when
+// EngineConfig.FetchMaxIdleConnsPerHost is unset.
+const DefaultFetchMaxIdleConnsPerHost = 16
+
+// DefaultFetchUserAgent is the User-Agent sent on fetches that don't set
+// one when EngineConfig.FetchUserAgent is unset. It matches
+// navigator.userAgent.
+const DefaultFetchUserAgent = "hostedat-worker/1.0"
+
+// FetchExpectContinueTimeout is how long a fetch sent with an
+// "Expect: 100-continue" header waits for the upstream's interim 100
+// response before sending the body anyway. An upstream that answers with a
+// final status instead, such as 417, never receives the body.
+const FetchExpectContinueTimeout = time.Second
+
+// FetchTransport is the http.RoundTripper used by fetch. It is shared by
+// every worker so that connections to an upstream are kept alive and reused
+// across executions; each new connection still goes through the SSRF-safe
+// dialer. Tests can override it.
 var FetchTransport http.RoundTripper = &http.Transport{
-	DialContext: ssrfSafeDialContext,
+	DialContext:           ssrfSafeDialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   DefaultFetchMaxIdleConnsPerHost,
+	IdleConnTimeout:       90 * time.Second,
+	ExpectContinueTimeout: FetchExpectContinueTimeout,
+}
+
+// fetchTransports caches the shared clones of FetchTransport made for
+// engines with a non-default idle connection limit or a DNS cache. Clones
+// of a FetchTransport that has since been replaced are evicted, and their
+// idle connections closed, the next time a clone is made.
+var fetchTransports sync.Map // fetchTransportKey -> *http.Transport
+
+type fetchTransportKey struct {
+	base            *http.Transport
+	maxIdlePerHost  int
+	dnsCacheTTL     int
+	dnsCacheEntries int
+}
+
+// fetchTransport returns the transport for a fetch: FetchTransport itself,
+// or a shared clone of it that keeps cfg.FetchMaxIdleConnsPerHost idle
+// connections per host and, with cfg.FetchDNSCacheTTL set, caches DNS
+// lookups. The DNS cache wraps FetchTransport's DialContext rather than
+// replacing it: the host is resolved through the cache and checked against
+// the SSRF rules, then the original dialer connects to the chosen IP.
+func fetchTransport(cfg core.EngineConfig) http.RoundTripper {
+	base, ok := FetchTransport.(*http.Transport)
+	if !ok {
+		return FetchTransport
+	}
+	maxIdlePerHost := cfg.FetchMaxIdleConnsPerHost
+	if maxIdlePerHost <= 0 {
+		maxIdlePerHost = base.MaxIdleConnsPerHost
+	}
+	dnsTTL, dnsEntries := cfg.FetchDNSCacheTTL, cfg.FetchDNSCacheEntries
+	if dnsTTL <= 0 {
+		dnsTTL, dnsEntries = 0, 0
+	}
+	if base.MaxIdleConnsPerHost == maxIdlePerHost && dnsTTL == 0 {
+		return FetchTransport
+	}
+	key := fetchTransportKey{base: base, maxIdlePerHost: maxIdlePerHost, dnsCacheTTL: dnsTTL, dnsCacheEntries: dnsEntries}
+	if t, ok := fetchTransports.Load(key); ok {
+		return t.(*http.Transport)
+	}
+	t := base.Clone()
+	t.MaxIdleConnsPerHost = maxIdlePerHost
+	if dnsTTL > 0 {
+		cache := newDNSCache(time.Duration(dnsTTL)*time.Second, dnsEntries)
+		t.DialContext = ssrfDialContext(cache.lookup, base.DialContext)
+	}
+	actual, loaded := fetchTransports.LoadOrStore(key, t)
+	if !loaded {
+		fetchTransports.Range(func(k, v any) bool {
+			if k.(fetchTransportKey).base != base {
+				if _, ok := fetchTransports.LoadAndDelete(k); ok {
+					v.(*http.Transport).CloseIdleConnections()
+				}
+			}
+			return true
+		})
+	}
+	return actual.(*http.Transport)
 }
 
 // fetchJS defines the global fetch() function and resolve/reject handlers.
@@ -51,12 +139,29 @@ globalThis.fetch = function(input, init) {
 	var reqID = String(globalThis.__requestID || '');
 	var url = '', method = 'GET', headers = {}, body = '', bodyIsBase64 = false;
 	var redirect = 'follow', signalAborted = false, signal = null;
+	var bodyContentType = '';
+	var cf = null;
+	var retry = null;
+	var streamBody = null;
+	var cacheMode = 'default';
+	var referrer = 'about:client', referrerPolicy = '';
+	var integrity = '', keepalive = false;
+	var hasBody = false;
 
 	function extractBody(b) {
 		if (b == null) return;
 		if (b instanceof ArrayBuffer || ArrayBuffer.isView(b)) {
 			body = __bufferSourceToB64(b);
 			bodyIsBase64 = true;
+		} else if (b instanceof FormData) {
+			var encoded = __encodeFormData(b);
+			body = __bufferSourceToB64(encoded.body);
+			bodyIsBase64 = true;
+			bodyContentType = encoded.contentType;
+		} else if (b instanceof Blob) {
+			body = __bufferSourceToB64(__blobBytes(b));
+			bodyIsBase64 = true;
+			bodyContentType = b.type;
 		} else if (b instanceof ReadableStream && b._queue) {
 			var chunks = [];
 			for (var i = 0; i < b._queue.length; i++) {
@@ -98,21 +203,35 @@ globalThis.fetch = function(input, init) {
 				var m = input.headers._map;
 				for (var k in m) { if (m.hasOwnProperty(k)) headers[k] = Array.isArray(m[k]) ? m[k].join(', ') : String(m[k]); }
 			} else if (typeof input.headers.forEach === 'function') {
-				input.headers.forEach(function(v, k) { headers[k] = v; });
+				input.headers.forEach(function(v, k) { headers[k] = k in headers ? headers[k] + ', ' + v : v; });
 			}
 		}
-		if (input._body != null) extractBody(input._body);
+		if (input._body != null) {
+			hasBody = true;
+			if (input._streamBody && input._body instanceof ReadableStream) streamBody = input._body;
+			else extractBody(input._body);
+		}
 		if (input.redirect !== undefined) redirect = String(input.redirect);
+		if (input.cache) cacheMode = String(input.cache);
+		if (input.referrer !== undefined) referrer = String(input.referrer);
+		if (input.referrerPolicy) referrerPolicy = String(input.referrerPolicy);
+		if (input.integrity) integrity = String(input.integrity);
+		if (input.keepalive) keepalive = true;
 		if (input.signal) { signal = input.signal; if (input.signal.aborted) signalAborted = true; }
 	}
 
 	if (init && typeof init === 'object') {
-		if (init.method !== undefined) method = String(init.method).toUpperCase();
+		try { validateRequestInit('fetch', init); }
+		catch(e) { return Promise.reject(e); }
+		if (init.method !== undefined) {
+			try { method = __normalizeMethod(init.method); }
+			catch(e) { return Promise.reject(e); }
+		}
 		if (init.headers) {
 			var src;
 			if (init.headers instanceof Headers) {
 				src = {};
-				init.headers.forEach(function(v, k) { src[k] = v; });
+				init.headers.forEach(function(v, k) { src[k] = k in src ? src[k] + ', ' + v : v; });
 			} else if (init.headers._map) {
 				src = {};
 				var _m = init.headers._map;
@@ -124,28 +243,74 @@ globalThis.fetch = function(input, init) {
 				for (var k2 in src) { if (src.hasOwnProperty(k2)) headers[k2.toLowerCase()] = String(src[k2]); }
 			}
 		}
-		if (init.body != null) extractBody(init.body);
+		if (init.body !== undefined) hasBody = init.body !== null;
+		if (init.body instanceof ReadableStream) {
+			if (init.duplex !== 'half') {
+				return Promise.reject(new TypeError('fetch: duplex: "half" is required when the body is a ReadableStream'));
+			}
+			streamBody = init.body;
+		} else if (init.body != null) {
+			streamBody = null;
+			extractBody(init.body);
+		}
 		if (init.redirect !== undefined) redirect = String(init.redirect);
+		if (init.cache !== undefined) cacheMode = init.cache;
 		if (init.signal) { signal = init.signal; if (init.signal.aborted) signalAborted = true; }
+		if (init.cf && typeof init.cf === 'object') cf = init.cf;
+		// retry is a non-standard extension: {attempts, backoffMs}.
+		if (init.retry && typeof init.retry === 'object') {
+			retry = {
+				attempts: Math.floor(Number(init.retry.attempts)) || 0,
+				backoffMs: Math.floor(Number(init.retry.backoffMs)) || 0
+			};
+		}
+		if (init.referrer !== undefined) referrer = String(init.referrer);
+		if (init.referrerPolicy !== undefined) referrerPolicy = init.referrerPolicy;
+		if (init.integrity !== undefined) integrity = String(init.integrity);
+		if (init.keepalive !== undefined) keepalive = !!init.keepalive;
 	}
 
 	if (!method) method = 'GET';
+	if (hasBody && (method === 'GET' || method === 'HEAD')) {
+		return Promise.reject(new TypeError('fetch: a ' + method + ' request cannot have a body'));
+	}
+	if (bodyContentType && !('content-type' in headers)) headers['content-type'] = bodyContentType;
+	if (!('referer' in headers)) {
+		var refererValue = referrerFor(referrer, referrerPolicy, url);
+		if (refererValue) headers['referer'] = refererValue;
+	}
 
 	if (signalAborted) {
-		return Promise.reject(new DOMException('The operation was aborted.', 'AbortError'));
+		return Promise.reject(abortReason(signal));
+	}
+	if (streamBody && streamBody._locked) {
+		return Promise.reject(new TypeError('fetch: request body stream is locked or disturbed'));
+	}
+	// A keepalive request is not cancelled when the invocation ends, so its
+	// body must be small and known up front.
+	if (keepalive) {
+		if (streamBody) {
+			return Promise.reject(new TypeError('fetch: a keepalive request cannot have a ReadableStream body'));
+		}
+		var bodyLen = bodyIsBase64 ? body.length * 3 / 4 - (body.match(/=*$/)[0].length) : new TextEncoder().encode(body).length;
+		if (bodyLen > 65536) {
+			return Promise.reject(new TypeError('fetch: keepalive request body exceeds 64 KiB'));
+		}
 	}
 
 	var headersJSON = JSON.stringify(headers);
 	var argsJSON = JSON.stringify({
 		url: url, method: method, headersJSON: headersJSON,
 		body: body || '', bodyIsBase64: bodyIsBase64,
-		redirect: redirect
+		redirect: redirect, cf: cf, cache: cacheMode, streamBody: !!streamBody,
+		integrity: integrity, retry: retry, keepalive: keepalive
 	});
 
 	return new Promise(function(resolve, reject) {
 		try {
 			var fetchID = __fetchStart(reqID, argsJSON);
 			globalThis.__fetchPromises[fetchID] = { resolve: resolve, reject: reject };
+			if (streamBody) pumpRequestBody(reqID, fetchID, streamBody.getReader());
 
 			if (signal && !signal.aborted) {
 				signal.addEventListener('abort', function onAbort() {
@@ -154,7 +319,7 @@ globalThis.fetch = function(input, init) {
 					var p = globalThis.__fetchPromises[fetchID];
 					if (p) {
 						delete globalThis.__fetchPromises[fetchID];
-						p.reject(new DOMException('The operation was aborted.', 'AbortError'));
+						p.reject(abortReason(signal));
 					}
 				});
 			}
@@ -162,14 +327,79 @@ globalThis.fetch = function(input, init) {
 	});
 };
 
-globalThis.__fetchResolve = function(fetchID, status, statusText, headersJSON, bodyB64, redirected, finalURL) {
+// referrerFor returns the Referer header for a fetch of target, or '' for
+// none. The referrer is a URL, '' for no referrer, or 'about:client' for the
+// URL of the request being handled; the policy decides how much of it the
+// target sees, defaulting to strict-origin-when-cross-origin.
+function referrerFor(referrer, policy, target) {
+	if (referrer === '') return '';
+	var source = referrer;
+	if (source === 'about:client') {
+		if (!globalThis.__req || !globalThis.__req.url) return '';
+		source = globalThis.__req.url;
+	}
+	var from, to;
+	try { from = new URL(source); to = new URL(target); } catch (e) { return ''; }
+	if (from.protocol !== 'http:' && from.protocol !== 'https:') return '';
+	var originOnly = from.origin + '/';
+	from.username = '';
+	from.password = '';
+	from.hash = '';
+	var full = from.href;
+	var sameOrigin = from.origin === to.origin;
+	var downgrade = from.protocol === 'https:' && to.protocol !== 'https:';
+	switch (policy) {
+	case 'no-referrer': return '';
+	case 'no-referrer-when-downgrade': return downgrade ? '' : full;
+	case 'origin': return originOnly;
+	case 'origin-when-cross-origin': return sameOrigin ? full : originOnly;
+	case 'same-origin': return sameOrigin ? full : '';
+	case 'strict-origin': return downgrade ? '' : originOnly;
+	case 'unsafe-url': return full;
+	default: return sameOrigin ? full : (downgrade ? '' : originOnly);
+	}
+}
+
+// abortReason is what an aborted fetch rejects with: the signal's reason,
+// which is an AbortError DOMException unless abort() was given one.
+function abortReason(signal) {
+	return signal.reason !== undefined ? signal.reason : new DOMException('The operation was aborted.', 'AbortError');
+}
+
+// pumpRequestBody feeds a duplex: "half" request body to the upstream
+// request chunk by chunk. If the fetch finishes first, the write throws and
+// the source stream is cancelled.
+function pumpRequestBody(reqID, fetchID, reader) {
+	function next() {
+		reader.read().then(function(r) {
+			if (r.done) {
+				__fetchBodyClose(reqID, fetchID, '');
+				return;
+			}
+			try {
+				var chunk = typeof r.value === 'string' ? new TextEncoder().encode(r.value) : r.value;
+				__fetchBodyWrite(reqID, fetchID, __bufferSourceToB64(chunk));
+			} catch(e) {
+				__fetchBodyClose(reqID, fetchID, String(e && e.message || e));
+				reader.cancel(e).catch(function() {});
+				return;
+			}
+			next();
+		}, function(e) {
+			__fetchBodyClose(reqID, fetchID, String(e && e.message || e));
+		});
+	}
+	next();
+}
+
+globalThis.__fetchResolve = function(fetchID, status, statusText, headersJSON, bodyB64, redirected, finalURL, trailersJSON) {
 	var p = globalThis.__fetchPromises[fetchID];
 	delete globalThis.__fetchPromises[fetchID];
 	if (!p) return;
 	try {
 		var hdrs = JSON.parse(headersJSON);
 		var body = null;
-		if (bodyB64 && bodyB64.length > 0) {
+		if (bodyB64 && bodyB64.length > 0 && !__isNullBodyStatus(status)) {
 			var buf = __b64ToBuffer(bodyB64);
 			var ct = (hdrs['content-type'] || '').toLowerCase();
 			if (ct.indexOf('text/') === 0 || ct.indexOf('application/json') !== -1 ||
@@ -185,6 +415,10 @@ globalThis.__fetchResolve = function(fetchID, status, statusText, headersJSON, b
 			Object.defineProperty(r, 'redirected', {value: true, writable: false});
 		}
 		Object.defineProperty(r, 'url', {value: finalURL || '', writable: false});
+		// The upstream body has been read in full before the response is
+		// handed to the worker, so its trailers are already known.
+		var trailers = new Headers(trailersJSON ? JSON.parse(trailersJSON) : {});
+		Object.defineProperty(r, 'trailers', {value: Promise.resolve(trailers), writable: false});
 		p.resolve(r);
 	} catch(e) { p.reject(e); }
 };
@@ -209,7 +443,7 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 	}
 
 	// __fetchStart(reqIDStr, argsJSON) -> fetchID
-	if err := rt.RegisterFunc("__fetchStart", func(reqIDStr, argsJSON string) (string, error) {
+	if err := registerBridge(rt, "fetch", "__fetchStart", func(reqIDStr, argsJSON string) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state != nil && state.FetchCount >= state.MaxFetches {
@@ -220,12 +454,18 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 		}
 
 		var args struct {
-			URL          string `json:"url"`
-			Method       string `json:"method"`
-			HeadersJSON  string `json:"headersJSON"`
-			Body         string `json:"body"`
-			BodyIsBase64 bool   `json:"bodyIsBase64"`
-			Redirect     string `json:"redirect"`
+			URL          string          `json:"url"`
+			Method       string          `json:"method"`
+			HeadersJSON  string          `json:"headersJSON"`
+			Body         string          `json:"body"`
+			BodyIsBase64 bool            `json:"bodyIsBase64"`
+			Redirect     string          `json:"redirect"`
+			CF           *fetchCFOptions `json:"cf"`
+			Cache        string          `json:"cache"`
+			StreamBody   bool            `json:"streamBody"`
+			Integrity    string          `json:"integrity"`
+			Retry        *fetchRetry     `json:"retry"`
+			Keepalive    bool            `json:"keepalive"`
 		}
 		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
 			return "", fmt.Errorf("fetch: parsing arguments: %s", err.Error())
@@ -246,8 +486,48 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 			}
 		}
 
+		// cf.cacheTtl / cf.cacheTtlByStatus route GET subrequests through
+		// the site's CacheStore, standing in for the edge cache. The
+		// request's cache mode decides whether it is read and written.
+		var cacheStore core.CacheStore
+		cacheKey := args.URL
+		if args.CF.cachesResponses() && args.Cache != "no-store" &&
+			(args.Method == "" || args.Method == "GET") && !args.StreamBody &&
+			state != nil && state.Env != nil && state.Env.Cache != nil {
+			cacheStore = state.Env.Cache
+			if args.CF.CacheKey != "" {
+				cacheKey = args.CF.CacheKey
+			}
+		}
+		if cacheStore != nil && fetchCacheReadable(args.Cache) {
+			if result, ok := cachedFetchResult(cacheStore, cacheKey, args.URL); ok {
+				if args.Integrity != "" {
+					body, _ := base64.StdEncoding.DecodeString(result.BodyB64)
+					if err := checkIntegrity(args.Integrity, body); err != nil {
+						result = eventloop.FetchResult{Err: err}
+					}
+				}
+				fetchID := core.NewFetchID(reqID)
+				resultCh := make(chan eventloop.FetchResult, 1)
+				resultCh <- result
+				el.AddPendingFetch(&eventloop.PendingFetch{ResultCh: resultCh, FetchID: fetchID})
+				return fetchID, nil
+			}
+		}
+		if args.Cache == "only-if-cached" {
+			return "", fmt.Errorf("fetch: no cached response for an only-if-cached request")
+		}
+
 		var bodyReader io.Reader
-		if args.Body != "" {
+		var streamBody *fetchBodyStream
+		if args.StreamBody {
+			if state == nil {
+				return "", fmt.Errorf("fetch: streaming request bodies require an active request")
+			}
+			// A body with unknown length is sent chunked.
+			streamBody = newFetchBodyStream()
+			bodyReader = streamBody
+		} else if args.Body != "" {
 			if args.BodyIsBase64 {
 				decoded, err := base64.StdEncoding.DecodeString(args.Body)
 				if err != nil {
@@ -261,6 +541,9 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 
 		fetchCtx, fetchCancel := context.WithCancel(context.Background())
 		fetchID := core.RegisterFetchCancel(reqID, fetchCancel)
+		if args.Keepalive {
+			core.KeepFetchAlive(reqID, fetchID)
+		}
 
 		httpReq, err := http.NewRequestWithContext(fetchCtx, args.Method, args.URL, bodyReader)
 		if err != nil {
@@ -268,12 +551,28 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 			core.RemoveFetchCancel(reqID, fetchID)
 			return "", fmt.Errorf("fetch: %s", err.Error())
 		}
+		var bodyStreams *fetchBodyStreams
+		if streamBody != nil {
+			bodyStreams = getFetchBodyStreams(state)
+			bodyStreams.add(fetchID, streamBody)
+		}
+		// Headers the worker sets win over the configured defaults.
+		for k, v := range cfg.FetchDefaultHeaders {
+			httpReq.Header.Set(k, v)
+		}
 		for k, v := range headers {
 			if ForbiddenFetchHeaders[strings.ToLower(k)] {
 				continue
 			}
 			httpReq.Header.Set(k, v)
 		}
+		if httpReq.Header.Get("User-Agent") == "" {
+			userAgent := cfg.FetchUserAgent
+			if userAgent == "" {
+				userAgent = DefaultFetchUserAgent
+			}
+			httpReq.Header.Set("User-Agent", userAgent)
+		}
 
 		redirectMode := args.Redirect
 		if redirectMode == "" {
@@ -303,7 +602,7 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 
 		client := &http.Client{
 			Timeout:       timeout,
-			Transport:     FetchTransport,
+			Transport:     fetchTransport(cfg),
 			CheckRedirect: checkRedirect,
 		}
 
@@ -311,11 +610,18 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 		capturedURL := args.URL
 		capturedFetchCtx := fetchCtx
 		capturedFetchCancel := fetchCancel
+		deadline := time.Now().Add(timeout)
 
 		resultCh := make(chan eventloop.FetchResult, 1)
 		go func() {
 			defer capturedFetchCancel()
-			resp, httpErr := client.Do(httpReq)
+			resp, httpErr := args.Retry.do(capturedFetchCtx, client, httpReq, deadline)
+			if streamBody != nil {
+				// Once the response arrives the upstream no longer reads
+				// the body; further writes from JS fail.
+				streamBody.finish(errFetchBodyClosed)
+				bodyStreams.remove(fetchID)
+			}
 			if httpErr != nil {
 				abortedBySignal := capturedFetchCtx.Err() != nil
 				core.RemoveFetchCancel(reqID, fetchID)
@@ -333,22 +639,63 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 			defer func() { _ = resp.Body.Close() }()
 			core.RemoveFetchCancel(reqID, fetchID)
 
-			limitedReader := io.LimitReader(resp.Body, maxBytes+1)
-			respBody, readErr := io.ReadAll(limitedReader)
-			if readErr != nil {
-				resultCh <- eventloop.FetchResult{Err: fmt.Errorf("fetch: reading body: %s", readErr.Error())}
-				return
+			// A HEAD response has no body even when the upstream sends
+			// one; its headers, Content-Length included, pass through.
+			// Otherwise the body is counted as it is read and the fetch
+			// fails as soon as it passes maxBytes, so an oversized
+			// download is never buffered in full.
+			var respBody []byte
+			if httpReq.Method != http.MethodHead {
+				if resp.ContentLength > maxBytes {
+					resultCh <- eventloop.FetchResult{Err: fetchTooLargeError(maxBytes)}
+					return
+				}
+				var readErr error
+				respBody, readErr = io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+				if readErr != nil {
+					resultCh <- eventloop.FetchResult{Err: fmt.Errorf("fetch: reading body: %s", readErr.Error())}
+					return
+				}
+				if int64(len(respBody)) > maxBytes {
+					resultCh <- eventloop.FetchResult{Err: fetchTooLargeError(maxBytes)}
+					return
+				}
 			}
-			if int64(len(respBody)) > maxBytes {
-				respBody = respBody[:maxBytes]
+			if args.Integrity != "" {
+				if err := checkIntegrity(args.Integrity, respBody); err != nil {
+					resultCh <- eventloop.FetchResult{Err: err}
+					return
+				}
 			}
 
 			respHeaders := make(map[string]string)
 			for k, vals := range resp.Header {
 				respHeaders[strings.ToLower(k)] = strings.Join(vals, ", ")
 			}
+			if cacheStore != nil {
+				if ttl, ok := args.CF.ttlFor(resp.StatusCode); ok && ttl > 0 &&
+					(args.CF.CacheEverything || fetchResponseShareable(resp.Header)) {
+					storedJSON, _ := json.Marshal(respHeaders)
+					_ = cacheStore.Put(fetchCacheName, cacheKey, resp.StatusCode, string(storedJSON), respBody, &ttl)
+				}
+				respHeaders["cf-cache-status"] = "MISS"
+			}
 			hdrsJSON, _ := json.Marshal(respHeaders)
 
+			// resp.Trailer is only filled in once the body has been read
+			// to EOF.
+			var trailersJSON string
+			if len(resp.Trailer) > 0 {
+				trailers := make(map[string]string)
+				for k, vals := range resp.Trailer {
+					if len(vals) > 0 {
+						trailers[strings.ToLower(k)] = strings.Join(vals, ", ")
+					}
+				}
+				data, _ := json.Marshal(trailers)
+				trailersJSON = string(data)
+			}
+
 			finalURL := capturedURL
 			if resp.Request != nil && resp.Request.URL != nil {
 				finalURL = resp.Request.URL.String()
@@ -356,12 +703,13 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 			redirected := finalURL != capturedURL
 
 			resultCh <- eventloop.FetchResult{
-				Status:      resp.StatusCode,
-				StatusText:  resp.Status,
-				HeadersJSON: string(hdrsJSON),
-				BodyB64:     base64.StdEncoding.EncodeToString(respBody),
-				Redirected:  redirected,
-				FinalURL:    finalURL,
+				Status:       resp.StatusCode,
+				StatusText:   resp.Status,
+				HeadersJSON:  string(hdrsJSON),
+				BodyB64:      base64.StdEncoding.EncodeToString(respBody),
+				Redirected:   redirected,
+				FinalURL:     finalURL,
+				TrailersJSON: trailersJSON,
 			}
 		}()
 
@@ -371,8 +719,41 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 		return err
 	}
 
+	// __fetchBodyWrite(reqID, fetchID, dataB64) queues a chunk of a
+	// streaming request body.
+	if err := registerBridge(rt, "fetch", "__fetchBodyWrite", func(reqIDStr, fetchID, dataB64 string) (string, error) {
+		body := lookupFetchBody(reqIDStr, fetchID)
+		if body == nil {
+			return "", errFetchBodyClosed
+		}
+		data, err := base64.StdEncoding.DecodeString(dataB64)
+		if err != nil {
+			return "", fmt.Errorf("fetch: decoding body chunk: %s", err.Error())
+		}
+		return "", body.write(data)
+	}); err != nil {
+		return err
+	}
+
+	// __fetchBodyClose(reqID, fetchID, errMsg) ends a streaming request
+	// body; a non-empty errMsg fails the upload.
+	if err := registerBridge(rt, "fetch", "__fetchBodyClose", func(reqIDStr, fetchID, errMsg string) (string, error) {
+		body := lookupFetchBody(reqIDStr, fetchID)
+		if body == nil {
+			return "", nil
+		}
+		if errMsg == "" {
+			body.finish(io.EOF)
+		} else {
+			body.finish(errors.New(errMsg))
+		}
+		return "", nil
+	}); err != nil {
+		return err
+	}
+
 	// __fetchAbort(reqID, fetchID)
-	if err := rt.RegisterFunc("__fetchAbort", func(reqIDStr, fetchID string) {
+	if err := registerBridge(rt, "fetch", "__fetchAbort", func(reqIDStr, fetchID string) {
 		reqID := core.ParseReqID(reqIDStr)
 		core.CallFetchCancel(reqID, fetchID)
 	}); err != nil {
@@ -382,6 +763,261 @@ func SetupFetch(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoo
 	return rt.Eval(fetchJS)
 }
 
+// maxFetchRetryAttempts caps init.retry.attempts.
+const maxFetchRetryAttempts = 10
+
+// maxFetchRetryBackoff caps the wait between two attempts, so a huge
+// init.retry.backoffMs cannot overflow time.Duration once doubled.
+const maxFetchRetryBackoff = time.Minute
+
+// fetchRetry is the non-standard init.retry option. An idempotent request
+// that fails to connect or gets a 5xx response is sent again, up to
+// Attempts times in all, waiting BackoffMs and doubling the wait after
+// each try. Retries stop early when the fetch is aborted or when the next
+// wait would run past the fetch timeout.
+type fetchRetry struct {
+	Attempts  int `json:"attempts"`
+	BackoffMs int `json:"backoffMs"`
+}
+
+// attemptsFor is how many times a request may be sent. A nil option, a
+// non-idempotent method or a body that cannot be replayed allows one.
+func (r *fetchRetry) attemptsFor(req *http.Request) int {
+	if r == nil || r.Attempts <= 1 {
+		return 1
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return 1
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 1
+	}
+	return min(r.Attempts, maxFetchRetryAttempts)
+}
+
+// do sends req, retrying as the option allows, and returns the last
+// response or error.
+func (r *fetchRetry) do(ctx context.Context, client *http.Client, req *http.Request, deadline time.Time) (*http.Response, error) {
+	attempts := r.attemptsFor(req)
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt >= attempts || ctx.Err() != nil || !retryableFetch(resp, err) {
+			return resp, err
+		}
+		delay := r.backoff(attempt)
+		if time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			_ = resp.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		next := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			next.Body = body
+		}
+		req = next
+	}
+}
+
+// backoff is the wait after the given attempt: BackoffMs doubled once per
+// earlier attempt, capped at maxFetchRetryBackoff.
+func (r *fetchRetry) backoff(attempt int) time.Duration {
+	base := time.Duration(min(max(r.BackoffMs, 0), int(maxFetchRetryBackoff/time.Millisecond))) * time.Millisecond
+	shift := min(max(attempt-1, 0), maxFetchRetryAttempts)
+	return min(base<<shift, maxFetchRetryBackoff)
+}
+
+// retryableFetch reports whether a fetch outcome is worth retrying: a
+// connection-level failure or a 5xx response.
+func retryableFetch(resp *http.Response, err error) bool {
+	if err != nil {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	return resp.StatusCode >= 500
+}
+
+// fetchTooLargeError is the rejection for a fetch whose response body is
+// larger than the configured MaxResponseBytes.
+func fetchTooLargeError(maxBytes int64) error {
+	return fmt.Errorf("fetch: response body too large: exceeds limit of %d bytes", maxBytes)
+}
+
+// fetchCacheName is the CacheStore cache that fetch() subrequests with cf
+// caching options read and write. It is kept apart from caches.default so
+// the Cache API does not see subrequest entries.
+const fetchCacheName = "__fetch_subrequests"
+
+// fetchCFOptions holds the cf caching options accepted by fetch().
+type fetchCFOptions struct {
+	CacheTTL         *int           `json:"cacheTtl"`
+	CacheTTLByStatus map[string]int `json:"cacheTtlByStatus"`
+	CacheEverything  bool           `json:"cacheEverything"`
+	CacheKey         string         `json:"cacheKey"`
+}
+
+// fetchCacheReadable reports whether a request with the given cache mode may
+// be answered from the cache. "reload" and "no-cache" always go to the
+// origin, since there is no conditional revalidation, but the fresh response
+// is still stored.
+func fetchCacheReadable(mode string) bool {
+	return mode != "reload" && mode != "no-cache"
+}
+
+// fetchResponseShareable reports whether a response may be stored under its
+// URL and replayed to other visitors without cf.cacheEverything: one that
+// sets cookies, is marked private or no-store, or varies on request headers
+// other than Accept-Encoding belongs to a single visitor.
+func fetchResponseShareable(h http.Header) bool {
+	if len(h.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			d, _, _ = strings.Cut(strings.TrimSpace(d), "=")
+			if strings.EqualFold(d, "private") || strings.EqualFold(d, "no-store") {
+				return false
+			}
+		}
+	}
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" && !strings.EqualFold(f, "Accept-Encoding") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cachesResponses reports whether any TTL option was given.
+func (o *fetchCFOptions) cachesResponses() bool {
+	return o != nil && (o.CacheTTL != nil || len(o.CacheTTLByStatus) > 0)
+}
+
+// ttlFor returns the TTL in seconds for a response with the given status.
+// A matching cacheTtlByStatus entry ("200", "200-299") takes precedence over
+// cacheTtl, the narrowest range winning; ok is false if neither applies.
+func (o *fetchCFOptions) ttlFor(status int) (ttl int, ok bool) {
+	width := -1
+	for rng, v := range o.CacheTTLByStatus {
+		lo, hi, valid := parseStatusRange(rng)
+		if !valid || status < lo || status > hi {
+			continue
+		}
+		if width < 0 || hi-lo < width || (hi-lo == width && v < ttl) {
+			ttl, width = v, hi-lo
+		}
+	}
+	if width >= 0 {
+		return ttl, true
+	}
+	if o.CacheTTL != nil {
+		return *o.CacheTTL, true
+	}
+	return 0, false
+}
+
+// parseStatusRange parses a cacheTtlByStatus key: a single status code or
+// an inclusive "lo-hi" range.
+func parseStatusRange(s string) (lo, hi int, ok bool) {
+	a, b, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	lo, err := strconv.Atoi(strings.TrimSpace(a))
+	if err != nil {
+		return 0, 0, false
+	}
+	hi = lo
+	if isRange {
+		if hi, err = strconv.Atoi(strings.TrimSpace(b)); err != nil {
+			return 0, 0, false
+		}
+	}
+	return lo, hi, lo <= hi
+}
+
+// checkIntegrity verifies body against subresource integrity metadata such
+// as "sha384-<base64>". Only the strongest algorithm listed is checked and
+// any of its digests may match; metadata naming no supported algorithm
+// passes, as in browsers.
+func checkIntegrity(metadata string, body []byte) error {
+	strength := map[string]int{"sha256": 1, "sha384": 2, "sha512": 3}
+	best := 0
+	var want []string
+	for _, token := range strings.Fields(metadata) {
+		token, _, _ = strings.Cut(token, "?")
+		alg, digest, ok := strings.Cut(token, "-")
+		s := strength[strings.ToLower(alg)]
+		if !ok || s == 0 || s < best {
+			continue
+		}
+		if s > best {
+			best, want = s, nil
+		}
+		want = append(want, strings.TrimRight(digest, "="))
+	}
+	if best == 0 {
+		return nil
+	}
+	var sum []byte
+	switch best {
+	case 1:
+		h := sha256.Sum256(body)
+		sum = h[:]
+	case 2:
+		h := sha512.Sum384(body)
+		sum = h[:]
+	default:
+		h := sha512.Sum512(body)
+		sum = h[:]
+	}
+	got := base64.RawStdEncoding.EncodeToString(sum)
+	for _, d := range want {
+		if subtle.ConstantTimeCompare([]byte(d), []byte(got)) == 1 {
+			return nil
+		}
+	}
+	return fmt.Errorf("fetch: integrity check failed")
+}
+
+// cachedFetchResult looks up a cached subrequest response and converts it to
+// a FetchResult marked with cf-cache-status: HIT.
+func cachedFetchResult(store core.CacheStore, key, url string) (eventloop.FetchResult, bool) {
+	entry, err := store.Match(fetchCacheName, key)
+	if err != nil || entry == nil {
+		return eventloop.FetchResult{}, false
+	}
+	if entry.ExpiresAt != nil && entry.ExpiresAt.Before(time.Now()) {
+		return eventloop.FetchResult{}, false
+	}
+	headers := make(map[string]string)
+	if entry.Headers != "" {
+		_ = json.Unmarshal([]byte(entry.Headers), &headers)
+	}
+	headers["cf-cache-status"] = "HIT"
+	hdrsJSON, _ := json.Marshal(headers)
+	return eventloop.FetchResult{
+		Status:      entry.Status,
+		StatusText:  fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		HeadersJSON: string(hdrsJSON),
+		BodyB64:     base64.StdEncoding.EncodeToString(entry.Body),
+		FinalURL:    url,
+	}, true
+}
+
 // --- SSRF Protection ---
 
 // IsPrivateHostname performs a fast, non-resolving pre-check for obviously
@@ -407,29 +1043,40 @@ func IsPrivateHostname(rawURL string) bool {
 
 // ssrfSafeDialContext resolves DNS and validates the resolved IP against
 // private ranges at connect time, preventing DNS rebinding / TOCTOU attacks.
-func ssrfSafeDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
-	host, port, err := net.SplitHostPort(addr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
-	}
-	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
-	if err != nil {
-		return nil, fmt.Errorf("DNS lookup failed for %s: %w", host, err)
+var ssrfSafeDialContext = ssrfDialContext(lookupIPAddr, nil)
+
+// ssrfDialContext returns an SSRF-safe dial function that resolves hosts
+// with lookup and connects to the chosen IP with dial, or a plain
+// net.Dialer when dial is nil. IP literals are not looked up.
+func ssrfDialContext(lookup func(ctx context.Context, host string) ([]net.IPAddr, error), dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
 	}
-	var safeIP net.IPAddr
-	found := false
-	for _, ip := range ips {
-		if !IsPrivateIP(ip.IP) {
-			safeIP = ip
-			found = true
-			break
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", addr, err)
 		}
+		var ips []net.IPAddr
+		if ip := net.ParseIP(host); ip != nil {
+			ips = []net.IPAddr{{IP: ip}}
+		} else if ips, err = lookup(ctx, host); err != nil {
+			return nil, fmt.Errorf("DNS lookup failed for %s: %w", host, err)
+		}
+		var safeIP net.IPAddr
+		found := false
+		for _, ip := range ips {
+			if !FetchSSRFEnabled || !IsPrivateIP(ip.IP) {
+				safeIP = ip
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("fetch to private IP addresses is not allowed")
+		}
+		return dial(ctx, network, net.JoinHostPort(safeIP.IP.String(), port))
 	}
-	if !found {
-		return nil, fmt.Errorf("fetch to private IP addresses is not allowed")
-	}
-	dialer := &net.Dialer{}
-	return dialer.DialContext(ctx, network, net.JoinHostPort(safeIP.IP.String(), port))
 }
 
 // privateRanges is parsed once at init time.
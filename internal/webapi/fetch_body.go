@@ -0,0 +1,137 @@
+package webapi
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/cryguy/worker/v2/internal/core"
+)
+
+// errFetchBodyClosed is returned to JS when it writes to a streaming request
+// body whose fetch has already finished or been aborted.
+var errFetchBodyClosed = errors.New("fetch: request body stream is closed")
+
+// fetchBodyStream is the upstream request body for a fetch() whose body is
+// a ReadableStream sent with duplex: "half". JS pushes chunks from the event
+// loop without blocking; the HTTP client goroutine reads them as they arrive.
+type fetchBodyStream struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	chunks [][]byte
+	done   bool
+	err    error // returned by Read once chunks are drained; io.EOF on a clean end
+}
+
+func newFetchBodyStream() *fetchBodyStream {
+	b := &fetchBodyStream{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Read blocks until a chunk is available or the body has ended.
+func (b *fetchBodyStream) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.chunks) == 0 && !b.done {
+		b.cond.Wait()
+	}
+	if len(b.chunks) == 0 {
+		return 0, b.err
+	}
+	n := copy(p, b.chunks[0])
+	if n == len(b.chunks[0]) {
+		b.chunks = b.chunks[1:]
+	} else {
+		b.chunks[0] = b.chunks[0][n:]
+	}
+	return n, nil
+}
+
+// Close is called by the HTTP transport once it no longer needs the body.
+func (b *fetchBodyStream) Close() error {
+	b.finish(errFetchBodyClosed)
+	return nil
+}
+
+// write queues a chunk from JS.
+func (b *fetchBodyStream) write(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return errFetchBodyClosed
+	}
+	if len(data) > 0 {
+		b.chunks = append(b.chunks, data)
+		b.cond.Broadcast()
+	}
+	return nil
+}
+
+// finish ends the body. Chunks already queued are still delivered, then
+// Read returns err. Only the first call has any effect.
+func (b *fetchBodyStream) finish(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return
+	}
+	b.done = true
+	b.err = err
+	b.cond.Broadcast()
+}
+
+// fetchBodyStreams tracks the streaming request bodies of one request's
+// in-flight fetches, keyed by fetch ID. Stored in core.RequestState via the
+// extension map under key "fetchBodies".
+type fetchBodyStreams struct {
+	mu     sync.Mutex
+	bodies map[string]*fetchBodyStream
+}
+
+// getFetchBodyStreams retrieves the fetchBodyStreams for a request, creating
+// it (and a cleanup that ends any unfinished bodies) if necessary.
+func getFetchBodyStreams(state *core.RequestState) *fetchBodyStreams {
+	if v := state.GetExt("fetchBodies"); v != nil {
+		return v.(*fetchBodyStreams)
+	}
+	fbs := &fetchBodyStreams{bodies: make(map[string]*fetchBodyStream)}
+	state.SetExt("fetchBodies", fbs)
+	state.RegisterCleanup(func() {
+		fbs.mu.Lock()
+		defer fbs.mu.Unlock()
+		for id, b := range fbs.bodies {
+			b.finish(io.ErrUnexpectedEOF)
+			delete(fbs.bodies, id)
+		}
+	})
+	return fbs
+}
+
+func (f *fetchBodyStreams) add(fetchID string, b *fetchBodyStream) {
+	f.mu.Lock()
+	f.bodies[fetchID] = b
+	f.mu.Unlock()
+}
+
+func (f *fetchBodyStreams) get(fetchID string) *fetchBodyStream {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.bodies[fetchID]
+}
+
+func (f *fetchBodyStreams) remove(fetchID string) {
+	f.mu.Lock()
+	delete(f.bodies, fetchID)
+	f.mu.Unlock()
+}
+
+// lookupFetchBody returns the streaming request body of an in-flight fetch,
+// or nil if the fetch has finished or has no streaming body.
+func lookupFetchBody(reqIDStr, fetchID string) *fetchBodyStream {
+	state := core.GetRequestState(core.ParseReqID(reqIDStr))
+	if state == nil {
+		return nil
+	}
+	return getFetchBodyStreams(state).get(fetchID)
+}
@@ -0,0 +1,121 @@
+package webapi
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// DNSResolver looks up the addresses of a host. *net.Resolver satisfies it.
+type DNSResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// FetchResolver is the resolver fetch connections use. Tests can override it.
+var FetchResolver DNSResolver = net.DefaultResolver
+
+// DefaultFetchDNSCacheEntries is the number of hosts the fetch DNS cache
+// holds when EngineConfig.FetchDNSCacheEntries is unset.
+const DefaultFetchDNSCacheEntries = 1024
+
+func lookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return FetchResolver.LookupIPAddr(ctx, host)
+}
+
+// dnsCache remembers successful lookups for ttl so repeated fetches to the
+// same host skip resolution. Failed lookups are never cached. Concurrent
+// misses for a host share a single lookup. The cached addresses still pass
+// through the SSRF check on every dial.
+type dnsCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu       sync.Mutex
+	entries  map[string]dnsCacheEntry
+	inflight map[string]*dnsLookup
+}
+
+type dnsCacheEntry struct {
+	addrs   []net.IPAddr
+	expires time.Time
+}
+
+// dnsLookup is a resolution in progress; done is closed once addrs and err
+// are set.
+type dnsLookup struct {
+	done  chan struct{}
+	addrs []net.IPAddr
+	err   error
+}
+
+func newDNSCache(ttl time.Duration, maxEntries int) *dnsCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultFetchDNSCacheEntries
+	}
+	return &dnsCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]dnsCacheEntry),
+		inflight:   make(map[string]*dnsLookup),
+	}
+}
+
+// lookup returns the cached addresses for host, resolving and caching them
+// when there is no live entry. A caller that finds a lookup for host already
+// running waits for its result instead of starting another.
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[host]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.addrs, nil
+	}
+	if call, ok := c.inflight[host]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.addrs, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &dnsLookup{done: make(chan struct{})}
+	c.inflight[host] = call
+	c.mu.Unlock()
+
+	// The shared lookup must not fail for every waiter because the dial that
+	// started it was cancelled.
+	call.addrs, call.err = lookupIPAddr(context.WithoutCancel(ctx), host)
+
+	c.mu.Lock()
+	delete(c.inflight, host)
+	if call.err == nil {
+		now := time.Now()
+		if _, ok := c.entries[host]; !ok && len(c.entries) >= c.maxEntries {
+			c.evictLocked(now)
+		}
+		c.entries[host] = dnsCacheEntry{addrs: call.addrs, expires: now.Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return call.addrs, call.err
+}
+
+// evictLocked drops expired entries, or the one closest to expiry when none
+// have expired yet. c.mu must be held.
+func (c *dnsCache) evictLocked(now time.Time) {
+	var oldest string
+	var oldestExpires time.Time
+	for host, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, host)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(oldestExpires) {
+			oldest, oldestExpires = host, entry.expires
+		}
+	}
+	if len(c.entries) >= c.maxEntries && oldest != "" {
+		delete(c.entries, oldest)
+	}
+}
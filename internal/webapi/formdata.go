@@ -13,6 +13,24 @@ const formdataJS = `
 
 // --- Blob ---
 
+// A Blob keeps its content as binary strings, one character per byte, so
+// text and binary parts can be mixed without losing bytes above 0x7f.
+function bytesToBinary(arr) {
+	const CHUNK = 1024;
+	let s = '';
+	for (let i = 0; i < arr.length; i += CHUNK) {
+		const end = Math.min(i + CHUNK, arr.length);
+		s += String.fromCharCode.apply(null, arr.subarray(i, end));
+	}
+	return s;
+}
+
+function binaryToBytes(s) {
+	const out = new Uint8Array(s.length);
+	for (let i = 0; i < s.length; i++) out[i] = s.charCodeAt(i) & 0xff;
+	return out;
+}
+
 class Blob {
 	constructor(parts, options) {
 		options = options || {};
@@ -24,37 +42,20 @@ class Blob {
 		if (parts) {
 			const enc = new TextEncoder();
 			for (const part of parts) {
-				if (typeof part === 'string') {
-					this._parts.push(part);
-					this._size += enc.encode(part).length;
-				} else if (part instanceof Blob) {
+				let s;
+				if (part instanceof Blob) {
 					this._parts.push(...part._parts);
 					this._size += part._size;
+					continue;
 				} else if (part instanceof ArrayBuffer) {
-					const arr = new Uint8Array(part);
-					const CHUNK = 1024;
-					let s = '';
-					for (let i = 0; i < arr.length; i += CHUNK) {
-						const end = Math.min(i + CHUNK, arr.length);
-						s += String.fromCharCode.apply(null, arr.subarray(i, end));
-					}
-					this._parts.push(s);
-					this._size += arr.length;
+					s = bytesToBinary(new Uint8Array(part));
 				} else if (ArrayBuffer.isView(part)) {
-					const arr = new Uint8Array(part.buffer, part.byteOffset, part.byteLength);
-					const CHUNK = 1024;
-					let s = '';
-					for (let i = 0; i < arr.length; i += CHUNK) {
-						const end = Math.min(i + CHUNK, arr.length);
-						s += String.fromCharCode.apply(null, arr.subarray(i, end));
-					}
-					this._parts.push(s);
-					this._size += arr.length;
+					s = bytesToBinary(new Uint8Array(part.buffer, part.byteOffset, part.byteLength));
 				} else {
-					const str = String(part);
-					this._parts.push(str);
-					this._size += enc.encode(str).length;
+					s = bytesToBinary(enc.encode(String(part)));
 				}
+				this._parts.push(s);
+				this._size += s.length;
 			}
 		}
 	}
@@ -67,20 +68,20 @@ class Blob {
 		const size = this._size;
 		let s = start === undefined ? 0 : start < 0 ? Math.max(size + start, 0) : Math.min(start, size);
 		let e = end === undefined ? size : end < 0 ? Math.max(size + end, 0) : Math.min(end, size);
-		const full = this._parts.join('');
-		const sliced = full.slice(s, e);
+		const sliced = this._parts.join('').slice(s, e);
 		const ct = contentType !== undefined ? String(contentType).toLowerCase() : this.type;
-		return new Blob([sliced], { type: ct });
+		const blob = new Blob([], { type: ct });
+		blob._parts = [sliced];
+		blob._size = sliced.length;
+		return blob;
 	}
 
 	async text() {
-		return this._parts.join('');
+		return new TextDecoder().decode(__blobBytes(this));
 	}
 
 	async arrayBuffer() {
-		const text = this._parts.join('');
-		const enc = new TextEncoder();
-		return enc.encode(text).buffer;
+		return __blobBytes(this).buffer;
 	}
 
 	get [Symbol.toStringTag]() { return 'Blob'; }
@@ -177,6 +178,38 @@ class FormData {
 	get [Symbol.toStringTag]() { return 'FormData'; }
 }
 
+// __encodeFormData serializes a FormData as a multipart/form-data body and
+// returns the bytes together with the Content-Type carrying its boundary.
+globalThis.__encodeFormData = function(fd) {
+	const enc = new TextEncoder();
+	const boundary = '----WorkerFormBoundary' + Math.random().toString(36).slice(2) + Math.random().toString(36).slice(2);
+	const escape = (s) => String(s).replace(/"/g, '%22').replace(/\r/g, '%0D').replace(/\n/g, '%0A');
+	const chunks = [];
+	for (const [name, value] of fd._entries) {
+		let head = '--' + boundary + '\r\nContent-Disposition: form-data; name="' + escape(name) + '"';
+		if (typeof value === 'string') {
+			chunks.push(enc.encode(head + '\r\n\r\n'), enc.encode(value));
+		} else {
+			head += '; filename="' + escape(value.name || 'blob') + '"\r\n';
+			head += 'Content-Type: ' + (value.type || 'application/octet-stream') + '\r\n\r\n';
+			chunks.push(enc.encode(head), __blobBytes(value));
+		}
+		chunks.push(enc.encode('\r\n'));
+	}
+	chunks.push(enc.encode('--' + boundary + '--\r\n'));
+	let total = 0;
+	for (const c of chunks) total += c.length;
+	const body = new Uint8Array(total);
+	let off = 0;
+	for (const c of chunks) { body.set(c, off); off += c.length; }
+	return { body: body, contentType: 'multipart/form-data; boundary=' + boundary };
+};
+
+// __blobBytes returns the content of a Blob as a fresh Uint8Array.
+globalThis.__blobBytes = function(blob) {
+	return binaryToBytes(blob._parts.join(''));
+};
+
 globalThis.Blob = Blob;
 globalThis.File = File;
 globalThis.FormData = FormData;
@@ -1,16 +1,21 @@
 package webapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cryguy/worker/v2/internal/core"
 	"github.com/cryguy/worker/v2/internal/eventloop"
 )
 
-// globalsJS defines pure-JS polyfills for simple global APIs.
+// globalsJS defines pure-JS polyfills for simple global APIs. It is a
+// format string taking navigator.userAgent, which matches the User-Agent
+// that fetch sends by default.
 const globalsJS = `
 globalThis.structuredClone = (function() {
 	var TYPED_ARRAY_CONSTRUCTORS = [
@@ -31,6 +36,57 @@ globalThis.structuredClone = (function() {
 		return new DOMException(msg, 'DataCloneError');
 	}
 
+	// Error types that keep their type across a clone; any other name
+	// comes back as a plain Error.
+	var ERROR_CONSTRUCTORS = {
+		Error: Error, EvalError: EvalError, RangeError: RangeError,
+		ReferenceError: ReferenceError, SyntaxError: SyntaxError,
+		TypeError: TypeError, URIError: URIError,
+	};
+
+	function defineHidden(obj, name, value) {
+		Object.defineProperty(obj, name, { value: value, writable: true, configurable: true });
+	}
+
+	// cloneErrorObject copies an Error's type, message, stack and cause. A
+	// DOMException keeps its name as well.
+	function cloneErrorObject(value, seen) {
+		var clonedErr;
+		if (typeof DOMException !== 'undefined' && value instanceof DOMException) {
+			clonedErr = new DOMException(value.message, value.name);
+		} else {
+			var name = String(value.name);
+			var Ctor = Object.prototype.hasOwnProperty.call(ERROR_CONSTRUCTORS, name) ? ERROR_CONSTRUCTORS[name] : Error;
+			clonedErr = new Ctor();
+			var msg = Object.getOwnPropertyDescriptor(value, 'message');
+			if (msg && 'value' in msg) defineHidden(clonedErr, 'message', String(msg.value));
+		}
+		seen.set(value, clonedErr);
+		if (typeof value.stack === 'string') defineHidden(clonedErr, 'stack', value.stack);
+		if (Object.prototype.hasOwnProperty.call(value, 'cause')) defineHidden(clonedErr, 'cause', deepClone(value.cause, seen));
+		return clonedErr;
+	}
+
+	function isDetached(buf) {
+		if (typeof buf.detached === 'boolean') return buf.detached;
+		// Engines without ArrayBuffer.prototype.detached refuse to create
+		// a view over a detached buffer.
+		try {
+			new Uint8Array(buf);
+			return false;
+		} catch (e) {
+			return true;
+		}
+	}
+
+	function cloneArrayBuffer(buf, seen) {
+		if (seen.has(buf)) return seen.get(buf);
+		if (isDetached(buf)) throw cloneError('ArrayBuffer is detached and could not be cloned');
+		var clonedAB = buf.slice(0);
+		seen.set(buf, clonedAB);
+		return clonedAB;
+	}
+
 	function deepClone(value, seen) {
 		if (value === null || value === undefined) return value;
 
@@ -50,30 +106,45 @@ globalThis.structuredClone = (function() {
 			seen.set(value, clonedDate);
 			return clonedDate;
 		}
+		// Primitive wrapper objects (Object(1n), new Number(1), ...) keep
+		// their wrapped value, including BigInt.
+		if (typeof BigInt !== 'undefined' && value instanceof BigInt) {
+			var clonedBigInt = Object(BigInt.prototype.valueOf.call(value));
+			seen.set(value, clonedBigInt);
+			return clonedBigInt;
+		}
+		if (value instanceof Number || value instanceof String || value instanceof Boolean) {
+			var clonedPrim = Object(value.valueOf());
+			seen.set(value, clonedPrim);
+			return clonedPrim;
+		}
+		if (value instanceof Error || (typeof DOMException !== 'undefined' && value instanceof DOMException)) {
+			return cloneErrorObject(value, seen);
+		}
 		if (value instanceof RegExp) {
 			var clonedRegex = new RegExp(value.source, value.flags);
 			seen.set(value, clonedRegex);
 			return clonedRegex;
 		}
 		if (value instanceof ArrayBuffer) {
-			var clonedAB = value.slice(0);
-			seen.set(value, clonedAB);
-			return clonedAB;
+			return cloneArrayBuffer(value, seen);
 		}
 
+		// Views are cloned over a copy of their whole buffer with the same
+		// offset and length, and views sharing a buffer share its clone.
 		for (var ti = 0; ti < TYPED_ARRAY_CONSTRUCTORS.length; ti++) {
 			var TA = TYPED_ARRAY_CONSTRUCTORS[ti];
 			if (value instanceof TA) {
-				var clonedBuf = value.buffer.slice(value.byteOffset, value.byteOffset + value.byteLength);
-				var clonedTA = new TA(clonedBuf);
+				var clonedBuf = cloneArrayBuffer(value.buffer, seen);
+				var clonedTA = new TA(clonedBuf, value.byteOffset, value.length);
 				seen.set(value, clonedTA);
 				return clonedTA;
 			}
 		}
 
 		if (typeof DataView !== 'undefined' && value instanceof DataView) {
-			var dvBuf = value.buffer.slice(value.byteOffset, value.byteOffset + value.byteLength);
-			var clonedDV = new DataView(dvBuf);
+			var dvBuf = cloneArrayBuffer(value.buffer, seen);
+			var clonedDV = new DataView(dvBuf, value.byteOffset, value.byteLength);
 			seen.set(value, clonedDV);
 			return clonedDV;
 		}
@@ -125,12 +196,27 @@ globalThis.structuredClone = (function() {
 })();
 
 globalThis.queueMicrotask = function(fn) {
-	Promise.resolve().then(fn);
+	Promise.resolve().then(function() {
+		try {
+			fn();
+		} catch (e) {
+			if (typeof globalThis.reportError === 'function') globalThis.reportError(e);
+		}
+	});
 };
 
+// self names the worker global scope, as in browsers and service workers,
+// so built-ins on globalThis are reachable through it too.
+Object.defineProperty(globalThis, 'self', {
+	value: globalThis,
+	writable: true,
+	enumerable: true,
+	configurable: true,
+});
+
 Object.defineProperty(globalThis, 'navigator', {
 	value: {
-		userAgent: "hostedat-worker/1.0",
+		userAgent: %q,
 		scheduling: { isInputPending: function() { return false; } },
 		sendBeacon: function(url, data) {
 			var body = '';
@@ -150,16 +236,366 @@ Object.defineProperty(globalThis, 'navigator', {
 });
 `
 
+// globalResetJS records the global object, every constructor on it with
+// its prototype and their prototype chains, and the namespace objects, as
+// they are once a worker has loaded, and defines __resetGlobals to put them
+// back. Pools call it between requests so properties a request adds,
+// replaces or deletes on globalThis or on a built-in prototype do not leak
+// into the next request on the same isolate. __resetGlobals returns the
+// names of the properties it could not restore or delete, such as a
+// non-configurable one the request defined.
+const globalResetJS = `
+(function() {
+	// Namespace objects are not constructors, so they are listed by name.
+	var namespaces = ['JSON', 'Math', 'Reflect', 'Atomics', 'Intl'];
+	var getDesc = Object.getOwnPropertyDescriptor;
+	var defineProp = Object.defineProperty;
+	var getProto = Object.getPrototypeOf;
+	var ownKeys = Reflect.ownKeys;
+	var same = Object.is;
+
+	// Defined before the snapshot so that it is part of it.
+	defineProp(globalThis, '__resetGlobals', { value: reset });
+
+	var targets = [globalThis], labels = ['globalThis'];
+	var seen = new Set(targets);
+	function record(obj, label) {
+		// Walk the prototype chain too, so that %TypedArray% and
+		// %TypedArray%.prototype behind Uint8Array are covered.
+		while (obj !== null && (typeof obj === 'object' || typeof obj === 'function') && !seen.has(obj)) {
+			seen.add(obj);
+			targets.push(obj);
+			labels.push(label);
+			obj = getProto(obj);
+			label += '.__proto__';
+		}
+	}
+	var globals = Object.getOwnPropertyNames(globalThis);
+	for (var i = 0; i < globals.length; i++) {
+		// The __ helpers are internal, so only their binding on globalThis
+		// is restored. Accessors are skipped rather than called.
+		if (globals[i].indexOf('__') === 0) continue;
+		var c = getDesc(globalThis, globals[i]).value;
+		if (typeof c !== 'function' || c.prototype === null ||
+			(typeof c.prototype !== 'object' && typeof c.prototype !== 'function')) continue;
+		record(c, globals[i]);
+		record(c.prototype, globals[i] + '.prototype');
+	}
+	for (var n = 0; n < namespaces.length; n++) {
+		var ns = getDesc(globalThis, namespaces[n]);
+		if (ns && ns.value !== null && typeof ns.value === 'object') record(ns.value, namespaces[n]);
+	}
+
+	// Every recorded property goes into flat arrays so that reset is one
+	// tight loop. Data properties are compared by value, which avoids
+	// building a descriptor per property on every reset; a deleted property
+	// reads differently too, so the slower scan for added keys only runs for
+	// a target whose key count changed or that had something restored.
+	var owner = [], names = [], values = [], isData = [], descs = [];
+	var keyCounts = [], known = [];
+	for (var t = 0; t < targets.length; t++) {
+		var keys = ownKeys(targets[t]);
+		keyCounts.push(keys.length);
+		known.push(new Set(keys));
+		for (var k = 0; k < keys.length; k++) {
+			var desc = getDesc(targets[t], keys[k]);
+			owner.push(t);
+			names.push(keys[k]);
+			isData.push('value' in desc);
+			values.push(desc.value);
+			descs.push(desc);
+		}
+	}
+
+	function reset() {
+		var dirty = [], stuck = [];
+		for (var i = 0; i < names.length; i++) {
+			var target = targets[owner[i]];
+			if (isData[i]) {
+				// Object.is only differs from === for zeros and NaN.
+				var v = target[names[i]];
+				if (v === values[i] ? v !== 0 || same(v, values[i]) : v !== v && values[i] !== values[i]) continue;
+			} else {
+				var cur = getDesc(target, names[i]);
+				if (cur !== undefined && cur.get === descs[i].get && cur.set === descs[i].set) continue;
+			}
+			dirty[owner[i]] = true;
+			try { defineProp(target, names[i], descs[i]); }
+			catch (e) { stuck.push(labels[owner[i]] + '.' + String(names[i])); }
+		}
+		for (var t = 0; t < targets.length; t++) {
+			var keys = ownKeys(targets[t]);
+			if (!dirty[t] && keys.length === keyCounts[t]) continue;
+			for (var k = 0; k < keys.length; k++) {
+				if (!known[t].has(keys[k])) {
+					var gone = false;
+					try { gone = delete targets[t][keys[k]]; } catch (e) {}
+					if (!gone) stuck.push(labels[t] + '.' + String(keys[k]));
+				}
+			}
+		}
+		return stuck;
+	}
+})();
+`
+
+// SnapshotGlobals records the worker's global environment so that
+// __resetGlobals can restore it between requests. It must run after the
+// worker script has loaded.
+func SnapshotGlobals(rt core.JSRuntime) error {
+	if err := rt.Eval(globalResetJS); err != nil {
+		return fmt.Errorf("evaluating global snapshot: %w", err)
+	}
+	return nil
+}
+
 // waitUntilJS provides ctx.waitUntil support and the drainWaitUntil mechanism.
 const waitUntilJS = `
 globalThis.__waitUntilPromises = [];
 `
 
+// SetupWindowAlias defines window as another name for the global scope.
+// Workers leave window undefined, and some libraries take its presence to
+// mean they run in a browser, so engines only call this when configured to.
+func SetupWindowAlias(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+	if err := rt.Eval(`Object.defineProperty(globalThis, 'window', { value: globalThis, writable: true, enumerable: true, configurable: true });`); err != nil {
+		return fmt.Errorf("defining window alias: %w", err)
+	}
+	return nil
+}
+
+// arrayBufferLimitJS wraps the ArrayBuffer and typed array constructors, and
+// the ArrayBuffer transfer/resize and SharedArrayBuffer grow methods, so
+// that a single allocation over the limit throws a RangeError before any
+// memory is reserved. Buffer contents live outside the JS heap on V8, so a
+// large enough allocation would otherwise get past the heap limit.
+//
+// When churnLimit is set the wrapper also totals the bytes allocated by the
+// current request. Once that total passes churnLimit the request is flagged
+// through __allocationLimitExceeded and every further allocation throws, so
+// a worker cannot keep churning through buffers by discarding them.
+const arrayBufferLimitJS = `
+(function(limit, churnLimit) {
+	var OriginalArrayBuffer = ArrayBuffer;
+	var OriginalSharedArrayBuffer = typeof SharedArrayBuffer === 'function' ? SharedArrayBuffer : null;
+	var churnReqID, churned = 0, churnTripped = false;
+	// check refuses a buffer of size bytes, of which added are newly
+	// allocated and count towards the request's churn.
+	function check(bytes, added) {
+		if (limit > 0 && bytes > limit) {
+			throw new RangeError('Array buffer allocation of ' + bytes + ' bytes exceeds the limit of ' + limit + ' bytes');
+		}
+		if (churnLimit <= 0 || added <= 0) return;
+		var reqID = globalThis.__requestID;
+		if (reqID !== churnReqID) {
+			churnReqID = reqID;
+			churned = 0;
+			churnTripped = false;
+		}
+		churned += added;
+		if (churned > churnLimit) {
+			if (!churnTripped) {
+				churnTripped = true;
+				if (reqID !== undefined) __allocationLimitExceeded(String(reqID), churned);
+			}
+			throw new RangeError('Request exceeded its allocation limit of ' + churnLimit + ' bytes');
+		}
+	}
+	function guard(name, bytesFor) {
+		var original = globalThis[name];
+		if (typeof original !== 'function') return;
+		var guarded = new Proxy(original, {
+			construct: function(target, args, newTarget) {
+				var bytes = bytesFor(args, target);
+				check(bytes, bytes);
+				return Reflect.construct(target, args, newTarget);
+			}
+		});
+		// Keep x.constructor === Name true for buffers and views.
+		Object.defineProperty(original.prototype, 'constructor', { value: guarded, writable: true, configurable: true });
+		Object.defineProperty(globalThis, name, { value: guarded, writable: true, configurable: true });
+	}
+	function bufferBytes(args) {
+		var n = Number(args[0]) || 0;
+		var opts = args[1];
+		if (opts !== null && typeof opts === 'object' && opts.maxByteLength !== undefined) {
+			n = Math.max(n, Number(opts.maxByteLength) || 0);
+		}
+		return n;
+	}
+	function viewBytes(args, target) {
+		var src = args[0];
+		if (src === null || typeof src !== 'object') return (Number(src) || 0) * target.BYTES_PER_ELEMENT;
+		// A view over an existing buffer allocates nothing new.
+		if (src instanceof OriginalArrayBuffer) return 0;
+		if (OriginalSharedArrayBuffer && src instanceof OriginalSharedArrayBuffer) return 0;
+		return (Number(src.length) || 0) * target.BYTES_PER_ELEMENT;
+	}
+	// guardResize wraps a method that gives this buffer a new length, taken
+	// from its first argument or defaulting to the current length.
+	function guardResize(ctor, method) {
+		if (!ctor) return;
+		var original = ctor.prototype[method];
+		if (typeof original !== 'function') return;
+		Object.defineProperty(ctor.prototype, method, {
+			value: function(newLength) {
+				var bytes = newLength === undefined ? this.byteLength : Number(newLength) || 0;
+				check(bytes, bytes - this.byteLength);
+				return original.apply(this, arguments);
+			},
+			writable: true, configurable: true
+		});
+	}
+	guardResize(OriginalArrayBuffer, 'transfer');
+	guardResize(OriginalArrayBuffer, 'transferToFixedLength');
+	guardResize(OriginalArrayBuffer, 'resize');
+	guardResize(OriginalSharedArrayBuffer, 'grow');
+	guard('ArrayBuffer', bufferBytes);
+	guard('SharedArrayBuffer', bufferBytes);
+	['Int8Array', 'Uint8Array', 'Uint8ClampedArray', 'Int16Array', 'Uint16Array',
+		'Int32Array', 'Uint32Array', 'Float16Array', 'Float32Array', 'Float64Array',
+		'BigInt64Array', 'BigUint64Array'].forEach(function(name) { guard(name, viewBytes); });
+})(%d, %d);
+`
+
+// SetupArrayBufferLimit caps the size of a single ArrayBuffer or typed array
+// allocation at cfg.MaxArrayBufferBytes and the bytes a single request may
+// allocate in total at cfg.MaxAllocationBytes. Both are opt-in: with neither
+// set it does nothing, and buffers are bounded only by the runtime memory
+// limit, which QuickJS applies to buffer contents but V8 does not.
+func SetupArrayBufferLimit(rt core.JSRuntime, cfg core.EngineConfig, el *eventloop.EventLoop) error {
+	limit := cfg.MaxArrayBufferBytes
+	churnLimit := cfg.MaxAllocationBytes
+	if limit <= 0 && churnLimit <= 0 {
+		return nil
+	}
+	if churnLimit > 0 {
+		if err := rt.RegisterFunc("__allocationLimitExceeded", func(reqIDStr string, bytes int) {
+			if state := core.GetRequestState(core.ParseReqID(reqIDStr)); state != nil {
+				state.SetExt(allocationLimitKey, bytes)
+			}
+			// The worker could catch the RangeError and keep running, so
+			// the execution is stopped here rather than when it returns.
+			if el != nil {
+				el.Fail(fmt.Errorf("worker exceeded allocation limit: %d bytes allocated, limit %d", bytes, churnLimit))
+			}
+			if in, ok := rt.(core.Interrupter); ok {
+				in.Interrupt()
+			}
+		}); err != nil {
+			return fmt.Errorf("registering __allocationLimitExceeded: %w", err)
+		}
+	}
+	if err := rt.Eval(fmt.Sprintf(arrayBufferLimitJS, limit, churnLimit)); err != nil {
+		return fmt.Errorf("evaluating array buffer limit: %w", err)
+	}
+	return nil
+}
+
+// allocationLimitKey is the request state extension key set once a request
+// has allocated more than cfg.MaxAllocationBytes.
+const allocationLimitKey = "allocationLimitExceeded"
+
+// CheckAllocationLimit returns an error if the request allocated more array
+// buffer bytes than the configured per-request total. The JS side already
+// refuses further allocations; this makes the request fail even when the
+// worker catches those RangeErrors and carries on.
+func CheckAllocationLimit(state *core.RequestState, limit int) error {
+	if limit <= 0 || state == nil {
+		return nil
+	}
+	if bytes, ok := state.GetExt(allocationLimitKey).(int); ok {
+		return fmt.Errorf("worker exceeded allocation limit: %d bytes allocated, limit %d", bytes, limit)
+	}
+	return nil
+}
+
+// disableGlobalsJS removes each dotted path, e.g. "fetch" or
+// "crypto.subtle", so the API reads as undefined to the worker. A path
+// whose parent does not exist is ignored.
+const disableGlobalsJS = `
+(function(paths) {
+	for (var i = 0; i < paths.length; i++) {
+		var parts = paths[i].split('.');
+		var parent = globalThis;
+		for (var j = 0; j < parts.length - 1 && parent != null; j++) parent = parent[parts[j]];
+		if (parent === null || (typeof parent !== 'object' && typeof parent !== 'function')) continue;
+		if (!Reflect.deleteProperty(parent, parts[parts.length - 1])) {
+			throw new TypeError('cannot disable ' + paths[i] + ': property is not configurable');
+		}
+	}
+})(%s);
+`
+
+// capabilityBridges maps the globals a host can disable to the Go bridges
+// that implement them. The bridges are globals too, so removing only the
+// public name would leave a worker free to call __fetchStart directly.
+// registerBridge fills it in as the bridges are registered.
+var (
+	capabilityMu      sync.Mutex
+	capabilityBridges = map[string]map[string]bool{}
+)
+
+// registerBridge registers fn as the global Go bridge name and records it
+// under capability, the dotted global it implements, so that disabling the
+// global also withdraws the bridge.
+func registerBridge(rt core.JSRuntime, capability, name string, fn any) error {
+	capabilityMu.Lock()
+	if capabilityBridges[capability] == nil {
+		capabilityBridges[capability] = make(map[string]bool)
+	}
+	capabilityBridges[capability][name] = true
+	capabilityMu.Unlock()
+	return rt.RegisterFunc(name, fn)
+}
+
+// disabledBridges returns the Go bridges behind path and every global
+// beneath it, so disabling "crypto" also withdraws the crypto.subtle ones.
+func disabledBridges(path string) []string {
+	capabilityMu.Lock()
+	defer capabilityMu.Unlock()
+	var names []string
+	for p, bridges := range capabilityBridges {
+		if p == path || strings.HasPrefix(p, path+".") {
+			for name := range bridges {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetupDisabledGlobals removes the globals named in cfg.DisabledGlobals,
+// together with the Go bridges behind them, so that a host can withhold
+// capabilities such as fetch from a tenant. It must run after every other
+// setup function.
+func SetupDisabledGlobals(rt core.JSRuntime, cfg core.EngineConfig, _ *eventloop.EventLoop) error {
+	var paths []string
+	for _, p := range cfg.DisabledGlobals {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+			paths = append(paths, disabledBridges(p)...)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	pathsJSON, err := json.Marshal(paths)
+	if err != nil {
+		return fmt.Errorf("encoding disabled globals: %w", err)
+	}
+	if err := rt.Eval(fmt.Sprintf(disableGlobalsJS, pathsJSON)); err != nil {
+		return fmt.Errorf("disabling globals: %w", err)
+	}
+	return nil
+}
+
 // SetupGlobals registers structuredClone, performance.now(), navigator,
 // queueMicrotask, and the Event/EventTarget base classes.
 func SetupGlobals(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	// __sendBeacon: Go-backed fire-and-forget POST with SSRF protection.
-	if err := rt.RegisterFunc("__sendBeacon", func(targetURL, body, contentType string) (int, error) {
+	if err := registerBridge(rt, "navigator.sendBeacon", "__sendBeacon", func(targetURL, body, contentType string) (int, error) {
 		if IsPrivateHostname(targetURL) {
 			return 0, nil
 		}
@@ -197,7 +633,7 @@ func SetupGlobals(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// Evaluate pure-JS polyfills.
-	if err := rt.Eval(globalsJS); err != nil {
+	if err := rt.Eval(fmt.Sprintf(globalsJS, DefaultFetchUserAgent)); err != nil {
 		return fmt.Errorf("evaluating globals.js: %w", err)
 	}
 
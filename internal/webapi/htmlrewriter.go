@@ -60,7 +60,7 @@ class HTMLRewriter {
 		delete globalThis.__htmlrw_handlers;
 		delete globalThis.__htmlrw_doc_handlers;
 
-		return new Response(transformed, {
+		return new Response(__isNullBodyStatus(response.status) ? null : transformed, {
 			status: response.status,
 			statusText: response.statusText,
 			headers: new Headers(response.headers),
@@ -0,0 +1,113 @@
+package webapi
+
+import (
+	"fmt"
+
+	"github.com/cryguy/worker/v2/internal/core"
+	"github.com/cryguy/worker/v2/internal/eventloop"
+)
+
+// jwtJS defines the non-standard JWT global, a small verifier for HS256 and
+// RS256 tokens built on crypto.subtle so workers need not hand-roll one.
+// Signatures are checked with subtle.verify, which compares HMACs in
+// constant time.
+const jwtJS = `
+(function() {
+	const _algs = {
+		HS256: { name: 'HMAC', hash: 'SHA-256' },
+		RS256: { name: 'RSASSA-PKCS1-v1_5', hash: 'SHA-256' },
+	};
+	const _has = Object.prototype.hasOwnProperty;
+
+	function split(token) {
+		const parts = typeof token === 'string' ? token.split('.') : [];
+		if (parts.length !== 3) {
+			throw new TypeError('JWT: token must have three dot-separated segments');
+		}
+		return parts;
+	}
+
+	function decodeSegment(segment, what) {
+		try {
+			const text = new TextDecoder('utf-8', { fatal: true }).decode(base64urlDecode(segment));
+			const value = JSON.parse(text);
+			if (typeof value !== 'object' || value === null) throw new TypeError();
+			return value;
+		} catch (e) {
+			throw new TypeError('JWT: invalid ' + what);
+		}
+	}
+
+	function hashName(hash) {
+		return typeof hash === 'string' ? hash : (hash && hash.name) || '';
+	}
+
+	// decode returns the header and payload without checking the signature.
+	function decode(token) {
+		const parts = split(token);
+		return { header: decodeSegment(parts[0], 'header'), payload: decodeSegment(parts[1], 'payload') };
+	}
+
+	// verify checks the signature and the exp/nbf claims, resolving to
+	// { header, payload } or rejecting. key is a CryptoKey, or for HS256 the
+	// secret as a string or BufferSource. options.algorithms limits the
+	// accepted algs, options.clockTolerance allows clock skew in seconds and
+	// options.currentTime (seconds) overrides the clock.
+	async function verify(token, key, options) {
+		options = options || {};
+		const parts = split(token);
+		const header = decodeSegment(parts[0], 'header');
+		const payload = decodeSegment(parts[1], 'payload');
+
+		const allowed = options.algorithms || Object.keys(_algs);
+		if (!_has.call(_algs, header.alg) || allowed.indexOf(header.alg) === -1) {
+			throw new TypeError('JWT: unsupported algorithm ' + String(header.alg));
+		}
+		const algo = _algs[header.alg];
+
+		if (!(key instanceof CryptoKey)) {
+			if (algo.name !== 'HMAC') {
+				throw new TypeError('JWT: ' + header.alg + ' requires a CryptoKey');
+			}
+			const secret = typeof key === 'string' ? new TextEncoder().encode(key) : key;
+			key = await crypto.subtle.importKey('raw', secret, algo, false, ['verify']);
+		}
+		// The key decides the algorithm family, so a token cannot switch an
+		// RSA public key into use as an HMAC secret.
+		if (!key.algorithm || key.algorithm.name !== algo.name || hashName(key.algorithm.hash).toUpperCase() !== algo.hash) {
+			throw new TypeError('JWT: key does not match algorithm ' + header.alg);
+		}
+
+		let signature;
+		try {
+			signature = base64urlDecode(parts[2]);
+		} catch (e) {
+			throw new TypeError('JWT: invalid signature encoding');
+		}
+		const data = new TextEncoder().encode(parts[0] + '.' + parts[1]);
+		if (!(await crypto.subtle.verify(algo, key, signature, data))) {
+			throw new Error('JWT: signature verification failed');
+		}
+
+		const now = options.currentTime !== undefined ? options.currentTime : Math.floor(Date.now() / 1000);
+		const tolerance = options.clockTolerance || 0;
+		if (typeof payload.exp === 'number' && now >= payload.exp + tolerance) {
+			throw new Error('JWT: token has expired');
+		}
+		if (typeof payload.nbf === 'number' && now < payload.nbf - tolerance) {
+			throw new Error('JWT: token is not yet valid');
+		}
+		return { header, payload };
+	}
+
+	globalThis.JWT = { decode, verify };
+})();
+`
+
+// SetupJWT registers the JWT global. It must run after the crypto setups.
+func SetupJWT(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+	if err := rt.Eval(jwtJS); err != nil {
+		return fmt.Errorf("evaluating jwt.js: %w", err)
+	}
+	return nil
+}
@@ -8,6 +8,41 @@ import (
 	"github.com/cryguy/worker/v2/internal/eventloop"
 )
 
+// kvStoreFor returns store, or when it implements core.ContextKVStore an
+// adapter that passes the request's context to every call.
+func kvStoreFor(state *core.RequestState, store core.KVStore) core.KVStore {
+	if cs, ok := store.(core.ContextKVStore); ok {
+		return contextKVStore{cs: cs, rc: state.RequestContext()}
+	}
+	return store
+}
+
+// contextKVStore adapts a ContextKVStore to KVStore for a single request.
+type contextKVStore struct {
+	cs core.ContextKVStore
+	rc core.RequestContext
+}
+
+func (s contextKVStore) Get(key string) (*string, error) {
+	return s.cs.GetContext(s.rc, key)
+}
+
+func (s contextKVStore) GetWithMetadata(key string) (*core.KVValueWithMetadata, error) {
+	return s.cs.GetWithMetadataContext(s.rc, key)
+}
+
+func (s contextKVStore) Put(key, value string, metadata *string, ttl *int) error {
+	return s.cs.PutContext(s.rc, key, value, metadata, ttl)
+}
+
+func (s contextKVStore) Delete(key string) error {
+	return s.cs.DeleteContext(s.rc, key)
+}
+
+func (s contextKVStore) List(prefix string, limit int, cursor string) (*core.KVListResult, error) {
+	return s.cs.ListContext(s.rc, prefix, limit, cursor)
+}
+
 // SetupKV registers global Go functions for KV namespace operations.
 // The actual KV binding objects are built in JS via buildEnvObject.
 func SetupKV(rt core.JSRuntime, _ *eventloop.EventLoop) error {
@@ -22,6 +57,7 @@ func SetupKV(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		if !ok {
 			return "null", nil
 		}
+		store = kvStoreFor(state, store)
 
 		val, err := store.Get(key)
 		if err != nil {
@@ -49,6 +85,7 @@ func SetupKV(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		if !ok {
 			return `{"value":null,"metadata":null}`, nil
 		}
+		store = kvStoreFor(state, store)
 
 		result, err := store.GetWithMetadata(key)
 		if err != nil {
@@ -79,6 +116,7 @@ func SetupKV(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		if !ok {
 			return "", fmt.Errorf("KV binding %q not found", bindingName)
 		}
+		store = kvStoreFor(state, store)
 
 		var metadata *string
 		var ttl *int
@@ -112,6 +150,7 @@ func SetupKV(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		if !ok {
 			return "", fmt.Errorf("KV binding %q not found", bindingName)
 		}
+		store = kvStoreFor(state, store)
 
 		if err := store.Delete(key); err != nil {
 			return "", err
@@ -132,6 +171,7 @@ func SetupKV(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		if !ok {
 			return "", fmt.Errorf("KV binding %q not found", bindingName)
 		}
+		store = kvStoreFor(state, store)
 
 		var prefix string
 		var cursor string
@@ -55,7 +55,9 @@ var PolyfillHashes = map[string]string{
 // globalThis.__worker_module__.
 //
 // If the source has no exports (already a plain script), the IIFE wrapping
-// is harmless -- the global name is set to the IIFE's return value.
+// is harmless -- the global name is set to the IIFE's return value. A
+// service-worker-style script that registers addEventListener("fetch")
+// instead is given a module whose fetch handler dispatches a FetchEvent.
 // If esbuild reports errors, the source is returned unchanged so that
 // callers handle compile errors downstream.
 func WrapESModule(source string) string {
@@ -72,6 +74,7 @@ func WrapESModule(source string) string {
 	// converting ESM to IIFE. Unwrap it so callers can access handlers
 	// (fetch, scheduled, etc.) directly on globalThis.__worker_module__.
 	code += "if(globalThis.__worker_module__&&globalThis.__worker_module__.default)globalThis.__worker_module__=globalThis.__worker_module__.default;\n"
+	code += "if(globalThis.__worker_module__===undefined&&typeof globalThis.__serviceWorkerModule==='function')globalThis.__worker_module__=globalThis.__serviceWorkerModule();\n"
 	return code
 }
 
@@ -7,7 +7,10 @@ import (
 	"github.com/cryguy/worker/v2/internal/eventloop"
 )
 
-// reportErrorJS defines ErrorEvent and reportError.
+// reportErrorJS defines ErrorEvent and reportError, and __callHandler, which
+// the engines invoke worker handlers through so that an exception a handler
+// throws, or a rejection of the promise it returns, is dispatched as an
+// "error" event before it is returned to the host.
 const reportErrorJS = `
 class ErrorEvent extends Event {
 	constructor(type, init) {
@@ -28,6 +31,23 @@ globalThis.reportError = function(error) {
 	var ev = new ErrorEvent('error', { error: error, message: msg });
 	globalThis.dispatchEvent(ev);
 };
+(function() {
+	var report = globalThis.reportError;
+	function reportQuietly(e) {
+		try { report(e); } catch (_) {}
+	}
+	globalThis.__callHandler = function(call) {
+		var result;
+		try {
+			result = call();
+		} catch (e) {
+			reportQuietly(e);
+			throw e;
+		}
+		if (result instanceof Promise) result.then(undefined, reportQuietly);
+		return result;
+	};
+})();
 `
 
 // SetupReportError evaluates the reportError/ErrorEvent polyfill.
@@ -7,12 +7,34 @@ import (
 	"github.com/cryguy/worker/v2/internal/eventloop"
 )
 
-// schedulerJS defines globalThis.scheduler with a wait() method.
+// schedulerJS defines globalThis.scheduler with wait(), yield(), and
+// postTask(). yield() resolves on the next event loop task, so pending
+// microtasks and already-due timers run first.
 const schedulerJS = `
 globalThis.scheduler = {
-	wait: function(ms) {
+	wait: function(ms, options) {
+		var signal = options && options.signal;
+		return new Promise(function(resolve, reject) {
+			if (signal && signal.aborted) {
+				reject(signal.reason !== undefined ? signal.reason : new DOMException('The operation was aborted', 'AbortError'));
+				return;
+			}
+			// The listener is removed once the timer fires, so a signal
+			// reused across many waits does not pile up settled ones.
+			var onAbort = function() {
+				clearTimeout(id);
+				reject(signal.reason !== undefined ? signal.reason : new DOMException('The operation was aborted', 'AbortError'));
+			};
+			var id = __internalSetTimeout(function() {
+				if (signal) signal.removeEventListener('abort', onAbort);
+				resolve();
+			}, ms || 0);
+			if (signal) signal.addEventListener('abort', onAbort, { once: true });
+		});
+	},
+	yield: function() {
 		return new Promise(function(resolve) {
-			setTimeout(resolve, ms || 0);
+			__internalSetTimeout(resolve, 0);
 		});
 	},
 	postTask: function(callback, options) {
@@ -20,25 +42,25 @@ globalThis.scheduler = {
 		var signal = options && options.signal;
 		return new Promise(function(resolve, reject) {
 			if (signal && signal.aborted) {
-				reject(signal.reason || new DOMException('The operation was aborted', 'AbortError'));
+				reject(signal.reason !== undefined ? signal.reason : new DOMException('The operation was aborted', 'AbortError'));
 				return;
 			}
-			var id = setTimeout(function() {
+			var onAbort = function() {
+				clearTimeout(id);
+				reject(signal.reason !== undefined ? signal.reason : new DOMException('The operation was aborted', 'AbortError'));
+			};
+			var id = __internalSetTimeout(function() {
+				if (signal) signal.removeEventListener('abort', onAbort);
 				try { resolve(callback()); }
 				catch(e) { reject(e); }
 			}, delay);
-			if (signal) {
-				signal.addEventListener('abort', function() {
-					clearTimeout(id);
-					reject(signal.reason || new DOMException('The operation was aborted', 'AbortError'));
-				});
-			}
+			if (signal) signal.addEventListener('abort', onAbort, { once: true });
 		});
 	},
 };
 `
 
-// SetupScheduler registers the scheduler global with wait().
+// SetupScheduler registers the scheduler global.
 func SetupScheduler(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	if err := rt.Eval(schedulerJS); err != nil {
 		return fmt.Errorf("evaluating scheduler.js: %w", err)
@@ -8,8 +8,17 @@ import (
 	"github.com/cryguy/worker/v2/internal/eventloop"
 )
 
+// DefaultMaxServiceBindingDepth is the number of nested service binding calls
+// allowed when EngineConfig.MaxServiceBindingDepth is unset.
+const DefaultMaxServiceBindingDepth = 16
+
 // SetupServiceBindings registers global Go functions for service binding operations.
-func SetupServiceBindings(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+func SetupServiceBindings(rt core.JSRuntime, cfg core.EngineConfig, _ *eventloop.EventLoop) error {
+	maxDepth := cfg.MaxServiceBindingDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxServiceBindingDepth
+	}
+
 	// __sb_fetch(reqIDStr, bindingName, reqJSON) -> JSON response or error
 	if err := rt.RegisterFunc("__sb_fetch", func(reqIDStr, bindingName, reqJSON string) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
@@ -21,6 +30,12 @@ func SetupServiceBindings(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		if !ok {
 			return "", fmt.Errorf("ServiceBinding %q not found", bindingName)
 		}
+		// Workers that call each other through bindings would otherwise
+		// recurse until the pools are exhausted.
+		depth := state.Env.ServiceBindingDepth + 1
+		if depth > maxDepth {
+			return "", fmt.Errorf("ServiceBinding %q: exceeded maximum subrequest depth (%d)", bindingName, maxDepth)
+		}
 
 		var reqData struct {
 			URL     string            `json:"url"`
@@ -32,10 +47,15 @@ func SetupServiceBindings(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			return "", fmt.Errorf("invalid request JSON: %w", err)
 		}
 
+		// The target runs on behalf of the same incoming request, so its
+		// bindings see the caller's context and metadata.
+		rc := state.RequestContext()
 		workerReq := &core.WorkerRequest{
-			Method:  reqData.Method,
-			URL:     reqData.URL,
-			Headers: reqData.Headers,
+			Method:   reqData.Method,
+			URL:      reqData.URL,
+			Headers:  reqData.Headers,
+			Context:  rc.Ctx,
+			Metadata: rc.Metadata,
 		}
 		if reqData.Body != nil {
 			workerReq.Body = []byte(*reqData.Body)
@@ -45,8 +65,9 @@ func SetupServiceBindings(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 		// receive the caller's env (secret isolation), but Execute requires
 		// a non-nil Env.
 		targetEnv := &core.Env{
-			Vars:    make(map[string]string),
-			Secrets: make(map[string]string),
+			Vars:                make(map[string]string),
+			Secrets:             make(map[string]string),
+			ServiceBindingDepth: depth,
 		}
 
 		result := state.Env.Dispatcher.Execute(config.TargetSiteID, config.TargetDeployKey, targetEnv, workerReq)
@@ -57,11 +78,13 @@ func SetupServiceBindings(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 			return "", fmt.Errorf("target worker returned no response")
 		}
 
-		// Build response JSON.
+		// Build response JSON. headerList keeps repeated headers such as
+		// Set-Cookie as separate values.
 		respJSON := map[string]interface{}{
-			"status":  result.Response.StatusCode,
-			"headers": result.Response.Headers,
-			"body":    string(result.Response.Body),
+			"status":     result.Response.StatusCode,
+			"headers":    result.Response.Headers,
+			"headerList": result.Response.HeaderList,
+			"body":       string(result.Response.Body),
 		}
 		data, _ := json.Marshal(respJSON)
 		return string(data), nil
@@ -111,10 +134,12 @@ globalThis.__makeSB = function(bindingName) {
 					var respStr = __sb_fetch(reqID, bindingName, reqJSON);
 					var respData = JSON.parse(respStr);
 					var h = new Headers();
-					if (respData.headers) {
+					if (respData.headerList && respData.headerList.length) {
+						for (var i = 0; i < respData.headerList.length; i++) h.append(respData.headerList[i][0], respData.headerList[i][1]);
+					} else if (respData.headers) {
 						for (var k in respData.headers) h.set(k, respData.headers[k]);
 					}
-					resolve(new Response(respData.body, { status: respData.status, headers: h }));
+					resolve(new Response(__isNullBodyStatus(respData.status) ? null : respData.body, { status: respData.status, headers: h }));
 				} catch(e) {
 					reject(e);
 				}
@@ -21,8 +21,25 @@ class ReadableStreamDefaultController {
 	}
 	enqueue(chunk) {
 		if (this._closeRequested) throw new TypeError('Cannot enqueue after close');
-		this._stream._queue.push(chunk);
-		this._stream._pull();
+		const stream = this._stream;
+		if (stream._closed) throw new TypeError('Cannot enqueue to a closed or canceled stream');
+		if (stream._sizeFn) {
+			let size;
+			try {
+				size = stream._sizeFn(chunk);
+			} catch (e) {
+				stream._errorInternal(e);
+				throw e;
+			}
+			if (typeof size !== 'number' || !isFinite(size) || size < 0) {
+				const err = new RangeError('Chunk size must be a finite, non-negative number');
+				stream._errorInternal(err);
+				throw err;
+			}
+		}
+		stream._queue.push(chunk);
+		stream._pull();
+		stream._callPullIfNeeded();
 	}
 	close() {
 		this._closeRequested = true;
@@ -32,7 +49,7 @@ class ReadableStreamDefaultController {
 		this._stream._errorInternal(e);
 	}
 	get desiredSize() {
-		return this._stream._highWaterMark - this._stream._queue.length;
+		return this._stream._desiredSize();
 	}
 }
 
@@ -54,8 +71,11 @@ class ReadableStreamDefaultReader {
 	}
 	async read() {
 		const stream = this._stream;
+		stream._disturbed = true;
 		if (stream._queue.length > 0) {
-			return { value: stream._queue.shift(), done: false };
+			const chunk = stream._queue.shift();
+			stream._callPullIfNeeded();
+			return { value: chunk, done: false };
 		}
 		if (stream._closed) {
 			return { value: undefined, done: true };
@@ -65,24 +85,7 @@ class ReadableStreamDefaultReader {
 		}
 		return new Promise((resolve, reject) => {
 			stream._pendingReads.push({ resolve, reject });
-			if (stream._pullFn && !stream._pulling) {
-				stream._pulling = true;
-				Promise.resolve().then(function pullLoop() {
-					stream._pulling = false;
-					if (stream._closed || stream._errored) return;
-					try {
-						var r = stream._pullFn(stream._controller);
-						function afterPull() {
-							if (stream._pendingReads.length > 0 && stream._queue.length === 0 && !stream._closed && !stream._errored && stream._pullFn) {
-								stream._pulling = true;
-								Promise.resolve().then(pullLoop);
-							}
-						}
-						if (r && typeof r.then === "function") r.then(afterPull, function(e) { stream._errorInternal(e); });
-						else afterPull();
-					} catch(e) { stream._errorInternal(e); }
-				});
-			}
+			stream._callPullIfNeeded();
 		});
 	}
 	releaseLock() {
@@ -95,7 +98,10 @@ class ReadableStreamDefaultReader {
 		return this._closedPromise;
 	}
 	cancel(reason) {
-		return this._stream.cancel(reason);
+		if (!this._stream || this._stream._reader !== this) {
+			return Promise.reject(new TypeError('Cannot cancel a stream using a released reader'));
+		}
+		return this._stream._cancelInternal(reason);
 	}
 }
 
@@ -104,12 +110,25 @@ class ReadableStream {
 		this._queue = [];
 		this._locked = false;
 		this._reader = null;
+		this._disturbed = false;
 		this._closed = false;
 		this._errored = false;
 		this._error = null;
 		this._pendingReads = [];
 		this._pulling = false;
-		this._highWaterMark = (strategy && strategy.highWaterMark) || 1;
+		this._pullAgain = false;
+		this._started = false;
+		this._highWaterMark = 1;
+		this._sizeFn = null;
+		if (strategy && strategy.highWaterMark !== undefined) {
+			const hwm = Number(strategy.highWaterMark);
+			if (isNaN(hwm) || hwm < 0) throw new RangeError('highWaterMark must be a non-negative number');
+			this._highWaterMark = hwm;
+		}
+		if (strategy && strategy.size !== undefined) {
+			if (typeof strategy.size !== 'function') throw new TypeError('strategy.size must be a function');
+			this._sizeFn = strategy.size;
+		}
 
 		this._controller = new ReadableStreamDefaultController(this);
 		this._pullFn = null;
@@ -122,10 +141,20 @@ class ReadableStream {
 			if (typeof underlyingSource.cancel === 'function') {
 				this._cancelFn = underlyingSource.cancel.bind(underlyingSource);
 			}
-			if (typeof underlyingSource.start === 'function') {
-				underlyingSource.start(this._controller);
-			}
 		}
+		let startResult;
+		if (underlyingSource && typeof underlyingSource.start === 'function') {
+			startResult = underlyingSource.start(this._controller);
+		}
+		// pull is not called until start has finished; after that it runs
+		// whenever the queue is below the high-water mark or a read is waiting.
+		const self = this;
+		Promise.resolve(startResult).then(function() {
+			self._started = true;
+			self._callPullIfNeeded();
+		}, function(e) {
+			self._errorInternal(e);
+		});
 	}
 
 	getReader() {
@@ -133,10 +162,25 @@ class ReadableStream {
 	}
 
 	cancel(reason) {
-		this._closed = true;
-		if (this._cancelFn) this._cancelFn(reason);
-		this._drainPending();
-		return Promise.resolve();
+		if (this._locked) return Promise.reject(new TypeError('Cannot cancel a locked ReadableStream'));
+		return this._cancelInternal(reason);
+	}
+
+	// _cancelInternal discards queued chunks, resolves waiting reads as done,
+	// and hands reason to the source's cancel(), settling once it has.
+	_cancelInternal(reason) {
+		this._disturbed = true;
+		if (this._errored) return Promise.reject(this._error);
+		if (this._closed) return Promise.resolve();
+		this._queue = [];
+		this._closeInternal();
+		let r;
+		try {
+			r = this._cancelFn ? this._cancelFn(reason) : undefined;
+		} catch (e) {
+			return Promise.reject(e);
+		}
+		return Promise.resolve(r).then(function() {});
 	}
 
 	get locked() { return this._locked; }
@@ -190,11 +234,27 @@ class ReadableStream {
 		let closed = false;
 		let branch1Controller;
 		let branch2Controller;
+		let canceled1 = false;
+		let canceled2 = false;
+		let reason1;
+		let reason2;
+		// The source is only canceled once both branches have been, with
+		// both reasons.
 		const branch1 = new ReadableStream({
 			start(controller) { branch1Controller = controller; },
+			cancel(reason) {
+				canceled1 = true;
+				reason1 = reason;
+				if (canceled2) return reader.cancel([reason1, reason2]);
+			},
 		});
 		const branch2 = new ReadableStream({
 			start(controller) { branch2Controller = controller; },
+			cancel(reason) {
+				canceled2 = true;
+				reason2 = reason;
+				if (canceled1) return reader.cancel([reason1, reason2]);
+			},
 		});
 		async function pump() {
 			try {
@@ -203,13 +263,13 @@ class ReadableStream {
 					if (done) {
 						if (!closed) {
 							closed = true;
-							branch1Controller.close();
-							branch2Controller.close();
+							if (!canceled1) branch1Controller.close();
+							if (!canceled2) branch2Controller.close();
 						}
 						return;
 					}
-					branch1Controller.enqueue(value);
-					branch2Controller.enqueue(value);
+					if (!canceled1) branch1Controller.enqueue(value);
+					if (!canceled2) branch2Controller.enqueue(value);
 				}
 			} catch(e) {
 				branch1Controller.error(e);
@@ -228,6 +288,49 @@ class ReadableStream {
 		}
 	}
 
+	_desiredSize() {
+		if (this._errored) return null;
+		if (this._closed) return 0;
+		let queued = this._queue.length;
+		if (this._sizeFn) {
+			queued = 0;
+			for (const chunk of this._queue) queued += this._sizeFn(chunk);
+		}
+		return this._highWaterMark - queued;
+	}
+
+	// _callPullIfNeeded invokes the source's pull() when a read is waiting or
+	// the queue is below the high-water mark, never running two pulls at
+	// once. A pull that settles without satisfying a waiting read is retried.
+	_callPullIfNeeded() {
+		if (!this._pullFn || !this._started || this._closed || this._errored) return;
+		if (this._pendingReads.length === 0 && !(this._desiredSize() > 0)) return;
+		if (this._pulling) {
+			this._pullAgain = true;
+			return;
+		}
+		this._pulling = true;
+		const self = this;
+		let r;
+		try {
+			r = this._pullFn(this._controller);
+		} catch (e) {
+			this._pulling = false;
+			this._errorInternal(e);
+			return;
+		}
+		Promise.resolve(r).then(function() {
+			self._pulling = false;
+			if (self._pullAgain || (self._pendingReads.length > 0 && self._queue.length === 0)) {
+				self._pullAgain = false;
+				Promise.resolve().then(function() { self._callPullIfNeeded(); });
+			}
+		}, function(e) {
+			self._pulling = false;
+			self._errorInternal(e);
+		});
+	}
+
 	_closeInternal() {
 		this._closed = true;
 		this._drainPending();
@@ -237,6 +340,7 @@ class ReadableStream {
 	}
 
 	_errorInternal(e) {
+		if (this._closed) return;
 		this._errored = true;
 		this._error = e;
 		for (const { reject } of this._pendingReads) {
@@ -485,6 +589,28 @@ ReadableStream.from = function(asyncIterable) {
 	});
 };
 
+// --- Response.ndjson() ---
+
+// Response.ndjson streams each value of an iterable, async iterable or
+// ReadableStream as one line of newline-delimited JSON.
+Response.ndjson = function(source, init) {
+	init = init || {};
+	const values = source instanceof ReadableStream ? source : ReadableStream.from(source);
+	const encoder = new TextEncoder();
+	const body = values.pipeThrough(new TransformStream({
+		transform(value, controller) {
+			const line = JSON.stringify(value);
+			if (line === undefined) {
+				throw new TypeError('Response.ndjson: value is not JSON-serializable');
+			}
+			controller.enqueue(encoder.encode(line + '\n'));
+		}
+	}));
+	const headers = new Headers(init.headers);
+	if (!headers.has('content-type')) headers.set('content-type', 'application/x-ndjson');
+	return new Response(body, Object.assign({}, init, { headers }));
+};
+
 // --- FixedLengthStream ---
 
 class FixedLengthStream {
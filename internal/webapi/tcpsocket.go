@@ -295,7 +295,7 @@ func getTCPSocketMap(state *core.RequestState) *tcpSocketMap {
 // SetupTCPSocket registers Go-backed TCP helpers and evaluates the JS wrapper.
 func SetupTCPSocket(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	// __tcpConnect(reqIDStr, hostname, port, secure) -> socketID
-	if err := rt.RegisterFunc("__tcpConnect", func(reqIDStr, hostname, port, secure string) (string, error) {
+	if err := registerBridge(rt, "connect", "__tcpConnect", func(reqIDStr, hostname, port, secure string) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil {
@@ -350,7 +350,7 @@ func SetupTCPSocket(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __tcpRead(reqIDStr, socketID, maxBytes) -> base64 data, "" for no data, "EOF" for closed
-	if err := rt.RegisterFunc("__tcpRead", func(reqIDStr, socketID string, maxBytes int) (string, error) {
+	if err := registerBridge(rt, "connect", "__tcpRead", func(reqIDStr, socketID string, maxBytes int) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil {
@@ -378,7 +378,7 @@ func SetupTCPSocket(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __tcpWrite(reqIDStr, socketID, b64data)
-	if err := rt.RegisterFunc("__tcpWrite", func(reqIDStr, socketID, b64data string) (int, error) {
+	if err := registerBridge(rt, "connect", "__tcpWrite", func(reqIDStr, socketID, b64data string) (int, error) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil {
@@ -402,7 +402,7 @@ func SetupTCPSocket(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __tcpClose(reqIDStr, socketID)
-	if err := rt.RegisterFunc("__tcpClose", func(reqIDStr, socketID string) {
+	if err := registerBridge(rt, "connect", "__tcpClose", func(reqIDStr, socketID string) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil {
@@ -421,7 +421,7 @@ func SetupTCPSocket(rt core.JSRuntime, _ *eventloop.EventLoop) error {
 	}
 
 	// __tcpStartTls(reqIDStr, socketID, hostname) -> new socketID
-	if err := rt.RegisterFunc("__tcpStartTls", func(reqIDStr, socketID, hostname string) (string, error) {
+	if err := registerBridge(rt, "connect", "__tcpStartTls", func(reqIDStr, socketID, hostname string) (string, error) {
 		reqID := core.ParseReqID(reqIDStr)
 		state := core.GetRequestState(reqID)
 		if state == nil {
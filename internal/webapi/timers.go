@@ -17,7 +17,7 @@ const timersJS = `
 		}
 		var args = [];
 		for (var i = 2; i < arguments.length; i++) args.push(arguments[i]);
-		var id = __timerRegister(delay || 0, false);
+		var id = __timerRegister(delay || 0, false, false);
 		globalThis.__timerCallbacks[id] = { fn: fn, args: args };
 		return id;
 	};
@@ -27,10 +27,17 @@ const timersJS = `
 		}
 		var args = [];
 		for (var i = 2; i < arguments.length; i++) args.push(arguments[i]);
-		var id = __timerRegister(interval || 0, true);
+		var id = __timerRegister(interval || 0, true, false);
 		globalThis.__timerCallbacks[id] = { fn: fn, args: args, interval: true };
 		return id;
 	};
+	// __internalSetTimeout schedules a callback for a runtime API. It shares
+	// clearTimeout with user timers but not their pending-timer cap.
+	globalThis.__internalSetTimeout = function(fn, delay) {
+		var id = __timerRegister(delay || 0, false, true);
+		globalThis.__timerCallbacks[id] = { fn: fn, args: [] };
+		return id;
+	};
 	globalThis.clearTimeout = globalThis.clearInterval = function(id) {
 		if (arguments.length === 0 || typeof id !== 'number') {
 			return;
@@ -43,8 +50,11 @@ const timersJS = `
 
 // SetupTimers registers Go-backed setTimeout/setInterval/clearTimeout/clearInterval.
 func SetupTimers(rt core.JSRuntime, el *eventloop.EventLoop) error {
-	if err := rt.RegisterFunc("__timerRegister", func(delayMs int, isInterval bool) int {
+	if err := rt.RegisterFunc("__timerRegister", func(delayMs int, isInterval, internal bool) (int, error) {
 		delay := time.Duration(delayMs) * time.Millisecond
+		if internal {
+			return el.RegisterInternalTimer(delay)
+		}
 		return el.RegisterTimer(delay, isInterval)
 	}); err != nil {
 		return err
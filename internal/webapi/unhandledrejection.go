@@ -1,16 +1,21 @@
 package webapi
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/cryguy/worker/v2/internal/core"
 	"github.com/cryguy/worker/v2/internal/eventloop"
 )
 
-// unhandledRejectionJS provides a best-effort polyfill for unhandled promise
-// rejection tracking.
+// unhandledRejectionJS provides unhandled promise rejection tracking: the
+// engine reports rejections through __hostPromiseRejection, and those still
+// unhandled at the next microtask checkpoint are dispatched as
+// "unhandledrejection" events on globalThis.
 const unhandledRejectionJS = `
 (function() {
 
@@ -22,49 +27,45 @@ class PromiseRejectionEvent extends Event {
 	}
 }
 
+// Promises that rejected without a handler since the last checkpoint. One
+// that gets a handler before the checkpoint is dropped again.
 const _pendingRejections = new Map();
-let _rejectionId = 0;
 
-const _origPromise = globalThis.Promise;
-
-const _origThen = _origPromise.prototype.then;
-
-_origPromise.prototype.then = function(onFulfilled, onRejected) {
-	const result = _origThen.call(this, onFulfilled, onRejected);
-	if (typeof onRejected === 'function' && this.__rejectionId !== undefined) {
-		_pendingRejections.delete(this.__rejectionId);
+function track(promise, reason, handled) {
+	if (handled) {
+		_pendingRejections.delete(promise);
+		return;
 	}
-	return result;
-};
+	if (_pendingRejections.has(promise)) return;
+	_pendingRejections.set(promise, reason);
+	// The event loop reports it at the next microtask checkpoint, like the
+	// HTML spec, so handlers attached later in the same task still count.
+	__notePendingRejection();
+}
 
-const _origCatch = _origPromise.prototype.catch;
-_origPromise.prototype.catch = function(onRejected) {
-	const result = _origCatch.call(this, onRejected);
-	if (typeof onRejected === 'function' && this.__rejectionId !== undefined) {
-		_pendingRejections.delete(this.__rejectionId);
-	}
-	return result;
-};
+// __hostPromiseRejection is called by the engine when a promise rejects
+// with no handler and when such a promise gets its first handler.
+Object.defineProperty(globalThis, '__hostPromiseRejection', { value: track });
 
+// __trackRejection reports a rejection by hand, for runtimes whose engine
+// does not report them.
 globalThis.__trackRejection = function(promise, reason) {
-	const id = ++_rejectionId;
-	try {
-		Object.defineProperty(promise, '__rejectionId', { value: id, writable: true, configurable: true });
-	} catch(e) {
-		return;
+	track(promise, reason, false);
+};
+
+// __dispatchRejections is called by the event loop at a microtask
+// checkpoint and reports every rejection that is still unhandled.
+globalThis.__dispatchRejections = function() {
+	const pending = Array.from(_pendingRejections);
+	_pendingRejections.clear();
+	for (const [promise, reason] of pending) {
+		const event = new PromiseRejectionEvent('unhandledrejection', {
+			promise: promise,
+			reason: reason,
+			cancelable: true,
+		});
+		globalThis.dispatchEvent(event);
 	}
-	_pendingRejections.set(id, { promise, reason });
-	queueMicrotask(function() {
-		if (_pendingRejections.has(id)) {
-			_pendingRejections.delete(id);
-			const event = new PromiseRejectionEvent('unhandledrejection', {
-				promise: promise,
-				reason: reason,
-				cancelable: true,
-			});
-			globalThis.dispatchEvent(event);
-		}
-	});
 };
 
 if (typeof globalThis.addEventListener !== 'function') {
@@ -79,15 +80,40 @@ globalThis.PromiseRejectionEvent = PromiseRejectionEvent;
 })();
 `
 
-// SetupUnhandledRejection registers PromiseRejectionEvent and best-effort
-// unhandled rejection tracking on globalThis.
-func SetupUnhandledRejection(rt core.JSRuntime, _ *eventloop.EventLoop) error {
+// SetupUnhandledRejection registers PromiseRejectionEvent and unhandled
+// rejection tracking on globalThis. Runtimes implementing
+// core.PromiseRejectionTracker report rejections from the engine; on others
+// only those passed to __trackRejection are seen. Pending rejections are
+// reported by el at its next microtask checkpoint.
+func SetupUnhandledRejection(rt core.JSRuntime, el *eventloop.EventLoop) error {
+	if err := rt.RegisterFunc("__notePendingRejection", func() {
+		if el != nil {
+			el.NotePendingRejection()
+		}
+	}); err != nil {
+		return fmt.Errorf("registering __notePendingRejection: %w", err)
+	}
 	if err := rt.Eval(unhandledRejectionJS); err != nil {
 		return fmt.Errorf("evaluating unhandledrejection.js: %w", err)
 	}
+	if tracker, ok := rt.(core.PromiseRejectionTracker); ok {
+		if err := tracker.TrackPromiseRejections(); err != nil {
+			return fmt.Errorf("tracking promise rejections: %w", err)
+		}
+	}
 	return nil
 }
 
+// checkpoint drains the microtask queue, reporting unhandled rejections
+// through el when there is one.
+func checkpoint(rt core.JSRuntime, el *eventloop.EventLoop) {
+	if el == nil {
+		rt.RunMicrotasks()
+		return
+	}
+	el.Checkpoint(rt)
+}
+
 // DrainWaitUntil drains any promises registered via ctx.waitUntil().
 func DrainWaitUntil(rt core.JSRuntime, deadline time.Time) {
 	_ = rt.Eval(`
@@ -117,10 +143,112 @@ func DrainWaitUntil(rt core.JSRuntime, deadline time.Time) {
 	_ = rt.Eval("delete globalThis.__waitUntilSettled;")
 }
 
+// HasWaitUntil reports whether the handler registered any promises via
+// ctx.waitUntil() that have not been drained yet.
+func HasWaitUntil(rt core.JSRuntime) bool {
+	pending, _ := rt.EvalBool("!!(globalThis.__waitUntilPromises && globalThis.__waitUntilPromises.length > 0)")
+	return pending
+}
+
+// ErrWaitUntilTimeout is returned by AwaitWaitUntil when the deadline passes
+// before every waitUntil promise settles.
+var ErrWaitUntilTimeout = errors.New("waitUntil promises did not settle before the deadline")
+
+// awaitWaitUntilJS settles the registered waitUntil promises, including any
+// registered while the first batch runs, and records each rejection.
+const awaitWaitUntilJS = `
+(function() {
+	globalThis.__waitUntilSettled = false;
+	globalThis.__waitUntilRejections = [];
+	function next() {
+		var batch = globalThis.__waitUntilPromises || [];
+		globalThis.__waitUntilPromises = [];
+		if (batch.length === 0) {
+			globalThis.__waitUntilSettled = true;
+			return;
+		}
+		Promise.allSettled(batch).then(function(results) {
+			for (var i = 0; i < results.length; i++) {
+				if (results[i].status !== 'rejected') continue;
+				var reason = results[i].reason;
+				globalThis.__waitUntilRejections.push(reason instanceof Error
+					? reason.name + ': ' + reason.message
+					: String(reason));
+			}
+			next();
+		});
+	}
+	next();
+})();
+`
+
+// AwaitWaitUntil settles the promises registered via ctx.waitUntil(),
+// running timers and pending fetches on el, until they all settle or the
+// deadline passes. Unlike DrainWaitUntil it reports the outcome: the error
+// lists every rejected promise, or is ErrWaitUntilTimeout.
+func AwaitWaitUntil(rt core.JSRuntime, deadline time.Time, el *eventloop.EventLoop) error {
+	if err := rt.Eval(awaitWaitUntilJS); err != nil {
+		return fmt.Errorf("draining waitUntil: %w", err)
+	}
+	defer func() {
+		_ = rt.Eval("delete globalThis.__waitUntilSettled; delete globalThis.__waitUntilRejections;")
+	}()
+
+	for {
+		checkpoint(rt, el)
+
+		if el != nil && el.HasPending() {
+			shortDeadline := time.Now().Add(10 * time.Millisecond)
+			if shortDeadline.After(deadline) {
+				shortDeadline = deadline
+			}
+			el.Drain(rt, shortDeadline)
+			if err := el.Err(); err != nil {
+				return err
+			}
+			el.Checkpoint(rt)
+		}
+
+		settled, _ := rt.EvalBool("!!globalThis.__waitUntilSettled")
+		if settled {
+			break
+		}
+		if time.Now().After(deadline) {
+			return ErrWaitUntilTimeout
+		}
+		runtime.Gosched()
+	}
+
+	raw, err := rt.EvalString("JSON.stringify(globalThis.__waitUntilRejections)")
+	if err != nil {
+		return fmt.Errorf("reading waitUntil results: %w", err)
+	}
+	var rejections []string
+	if err := json.Unmarshal([]byte(raw), &rejections); err != nil {
+		return fmt.Errorf("reading waitUntil results: %w", err)
+	}
+	if len(rejections) > 0 {
+		return fmt.Errorf("waitUntil: %d promise(s) rejected: %s", len(rejections), strings.Join(rejections, "; "))
+	}
+	return nil
+}
+
+// ErrAwaitTimeout is returned by AwaitValue when the deadline passes before
+// the awaited promise settles.
+var ErrAwaitTimeout = errors.New("promise resolution timed out")
+
 // AwaitValue resolves a potentially-promise value stored in a global variable
 // by pumping the microtask queue. The global variable is updated in-place
 // with the resolved value. Optionally drains the event loop between pumps.
 func AwaitValue(rt core.JSRuntime, globalVar string, deadline time.Time, el *eventloop.EventLoop) error {
+	// A resource limit hit by the event loop ends the execution even if
+	// the worker caught the error.
+	if el != nil {
+		if err := el.Err(); err != nil {
+			return err
+		}
+	}
+
 	// Check if the value is a Promise.
 	isPromise, err := rt.EvalBool(fmt.Sprintf("globalThis.%s instanceof Promise", globalVar))
 	if err != nil || !isPromise {
@@ -142,7 +270,12 @@ func AwaitValue(rt core.JSRuntime, globalVar string, deadline time.Time, el *eve
 
 	// Pump microtasks (and optionally the event loop) until the promise settles.
 	for {
-		rt.RunMicrotasks()
+		checkpoint(rt, el)
+		if el != nil {
+			if err := el.Err(); err != nil {
+				return err
+			}
+		}
 
 		if el != nil && el.HasPending() {
 			shortDeadline := time.Now().Add(10 * time.Millisecond)
@@ -150,7 +283,10 @@ func AwaitValue(rt core.JSRuntime, globalVar string, deadline time.Time, el *eve
 				shortDeadline = deadline
 			}
 			el.Drain(rt, shortDeadline)
-			rt.RunMicrotasks()
+			if err := el.Err(); err != nil {
+				return err
+			}
+			el.Checkpoint(rt)
 		}
 
 		stateStr, err := rt.EvalString("String(globalThis.__awaited_state)")
@@ -162,7 +298,7 @@ func AwaitValue(rt core.JSRuntime, globalVar string, deadline time.Time, el *eve
 		}
 
 		if time.Now().After(deadline) {
-			return fmt.Errorf("promise resolution timed out")
+			return ErrAwaitTimeout
 		}
 		runtime.Gosched()
 	}
@@ -14,43 +14,130 @@ import (
 const webAPIsJS = `
 class Headers {
 	constructor(init) {
+		// _list holds every [name, value] pair in insertion order; _map
+		// indexes the values by lowercased name for lookups.
+		this._list = [];
 		this._map = {};
 		if (init) {
 			if (init instanceof Headers) {
-				for (const [k, v] of init.entries()) {
-					const key = k.toLowerCase();
-					if (!this._map[key]) this._map[key] = [];
-					this._map[key].push(v);
-				}
-			} else if (Array.isArray(init)) {
-				for (const [k, v] of init) {
-					const key = k.toLowerCase();
-					if (!this._map[key]) this._map[key] = [];
-					this._map[key].push(String(v));
+				// Copy the pairs directly so repeated headers such as
+				// Set-Cookie stay separate instead of being joined.
+				for (const [k, v] of init._list) this._add(k, v);
+			} else if (typeof init[Symbol.iterator] === 'function') {
+				// Any iterable of [name, value] pairs: arrays, Maps,
+				// generators, another Headers-like iterable.
+				for (const entry of init) {
+					const pair = typeof entry === 'string' ? null : Array.from(entry);
+					if (!pair || pair.length !== 2) {
+						throw new TypeError('Headers constructor: each entry must be a [name, value] pair');
+					}
+					this._add(String(pair[0]).toLowerCase(), String(pair[1]));
 				}
 			} else {
-				for (const [k, v] of Object.entries(init)) this._map[k.toLowerCase()] = [String(v)];
+				// Names differing only in case are the same header, so their
+				// values are combined rather than the last one winning.
+				for (const [k, v] of Object.entries(init)) this._add(k.toLowerCase(), String(v));
 			}
 		}
 	}
+	_add(key, value) {
+		this._list.push([key, value]);
+		if (!this._map[key]) this._map[key] = [];
+		this._map[key].push(value);
+	}
+	// _sorted lists [name, combined value] pairs ordered by name, which is
+	// how the Fetch spec iterates headers whatever order they were added in.
+	// Set-Cookie values are never combined, so each gets its own pair.
+	_sorted() {
+		const out = [];
+		for (const k of Object.keys(this._map).sort()) {
+			if (k === 'set-cookie') for (const v of this._map[k]) out.push([k, v]);
+			else out.push([k, this._map[k].join(', ')]);
+		}
+		return out;
+	}
+	// _guard is 'immutable' for headers that belong to Response.error() and
+	// Response.redirect(); mutating them throws like the Fetch spec requires.
+	_checkMutable() {
+		if (this._guard === 'immutable') throw new TypeError('Headers are immutable');
+	}
 	get(name) { return this._map[name.toLowerCase()]?.join(', ') ?? null; }
-	set(name, value) { this._map[name.toLowerCase()] = [String(value)]; }
+	set(name, value) {
+		this._checkMutable();
+		const key = name.toLowerCase();
+		value = String(value);
+		// The first pair with this name keeps its position; later ones go.
+		const i = this._list.findIndex(p => p[0] === key);
+		if (i === -1) {
+			this._add(key, value);
+			return;
+		}
+		this._list[i] = [key, value];
+		this._list = this._list.filter((p, j) => j <= i || p[0] !== key);
+		this._map[key] = [value];
+	}
 	has(name) { return name.toLowerCase() in this._map; }
-	delete(name) { delete this._map[name.toLowerCase()]; }
-	append(name, value) {
+	delete(name) {
+		this._checkMutable();
 		const key = name.toLowerCase();
-		if (!this._map[key]) this._map[key] = [];
-		this._map[key].push(String(value));
+		if (!(key in this._map)) return;
+		this._list = this._list.filter(p => p[0] !== key);
+		delete this._map[key];
 	}
-	forEach(cb) { for (const [k, vs] of Object.entries(this._map)) cb(vs.join(', '), k, this); }
-	entries() { return Object.entries(this._map).map(([k, vs]) => [k, vs.join(', ')])[Symbol.iterator](); }
-	keys() { return Object.keys(this._map)[Symbol.iterator](); }
-	values() { return Object.entries(this._map).map(([, vs]) => vs.join(', '))[Symbol.iterator](); }
+	append(name, value) {
+		this._checkMutable();
+		this._add(name.toLowerCase(), String(value));
+	}
+	forEach(cb, thisArg) { for (const [k, v] of this._sorted()) cb.call(thisArg, v, k, this); }
+	entries() { return this._sorted()[Symbol.iterator](); }
+	keys() { return this._sorted().map(([k]) => k)[Symbol.iterator](); }
+	values() { return this._sorted().map(([, v]) => v)[Symbol.iterator](); }
 	getSetCookie() { return [...(this._map['set-cookie'] || [])]; }
 	get [Symbol.toStringTag]() { return 'Headers'; }
 	[Symbol.iterator]() { return this.entries(); }
 }
 
+// Default ports of the special schemes; other schemes have opaque origins.
+const urlSpecialPorts = { 'http:': '80', 'https:': '443', 'ws:': '80', 'wss:': '443', 'ftp:': '21' };
+
+// urlEncodePath percent-encodes the characters of the URL standard's path
+// percent-encode set: controls, space, ", #, <, >, ?, backtick, {, } and anything
+// outside ASCII. Existing %XX escapes are kept.
+function urlEncodePath(path) {
+	let out = '';
+	for (const ch of path) {
+		const c = ch.codePointAt(0);
+		if (c <= 0x20 || c === 0x22 || c === 0x23 || c === 0x3C || c === 0x3E || c === 0x3F ||
+			c === 0x60 || c === 0x7B || c === 0x7D || c >= 0x7F) {
+			// A lone surrogate has no UTF-8 encoding; use U+FFFD as TextEncoder does.
+			out += (c >= 0xD800 && c <= 0xDFFF) ? '%EF%BF%BD' : encodeURIComponent(ch);
+		} else {
+			out += ch;
+		}
+	}
+	return out;
+}
+
+// urlNormalizePath resolves "." and ".." segments (including their %2e
+// spellings) in an absolute path.
+function urlNormalizePath(path) {
+	const out = [];
+	const segs = path.split('/');
+	for (let i = 1; i < segs.length; i++) {
+		const seg = segs[i].toLowerCase();
+		const last = i === segs.length - 1;
+		if (seg === '.' || seg === '%2e') {
+			if (last) out.push('');
+		} else if (seg === '..' || seg === '.%2e' || seg === '%2e.' || seg === '%2e%2e') {
+			out.pop();
+			if (last) out.push('');
+		} else {
+			out.push(segs[i]);
+		}
+	}
+	return '/' + out.join('/');
+}
+
 class URL {
 	constructor(input, base) {
 		if (typeof input === 'object' && input !== null) input = String(input);
@@ -67,6 +154,7 @@ class URL {
 		this._host = parsed.host;
 		this._username = parsed.username || '';
 		this._password = parsed.password || '';
+		this._opaque = !!parsed.opaque;
 		this._href = parsed.href;
 		this._buildHref();
 		this._searchParams = new URLSearchParams(this._search);
@@ -77,10 +165,26 @@ class URL {
 		if (this._username) {
 			userInfo = this._username + (this._password ? ':' + this._password : '') + '@';
 		}
+		if (this._port === urlSpecialPorts[this._protocol]) this._port = '';
 		this._host = this._port ? this._hostname + ':' + this._port : this._hostname;
-		this._origin = this._protocol + '//' + this._host;
+		this._origin = this._computeOrigin();
+		if (this._opaque) {
+			this._href = this._protocol + this._pathname + this._search + this._hash;
+			return;
+		}
 		this._href = this._protocol + '//' + userInfo + this._host + this._pathname + this._search + this._hash;
 	}
+	_computeOrigin() {
+		if (this._protocol === 'blob:') {
+			try {
+				const inner = new URL(this._pathname);
+				if (inner.protocol === 'http:' || inner.protocol === 'https:') return inner.origin;
+			} catch(e) {}
+			return 'null';
+		}
+		if (!(this._protocol in urlSpecialPorts)) return 'null';
+		return this._protocol + '//' + this._host;
+	}
 	get href() { return this._href; }
 	set href(v) {
 		if (typeof v === 'object' && v !== null) v = String(v);
@@ -94,17 +198,26 @@ class URL {
 		this._hash = parsed.hash;
 		this._username = parsed.username || '';
 		this._password = parsed.password || '';
+		this._opaque = !!parsed.opaque;
 		this._buildHref();
 		this._rebuildSearchParams();
 	}
 	get protocol() { return this._protocol; }
 	set protocol(v) { this._protocol = v; this._buildHref(); }
 	get hostname() { return this._hostname; }
-	set hostname(v) { this._hostname = v; this._buildHref(); }
+	set hostname(v) { if (this._opaque) return; this._hostname = v; this._buildHref(); }
 	get port() { return this._port; }
-	set port(v) { this._port = String(v); this._buildHref(); }
+	set port(v) { if (this._opaque) return; this._port = String(v); this._buildHref(); }
 	get pathname() { return this._pathname; }
-	set pathname(v) { this._pathname = v; this._buildHref(); }
+	set pathname(v) {
+		if (this._opaque) return;
+		v = String(v);
+		// Special schemes treat a backslash as a path separator.
+		if (this._protocol in urlSpecialPorts) v = v.replace(/\\/g, '/');
+		if (!v.startsWith('/')) v = '/' + v;
+		this._pathname = urlNormalizePath(urlEncodePath(v));
+		this._buildHref();
+	}
 	get search() { return this._search; }
 	set search(v) {
 		this._search = v;
@@ -188,9 +301,100 @@ class URLSearchParams {
 	[Symbol.iterator]() { return this.entries(); }
 }
 
+// __normalizeMethod validates an HTTP method and upper-cases the standard
+// ones, leaving extension methods as given (Fetch spec "normalize").
+globalThis.__normalizeMethod = function(method) {
+	method = String(method);
+	if (!/^[!#$%&'*+\-.^_\x60|~0-9A-Za-z]+$/.test(method)) {
+		throw new TypeError('Invalid HTTP method: ' + method);
+	}
+	const upper = method.toUpperCase();
+	if (upper === 'CONNECT' || upper === 'TRACE' || upper === 'TRACK') {
+		throw new TypeError('Forbidden method: ' + method);
+	}
+	if (['DELETE', 'GET', 'HEAD', 'OPTIONS', 'POST', 'PUT'].indexOf(upper) !== -1) return upper;
+	return method;
+};
+
+// Values accepted for RequestInit.cache.
+const requestCacheModes = ['default', 'no-store', 'reload', 'no-cache', 'force-cache', 'only-if-cached'];
+
+// Values accepted for RequestInit.referrerPolicy; '' means the default.
+const referrerPolicies = ['', 'no-referrer', 'no-referrer-when-downgrade', 'same-origin', 'origin',
+	'strict-origin', 'origin-when-cross-origin', 'strict-origin-when-cross-origin', 'unsafe-url'];
+
+// The enum-valued RequestInit members with the values each accepts.
+const requestInitEnums = [
+	['redirect', 'redirect mode', ['follow', 'error', 'manual']],
+	['mode', 'mode', ['navigate', 'same-origin', 'no-cors', 'cors']],
+	['credentials', 'credentials mode', ['omit', 'same-origin', 'include']],
+	['cache', 'cache mode', requestCacheModes],
+	['referrerPolicy', 'referrer policy', referrerPolicies],
+	['duplex', 'duplex', ['half']],
+	['priority', 'priority', ['high', 'low', 'auto']],
+];
+
+// validateRequestInit throws a TypeError naming caller when an enum member
+// of init holds a value outside its enum. Other members, including ones
+// this runtime accepts but ignores such as priority, are left alone.
+const validateRequestInit = function(caller, init) {
+	for (const [name, label, values] of requestInitEnums) {
+		if (init[name] !== undefined && values.indexOf(init[name]) === -1) {
+			throw new TypeError(caller + ': invalid ' + label + ': ' + init[name]);
+		}
+	}
+};
+
+// bodyStream wraps a non-stream body in a ReadableStream of its UTF-8 or
+// raw bytes, so .body is a stream whatever the body was built from. A body
+// that was already consumed yields an empty stream.
+const bodyStream = function(content, consumed) {
+	return new ReadableStream({
+		start(controller) {
+			if (consumed) {
+				// Nothing left to read.
+			} else if (typeof content === 'string') {
+				controller.enqueue(new TextEncoder().encode(content));
+			} else if (content instanceof ArrayBuffer) {
+				controller.enqueue(new Uint8Array(content));
+			} else if (ArrayBuffer.isView(content)) {
+				controller.enqueue(new Uint8Array(content.buffer, content.byteOffset, content.byteLength));
+			} else {
+				controller.enqueue(new TextEncoder().encode(String(content)));
+			}
+			controller.close();
+		}
+	});
+};
+
+// checkBodyStream rejects a ReadableStream body that something else already
+// holds or has read from: the new body would miss the consumed chunks.
+const checkBodyStream = function(caller, body) {
+	if (body instanceof ReadableStream && (body._locked || body._disturbed)) {
+		throw new TypeError(caller + ': body stream is locked or disturbed');
+	}
+};
+
+// __isNullBodyStatus reports the statuses the Fetch spec forbids a body on:
+// 1xx, 204 No Content, 205 Reset Content and 304 Not Modified.
+globalThis.__isNullBodyStatus = function(status) {
+	return (status >= 100 && status < 200) || status === 204 || status === 205 || status === 304;
+};
+
+// __teeBody returns the body a clone of src should get. A stream can only be
+// read once, so it is split: src keeps one branch and the clone gets the
+// other, and each can be read independently. Other bodies are shared.
+globalThis.__teeBody = function(src) {
+	if (!(src._body instanceof ReadableStream)) return src._body;
+	const [mine, theirs] = src._body.tee();
+	src._body = mine;
+	return theirs;
+};
+
 class Request {
 	constructor(input, init) {
 		init = init || {};
+		validateRequestInit('Request', init);
 		this._bodyUsed = false;
 		if (input instanceof Request) {
 			this.url = input.url;
@@ -207,47 +411,44 @@ class Request {
 			this.keepalive = input.keepalive;
 			this.signal = input.signal;
 			this.destination = input.destination;
+			this.duplex = input.duplex;
 		} else {
 			try { this.url = new URL(String(input)).href; } catch(e) { this.url = String(input); }
-			this.method = (init.method || 'GET').toUpperCase();
+			this.method = 'GET';
 			this.headers = new Headers(init.headers);
 			this._body = init.body !== undefined ? init.body : null;
 		}
-		if (init.method) this.method = init.method.toUpperCase();
+		if (init.method) this.method = __normalizeMethod(init.method);
 		if (init.headers) this.headers = new Headers(init.headers);
 		if (init.body !== undefined) this._body = init.body;
-		if (['CONNECT','TRACE','TRACK'].indexOf(this.method) !== -1) throw new TypeError('Forbidden method: ' + this.method);
+		if (init.body instanceof ReadableStream && init.duplex !== 'half') {
+			throw new TypeError('Request: duplex: "half" is required when the body is a ReadableStream');
+		}
+		if (init.body !== undefined) checkBodyStream('Request', init.body);
+		if (init.body !== undefined) this._streamBody = init.body instanceof ReadableStream;
+		else if (input instanceof Request) this._streamBody = input._streamBody;
+		if ((this.method === 'GET' || this.method === 'HEAD') && this._body != null) {
+			throw new TypeError('Request: a ' + this.method + ' request cannot have a body');
+		}
 		this.redirect = init.redirect || this.redirect || 'follow';
 		this.mode = init.mode || this.mode || 'cors';
 		this.credentials = init.credentials || this.credentials || 'same-origin';
 		this.cache = init.cache || this.cache || 'default';
+		if (this.cache === 'only-if-cached' && this.mode !== 'same-origin') {
+			throw new TypeError('Request: cache mode "only-if-cached" requires mode "same-origin"');
+		}
 		this.referrer = init.referrer !== undefined ? init.referrer : (this.referrer !== undefined ? this.referrer : 'about:client');
 		this.referrerPolicy = init.referrerPolicy || this.referrerPolicy || '';
 		this.integrity = init.integrity || this.integrity || '';
 		this.keepalive = init.keepalive !== undefined ? !!init.keepalive : (this.keepalive !== undefined ? this.keepalive : false);
 		this.signal = init.signal !== undefined ? init.signal : (this.signal !== undefined ? this.signal : null);
 		this.destination = this.destination || '';
+		this.duplex = init.duplex || this.duplex || 'half';
 	}
 	get body() {
 		if (this._body === null || this._body === undefined) return null;
-		if (this._body instanceof ReadableStream) return this._body;
-		const content = this._body;
-		const stream = new ReadableStream({
-			start(controller) {
-				if (typeof content === 'string') {
-					controller.enqueue(new TextEncoder().encode(content));
-				} else if (content instanceof ArrayBuffer) {
-					controller.enqueue(new Uint8Array(content));
-				} else if (ArrayBuffer.isView(content)) {
-					controller.enqueue(new Uint8Array(content.buffer, content.byteOffset, content.byteLength));
-				} else {
-					controller.enqueue(new TextEncoder().encode(String(content)));
-				}
-				controller.close();
-			}
-		});
-		this._body = stream;
-		return stream;
+		if (!(this._body instanceof ReadableStream)) this._body = bodyStream(this._body, this._bodyUsed);
+		return this._body;
 	}
 	get bodyUsed() {
 		return this._bodyUsed || (this._body instanceof ReadableStream && this._body._locked);
@@ -290,33 +491,19 @@ class Request {
 		const enc = new TextEncoder();
 		return enc.encode(t).buffer;
 	}
-	async bytes() {
-		if (this._body instanceof ReadableStream) {
-			if (this._bodyUsed) throw new TypeError('body already consumed');
-			this._bodyUsed = true;
-			const reader = this._body.getReader();
-			const chunks = [];
-			while (true) {
-				const {done, value} = await reader.read();
-				if (done) break;
-				chunks.push(value);
-			}
-			const totalLen = chunks.reduce((s, c) => s + c.byteLength, 0);
-			const result = new Uint8Array(totalLen);
-			let offset = 0;
-			for (const c of chunks) { result.set(c, offset); offset += c.byteLength; }
-			return result;
-		}
-		const t = this._body !== null && this._body !== undefined ? String(this._body) : '';
-		return new TextEncoder().encode(t);
+	clone() {
+		if (this.bodyUsed) throw new TypeError('Cannot clone a consumed request');
+		const r = new Request(this);
+		r._body = __teeBody(this);
+		return r;
 	}
-	clone() { return new Request(this); }
 	get [Symbol.toStringTag]() { return 'Request'; }
 }
 
 class Response {
 	constructor(body, init) {
 		init = init || {};
+		checkBodyStream('Response', body);
 		this._body = body !== undefined && body !== null ? body : null;
 		this._bodyUsed = false;
 		this.type = 'default';
@@ -324,6 +511,9 @@ class Response {
 		if (init.status !== undefined && init.status !== 0 && (init.status < 100 || init.status > 599)) {
 			throw new RangeError('Invalid status code: ' + init.status);
 		}
+		if (this._body !== null && __isNullBodyStatus(this.status)) {
+			throw new TypeError('Response with null body status ' + this.status + ' cannot have a body');
+		}
 		this.statusText = init.statusText || '';
 		this.headers = new Headers(init.headers);
 		this.redirected = false;
@@ -333,24 +523,8 @@ class Response {
 	get ok() { return this.status >= 200 && this.status < 300; }
 	get body() {
 		if (this._body === null || this._body === undefined) return null;
-		if (this._body instanceof ReadableStream) return this._body;
-		const content = this._body;
-		const stream = new ReadableStream({
-			start(controller) {
-				if (typeof content === 'string') {
-					controller.enqueue(new TextEncoder().encode(content));
-				} else if (content instanceof ArrayBuffer) {
-					controller.enqueue(new Uint8Array(content));
-				} else if (ArrayBuffer.isView(content)) {
-					controller.enqueue(new Uint8Array(content.buffer, content.byteOffset, content.byteLength));
-				} else {
-					controller.enqueue(new TextEncoder().encode(String(content)));
-				}
-				controller.close();
-			}
-		});
-		this._body = stream;
-		return stream;
+		if (!(this._body instanceof ReadableStream)) this._body = bodyStream(this._body, this._bodyUsed);
+		return this._body;
 	}
 	get bodyUsed() {
 		return this._bodyUsed || (this._body instanceof ReadableStream && this._body._locked);
@@ -393,56 +567,74 @@ class Response {
 		const enc = new TextEncoder();
 		return enc.encode(t).buffer;
 	}
-	async bytes() {
-		if (this._body instanceof ReadableStream) {
-			if (this._bodyUsed) throw new TypeError('body already consumed');
-			this._bodyUsed = true;
-			const reader = this._body.getReader();
-			const chunks = [];
-			while (true) {
-				const {done, value} = await reader.read();
-				if (done) break;
-				chunks.push(value);
-			}
-			const totalLen = chunks.reduce((s, c) => s + c.byteLength, 0);
-			const result = new Uint8Array(totalLen);
-			let offset = 0;
-			for (const c of chunks) { result.set(c, offset); offset += c.byteLength; }
-			return result;
-		}
-		const t = this._body !== null && this._body !== undefined ? String(this._body) : '';
-		return new TextEncoder().encode(t);
-	}
 	clone() {
-		if (this._bodyUsed) throw new TypeError('Cannot clone a consumed response');
-		const r = new Response(this._body, {
+		if (this.bodyUsed) throw new TypeError('Cannot clone a consumed response');
+		const r = new Response(__teeBody(this), {
 			status: this.status,
 			statusText: this.statusText,
 			headers: new Headers(this.headers),
 		});
+		r.headers._guard = this.headers._guard;
 		r.type = this.type;
 		r.url = this.url;
 		r.redirected = this.redirected;
+		if (this.trailers !== undefined) r.trailers = this.trailers;
 		return r;
 	}
 	static json(data, init) {
 		init = init || {};
-		const body = JSON.stringify(data);
+		// BigInt has no JSON representation. Values that define toJSON
+		// (e.g. BigInt.prototype.toJSON) are converted before the replacer
+		// sees them, so only raw BigInts reach the throw below.
+		// ancestors tracks the objects on the current path from the root so
+		// cycles are reported with V8's message on every engine; shared
+		// (non-cyclic) references are still allowed.
+		const ancestors = [];
+		const body = JSON.stringify(data, function(key, value) {
+			if (typeof value === 'bigint') {
+				throw new TypeError('Do not know how to serialize a BigInt');
+			}
+			if (typeof value === 'object' && value !== null) {
+				while (ancestors.length > 0 && ancestors[ancestors.length - 1] !== this) ancestors.pop();
+				if (ancestors.indexOf(value) !== -1) {
+					throw new TypeError('Converting circular structure to JSON');
+				}
+				ancestors.push(value);
+			}
+			return value;
+		});
+		// Unlike the constructor, which allows 0 and 1xx for internal use,
+		// a JSON response needs a status that can carry a body.
+		if (init.status !== undefined && !(init.status >= 200 && init.status <= 599)) {
+			throw new RangeError('Response.json: invalid status code: ' + init.status);
+		}
+		// An explicit content-type in init wins over the JSON default.
 		const headers = new Headers(init.headers);
 		if (!headers.has('content-type')) headers.set('content-type', 'application/json');
 		return new Response(body, { ...init, headers });
 	}
 	static redirect(url, status) {
-		status = status || 302;
+		// Location carries the serialized absolute URL, so a bare origin
+		// gains its trailing slash; relative URLs have no base and throw.
+		let location;
+		try {
+			location = new URL(String(url)).href;
+		} catch (e) {
+			throw new TypeError('Response.redirect: invalid URL: ' + url);
+		}
+		status = status === undefined ? 302 : status;
 		if ([301, 302, 303, 307, 308].indexOf(status) === -1) {
 			throw new RangeError('Invalid redirect status: ' + status);
 		}
-		return new Response(null, { status, headers: { location: url } });
+		const r = new Response(null, { status, headers: { location } });
+		r.headers._guard = 'immutable';
+		return r;
 	}
 	static error() {
 		const r = new Response(null, { status: 0, statusText: '' });
 		r.type = 'error';
 		r.status = 0;
+		r.headers._guard = 'immutable';
 		return r;
 	}
 	get [Symbol.toStringTag]() { return 'Response'; }
@@ -473,36 +665,63 @@ if (typeof TextEncoder === 'undefined') {
 		encodeInto(source, destination) {
 			source = String(source);
 			const encoded = this.encode(source);
-			const written = Math.min(encoded.length, destination.length);
-			destination.set(encoded.subarray(0, written));
+			// Count whole characters that fit so a multi-byte sequence is never
+			// split at the end of destination; read is in UTF-16 code units.
 			let read = 0;
-			let byteCount = 0;
-			for (let i = 0; i < source.length && byteCount < written; i++) {
-				let c = source.charCodeAt(i);
-				let charBytes;
+			let written = 0;
+			for (let i = 0; i < source.length; i++) {
+				const c = source.charCodeAt(i);
+				let charBytes = 3;
+				let units = 1;
 				if (c < 0x80) charBytes = 1;
 				else if (c < 0x800) charBytes = 2;
-				else if (c >= 0xd800 && c <= 0xdbff) { charBytes = 4; }
-				else charBytes = 3;
-				if (byteCount + charBytes > written) break;
-				byteCount += charBytes;
-				read++;
-				if (charBytes === 4) i++;
+				else if (c >= 0xd800 && c <= 0xdbff && i + 1 < source.length) { charBytes = 4; units = 2; }
+				if (written + charBytes > destination.length) break;
+				written += charBytes;
+				read += units;
+				i += units - 1;
 			}
-			return { read, written: byteCount };
+			destination.set(encoded.subarray(0, written));
+			return { read, written };
 		}
 		get [Symbol.toStringTag]() { return 'TextEncoder'; }
 	};
 }
 
+// Encoding-spec labels accepted by TextDecoder, mapped to the canonical
+// encoding name. Labels are matched after lowercasing and trimming ASCII
+// whitespace; anything else is a RangeError.
+const textDecoderLabels = {
+	'unicode-1-1-utf-8': 'utf-8', 'unicode11utf8': 'utf-8', 'unicode20utf8': 'utf-8',
+	'utf-8': 'utf-8', 'utf8': 'utf-8', 'x-unicode20utf8': 'utf-8',
+	'ansi_x3.4-1968': 'windows-1252', 'ascii': 'windows-1252', 'cp1252': 'windows-1252',
+	'cp819': 'windows-1252', 'csisolatin1': 'windows-1252', 'ibm819': 'windows-1252',
+	'iso-8859-1': 'windows-1252', 'iso-ir-100': 'windows-1252', 'iso8859-1': 'windows-1252',
+	'iso88591': 'windows-1252', 'iso_8859-1': 'windows-1252', 'iso_8859-1:1987': 'windows-1252',
+	'l1': 'windows-1252', 'latin1': 'windows-1252', 'us-ascii': 'windows-1252',
+	'windows-1252': 'windows-1252', 'x-cp1252': 'windows-1252',
+	'csunicode': 'utf-16le', 'iso-10646-ucs-2': 'utf-16le', 'ucs-2': 'utf-16le',
+	'unicode': 'utf-16le', 'unicodefeff': 'utf-16le', 'utf-16': 'utf-16le',
+	'utf-16le': 'utf-16le', 'unicodefffe': 'utf-16be', 'utf-16be': 'utf-16be',
+};
+
+// windows-1252 code points for bytes 0x80-0x9F; every other byte maps to
+// the code point of the same value.
+const windows1252High = [
+	0x20AC, 0x81, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x8D, 0x017D, 0x8F,
+	0x90, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x9D, 0x017E, 0x0178,
+];
+
 globalThis.TextDecoder = class TextDecoder {
 		constructor(encoding, options) {
-			var label = (encoding || 'utf-8').toLowerCase().trim();
-			// Normalize label aliases to canonical names.
-			if (label === 'utf8' || label === 'unicode-1-1-utf-8') label = 'utf-8';
-			else if (label === 'latin1' || label === 'iso-8859-1' || label === 'ascii' ||
-			         label === 'us-ascii' || label === 'iso8859-1' || label === 'iso_8859-1') label = 'windows-1252';
-			this._encoding = label;
+			var raw = encoding === undefined ? 'utf-8' : String(encoding);
+			var label = raw.replace(/^[\t\n\f\r ]+|[\t\n\f\r ]+$/g, '').toLowerCase();
+			if (!Object.prototype.hasOwnProperty.call(textDecoderLabels, label)) {
+				throw new RangeError('TextDecoder: unsupported encoding label "' + raw + '"');
+			}
+			this._encoding = textDecoderLabels[label];
 			this._fatal = !!(options && options.fatal);
 			this._ignoreBOM = !!(options && options.ignoreBOM);
 			this._bomSeen = false;
@@ -535,6 +754,8 @@ globalThis.TextDecoder = class TextDecoder {
 			} else {
 				bytes = incoming;
 			}
+			if (this._encoding === 'windows-1252') return this._decodeWindows1252(bytes);
+			if (this._encoding !== 'utf-8') return this._decodeUTF16(bytes, stream);
 			var start = 0;
 			// BOM handling: strip UTF-8 BOM (EF BB BF) on first decode unless ignoreBOM.
 			// Only attempt BOM detection once we have at least 3 bytes, or on the
@@ -621,6 +842,64 @@ globalThis.TextDecoder = class TextDecoder {
 			}
 			return result;
 		}
+		_decodeWindows1252(bytes) {
+			var result = '';
+			for (var i = 0; i < bytes.length; i++) {
+				var b = bytes[i];
+				result += String.fromCharCode(b >= 0x80 && b <= 0x9F ? windows1252High[b - 0x80] : b);
+			}
+			return result;
+		}
+		_decodeUTF16(bytes, stream) {
+			var le = this._encoding === 'utf-16le';
+			var unitAt = function(j) {
+				return le ? (bytes[j] | (bytes[j+1] << 8)) : ((bytes[j] << 8) | bytes[j+1]);
+			};
+			var start = 0;
+			// Same deferred BOM decision as UTF-8, with a 2-byte BOM.
+			if (!this._bomSeen) {
+				if (bytes.length >= 2) {
+					if (!this._ignoreBOM && unitAt(0) === 0xFEFF) start = 2;
+					this._bomSeen = true;
+				} else if (!stream) {
+					this._bomSeen = true;
+				}
+			}
+			var result = '';
+			var i = start;
+			for (; i + 1 < bytes.length; i += 2) {
+				var unit = unitAt(i);
+				if (unit >= 0xD800 && unit <= 0xDBFF) {
+					if (i + 3 < bytes.length) {
+						var next = unitAt(i + 2);
+						if (next >= 0xDC00 && next <= 0xDFFF) {
+							result += String.fromCharCode(unit, next);
+							i += 2;
+							continue;
+						}
+					} else if (stream) {
+						// High surrogate at the end of a chunk: wait for its pair.
+						break;
+					}
+					if (this._fatal) throw new TypeError('The encoded data was not valid ' + this._encoding);
+					result += '\uFFFD';
+				} else if (unit >= 0xDC00 && unit <= 0xDFFF) {
+					if (this._fatal) throw new TypeError('The encoded data was not valid ' + this._encoding);
+					result += '\uFFFD';
+				} else {
+					result += String.fromCharCode(unit);
+				}
+			}
+			if (i < bytes.length) {
+				if (stream) {
+					this._pending = Array.from(bytes.subarray(i));
+				} else {
+					if (this._fatal) throw new TypeError('The encoded data was not valid ' + this._encoding);
+					result += '\uFFFD';
+				}
+			}
+			return result;
+		}
 	};
 
 globalThis.Headers = Headers;
@@ -733,6 +1012,9 @@ type URLParsed struct {
 	Host     string `json:"host"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Opaque is set for URLs with an opaque path and no authority, such as
+	// mailto:, data: and blob: URLs.
+	Opaque bool `json:"opaque,omitempty"`
 }
 
 func ParseURL(rawURL, base string) (*URLParsed, error) {
@@ -763,11 +1045,14 @@ func ParseURL(rawURL, base string) (*URLParsed, error) {
 	protocol := u.Scheme + ":"
 	hostname := u.Hostname()
 	port := u.Port()
+	if port == urlDefaultPorts[u.Scheme] {
+		port = ""
+	}
 	host := hostname
 	if port != "" {
 		host = hostname + ":" + port
 	}
-	origin := protocol + "//" + host
+	origin := urlOrigin(u, host)
 	search := ""
 	if u.RawQuery != "" {
 		search = "?" + u.RawQuery
@@ -783,7 +1068,15 @@ func ParseURL(rawURL, base string) (*URLParsed, error) {
 		password, _ = u.User.Password()
 	}
 
-	pathname := u.Path
+	// An opaque path (mailto:user@host, data:text/plain,hi) has no authority
+	// and serializes directly after the scheme.
+	opaque := u.Opaque != ""
+	// EscapedPath keeps the input's percent-encoding rather than decoding
+	// %20 and friends back into characters that corrupt href.
+	pathname := u.EscapedPath()
+	if opaque {
+		pathname = u.Opaque
+	}
 	if pathname == "" {
 		pathname = "/"
 	}
@@ -793,6 +1086,9 @@ func ParseURL(rawURL, base string) (*URLParsed, error) {
 		userInfo = u.User.String() + "@"
 	}
 	href := protocol + "//" + userInfo + host + pathname + search + hash
+	if opaque {
+		href = protocol + pathname + search + hash
+	}
 
 	return &URLParsed{
 		Href:     href,
@@ -806,9 +1102,36 @@ func ParseURL(rawURL, base string) (*URLParsed, error) {
 		Host:     host,
 		Username: username,
 		Password: password,
+		Opaque:   opaque,
 	}, nil
 }
 
+// urlDefaultPorts maps the URL standard's special schemes to their default
+// ports, which are omitted from host, port and origin.
+var urlDefaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// urlOrigin serializes the origin of u. Special schemes have a tuple origin;
+// a blob: URL takes the origin of the http(s) URL it wraps; everything else
+// is opaque and serializes as "null".
+func urlOrigin(u *url.URL, host string) string {
+	if _, ok := urlDefaultPorts[u.Scheme]; ok {
+		return u.Scheme + "://" + host
+	}
+	if u.Scheme == "blob" {
+		if inner, err := ParseURL(u.Opaque, ""); err == nil &&
+			(inner.Protocol == "http:" || inner.Protocol == "https:") {
+			return inner.Origin
+		}
+	}
+	return "null"
+}
+
 // SetupWebAPIs registers Go-backed helpers and evaluates the JS class
 // definitions that form the Web API surface available to workers.
 func SetupWebAPIs(rt core.JSRuntime, _ *eventloop.EventLoop) error {
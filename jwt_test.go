@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// jwtIOToken is the HS256 example token from jwt.io, signed with the secret
+// "your-256-bit-secret".
+const jwtIOToken = "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9." +
+	"eyJzdWIiOiIxMjM0NTY3ODkwIiwibmFtZSI6IkpvaG4gRG9lIiwiaWF0IjoxNTE2MjM5MDIyfQ." +
+	"SflKxwRJSMeKKF2QT4fwpMeJf36POk6yJV_adQssw5c"
+
+func TestBase64url_DecodesJWTSegment(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const [h, p, s] = "` + jwtIOToken + `".split(".");
+    const dec = new TextDecoder();
+    const header = JSON.parse(dec.decode(base64urlDecode(h)));
+    const payload = JSON.parse(dec.decode(base64urlDecode(p)));
+    const sig = base64urlDecode(s);
+    // Same bytes with and without padding.
+    const padded = base64urlDecode("AQ==");
+    const unpadded = base64urlDecode("AQ");
+    let bad = "";
+    try { base64urlDecode("a+b/"); } catch (e) { bad = e.name; }
+    return Response.json({
+      alg: header.alg,
+      name: payload.name,
+      sigLen: sig.length,
+      reencoded: base64urlEncode(sig) === s,
+      padded: Array.from(padded),
+      unpadded: Array.from(unpadded),
+      fromString: base64urlEncode("ÿ?>"),
+      bad,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Alg        string `json:"alg"`
+		Name       string `json:"name"`
+		SigLen     int    `json:"sigLen"`
+		Reencoded  bool   `json:"reencoded"`
+		Padded     []int  `json:"padded"`
+		Unpadded   []int  `json:"unpadded"`
+		FromString string `json:"fromString"`
+		Bad        string `json:"bad"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Alg != "HS256" || data.Name != "John Doe" {
+		t.Errorf("decoded alg = %q, name = %q", data.Alg, data.Name)
+	}
+	if data.SigLen != 32 || !data.Reencoded {
+		t.Errorf("signature length = %d, re-encoded match = %v", data.SigLen, data.Reencoded)
+	}
+	if len(data.Padded) != 1 || data.Padded[0] != 1 || len(data.Unpadded) != 1 || data.Unpadded[0] != 1 {
+		t.Errorf("padded = %v, unpadded = %v, want [1]", data.Padded, data.Unpadded)
+	}
+	// UTF-8 of "ÿ?>" is c3 bf 3f 3e, which uses both - and _.
+	if data.FromString != "w78_Pg" {
+		t.Errorf("base64urlEncode = %q, want %q", data.FromString, "w78_Pg")
+	}
+	if data.Bad != "InvalidCharacterError" {
+		t.Errorf("standard base64 input threw %q, want InvalidCharacterError", data.Bad)
+	}
+}
+
+func TestJWT_Verify(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const token = "` + jwtIOToken + `";
+    const outcome = async (fn) => {
+      try { await fn(); return "ok"; } catch (e) { return e.message; }
+    };
+    const enc = new TextEncoder();
+
+    const hs = await JWT.verify(token, "your-256-bit-secret");
+    const wrongSecret = await outcome(() => JWT.verify(token, "not-the-secret"));
+    const [h, p, s] = token.split(".");
+    const forged = h + "." + base64urlEncode('{"sub":"admin"}') + "." + s;
+    const tampered = await outcome(() => JWT.verify(forged, "your-256-bit-secret"));
+
+    async function hsToken(payload, secret) {
+      const head = base64urlEncode('{"alg":"HS256","typ":"JWT"}');
+      const body = base64urlEncode(payload);
+      const key = await crypto.subtle.importKey("raw", enc.encode(secret), { name: "HMAC", hash: "SHA-256" }, false, ["sign"]);
+      const sig = await crypto.subtle.sign("HMAC", key, enc.encode(head + "." + body));
+      return head + "." + body + "." + base64urlEncode(sig);
+    }
+    const expiredToken = await hsToken('{"exp":100}', "k");
+    const expiredErr = await outcome(() => JWT.verify(expiredToken, "k", { currentTime: 200 }));
+    const withinSkew = await outcome(() => JWT.verify(expiredToken, "k", { currentTime: 105, clockTolerance: 10 }));
+
+    const pair = await crypto.subtle.generateKey(
+      { name: "RSASSA-PKCS1-v1_5", modulusLength: 2048, publicExponent: new Uint8Array([1, 0, 1]), hash: "SHA-256" },
+      true, ["sign", "verify"]);
+    const rsHead = base64urlEncode('{"alg":"RS256","typ":"JWT"}');
+    const rsBody = base64urlEncode('{"sub":"rsa-user"}');
+    const rsSig = await crypto.subtle.sign("RSASSA-PKCS1-v1_5", pair.privateKey, enc.encode(rsHead + "." + rsBody));
+    const rsToken = rsHead + "." + rsBody + "." + base64urlEncode(rsSig);
+    const rs = await JWT.verify(rsToken, pair.publicKey);
+    const rsOnly = await outcome(() => JWT.verify(token, pair.publicKey));
+    const hsRejected = await outcome(() => JWT.verify(token, "your-256-bit-secret", { algorithms: ["RS256"] }));
+    const malformed = await outcome(() => JWT.verify("abc.def", "k"));
+
+    return Response.json({
+      hsSub: hs.payload.sub, hsAlg: hs.header.alg,
+      wrongSecret, tampered, expiredErr, withinSkew,
+      rsSub: rs.payload.sub, rsOnly, hsRejected, malformed,
+      decoded: JWT.decode(token).payload.name,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"hsSub":       "1234567890",
+		"hsAlg":       "HS256",
+		"wrongSecret": "JWT: signature verification failed",
+		"tampered":    "JWT: signature verification failed",
+		"expiredErr":  "JWT: token has expired",
+		"withinSkew":  "ok",
+		"rsSub":       "rsa-user",
+		"rsOnly":      "JWT: key does not match algorithm HS256",
+		"hsRejected":  "JWT: unsupported algorithm HS256",
+		"malformed":   "JWT: token must have three dot-separated segments",
+		"decoded":     "John Doe",
+	}
+	for key, w := range want {
+		if data[key] != w {
+			t.Errorf("%s = %q, want %q", key, data[key], w)
+		}
+	}
+}
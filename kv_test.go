@@ -1,9 +1,11 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -1563,3 +1565,153 @@ func TestKV_JSGetEmptyStringValue(t *testing.T) {
 		t.Error("KV.get() for empty string value should return a string type")
 	}
 }
+
+// tracingKVStore is a mock KV that records the trace ID each call sees in
+// its request context.
+type tracingKVStore struct {
+	*mockKVStore
+	mu     sync.Mutex
+	traces []string
+	tenant any
+	// deadline and ctxErr describe the context of the most recent call.
+	deadline bool
+	ctxErr   error
+}
+
+var _ ContextKVStore = (*tracingKVStore)(nil)
+
+type tenantKey struct{}
+
+func (kv *tracingKVStore) record(rc RequestContext, op string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.traces = append(kv.traces, op+":"+rc.Metadata["trace-id"])
+	kv.tenant = rc.Ctx.Value(tenantKey{})
+	_, kv.deadline = rc.Ctx.Deadline()
+	kv.ctxErr = rc.Ctx.Err()
+}
+
+func (kv *tracingKVStore) GetContext(rc RequestContext, key string) (*string, error) {
+	kv.record(rc, "get")
+	return kv.Get(key)
+}
+
+func (kv *tracingKVStore) GetWithMetadataContext(rc RequestContext, key string) (*KVValueWithMetadata, error) {
+	kv.record(rc, "getWithMetadata")
+	return kv.GetWithMetadata(key)
+}
+
+func (kv *tracingKVStore) PutContext(rc RequestContext, key, value string, metadata *string, ttl *int) error {
+	kv.record(rc, "put")
+	return kv.Put(key, value, metadata, ttl)
+}
+
+func (kv *tracingKVStore) DeleteContext(rc RequestContext, key string) error {
+	kv.record(rc, "delete")
+	return kv.Delete(key)
+}
+
+func (kv *tracingKVStore) ListContext(rc RequestContext, prefix string, limit int, cursor string) (*KVListResult, error) {
+	kv.record(rc, "list")
+	return kv.List(prefix, limit, cursor)
+}
+
+func TestKVBridge_RequestContext(t *testing.T) {
+	e := newTestEngine(t)
+	kv := &tracingKVStore{mockKVStore: newMockKVStore()}
+	env := &Env{
+		Vars:    make(map[string]string),
+		Secrets: make(map[string]string),
+		KV:      map[string]KVStore{"MY_KV": kv},
+	}
+
+	source := `export default {
+  async fetch(request, env) {
+    await env.MY_KV.put("k", "v");
+    const v = await env.MY_KV.get("k");
+    await env.MY_KV.list();
+    await env.MY_KV.delete("k");
+    return new Response(v);
+  },
+};`
+
+	req := getReq("http://localhost/")
+	req.Context = context.WithValue(context.Background(), tenantKey{}, "acme")
+	req.Metadata = map[string]string{"trace-id": "trace-123"}
+	r := execJS(t, e, source, env, req)
+	assertOK(t, r)
+	if string(r.Response.Body) != "v" {
+		t.Errorf("body = %q, want %q", r.Response.Body, "v")
+	}
+
+	want := []string{"put:trace-123", "get:trace-123", "list:trace-123", "delete:trace-123"}
+	if strings.Join(kv.traces, ",") != strings.Join(want, ",") {
+		t.Errorf("traces = %v, want %v", kv.traces, want)
+	}
+	if kv.tenant != "acme" {
+		t.Errorf("context value = %v, want %q", kv.tenant, "acme")
+	}
+	if !kv.deadline {
+		t.Error("request context has no execution deadline")
+	}
+
+	// A request without a context still reaches the store, with an empty
+	// trace ID and a usable background context.
+	kv.traces = nil
+	r = execJS(t, e, source, env, getReq("http://localhost/"))
+	assertOK(t, r)
+	if len(kv.traces) != 4 || kv.traces[0] != "put:" {
+		t.Errorf("traces without metadata = %v", kv.traces)
+	}
+}
+
+func TestKVBridge_RequestContextOutlivesResponseForWaitUntil(t *testing.T) {
+	e := newTestEngine(t)
+	kv := &tracingKVStore{mockKVStore: newMockKVStore()}
+	env := &Env{
+		Vars:    make(map[string]string),
+		Secrets: make(map[string]string),
+		KV:      map[string]KVStore{"MY_KV": kv},
+	}
+
+	source := `export default {
+  async fetch(request, env, ctx) {
+    ctx.waitUntil((async () => {
+      await scheduler.wait(50);
+      await env.MY_KV.put("bg", "v");
+    })());
+    return new Response("ok");
+  },
+};`
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), tenantKey{}, "acme"))
+	req := getReq("http://localhost/")
+	req.Context = ctx
+	req.Metadata = map[string]string{"trace-id": "trace-bg"}
+	r := execJS(t, e, source, env, req)
+	assertOK(t, r)
+
+	// The caller is done with the request once it has the response.
+	cancel()
+	if r.WaitUntil == nil {
+		t.Fatal("expected pending waitUntil work")
+	}
+	if wu := <-r.WaitUntil; wu.Error != nil {
+		t.Fatalf("waitUntil error: %v", wu.Error)
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if len(kv.traces) != 1 || kv.traces[0] != "put:trace-bg" {
+		t.Fatalf("traces = %v, want [put:trace-bg]", kv.traces)
+	}
+	if kv.ctxErr != nil {
+		t.Errorf("background context error = %v, want nil", kv.ctxErr)
+	}
+	if kv.tenant != "acme" {
+		t.Errorf("background context value = %v, want %q", kv.tenant, "acme")
+	}
+	if !kv.deadline {
+		t.Error("background context has no waitUntil deadline")
+	}
+}
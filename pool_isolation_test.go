@@ -1,10 +1,19 @@
 package worker
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"os"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 // ---------------------------------------------------------------------------
@@ -157,6 +166,190 @@ func TestPool_GlobalStateIsolation(t *testing.T) {
 	}
 }
 
+// TestPool_GlobalsResetBetweenRequests runs two requests on the same
+// single-worker pool: the first adds, replaces and deletes globals and
+// patches a built-in prototype; the second must see none of it, while
+// globals the script defined when it loaded are kept.
+func TestPool_GlobalsResetBetweenRequests(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `globalThis.fromLoad = "kept";
+export default {
+  fetch(request, env) {
+    if (new URL(request.url).searchParams.has("set")) {
+      globalThis.leak = 1;
+      globalThis.fromLoad = "changed";
+      globalThis.atob = () => "patched";
+      delete globalThis.btoa;
+      Array.prototype.leaky = () => "patched";
+      return new Response("set");
+    }
+    return Response.json({
+      leak: typeof globalThis.leak,
+      fromLoad: globalThis.fromLoad,
+      atob: atob("aGk="),
+      btoa: typeof btoa,
+      leaky: typeof [].leaky,
+    });
+  },
+};`
+
+	siteID := "global-reset-" + t.Name()
+	if _, err := e.CompileAndCache(siteID, "deploy1", source); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	r1 := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/?set"))
+	assertOK(t, r1)
+
+	r2 := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r2)
+	want := `{"leak":"undefined","fromLoad":"kept","atob":"hi","btoa":"function","leaky":"undefined"}`
+	if got := string(r2.Response.Body); got != want {
+		t.Errorf("second request saw %s, want %s", got, want)
+	}
+}
+
+// TestPool_BuiltinPrototypesResetBetweenRequests verifies that the reset
+// covers every constructor on globalThis and its prototype chain, not only
+// a fixed set of built-ins.
+func TestPool_BuiltinPrototypesResetBetweenRequests(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  fetch(request) {
+    if (new URL(request.url).searchParams.has("set")) {
+      Uint8Array.prototype.leaky = () => "patched";
+      Uint8Array.prototype.fill = () => "patched";
+      Object.getPrototypeOf(Uint8Array.prototype).shared = "patched";
+      TextEncoder.prototype.encode = () => "patched";
+      ReadableStream.prototype.leaky = "patched";
+      AbortController.prototype.leaky = "patched";
+      Blob.leaky = "patched";
+      return new Response("set");
+    }
+    return Response.json({
+      leaky: typeof new Uint8Array(1).leaky,
+      fill: new Uint8Array(2).fill(7).join(","),
+      shared: typeof new Float64Array(1).shared,
+      encode: new TextEncoder().encode("a").length,
+      stream: typeof ReadableStream.prototype.leaky,
+      abort: typeof new AbortController().leaky,
+      blob: typeof Blob.leaky,
+    });
+  },
+};`
+
+	siteID := "builtin-reset-" + t.Name()
+	if _, err := e.CompileAndCache(siteID, "deploy1", source); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	r1 := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/?set"))
+	assertOK(t, r1)
+
+	r2 := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r2)
+	want := `{"leaky":"undefined","fill":"7,7","shared":"undefined","encode":1,"stream":"undefined","abort":"undefined","blob":"undefined"}`
+	if got := string(r2.Response.Body); got != want {
+		t.Errorf("second request saw %s, want %s", got, want)
+	}
+	for _, st := range e.Stats() {
+		if st.SiteID == siteID && st.Live != 1 {
+			t.Errorf("Live = %d, want 1 (worker restored, not discarded)", st.Live)
+		}
+	}
+}
+
+func TestPool_UnrestorableGlobalDiscardsWorker(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	// A non-configurable property cannot be deleted again, so the worker
+	// that defined it must not serve another request.
+	source := `export default {
+  fetch(request, env) {
+    if (new URL(request.url).searchParams.has("set")) {
+      Object.defineProperty(globalThis, "pinned", { value: 1, configurable: false });
+      return new Response("set");
+    }
+    return new Response(typeof globalThis.pinned);
+  },
+};`
+
+	siteID := "global-stuck-" + t.Name()
+	if _, err := e.CompileAndCache(siteID, "deploy1", source); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	r1 := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/?set"))
+	assertOK(t, r1)
+	if !strings.Contains(logs.String(), "globalThis.pinned") {
+		t.Errorf("log = %q, want it to name globalThis.pinned", logs.String())
+	}
+
+	r2 := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r2)
+	if got := string(r2.Response.Body); got != "undefined" {
+		t.Errorf("second request saw pinned as %s, want undefined", got)
+	}
+}
+
+func TestPool_ThrowingCleanupDiscardsWorker(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	// Reading the replaced global makes the cleanup script throw before it
+	// can restore anything, so the worker must not serve another request.
+	source := `export default {
+  fetch(request, env) {
+    if (new URL(request.url).searchParams.has("set")) {
+      Object.defineProperty(globalThis, "fetch", {
+        get() { throw new Error("trapped"); },
+        configurable: true,
+      });
+      return new Response("set");
+    }
+    return new Response(typeof globalThis.fetch);
+  },
+};`
+
+	siteID := "global-throw-" + t.Name()
+	if _, err := e.CompileAndCache(siteID, "deploy1", source); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	r1 := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/?set"))
+	assertOK(t, r1)
+	if !strings.Contains(logs.String(), "cleanup failed") {
+		t.Errorf("log = %q, want a cleanup failure", logs.String())
+	}
+
+	r2 := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r2)
+	if got := string(r2.Response.Body); got != "function" {
+		t.Errorf("second request saw fetch as %s, want function", got)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // 4. Concurrent requests return distinct, uncontaminated payloads
 // ---------------------------------------------------------------------------
@@ -400,3 +593,775 @@ func TestPool_MemoryLimitRecovery(t *testing.T) {
 		t.Errorf("body = %q, want \"recovered\"", rOK.Response.Body)
 	}
 }
+
+// TestPool_ArrayBufferAllocationLimit verifies that a single oversized
+// ArrayBuffer or typed array allocation throws a RangeError the worker can
+// catch, instead of taking the runtime past its memory limit.
+func TestPool_ArrayBufferAllocationLimit(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxArrayBufferBytes = 4 << 20
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  fetch() {
+    const attempt = (fn) => {
+      try { fn(); return "allocated"; } catch (e) { return e.constructor.name; }
+    };
+    // Not every engine has the transfer and resize methods.
+    const method = (name, fn) =>
+      typeof ArrayBuffer.prototype[name] === "function" ? attempt(fn) : "unsupported";
+    class Bytes extends Uint8Array {}
+    const small = new Uint8Array(1024);
+    return Response.json({
+      buffer: attempt(() => new ArrayBuffer(2 ** 31)),
+      typed: attempt(() => new Uint8Array(2 ** 30)),
+      wide: attempt(() => new Float64Array(1 << 20)),
+      fromArray: attempt(() => Uint8Array.from({ length: 8 << 20 })),
+      resizable: attempt(() => new ArrayBuffer(8, { maxByteLength: 2 ** 31 })),
+      transfer: method("transfer", () => new ArrayBuffer(8).transfer(2 ** 31)),
+      transferFixed: method("transferToFixedLength", () => new ArrayBuffer(8).transferToFixedLength(2 ** 31)),
+      transferSmall: method("transfer", () => new ArrayBuffer(8).transfer(1024)),
+      resize: method("resize", () => new ArrayBuffer(8, { maxByteLength: 1024 }).resize(512)),
+      small: attempt(() => new ArrayBuffer(1 << 20)),
+      view: attempt(() => new Float64Array(new ArrayBuffer(1024))),
+      subclass: new Bytes(4) instanceof Uint8Array && new Bytes(4) instanceof Bytes,
+      identity: small instanceof Uint8Array && small.constructor === Uint8Array &&
+        small.buffer instanceof ArrayBuffer && small.buffer.constructor === ArrayBuffer,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]any{
+		"buffer":        "RangeError",
+		"typed":         "RangeError",
+		"wide":          "RangeError",
+		"fromArray":     "RangeError",
+		"resizable":     "RangeError",
+		"transfer":      "RangeError",
+		"transferFixed": "RangeError",
+		"transferSmall": "allocated",
+		"resize":        "allocated",
+		"small":         "allocated",
+		"view":          "allocated",
+		"subclass":      true,
+		"identity":      true,
+	}
+	for k, v := range want {
+		if data[k] != v && data[k] != "unsupported" {
+			t.Errorf("%s = %v, want %v", k, data[k], v)
+		}
+	}
+
+	// The runtime is still usable afterwards.
+	r = execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+}
+
+func TestPool_AllocationChurnLimit(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxAllocationBytes = 16 << 20
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  fetch(request) {
+    const rounds = Number(new URL(request.url).searchParams.get("rounds"));
+    let done = 0;
+    try {
+      for (let i = 0; i < rounds; i++) {
+        new Uint8Array(1 << 20).fill(1);
+        done++;
+      }
+    } catch (e) {
+      // Swallowing the error must not let the request succeed.
+    }
+    return new Response(String(done));
+  },
+};`
+
+	// Each buffer is dropped straight away, so peak memory stays low but the
+	// cumulative total passes the limit.
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/?rounds=64"))
+	if r.Error == nil {
+		t.Fatalf("expected allocation limit error, got response %q", r.Response.Body)
+	}
+	if !strings.Contains(r.Error.Error(), "allocation limit") {
+		t.Errorf("error = %v, want allocation limit", r.Error)
+	}
+
+	// The count is per request, so a later request under the limit succeeds.
+	for i := 0; i < 2; i++ {
+		r = execJS(t, e, source, defaultEnv(), getReq("http://localhost/?rounds=8"))
+		assertOK(t, r)
+		if string(r.Response.Body) != "8" {
+			t.Errorf("body = %q, want 8", r.Response.Body)
+		}
+	}
+}
+
+func TestPool_DisabledGlobals(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.DisabledGlobals = []string{"fetch", "crypto", "WebSocket", "caches", "navigator.sendBeacon", "missing.parent"}
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	siteID := "pool-disabled-globals"
+	source := `export default {
+  async fetch(request, env) {
+    let called;
+    try { await fetch("https://example.com/"); called = "fetched"; } catch (e) { called = e.constructor.name; }
+    const random = Math.random();
+    const result = {
+      fetch: typeof fetch,
+      inGlobal: "fetch" in globalThis,
+      called,
+      crypto: typeof crypto,
+      random: random >= 0 && random < 1,
+      webSocket: typeof WebSocket,
+      response: typeof Response,
+      navigator: typeof navigator,
+      sendBeacon: typeof navigator.sendBeacon,
+      fetchBridge: typeof __fetchStart,
+      digestBridge: typeof __cryptoDigest,
+      randomBridge: typeof __cryptoGetRandomBytes,
+      beaconBridge: typeof __sendBeacon,
+      caches: typeof caches,
+      cacheBridge: typeof __cache_delete_all,
+    };
+    // A request cannot restore a disabled global for the next one.
+    globalThis.fetch = () => "smuggled";
+    return Response.json(result);
+  },
+};`
+	if _, err := e.CompileAndCache(siteID, "deploy1", source); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+
+		var data map[string]any
+		if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		want := map[string]any{
+			"fetch":        "undefined",
+			"inGlobal":     false,
+			"called":       "ReferenceError",
+			"crypto":       "undefined",
+			"random":       true,
+			"webSocket":    "undefined",
+			"response":     "function",
+			"navigator":    "object",
+			"sendBeacon":   "undefined",
+			"fetchBridge":  "undefined",
+			"digestBridge": "undefined",
+			"randomBridge": "undefined",
+			"beaconBridge": "undefined",
+			"caches":       "undefined",
+			"cacheBridge":  "undefined",
+		}
+		for k, v := range want {
+			if data[k] != v {
+				t.Errorf("request %d: %s = %v, want %v", i+1, k, data[k], v)
+			}
+		}
+	}
+
+	// Pool cleanup must still succeed with these globals gone, or every
+	// request would pay for a new runtime.
+	for _, st := range e.Stats() {
+		if st.SiteID != siteID {
+			continue
+		}
+		if st.Live != 1 || st.Gets != 2 {
+			t.Errorf("Live = %d, Gets = %d; want 1, 2 (worker reused)", st.Live, st.Gets)
+		}
+		return
+	}
+	t.Fatal("pool missing from Stats")
+}
+
+// TestPool_DisabledCryptoKeepsWorker verifies that withdrawing crypto does
+// not break the Math.random reseed in pool cleanup, which would discard the
+// worker after every request.
+func TestPool_DisabledCryptoKeepsWorker(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.DisabledGlobals = []string{"crypto"}
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	siteID := "pool-no-crypto"
+	src := `export default {
+  fetch() {
+    const r = Math.random();
+    return new Response(typeof crypto + " " + (r >= 0 && r < 1));
+  },
+};`
+	if _, err := e.CompileAndCache(siteID, "deploy1", src); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+		if got := string(r.Response.Body); got != "undefined true" {
+			t.Fatalf("request %d: body = %q, want %q", i+1, got, "undefined true")
+		}
+	}
+
+	for _, st := range e.Stats() {
+		if st.SiteID != siteID {
+			continue
+		}
+		if st.Live != 1 || st.Gets != 2 {
+			t.Errorf("Live = %d, Gets = %d; want 1, 2 (worker reused)", st.Live, st.Gets)
+		}
+		return
+	}
+	t.Fatal("pool missing from Stats")
+}
+
+func TestPool_DisabledCryptoSubtleWithdrawsBridges(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.DisabledGlobals = []string{"crypto.subtle"}
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	// Every __crypto* global left behind is called; only the bridges of
+	// crypto APIs that are still enabled may remain.
+	source := `export default {
+  fetch(request, env) {
+    const called = [];
+    for (const name of Object.getOwnPropertyNames(globalThis)) {
+      if (!name.startsWith("__crypto") || typeof globalThis[name] !== "function") continue;
+      try { globalThis[name]("AES-CBC", "", "", ""); } catch (e) {}
+      called.push(name);
+    }
+    return Response.json(called.sort());
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var called []string
+	if err := json.Unmarshal(r.Response.Body, &called); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := []string{
+		"__cryptoDigestStreamCreate", "__cryptoDigestStreamFinish", "__cryptoDigestStreamWrite",
+		"__cryptoGetRandomBytes", "__cryptoRandomUUID",
+	}
+	if strings.Join(called, ",") != strings.Join(want, ",") {
+		t.Errorf("callable crypto bridges = %v, want %v", called, want)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Pool metrics
+// ---------------------------------------------------------------------------
+
+// TestPool_StatsReflectCheckedOutWorker verifies that Engine.Stats reports a
+// worker as in use while a request holds it and releases it afterwards.
+func TestPool_StatsReflectCheckedOutWorker(t *testing.T) {
+	e := newTestEngine(t)
+
+	siteID := "pool-stats"
+	src := `export default {
+  async fetch(request) {
+    await scheduler.wait(300);
+    return new Response("done");
+  },
+};`
+	if _, err := e.CompileAndCache(siteID, "deploy1", src); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	done := make(chan *WorkerResult, 1)
+	go func() {
+		done <- e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+	}()
+
+	findStats := func() (PoolStats, bool) {
+		for _, st := range e.Stats() {
+			if st.SiteID == siteID && st.DeployKey == "deploy1" {
+				return st, true
+			}
+		}
+		return PoolStats{}, false
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var busy PoolStats
+	for {
+		st, ok := findStats()
+		if ok && st.InUse == 1 {
+			busy = st
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("in-use count never reached 1, last stats = %+v", st)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if busy.Size != testCfg().PoolSize {
+		t.Errorf("Size = %d, want %d", busy.Size, testCfg().PoolSize)
+	}
+	if busy.Gets != 1 {
+		t.Errorf("Gets = %d, want 1", busy.Gets)
+	}
+
+	r := <-done
+	assertOK(t, r)
+
+	idle, ok := findStats()
+	if !ok {
+		t.Fatal("pool missing from Stats after request")
+	}
+	if idle.InUse != 0 {
+		t.Errorf("InUse after request = %d, want 0", idle.InUse)
+	}
+	if idle.Gets != 1 {
+		t.Errorf("Gets after request = %d, want 1", idle.Gets)
+	}
+}
+
+// TestPool_GrowsUnderLoadAndShrinks verifies that a pool with MaxPoolSize
+// above PoolSize creates extra workers while all are busy and reclaims them
+// after PoolIdleTimeout.
+func TestPool_GrowsUnderLoadAndShrinks(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxPoolSize = 3
+	cfg.PoolIdleTimeout = 100
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	siteID := "pool-grow"
+	src := `export default {
+  async fetch(request) {
+    await scheduler.wait(300);
+    return new Response("ok");
+  },
+};`
+	if _, err := e.CompileAndCache(siteID, "deploy1", src); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	live := func() int {
+		for _, st := range e.Stats() {
+			if st.SiteID == siteID {
+				return st.Live
+			}
+		}
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+			if r.Error != nil {
+				errs <- r.Error
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	peak := 0
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-time.After(5 * time.Millisecond):
+		}
+		if n := live(); n > peak {
+			peak = n
+		}
+	}
+	close(errs)
+	for err := range errs {
+		t.Errorf("execute: %v", err)
+	}
+
+	if peak <= cfg.PoolSize {
+		t.Errorf("peak live workers = %d, want more than PoolSize %d", peak, cfg.PoolSize)
+	}
+	if peak > cfg.MaxPoolSize {
+		t.Errorf("peak live workers = %d, exceeds MaxPoolSize %d", peak, cfg.MaxPoolSize)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for live() != cfg.PoolSize {
+		if time.Now().After(deadline) {
+			t.Fatalf("live workers = %d after idle timeout, want %d", live(), cfg.PoolSize)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestPool_ShutdownDrainsInFlight verifies that Shutdown waits for a running
+// execution to finish before disposing of the pools and rejects new work.
+func TestPool_ShutdownDrainsInFlight(t *testing.T) {
+	e := newTestEngine(t)
+
+	siteID := "pool-shutdown"
+	src := `export default {
+  async fetch(request) {
+    await scheduler.wait(300);
+    return new Response("finished");
+  },
+};`
+	if _, err := e.CompileAndCache(siteID, "deploy1", src); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	var finished time.Time
+	done := make(chan *WorkerResult, 1)
+	go func() {
+		r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+		finished = time.Now()
+		done <- r
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := e.Stats()
+		if len(stats) == 1 && stats[0].InUse == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("execution never started, stats = %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	e.Shutdown()
+	shutdownReturned := time.Now()
+
+	r := <-done
+	assertOK(t, r)
+	if string(r.Response.Body) != "finished" {
+		t.Errorf("body = %q, want finished", r.Response.Body)
+	}
+	if finished.After(shutdownReturned) {
+		t.Error("Shutdown returned before the in-flight execution finished")
+	}
+
+	late := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+	if !errors.Is(late.Error, ErrEngineShutdown) {
+		t.Errorf("execution after Shutdown: error = %v, want ErrEngineShutdown", late.Error)
+	}
+}
+
+// TestPool_SourceChangeInvalidatesPool verifies that recompiling a different
+// source under the same deploy key replaces the pool and its source hash.
+func TestPool_SourceChangeInvalidatesPool(t *testing.T) {
+	e := newTestEngine(t)
+
+	siteID := "pool-source-hash"
+	v1 := `export default { fetch() { return new Response("v1"); } };`
+	v2 := `export default { fetch() { return new Response("v2"); } };`
+
+	if _, ok := e.SourceHash(siteID, "deploy1"); ok {
+		t.Fatal("SourceHash reported a hash before any source was cached")
+	}
+
+	if _, err := e.CompileAndCache(siteID, "deploy1", v1); err != nil {
+		t.Fatalf("compile v1: %v", err)
+	}
+	h1, ok := e.SourceHash(siteID, "deploy1")
+	sum := sha256.Sum256([]byte(v1))
+	if !ok || h1 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("SourceHash = %q, %v; want sha256 of v1", h1, ok)
+	}
+	r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if string(r.Response.Body) != "v1" {
+		t.Fatalf("body = %q, want v1", r.Response.Body)
+	}
+
+	if _, err := e.CompileAndCache(siteID, "deploy1", v2); err != nil {
+		t.Fatalf("compile v2: %v", err)
+	}
+	h2, _ := e.SourceHash(siteID, "deploy1")
+	if h2 == h1 {
+		t.Error("SourceHash did not change with the source")
+	}
+	for i := 0; i < testCfg().PoolSize+1; i++ {
+		r = e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+		if string(r.Response.Body) != "v2" {
+			t.Fatalf("request %d after recompiling: body = %q, want v2", i, r.Response.Body)
+		}
+	}
+
+	// Recompiling identical source keeps the hash stable.
+	if _, err := e.CompileAndCache(siteID, "deploy1", v2); err != nil {
+		t.Fatalf("recompile v2: %v", err)
+	}
+	if h, _ := e.SourceHash(siteID, "deploy1"); h != h2 {
+		t.Errorf("SourceHash for identical source = %q, want %q", h, h2)
+	}
+}
+
+// TestEngine_WarmBuildsPoolBeforeTraffic verifies that Warm loads the
+// source and evaluates the module in every pooled worker, so the first
+// Execute reuses them instead of paying the cold start.
+func TestEngine_WarmBuildsPoolBeforeTraffic(t *testing.T) {
+	siteID := "warm-site"
+	loader := &mockSourceLoader{scripts: map[string]string{
+		siteID + ":deploy1": `const loadedAt = Date.now();
+export default {
+  fetch() {
+    return new Response(String(loadedAt));
+  },
+};`,
+	}}
+	e := NewEngine(testCfg(), loader)
+	t.Cleanup(func() { e.Shutdown() })
+
+	if err := e.Warm(siteID, "deploy1"); err != nil {
+		t.Fatalf("Warm: %v", err)
+	}
+	warmed := time.Now()
+
+	var st PoolStats
+	var found bool
+	for _, s := range e.Stats() {
+		if s.SiteID == siteID && s.DeployKey == "deploy1" {
+			st, found = s, true
+		}
+	}
+	if !found {
+		t.Fatal("Warm did not create a pool")
+	}
+	if st.Live != testCfg().PoolSize || st.Gets != 0 {
+		t.Errorf("after Warm: Live = %d, Gets = %d; want %d, 0", st.Live, st.Gets, testCfg().PoolSize)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	var loadedAt int64
+	if _, err := fmt.Sscan(string(r.Response.Body), &loadedAt); err != nil {
+		t.Fatalf("parsing body %q: %v", r.Response.Body, err)
+	}
+	if loadedAt > warmed.UnixMilli() {
+		t.Errorf("module evaluated at %d, after Warm returned at %d", loadedAt, warmed.UnixMilli())
+	}
+
+	if err := e.Warm("missing-site", "deploy1"); err == nil {
+		t.Error("Warm with no source should fail")
+	}
+	e.Shutdown()
+	if err := e.Warm(siteID, "deploy1"); !errors.Is(err, ErrEngineShutdown) {
+		t.Errorf("Warm after Shutdown = %v, want ErrEngineShutdown", err)
+	}
+}
+
+// metaSourceLoader is a ContextSourceLoader whose scripts carry
+// caller-chosen metadata, so a test can tell whether the engine trusts it.
+type metaSourceLoader struct {
+	mu     sync.Mutex
+	source string
+	meta   SourceMeta
+	loads  int
+}
+
+func (m *metaSourceLoader) GetWorkerScript(siteID, deployKey string) (string, error) {
+	return "", errors.New("GetWorkerScript called on a ContextSourceLoader")
+}
+
+func (m *metaSourceLoader) LoadWorkerScript(ctx context.Context, siteID, deployKey string) (string, SourceMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return "", SourceMeta{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loads++
+	return m.source, m.meta, nil
+}
+
+func (m *metaSourceLoader) loadCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loads
+}
+
+func (m *metaSourceLoader) set(source, hash string) {
+	m.setMeta(source, SourceMeta{Hash: hash})
+}
+
+func (m *metaSourceLoader) setMeta(source string, meta SourceMeta) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.source, m.meta = source, meta
+}
+
+// TestEngine_RefreshSourceSkipsUnchangedHash verifies that RefreshSource
+// keeps the existing pool when the loader reports the same hash, and
+// rebuilds it when the hash changes.
+func TestEngine_RefreshSourceSkipsUnchangedHash(t *testing.T) {
+	const siteID, deployKey = "refresh-site", "deploy1"
+	script := func(name string) string {
+		return `const instance = "` + name + `:" + Math.random();
+export default { fetch() { return new Response(instance); } };`
+	}
+	loader := &metaSourceLoader{}
+	loader.set(script("v1"), "hash-v1")
+
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	e := NewEngine(cfg, loader)
+	t.Cleanup(func() { e.Shutdown() })
+
+	body := func() string {
+		t.Helper()
+		r := e.Execute(siteID, deployKey, defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+		return string(r.Response.Body)
+	}
+
+	first := body()
+	if hash, _ := e.SourceHash(siteID, deployKey); hash != "hash-v1" {
+		t.Errorf("SourceHash = %q, want the loader's hash-v1", hash)
+	}
+
+	// New content under the same hash: the engine trusts the hash and keeps
+	// the pool that already evaluated the module.
+	loader.set(script("v2"), "hash-v1")
+	changed, err := e.RefreshSource(context.Background(), siteID, deployKey)
+	if err != nil || changed {
+		t.Fatalf("RefreshSource = %v, %v; want false, nil", changed, err)
+	}
+	if got := body(); got != first {
+		t.Errorf("after unchanged refresh body = %q, want %q (no recompilation)", got, first)
+	}
+
+	loader.set(script("v2"), "hash-v2")
+	changed, err = e.RefreshSource(context.Background(), siteID, deployKey)
+	if err != nil || !changed {
+		t.Fatalf("RefreshSource = %v, %v; want true, nil", changed, err)
+	}
+	if got := body(); !strings.HasPrefix(got, "v2:") {
+		t.Errorf("after changed refresh body = %q, want the v2 script", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.RefreshSource(ctx, siteID, deployKey); !errors.Is(err, context.Canceled) {
+		t.Errorf("RefreshSource with cancelled context = %v, want context.Canceled", err)
+	}
+	if n := loader.loadCount(); n != 3 {
+		t.Errorf("loader calls = %d, want 3", n)
+	}
+}
+
+// TestEngine_RefreshSourceUsesLastModified verifies that the engine keeps
+// the loader's bytecode flag and last-modified time, and that a refresh
+// whose script is no newer than the cached one does not rebuild the pool.
+func TestEngine_RefreshSourceUsesLastModified(t *testing.T) {
+	const siteID, deployKey = "refresh-modified", "deploy1"
+	script := func(name string) string {
+		return `const instance = "` + name + `:" + Math.random();
+export default { fetch() { return new Response(instance); } };`
+	}
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	loader := &metaSourceLoader{}
+	loader.setMeta(script("v1"), SourceMeta{HasBytecode: true, LastModified: modified})
+
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	e := NewEngine(cfg, loader)
+	t.Cleanup(func() { e.Shutdown() })
+
+	body := func() string {
+		t.Helper()
+		r := e.Execute(siteID, deployKey, defaultEnv(), getReq("http://localhost/"))
+		assertOK(t, r)
+		return string(r.Response.Body)
+	}
+
+	first := body()
+	meta, ok := e.SourceMeta(siteID, deployKey)
+	if !ok || !meta.HasBytecode || !meta.LastModified.Equal(modified) {
+		t.Errorf("SourceMeta = %+v, %v; want HasBytecode and LastModified from the loader", meta, ok)
+	}
+	if h, _ := e.SourceHash(siteID, deployKey); h != meta.Hash || h == "" {
+		t.Errorf("SourceHash = %q, want the computed hash %q", h, meta.Hash)
+	}
+
+	// A stale copy with different content but an older timestamp is skipped.
+	loader.setMeta(script("stale"), SourceMeta{LastModified: modified.Add(-time.Hour)})
+	changed, err := e.RefreshSource(context.Background(), siteID, deployKey)
+	if err != nil || changed {
+		t.Fatalf("RefreshSource with older script = %v, %v; want false, nil", changed, err)
+	}
+	if got := body(); got != first {
+		t.Errorf("after stale refresh body = %q, want %q (no recompilation)", got, first)
+	}
+
+	loader.setMeta(script("v2"), SourceMeta{LastModified: modified.Add(time.Hour)})
+	changed, err = e.RefreshSource(context.Background(), siteID, deployKey)
+	if err != nil || !changed {
+		t.Fatalf("RefreshSource with newer script = %v, %v; want true, nil", changed, err)
+	}
+	if got := body(); !strings.HasPrefix(got, "v2:") {
+		t.Errorf("after newer refresh body = %q, want the v2 script", got)
+	}
+	if meta, _ := e.SourceMeta(siteID, deployKey); meta.HasBytecode {
+		t.Error("SourceMeta still reports bytecode after the loader stopped offering it")
+	}
+}
+
+func TestPool_AllocationChurnLimitStopsExecution(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxAllocationBytes = 16 << 20
+	cfg.ExecutionTimeout = 10000
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	// Catching every RangeError would keep this loop going until the
+	// execution timeout; crossing the limit has to stop it straight away.
+	source := `export default {
+  async fetch(request) {
+    await null;
+    for (;;) {
+      try { new Uint8Array(1 << 20); } catch (e) {}
+    }
+  },
+};`
+
+	start := time.Now()
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	if r.Error == nil || !strings.Contains(r.Error.Error(), "allocation limit") {
+		t.Fatalf("error = %v, want allocation limit", r.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("execution took %v; the limit did not stop it", elapsed)
+	}
+
+	r = execJS(t, e, `export default { fetch() { return new Response("ok"); } };`, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+}
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -88,11 +89,51 @@ func TestResponseLimit_OverLimitErrors(t *testing.T) {
 	}
 	r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
 	if r.Error == nil {
-		// Some engines may truncate rather than error; log and accept.
-		t.Logf("over-limit: no error (engine may truncate), body len = %d", len(r.Response.Body))
-		return
+		t.Fatalf("over-limit response should fail, got body len = %d", len(r.Response.Body))
+	}
+	if !strings.Contains(r.Error.Error(), "response body too large") {
+		t.Errorf("error = %v, want a 'response body too large' error", r.Error)
+	}
+	if r.Response != nil {
+		t.Error("over-limit response should not be returned")
+	}
+}
+
+// TestRequestLimit_OverLimitRejected verifies that an incoming request body
+// larger than MaxRequestBytes is rejected before the worker runs.
+func TestRequestLimit_OverLimitRejected(t *testing.T) {
+	cfg := testCfg()
+	cfg.MaxRequestBytes = 64
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  async fetch(request, env) {
+    console.log("handler ran");
+    return new Response(await request.text());
+  },
+};`
+
+	siteID := "test-" + t.Name()
+	if _, err := e.CompileAndCache(siteID, "deploy1", source); err != nil {
+		t.Fatalf("CompileAndCache: %v", err)
+	}
+
+	small := &WorkerRequest{Method: "POST", URL: "http://localhost/", Headers: map[string]string{}, Body: []byte("ok")}
+	r := e.Execute(siteID, "deploy1", defaultEnv(), small)
+	assertOK(t, r)
+
+	big := &WorkerRequest{Method: "POST", URL: "http://localhost/", Headers: map[string]string{}, Body: []byte(strings.Repeat("z", 65))}
+	r = e.Execute(siteID, "deploy1", defaultEnv(), big)
+	if r.Error == nil {
+		t.Fatal("over-limit request should fail")
+	}
+	if !strings.Contains(r.Error.Error(), "request body too large") {
+		t.Errorf("error = %v, want a 'request body too large' error", r.Error)
+	}
+	if len(r.Logs) != 0 {
+		t.Errorf("worker should not run for an over-limit request, got logs %v", r.Logs)
 	}
-	t.Logf("over-limit error: %v", r.Error)
 }
 
 // TestResponseLimit_EngineRecoveryAfterOverLimit verifies that after a
@@ -257,3 +298,60 @@ func TestResponseLimit_StreamingBodyWithinLimit(t *testing.T) {
 		t.Errorf("body = %q, want both 'chunk1' and 'chunk2'", body)
 	}
 }
+
+// TestHeaderLimits_ResponseAndRequest verifies that MaxHeaderCount and
+// MaxHeaderBytes reject oversized worker responses and incoming requests.
+func TestHeaderLimits_ResponseAndRequest(t *testing.T) {
+	cfg := testCfg()
+	cfg.MaxHeaderCount = 8
+	cfg.MaxHeaderBytes = 512
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  fetch(request, env) {
+    const url = new URL(request.url);
+    const headers = new Headers();
+    const n = Number(url.searchParams.get("n") || "0");
+    for (let i = 0; i < n; i++) headers.append("x-h" + i, "v");
+    const cookies = Number(url.searchParams.get("cookies") || "0");
+    for (let i = 0; i < cookies; i++) headers.append("set-cookie", "c" + i + "=1");
+    if (url.searchParams.has("big")) headers.set("x-big", "b".repeat(600));
+    return new Response("ok", { headers });
+  },
+};`
+
+	siteID := "test-" + t.Name()
+	if _, err := e.CompileAndCache(siteID, "deploy1", source); err != nil {
+		t.Fatalf("CompileAndCache: %v", err)
+	}
+
+	r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/?n=4"))
+	assertOK(t, r)
+
+	cases := map[string]string{
+		"count":        "http://localhost/?n=20",
+		"set-cookie":   "http://localhost/?cookies=9",
+		"header bytes": "http://localhost/?big=1",
+	}
+	for name, url := range cases {
+		r := e.Execute(siteID, "deploy1", defaultEnv(), getReq(url))
+		if r.Error == nil {
+			t.Errorf("%s: over-limit response headers should fail", name)
+			continue
+		}
+		if !strings.Contains(r.Error.Error(), "response headers too large") {
+			t.Errorf("%s: error = %v, want a 'response headers too large' error", name, r.Error)
+		}
+	}
+
+	headers := map[string]string{}
+	for i := 0; i < 9; i++ {
+		headers[fmt.Sprintf("x-in%d", i)] = "v"
+	}
+	req := &WorkerRequest{Method: "GET", URL: "http://localhost/", Headers: headers}
+	r = e.Execute(siteID, "deploy1", defaultEnv(), req)
+	if r.Error == nil || !strings.Contains(r.Error.Error(), "request headers too large") {
+		t.Errorf("over-limit request headers: error = %v, want a 'request headers too large' error", r.Error)
+	}
+}
@@ -501,3 +501,88 @@ func TestTailHandler_EmptyEvents(t *testing.T) {
 		t.Error("events should be an array")
 	}
 }
+
+func TestScheduledEvent_CFMetadata(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch() { return new Response("ok"); },
+  scheduled(event, env, ctx) {
+    console.log(JSON.stringify({
+      colo: event.cf.colo,
+      region: event.cf.region,
+      branch: event.cf.region === "eu-west" ? "eu" : "other",
+    }));
+  },
+};`
+	siteID := "test-sched-cf"
+	deployKey := "deploy1"
+	if _, err := e.CompileAndCache(siteID, deployKey, source); err != nil {
+		t.Fatalf("CompileAndCache: %v", err)
+	}
+
+	result := e.ExecuteScheduledWithCF(siteID, deployKey, defaultEnv(), "0 * * * *",
+		map[string]any{"colo": "AMS", "region": "eu-west"})
+	if result.Error != nil {
+		t.Fatalf("ExecuteScheduledWithCF: %v", result.Error)
+	}
+	if len(result.Logs) == 0 {
+		t.Fatal("expected logs from scheduled handler")
+	}
+	var data map[string]string
+	if err := json.Unmarshal([]byte(result.Logs[0].Message), &data); err != nil {
+		t.Fatalf("unmarshal log: %v", err)
+	}
+	if data["colo"] != "AMS" || data["region"] != "eu-west" || data["branch"] != "eu" {
+		t.Errorf("cf as seen by handler = %v, want colo AMS, region eu-west", data)
+	}
+
+	// Without metadata event.cf is an empty object, so handlers can read
+	// from it unconditionally.
+	result = e.ExecuteScheduled(siteID, deployKey, defaultEnv(), "0 * * * *")
+	if result.Error != nil {
+		t.Fatalf("ExecuteScheduled: %v", result.Error)
+	}
+	if len(result.Logs) == 0 || result.Logs[0].Message != `{"branch":"other"}` {
+		t.Errorf("logs without cf = %v, want {\"branch\":\"other\"}", result.Logs)
+	}
+}
+
+// TestScheduled_AllocationLimitDiscardsWorker verifies that a scheduled
+// run that crosses MaxAllocationBytes does not return its runtime to the
+// pool, even when the handler swallows the errors and completes.
+func TestScheduled_AllocationLimitDiscardsWorker(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxAllocationBytes = 16 << 20
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `let runs = 0;
+export default {
+  fetch() { return new Response(String(runs)); },
+  scheduled() {
+    runs++;
+    for (let i = 0; i < 64; i++) {
+      try { new Uint8Array(1 << 20).fill(1); } catch (e) {}
+    }
+  },
+};`
+	siteID := "test-sched-alloc"
+	deployKey := "deploy1"
+	if _, err := e.CompileAndCache(siteID, deployKey, source); err != nil {
+		t.Fatalf("CompileAndCache: %v", err)
+	}
+
+	result := e.ExecuteScheduled(siteID, deployKey, defaultEnv(), "* * * * *")
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "allocation limit") {
+		t.Fatalf("ExecuteScheduled error = %v, want allocation limit", result.Error)
+	}
+
+	// A fresh runtime has not run the scheduled handler.
+	r := e.Execute(siteID, deployKey, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if got := string(r.Response.Body); got != "0" {
+		t.Errorf("runs seen by the next request = %s, want 0 (worker discarded)", got)
+	}
+}
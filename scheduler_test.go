@@ -203,3 +203,107 @@ func TestScheduler_WaitNoArgs(t *testing.T) {
 		t.Error("scheduler.wait() with no args should resolve")
 	}
 }
+
+func TestScheduler_Yield(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const order = [];
+    setTimeout(() => order.push('timer'), 0);
+    queueMicrotask(() => order.push('microtask'));
+    await scheduler.yield();
+    order.push('yielded');
+    await scheduler.wait(5);
+    order.push('waited');
+    return Response.json({ order });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Order []string `json:"order"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	want := []string{"microtask", "timer", "yielded", "waited"}
+	if len(data.Order) != len(want) {
+		t.Fatalf("order = %v, want %v", data.Order, want)
+	}
+	for i := range want {
+		if data.Order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", data.Order, want)
+		}
+	}
+}
+
+func TestScheduler_WaitAbortSignal(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const controller = new AbortController();
+    const pending = scheduler.wait(1000, { signal: controller.signal });
+    controller.abort();
+    let name = null;
+    try { await pending; } catch (e) { name = e.name; }
+    return Response.json({ name });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Name != "AbortError" {
+		t.Errorf("aborted wait rejected with %q, want AbortError", data.Name)
+	}
+}
+
+func TestScheduler_WaitReleasesAbortListener(t *testing.T) {
+	e := newTestEngine(t)
+
+	// A long-lived signal shared by many waits must not keep a listener
+	// for each one that has already resolved.
+	source := `export default {
+  async fetch(request, env) {
+    const controller = new AbortController();
+    for (let i = 0; i < 20; i++) {
+      await scheduler.wait(0, { signal: controller.signal });
+      await scheduler.postTask(() => i, { signal: controller.signal });
+    }
+    const listeners = (controller.signal._listeners.abort || []).length;
+    const pending = scheduler.wait(1000, { signal: controller.signal });
+    controller.abort();
+    let name = null;
+    try { await pending; } catch (e) { name = e.name; }
+    return Response.json({ listeners, name });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Listeners int    `json:"listeners"`
+		Name      string `json:"name"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Listeners != 0 {
+		t.Errorf("abort listeners left after 40 settled waits = %d, want 0", data.Listeners)
+	}
+	if data.Name != "AbortError" {
+		t.Errorf("aborted wait rejected with %q, want AbortError", data.Name)
+	}
+}
@@ -105,6 +105,68 @@ func TestServiceBinding_FetchCallsTarget(t *testing.T) {
 	}
 }
 
+func TestServiceBinding_PreservesSetCookieList(t *testing.T) {
+	e := newTestEngine(t)
+
+	targetSource := `export default {
+  async fetch(request, env) {
+    const headers = new Headers({ "content-type": "text/plain" });
+    headers.append("Set-Cookie", "a=1; Path=/; Expires=Wed, 21 Oct 2026 07:28:00 GMT");
+    headers.append("Set-Cookie", "b=2; HttpOnly");
+    return new Response("ok", { headers });
+  },
+};`
+	targetSiteID := "sb-cookie-target"
+	targetDeployKey := "deploy1"
+	if _, err := e.CompileAndCache(targetSiteID, targetDeployKey, targetSource); err != nil {
+		t.Fatalf("CompileAndCache target: %v", err)
+	}
+
+	callerSource := `export default {
+  async fetch(request, env) {
+    const resp = await env.TARGET.fetch("https://fake-host/cookies");
+    return Response.json({
+      cookies: resp.headers.getSetCookie(),
+      contentType: resp.headers.get("content-type"),
+    });
+  },
+};`
+
+	env := &Env{
+		Vars:    make(map[string]string),
+		Secrets: make(map[string]string),
+		ServiceBindings: map[string]ServiceBindingConfig{
+			"TARGET": {
+				TargetSiteID:    targetSiteID,
+				TargetDeployKey: targetDeployKey,
+			},
+		},
+	}
+
+	r := execJS(t, e, callerSource, env, getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Cookies     []string `json:"cookies"`
+		ContentType string   `json:"contentType"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a=1; Path=/; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "b=2; HttpOnly"}
+	if len(data.Cookies) != len(want) {
+		t.Fatalf("getSetCookie() = %q, want %q", data.Cookies, want)
+	}
+	for i := range want {
+		if data.Cookies[i] != want[i] {
+			t.Errorf("cookie %d = %q, want %q", i, data.Cookies[i], want[i])
+		}
+	}
+	if data.ContentType != "text/plain" {
+		t.Errorf("content-type = %q, want text/plain", data.ContentType)
+	}
+}
+
 func TestServiceBinding_Construction(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -630,3 +692,67 @@ func TestServiceBinding_TargetGetsOwnEnv(t *testing.T) {
 		t.Errorf("caller's CALLER_SECRET leaked to target: got %q", data.CallerLeak)
 	}
 }
+
+// peerDispatcher gives each target worker a PEER binding to the other site
+// before running it, so the two workers call each other.
+type peerDispatcher struct {
+	e     *Engine
+	peers map[string]string // siteID -> PEER siteID
+}
+
+func (d *peerDispatcher) Execute(siteID, deployKey string, env *Env, req *WorkerRequest) *WorkerResult {
+	env.ServiceBindings = map[string]ServiceBindingConfig{
+		"PEER": {TargetSiteID: d.peers[siteID], TargetDeployKey: deployKey},
+	}
+	env.Dispatcher = d
+	return d.e.Execute(siteID, deployKey, env, req)
+}
+
+func TestServiceBinding_MaxDepth(t *testing.T) {
+	cfg := testCfg()
+	cfg.MaxServiceBindingDepth = 3
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	// Each worker forwards to its peer and reports how deep it was when the
+	// peer call was rejected.
+	source := `export default {
+  async fetch(request, env) {
+    const hops = Number(new URL(request.url).searchParams.get("hops") || 0);
+    try {
+      const resp = await env.PEER.fetch("https://fake-host/?hops=" + (hops + 1));
+      return new Response(await resp.text());
+    } catch (e) {
+      return Response.json({ hops, error: e.message });
+    }
+  },
+};`
+	for _, site := range []string{"sb-ping", "sb-pong"} {
+		if _, err := e.CompileAndCache(site, "deploy1", source); err != nil {
+			t.Fatalf("CompileAndCache %s: %v", site, err)
+		}
+	}
+	d := &peerDispatcher{e: e, peers: map[string]string{"sb-ping": "sb-pong", "sb-pong": "sb-ping"}}
+
+	env := defaultEnv()
+	env.Dispatcher = d
+	env.ServiceBindings = map[string]ServiceBindingConfig{
+		"PEER": {TargetSiteID: "sb-pong", TargetDeployKey: "deploy1"},
+	}
+	r := e.Execute("sb-ping", "deploy1", env, getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Hops  int    `json:"hops"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal %q: %v", r.Response.Body, err)
+	}
+	if data.Hops != 3 {
+		t.Errorf("rejected at hops = %d, want 3", data.Hops)
+	}
+	if !strings.Contains(data.Error, "maximum subrequest depth") {
+		t.Errorf("error = %q, want subrequest depth error", data.Error)
+	}
+}
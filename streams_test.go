@@ -2,7 +2,9 @@ package worker
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestStreams_ReadableStreamBasic(t *testing.T) {
@@ -485,6 +487,89 @@ func TestStreams_ReadableStreamWithPull(t *testing.T) {
 	}
 }
 
+func TestStreams_PullRespectsHighWaterMark(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const tick = () => new Promise(r => setTimeout(r, 5));
+
+    let pulls = 0, active = 0, overlapped = false, next = 0;
+    const stream = new ReadableStream({
+      async pull(controller) {
+        pulls++;
+        if (active++ > 0) overlapped = true;
+        await tick();
+        controller.enqueue(next++);
+        active--;
+      }
+    }, { highWaterMark: 2 });
+
+    await tick(); await tick(); await tick();
+    const idlePulls = pulls;
+    const reader = stream.getReader();
+    const first = await reader.read();
+    await tick(); await tick();
+    const afterOneRead = pulls;
+
+    let lazyPulls = 0;
+    const lazy = new ReadableStream({
+      pull(controller) { lazyPulls++; controller.enqueue("x"); }
+    }, { highWaterMark: 0 });
+    await tick();
+    const lazyIdle = lazyPulls;
+    await lazy.getReader().read();
+
+    let bytePulls = 0;
+    const sized = new ReadableStream({
+      pull(controller) { bytePulls++; controller.enqueue(new Uint8Array(4)); }
+    }, new ByteLengthQueuingStrategy({ highWaterMark: 10 }));
+    await tick();
+
+    return Response.json({
+      idlePulls, afterOneRead, first: first.value, overlapped,
+      desiredSize: sized._controller.desiredSize,
+      lazyIdle, lazyAfterRead: lazyPulls, bytePulls,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		IdlePulls     int  `json:"idlePulls"`
+		AfterOneRead  int  `json:"afterOneRead"`
+		First         int  `json:"first"`
+		Overlapped    bool `json:"overlapped"`
+		DesiredSize   int  `json:"desiredSize"`
+		LazyIdle      int  `json:"lazyIdle"`
+		LazyAfterRead int  `json:"lazyAfterRead"`
+		BytePulls     int  `json:"bytePulls"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.IdlePulls != 2 {
+		t.Errorf("pulls with no reader = %d, want 2 (highWaterMark)", data.IdlePulls)
+	}
+	if data.First != 0 {
+		t.Errorf("first chunk = %d, want 0", data.First)
+	}
+	if data.AfterOneRead != 3 {
+		t.Errorf("pulls after one read = %d, want 3", data.AfterOneRead)
+	}
+	if data.Overlapped {
+		t.Error("pull was invoked while a previous pull was still pending")
+	}
+	if data.LazyIdle != 0 || data.LazyAfterRead != 1 {
+		t.Errorf("highWaterMark 0 pulls: idle=%d afterRead=%d, want 0 and 1", data.LazyIdle, data.LazyAfterRead)
+	}
+	if data.BytePulls != 3 || data.DesiredSize != -2 {
+		t.Errorf("byte-length strategy: pulls=%d desiredSize=%d, want 3 and -2", data.BytePulls, data.DesiredSize)
+	}
+}
+
 func TestStreams_WriterClosedPromise(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -1430,6 +1515,84 @@ func TestResponseBody_ReturnsReadableStream(t *testing.T) {
 	}
 }
 
+func TestResponseBody_StringBodyIsStream(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const readAll = async (stream) => {
+      const reader = stream.getReader();
+      const bytes = [];
+      while (true) {
+        const { value, done } = await reader.read();
+        if (done) break;
+        bytes.push(...value);
+      }
+      return new TextDecoder().decode(new Uint8Array(bytes));
+    };
+
+    const resp = new Response("hello");
+    const usedBefore = resp.bodyUsed;
+    const text = await readAll(resp.body);
+    let rereadRejected = false;
+    try { await resp.text(); } catch (e) { rereadRejected = e instanceof TypeError; }
+
+    const [a, b] = new Response("hello").body.tee();
+    const teed = [await readAll(a), await readAll(b)];
+
+    const consumed = new Response("hello");
+    await consumed.text();
+    let secondTextRejected = false;
+    try { await consumed.text(); } catch (e) { secondTextRejected = e instanceof TypeError; }
+
+    return Response.json({
+      usedBefore,
+      text,
+      usedAfter: resp.bodyUsed,
+      rereadRejected,
+      teed,
+      consumedUsed: consumed.bodyUsed,
+      secondTextRejected,
+      nullBody: new Response(null).body === null,
+    });
+  },
+};`
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		UsedBefore         bool     `json:"usedBefore"`
+		Text               string   `json:"text"`
+		UsedAfter          bool     `json:"usedAfter"`
+		RereadRejected     bool     `json:"rereadRejected"`
+		Teed               []string `json:"teed"`
+		ConsumedUsed       bool     `json:"consumedUsed"`
+		SecondTextRejected bool     `json:"secondTextRejected"`
+		NullBody           bool     `json:"nullBody"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.UsedBefore {
+		t.Error("bodyUsed should be false before reading")
+	}
+	if data.Text != "hello" {
+		t.Errorf("text from reader = %q, want 'hello'", data.Text)
+	}
+	if !data.UsedAfter || !data.RereadRejected {
+		t.Errorf("after reading .body: bodyUsed = %v, text() rejected = %v; want both true", data.UsedAfter, data.RereadRejected)
+	}
+	if len(data.Teed) != 2 || data.Teed[0] != "hello" || data.Teed[1] != "hello" {
+		t.Errorf("tee branches = %v, want [hello hello]", data.Teed)
+	}
+	if !data.ConsumedUsed || !data.SecondTextRejected {
+		t.Errorf("after text(): bodyUsed = %v, second text() rejected = %v; want both true", data.ConsumedUsed, data.SecondTextRejected)
+	}
+	if !data.NullBody {
+		t.Error("Response(null).body should be null")
+	}
+}
+
 func TestBody_NullForNullBody(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -1836,6 +1999,108 @@ func TestStreams_ReadableStreamCancelViaReader(t *testing.T) {
 	}
 }
 
+func TestStreams_CancelPropagatesToSource(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    // A source that never produces data on its own: a pending read only
+    // settles through cancellation.
+    const log = [];
+    let pulls = 0;
+    const stream = new ReadableStream({
+      start(controller) { controller.enqueue("queued"); },
+      pull() { pulls++; return new Promise(() => {}); },
+      cancel(reason) { log.push("cancel:" + reason); },
+    });
+    const reader = stream.getReader();
+    await reader.read();
+    const pending = reader.read();
+    const pullsBeforeCancel = pulls;
+    await reader.cancel("stop");
+    const afterCancel = await pending;
+    await reader.closed;
+    const lockedCancel = await stream.cancel("again").then(() => "resolved", (e) => e.name);
+
+    // Breaking out of async iteration cancels the source too.
+    const iterLog = [];
+    const iterated = new ReadableStream({
+      pull(controller) { controller.enqueue("x"); },
+      cancel(reason) { iterLog.push("cancel"); },
+    });
+    for await (const chunk of iterated) break;
+
+    // tee() cancels its source once both branches have been canceled.
+    const teeLog = [];
+    const teed = new ReadableStream({
+      start(controller) { controller.enqueue("t"); },
+      cancel(reason) { teeLog.push(JSON.stringify(reason)); },
+    });
+    const [b1, b2] = teed.tee();
+    await b1.cancel("one");
+    const afterFirst = teeLog.length;
+    await b2.cancel("two");
+
+    // A source whose cancel() rejects surfaces that to the caller.
+    const failing = new ReadableStream({ cancel() { throw new Error("boom"); } });
+    const failed = await failing.cancel().then(() => "resolved", (e) => e.message);
+
+    return Response.json({
+      log,
+      pullsBeforeCancel,
+      pullsAfterCancel: pulls,
+      afterCancel,
+      lockedCancel,
+      iterLog,
+      afterFirst,
+      teeLog,
+      failed,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Log               []string `json:"log"`
+		PullsBeforeCancel int      `json:"pullsBeforeCancel"`
+		PullsAfterCancel  int      `json:"pullsAfterCancel"`
+		AfterCancel       struct {
+			Done bool `json:"done"`
+		} `json:"afterCancel"`
+		LockedCancel string   `json:"lockedCancel"`
+		IterLog      []string `json:"iterLog"`
+		AfterFirst   int      `json:"afterFirst"`
+		TeeLog       []string `json:"teeLog"`
+		Failed       string   `json:"failed"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(data.Log) != 1 || data.Log[0] != "cancel:stop" {
+		t.Errorf("source cancel log = %v, want [cancel:stop]", data.Log)
+	}
+	if !data.AfterCancel.Done {
+		t.Error("a read pending at cancel time should resolve as done")
+	}
+	if data.PullsAfterCancel != data.PullsBeforeCancel {
+		t.Errorf("pull called %d times after cancel", data.PullsAfterCancel-data.PullsBeforeCancel)
+	}
+	if data.LockedCancel != "TypeError" {
+		t.Errorf("cancel on a locked stream = %q, want TypeError", data.LockedCancel)
+	}
+	if len(data.IterLog) != 1 {
+		t.Errorf("breaking async iteration: cancel log = %v, want one cancel", data.IterLog)
+	}
+	if data.AfterFirst != 0 || len(data.TeeLog) != 1 || data.TeeLog[0] != `["one","two"]` {
+		t.Errorf("tee cancel: after first = %d, log = %v; want 0 then [[\"one\",\"two\"]]", data.AfterFirst, data.TeeLog)
+	}
+	if data.Failed != "boom" {
+		t.Errorf("rejecting source cancel = %q, want boom", data.Failed)
+	}
+}
+
 func TestStreams_PipeThroughTransformStream(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -2062,3 +2327,83 @@ func TestStreams_TransformStreamSymbolToStringTag(t *testing.T) {
 		t.Errorf("tag = %q, want '[object TransformStream]'", data.Tag)
 	}
 }
+
+func TestStreams_ResponseNDJSON(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    async function* events() {
+      for (let i = 1; i <= 3; i++) {
+        await new Promise(r => setTimeout(r, 1));
+        yield { seq: i, msg: "line " + i };
+      }
+    }
+    if (new URL(request.url).pathname === "/raw") {
+      const enc = new TextEncoder();
+      const lines = [{ seq: 1 }, { seq: 2 }, { seq: 3 }].map(v => JSON.stringify(v) + "\n");
+      return new Response(new ReadableStream({
+        pull(controller) {
+          if (lines.length === 0) return controller.close();
+          controller.enqueue(enc.encode(lines.shift()));
+        },
+      }), { headers: { "content-type": "application/x-ndjson" } });
+    }
+    return Response.ndjson(events(), { status: 201 });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if r.Response.StatusCode != 201 {
+		t.Errorf("status = %d, want 201", r.Response.StatusCode)
+	}
+	if ct := r.Response.Headers["content-type"]; ct != "application/x-ndjson" {
+		t.Errorf("content-type = %q, want application/x-ndjson", ct)
+	}
+	want := "{\"seq\":1,\"msg\":\"line 1\"}\n{\"seq\":2,\"msg\":\"line 2\"}\n{\"seq\":3,\"msg\":\"line 3\"}\n"
+	if string(r.Response.Body) != want {
+		t.Errorf("body = %q, want %q", r.Response.Body, want)
+	}
+
+	raw := execJS(t, e, source, defaultEnv(), getReq("http://localhost/raw"))
+	assertOK(t, raw)
+	lines := strings.Split(strings.TrimSuffix(string(raw.Response.Body), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("raw body = %q, want 3 lines", raw.Response.Body)
+	}
+	for i, line := range lines {
+		var v struct {
+			Seq int `json:"seq"`
+		}
+		if err := json.Unmarshal([]byte(line), &v); err != nil || v.Seq != i+1 {
+			t.Errorf("line %d = %q (err %v)", i, line, err)
+		}
+	}
+}
+
+func TestStreams_PullResponseStopsAtMaxResponseBytes(t *testing.T) {
+	cfg := testCfg()
+	cfg.MaxResponseBytes = 64 << 10
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  fetch(request, env) {
+    const chunk = new Uint8Array(16 << 10);
+    return new Response(new ReadableStream({
+      pull(controller) { controller.enqueue(chunk); },
+    }));
+  },
+};`
+
+	start := time.Now()
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	if r.Error == nil || !strings.Contains(r.Error.Error(), "response body too large") {
+		t.Fatalf("error = %v, want response body too large", r.Error)
+	}
+	// The endless stream is abandoned at the limit, not at the timeout.
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %v, want the read to stop at the limit", elapsed)
+	}
+}
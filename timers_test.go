@@ -2,6 +2,7 @@ package worker
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -311,3 +312,112 @@ func TestTimers_SetTimeoutWithDelay(t *testing.T) {
 		t.Error("setTimeout with 20ms delay should take at least 15ms")
 	}
 }
+
+func TestTimers_MicrotasksDrainBeforeEachTimer(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const log = [];
+    const done = new Promise(resolve => {
+      setTimeout(() => {
+        log.push("timeout1");
+        Promise.resolve().then(() => log.push("timeout1 micro"));
+        queueMicrotask(() => log.push("timeout1 queued"));
+      }, 0);
+      setTimeout(() => {
+        log.push("timeout2");
+        setTimeout(() => { log.push("timeout3"); resolve(); }, 0);
+        Promise.resolve().then(() => Promise.resolve()).then(() => log.push("timeout2 chained"));
+      }, 0);
+      Promise.resolve().then(() => log.push("micro1")).then(() => log.push("micro2"));
+      queueMicrotask(() => log.push("queued"));
+      log.push("sync");
+    });
+    Promise.resolve().then(() => log.push("after setup"));
+    await done;
+    return Response.json(log);
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var got []string
+	if err := json.Unmarshal(r.Response.Body, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := []string{
+		"sync", "micro1", "queued", "after setup", "micro2",
+		"timeout1", "timeout1 micro", "timeout1 queued",
+		"timeout2", "timeout2 chained",
+		"timeout3",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("order = %q\nwant    %q", got, want)
+	}
+}
+
+func TestTimers_MaxPendingTimers(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxPendingTimers = 50
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  fetch(request, env) {
+    try {
+      for (let i = 0; i < 100; i++) setTimeout(() => {}, 60000);
+    } catch (e) {
+      // Swallowing the error must not let the execution continue.
+    }
+    return new Response("should not be returned");
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	if r.Error == nil {
+		t.Fatal("expected a resource error after exceeding MaxPendingTimers")
+	}
+	if !strings.Contains(r.Error.Error(), "exceeded maximum pending timers (50)") {
+		t.Errorf("error = %v, want pending timer limit error", r.Error)
+	}
+
+	// The pooled runtime is reset and serves the next request normally.
+	ok := `export default {
+  async fetch(request, env) {
+    await new Promise(r => setTimeout(r, 1));
+    return new Response("ok");
+  },
+};`
+	r = execJS(t, e, ok, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+}
+
+func TestTimers_MaxPendingTimersIgnoresInternalTimers(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxPendingTimers = 3
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	// AbortSignal.timeout and the scheduler keep timers of their own; only
+	// the worker's setTimeout/setInterval count against the cap.
+	source := `export default {
+  async fetch(request, env) {
+    const signals = [];
+    for (let i = 0; i < 10; i++) signals.push(AbortSignal.timeout(60000));
+    const waits = [];
+    for (let i = 0; i < 10; i++) waits.push(scheduler.wait(1));
+    const ids = [setTimeout(() => {}, 60000), setTimeout(() => {}, 60000)];
+    await Promise.all(waits);
+    await new Promise(r => setTimeout(r, 1));
+    ids.forEach(clearTimeout);
+    return new Response("ok");
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+}
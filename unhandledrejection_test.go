@@ -2,6 +2,7 @@ package worker
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -207,3 +208,195 @@ func TestUnhandledRejection_ThenMarksHandled(t *testing.T) {
 	// but the test should not panic or error.
 	t.Logf("caught = %v (handled rejection)", data.Caught)
 }
+
+func TestUnhandledRejection_ListenerFiresForUnhandledPromise(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const reasons = [];
+    globalThis.addEventListener('unhandledrejection', function(e) {
+      reasons.push(String(e.reason && e.reason.message || e.reason));
+    });
+
+    Promise.reject(new Error('boom'));
+    new Promise(function(_, reject) { reject('from executor'); });
+
+    // Handled rejections must not be reported, including ones that are
+    // awaited before they reject.
+    Promise.reject('caught').catch(function() {});
+    const later = new Promise(function(_, reject) { setTimeout(function() { reject('late'); }, 5); });
+    try { await later; } catch (e) {}
+
+    await new Promise(resolve => setTimeout(resolve, 50));
+    return Response.json({ reasons });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Reasons []string `json:"reasons"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(data.Reasons) != 2 || data.Reasons[0] != "boom" || data.Reasons[1] != "from executor" {
+		t.Errorf("reasons = %v, want [boom from executor]", data.Reasons)
+	}
+}
+
+func TestUnhandledRejection_ErrorEventForTimerException(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    let message = null;
+    globalThis.addEventListener('error', function(e) {
+      message = e.message;
+    });
+    setTimeout(function() { throw new Error('timer failed'); }, 0);
+    await new Promise(resolve => setTimeout(resolve, 20));
+    return Response.json({ message });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Message != "timer failed" {
+		t.Errorf("message = %q, want 'timer failed'", data.Message)
+	}
+}
+
+func TestUnhandledRejection_TrackingUsesNoTimers(t *testing.T) {
+	cfg := testCfg()
+	cfg.MaxPendingTimers = 100
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  async fetch(request, env) {
+    const reasons = [];
+    globalThis.addEventListener('unhandledrejection', function(e) {
+      reasons.push(String(e.reason));
+    });
+
+    // Each rejection is tracked until the next checkpoint; none of that
+    // bookkeeping may count against the worker's timer budget.
+    const rejected = [];
+    for (let i = 0; i < 200; i++) {
+      rejected.push(new Promise(function(_, reject) { queueMicrotask(function() { reject(i); }); }));
+    }
+    await null;
+    await Promise.all(rejected.map(function(p) { return p.catch(function() { return 0; }); }));
+    Promise.reject('unhandled');
+
+    await new Promise(resolve => setTimeout(resolve, 0));
+    return Response.json({
+      reasons,
+      asyncIsPromise: (async () => {})() instanceof Promise,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Reasons        []string `json:"reasons"`
+		AsyncIsPromise bool     `json:"asyncIsPromise"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(data.Reasons) != 1 || data.Reasons[0] != "unhandled" {
+		t.Errorf("reasons = %v, want [unhandled]", data.Reasons)
+	}
+	if !data.AsyncIsPromise {
+		t.Error("async function result should be instanceof Promise")
+	}
+}
+
+func TestUnhandledRejection_AsyncFunctionRejection(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const reasons = [];
+    globalThis.addEventListener('unhandledrejection', function(e) {
+      reasons.push(String(e.reason && e.reason.message || e.reason));
+    });
+
+    (async function() { throw new Error('async boom'); })();
+    // An async rejection that is awaited is handled.
+    try { await (async function() { throw new Error('awaited'); })(); } catch (e) {}
+
+    await new Promise(resolve => setTimeout(resolve, 10));
+    return Response.json({
+      reasons,
+      ownConstructor: Object.prototype.hasOwnProperty.call(new Promise(function() {}), 'constructor'),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Reasons        []string `json:"reasons"`
+		OwnConstructor bool     `json:"ownConstructor"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(data.Reasons) != 1 || data.Reasons[0] != "async boom" {
+		t.Errorf("reasons = %v, want [async boom]", data.Reasons)
+	}
+	if data.OwnConstructor {
+		t.Error("new Promise() should not carry an own constructor property")
+	}
+}
+
+func TestUnhandledRejection_ErrorEventForHandlerException(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `addEventListener('error', function(e) {
+  console.log('error event: ' + e.message);
+});
+export default {
+  async fetch(request, env) {
+    if (new URL(request.url).searchParams.has("async")) {
+      await null;
+      throw new Error('async handler failed');
+    }
+    throw new Error('handler failed');
+  },
+};`
+
+	for _, tc := range []struct{ url, want string }{
+		{"http://localhost/?async", "async handler failed"},
+		{"http://localhost/", "handler failed"},
+	} {
+		r := execJS(t, e, source, defaultEnv(), getReq(tc.url))
+		if r.Error == nil || !strings.Contains(r.Error.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want it to contain %q", tc.url, r.Error, tc.want)
+		}
+		var logged bool
+		for _, l := range r.Logs {
+			if l.Message == "error event: "+tc.want {
+				logged = true
+			}
+		}
+		if !logged {
+			t.Errorf("%s: logs = %v, want an error event for %q", tc.url, r.Logs, tc.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestWaitUntil_SinglePromise(t *testing.T) {
@@ -83,9 +84,18 @@ func TestWaitUntil_PromiseWithConsoleLog(t *testing.T) {
 
 	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
 	assertOK(t, r)
+	if r.WaitUntil == nil {
+		t.Fatal("WaitUntil channel is nil")
+	}
+	bg := <-r.WaitUntil
+	if bg.Error != nil {
+		t.Fatalf("waitUntil error: %v", bg.Error)
+	}
 
+	// A short timer may fire while the response is still being read, so
+	// the log can land on either side of the response.
 	found := false
-	for _, log := range r.Logs {
+	for _, log := range append(r.Logs, bg.Logs...) {
 		if strings.Contains(log.Message, "background task completed") {
 			found = true
 			break
@@ -187,3 +197,181 @@ func TestWaitUntil_WithKVWrite(t *testing.T) {
 		t.Errorf("KV value = %v, want 'bg_value'", val)
 	}
 }
+
+func TestWaitUntil_CompletesAfterResponse(t *testing.T) {
+	e := newTestEngine(t)
+
+	mock := newMockKVStore()
+	env := &Env{
+		Vars:    make(map[string]string),
+		Secrets: make(map[string]string),
+		KV:      map[string]KVStore{"MY_KV": mock},
+	}
+
+	source := `export default {
+  async fetch(request, env, ctx) {
+    ctx.waitUntil(new Promise(resolve => setTimeout(resolve, 300)).then(async () => {
+      await env.MY_KV.put("late_key", "late_value");
+      console.log("late work done");
+    }));
+    ctx.waitUntil(new Promise((_, reject) => {
+      setTimeout(() => reject(new TypeError("background boom")), 50);
+    }));
+    return new Response("early");
+  },
+};`
+
+	siteID := "test-wu-early-site"
+	deployKey := "deploy1"
+	if _, err := e.CompileAndCache(siteID, deployKey, source); err != nil {
+		t.Fatalf("CompileAndCache: %v", err)
+	}
+	r := e.Execute(siteID, deployKey, env, getReq("http://localhost/"))
+	assertOK(t, r)
+	if string(r.Response.Body) != "early" {
+		t.Errorf("body = %q, want 'early'", r.Response.Body)
+	}
+	if r.Duration >= 300*time.Millisecond {
+		t.Errorf("response took %v, should not wait for the waitUntil timer", r.Duration)
+	}
+	if val, _ := mock.Get("late_key"); val != nil {
+		t.Error("waitUntil work finished before the response was returned")
+	}
+	if r.WaitUntil == nil {
+		t.Fatal("WaitUntil channel is nil")
+	}
+
+	var bg WaitUntilResult
+	select {
+	case bg = <-r.WaitUntil:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waitUntil did not complete")
+	}
+
+	val, err := mock.Get("late_key")
+	if err != nil {
+		t.Fatalf("KV get: %v", err)
+	}
+	if val == nil || *val != "late_value" {
+		t.Errorf("KV value = %v, want 'late_value'", val)
+	}
+	if bg.Error == nil || !strings.Contains(bg.Error.Error(), "TypeError: background boom") {
+		t.Errorf("waitUntil error = %v, want the rejection surfaced", bg.Error)
+	}
+	found := false
+	for _, l := range bg.Logs {
+		if strings.Contains(l.Message, "late work done") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("background logs = %v, want 'late work done'", bg.Logs)
+	}
+}
+
+func TestWaitUntil_BackgroundTimeout(t *testing.T) {
+	cfg := testCfg()
+	cfg.WaitUntilTimeout = 100
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	source := `export default {
+  async fetch(request, env, ctx) {
+    ctx.waitUntil(new Promise(resolve => setTimeout(resolve, 2000)));
+    return new Response("ok");
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+	if r.WaitUntil == nil {
+		t.Fatal("WaitUntil channel is nil")
+	}
+	bg := <-r.WaitUntil
+	if bg.Error == nil || !strings.Contains(bg.Error.Error(), "waitUntil timed out") {
+		t.Errorf("waitUntil error = %v, want a timeout", bg.Error)
+	}
+
+	// The worker is replaced and later requests still run.
+	r = execJS(t, e, `export default { fetch() { return new Response("next"); } };`, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+}
+
+// waitUntilLeakSource registers waitUntil work and then fails the request
+// in a way chosen by the path; /count reports how many requests this
+// runtime has served.
+const waitUntilLeakSource = `let served = 0;
+export default {
+  async fetch(request, env, ctx) {
+    served++;
+    const path = new URL(request.url).pathname;
+    if (path === "/count") return Response.json({ served });
+    ctx.waitUntil(new Promise(resolve => setTimeout(resolve, 50)));
+    if (path === "/big") return new Response("x".repeat(4096));
+    if (path === "/alloc") {
+      try { for (let i = 0; i < 64; i++) new Uint8Array(1 << 20); } catch (e) {}
+    }
+    if (path === "/headers") {
+      const headers = new Headers();
+      for (let i = 0; i < 20; i++) headers.set("x-h" + i, "v");
+      return new Response("ok", { headers });
+    }
+    return new Response("ok");
+  },
+};`
+
+// assertWaitUntilWorkerDiscarded runs a failing request that leaves
+// waitUntil work behind and checks that the next request gets a fresh
+// runtime instead of the one holding that work.
+func assertWaitUntilWorkerDiscarded(t *testing.T, e *Engine, path string) {
+	t.Helper()
+	siteID := "test-" + t.Name()
+	if _, err := e.CompileAndCache(siteID, "deploy1", waitUntilLeakSource); err != nil {
+		t.Fatalf("CompileAndCache: %v", err)
+	}
+	r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost"+path))
+	if r.Error == nil {
+		t.Fatalf("%s: expected an error", path)
+	}
+	r = e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/count"))
+	assertOK(t, r)
+	var data struct {
+		Served int `json:"served"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Served != 1 {
+		t.Errorf("served = %d, want 1: the worker with pending waitUntil work was reused", data.Served)
+	}
+}
+
+func TestWaitUntil_DiscardedAfterResponseSizeError(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxResponseBytes = 1024
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	assertWaitUntilWorkerDiscarded(t, e, "/big")
+}
+
+func TestWaitUntil_DiscardedAfterHeaderLimitError(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxHeaderCount = 10
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	assertWaitUntilWorkerDiscarded(t, e, "/headers")
+}
+
+func TestWaitUntil_DiscardedAfterAllocationLimitError(t *testing.T) {
+	cfg := testCfg()
+	cfg.PoolSize = 1
+	cfg.MaxAllocationBytes = 16 << 20
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	assertWaitUntilWorkerDiscarded(t, e, "/alloc")
+}
@@ -2,6 +2,8 @@ package worker
 
 import (
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -1484,6 +1486,63 @@ func TestResponse_Error(t *testing.T) {
 // Integration: Request.bytes()
 // ---------------------------------------------------------------------------
 
+func TestResponse_ErrorHeadersImmutable(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const attempt = (fn) => {
+      try { fn(); return null; } catch (e) { return e instanceof TypeError ? 'TypeError' : String(e); }
+    };
+    const errResp = Response.error();
+    const redirect = Response.redirect("https://example.com/", 302);
+    const plain = new Response("ok");
+    return Response.json({
+      errorSet: attempt(() => errResp.headers.set("x-test", "1")),
+      errorAppend: attempt(() => errResp.headers.append("x-test", "1")),
+      errorDelete: attempt(() => errResp.headers.delete("x-test")),
+      redirectSet: attempt(() => redirect.headers.set("location", "https://evil.example/")),
+      cloneSet: attempt(() => errResp.clone().headers.set("x-test", "1")),
+      plainSet: attempt(() => plain.headers.set("x-test", "1")),
+      location: redirect.headers.get("location"),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		ErrorSet    *string `json:"errorSet"`
+		ErrorAppend *string `json:"errorAppend"`
+		ErrorDelete *string `json:"errorDelete"`
+		RedirectSet *string `json:"redirectSet"`
+		CloneSet    *string `json:"cloneSet"`
+		PlainSet    *string `json:"plainSet"`
+		Location    string  `json:"location"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for name, got := range map[string]*string{
+		"error set":    data.ErrorSet,
+		"error append": data.ErrorAppend,
+		"error delete": data.ErrorDelete,
+		"redirect set": data.RedirectSet,
+		"clone set":    data.CloneSet,
+	} {
+		if got == nil || *got != "TypeError" {
+			t.Errorf("%s: expected TypeError, got %v", name, got)
+		}
+	}
+	if data.PlainSet != nil {
+		t.Errorf("plain response headers should be mutable, got %q", *data.PlainSet)
+	}
+	if data.Location != "https://example.com/" {
+		t.Errorf("location = %q, want unchanged redirect target", data.Location)
+	}
+}
+
 func TestRequest_Bytes(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -1602,18 +1661,22 @@ func TestResponse_Bytes_EmptyBody(t *testing.T) {
 func TestResponse_Bytes_CalledTwice(t *testing.T) {
 	e := newTestEngine(t)
 
-	// Note: the current implementation uses .text() which reads _body as a
-	// string (no locking), so calling bytes() twice works the same as calling
-	// text() twice. This test verifies the second call still succeeds and
-	// returns the same data (consistent with the existing arrayBuffer behaviour).
+	// Reading a body consumes it, so a second bytes() call rejects with a
+	// TypeError just as it would for a streamed body.
 	source := `export default {
   async fetch(request, env) {
     const resp = new Response("data");
     const b1 = await resp.bytes();
-    const b2 = await resp.bytes();
+    let second = "";
+    try {
+      await resp.bytes();
+    } catch (e) {
+      second = e.name;
+    }
     return Response.json({
       first: new TextDecoder().decode(b1),
-      second: new TextDecoder().decode(b2),
+      second,
+      bodyUsed: resp.bodyUsed,
     });
   },
 };`
@@ -1622,8 +1685,9 @@ func TestResponse_Bytes_CalledTwice(t *testing.T) {
 	assertOK(t, r)
 
 	var data struct {
-		First  string `json:"first"`
-		Second string `json:"second"`
+		First    string `json:"first"`
+		Second   string `json:"second"`
+		BodyUsed bool   `json:"bodyUsed"`
 	}
 	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
 		t.Fatalf("unmarshal: %v", err)
@@ -1631,8 +1695,11 @@ func TestResponse_Bytes_CalledTwice(t *testing.T) {
 	if data.First != "data" {
 		t.Errorf("first = %q, want 'data'", data.First)
 	}
-	if data.Second != "data" {
-		t.Errorf("second = %q, want 'data'", data.Second)
+	if data.Second != "TypeError" {
+		t.Errorf("second call error = %q, want TypeError", data.Second)
+	}
+	if !data.BodyUsed {
+		t.Error("bodyUsed should be true after bytes()")
 	}
 }
 
@@ -1646,6 +1713,7 @@ func TestWebAPI_ResponseRedirectBodyIsNull(t *testing.T) {
       bodyIsNull: r.body === null,
       status: r.status,
       location: r.headers.get("location"),
+      contentLength: r.headers.get("content-length"),
     });
   },
 };`
@@ -1654,9 +1722,10 @@ func TestWebAPI_ResponseRedirectBodyIsNull(t *testing.T) {
 	assertOK(t, r)
 
 	var data struct {
-		BodyIsNull bool   `json:"bodyIsNull"`
-		Status     int    `json:"status"`
-		Location   string `json:"location"`
+		BodyIsNull    bool    `json:"bodyIsNull"`
+		Status        int     `json:"status"`
+		Location      string  `json:"location"`
+		ContentLength *string `json:"contentLength"`
 	}
 	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
 		t.Fatalf("unmarshal: %v", err)
@@ -1667,8 +1736,11 @@ func TestWebAPI_ResponseRedirectBodyIsNull(t *testing.T) {
 	if data.Status != 302 {
 		t.Errorf("status = %d, want 302", data.Status)
 	}
-	if data.Location != "https://example.com" {
-		t.Errorf("location = %q, want 'https://example.com'", data.Location)
+	if data.Location != "https://example.com/" {
+		t.Errorf("location = %q, want 'https://example.com/'", data.Location)
+	}
+	if data.ContentLength != nil {
+		t.Errorf("content-length = %q, want none", *data.ContentLength)
 	}
 }
 
@@ -2072,8 +2144,8 @@ func TestResponse_Redirect(t *testing.T) {
 		t.Errorf("status = %d, want 302", r.Response.StatusCode)
 	}
 	loc := r.Response.Headers["location"]
-	if loc != "https://example.com" {
-		t.Errorf("location = %q, want 'https://example.com'", loc)
+	if loc != "https://example.com/" {
+		t.Errorf("location = %q, want 'https://example.com/'", loc)
 	}
 }
 
@@ -2113,6 +2185,70 @@ func TestRequest_Clone(t *testing.T) {
 	}
 }
 
+func TestRequest_CloneStreamBodyTee(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    // Touching request.body turns the incoming body into a stream.
+    const incoming = request.body instanceof ReadableStream;
+    const cloned = request.clone();
+    const cloneText = await cloned.text();
+    const originalText = await request.text();
+
+    // A Request built around a ReadableStream.
+    const enc = new TextEncoder();
+    const stream = new ReadableStream({
+      start(c) {
+        c.enqueue(enc.encode("chunk one, "));
+        c.enqueue(enc.encode("chunk two"));
+        c.close();
+      },
+    });
+    const built = new Request("http://localhost/upload", { method: "PUT", body: stream, duplex: "half" });
+    const builtClone = built.clone();
+    const builtCloneText = await builtClone.text();
+    const builtUsedAfterClone = built.bodyUsed;
+    const builtText = await built.text();
+    let cloneAfterRead;
+    try { built.clone(); cloneAfterRead = "cloned"; } catch (e) { cloneAfterRead = e.constructor.name; }
+
+    return Response.json({
+      incoming, cloneText, originalText,
+      builtCloneText, builtText, builtUsedAfterClone, cloneAfterRead,
+    });
+  },
+};`
+
+	req := &WorkerRequest{
+		Method:  "POST",
+		URL:     "http://localhost/",
+		Headers: map[string]string{"content-type": "text/plain"},
+		Body:    []byte("streamed request body"),
+	}
+	r := execJS(t, e, source, defaultEnv(), req)
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]any{
+		"incoming":            true,
+		"cloneText":           "streamed request body",
+		"originalText":        "streamed request body",
+		"builtCloneText":      "chunk one, chunk two",
+		"builtText":           "chunk one, chunk two",
+		"builtUsedAfterClone": false,
+		"cloneAfterRead":      "TypeError",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %v, want %v", k, data[k], v)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Spec compliance: Headers.getSetCookie()
 // ---------------------------------------------------------------------------
@@ -2156,6 +2292,85 @@ func TestHeaders_GetSetCookie(t *testing.T) {
 	}
 }
 
+func TestHeaders_SetCookieDeleteAndSet(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const h = new Headers();
+    h.append('Set-Cookie', 'a=1');
+    h.append('set-cookie', 'b=2');
+    h.delete('SET-COOKIE');
+    const afterDelete = { cookies: h.getSetCookie(), has: h.has('set-cookie'), get: h.get('set-cookie') };
+    h.append('set-cookie', 'c=3');
+    h.append('set-cookie', 'd=4');
+    h.set('Set-Cookie', 'e=5');
+    return Response.json({ afterDelete, afterSet: h.getSetCookie(), keys: [...h.keys()] });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		AfterDelete struct {
+			Cookies []string `json:"cookies"`
+			Has     bool     `json:"has"`
+			Get     *string  `json:"get"`
+		} `json:"afterDelete"`
+		AfterSet []string `json:"afterSet"`
+		Keys     []string `json:"keys"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.AfterDelete.Cookies == nil || len(data.AfterDelete.Cookies) != 0 {
+		t.Errorf("getSetCookie() after delete = %v, want []", data.AfterDelete.Cookies)
+	}
+	if data.AfterDelete.Has || data.AfterDelete.Get != nil {
+		t.Errorf("after delete: has = %v, get = %v; want false, null", data.AfterDelete.Has, data.AfterDelete.Get)
+	}
+	if len(data.AfterSet) != 1 || data.AfterSet[0] != "e=5" {
+		t.Errorf("getSetCookie() after set = %v, want [e=5]", data.AfterSet)
+	}
+	if len(data.Keys) != 1 || data.Keys[0] != "set-cookie" {
+		t.Errorf("keys() = %v, want [set-cookie]", data.Keys)
+	}
+}
+
+func TestHeaders_IterationKeepsSetCookieSeparate(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const h = new Headers();
+    h.append('X-Multi', 'a');
+    h.append('Set-Cookie', 'a=1');
+    h.append('x-multi', 'b');
+    h.append('set-cookie', 'b=2; Path=/');
+    return Response.json({ entries: [...h], values: [...h.values()] });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Entries [][2]string `json:"entries"`
+		Values  []string    `json:"values"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := [][2]string{{"set-cookie", "a=1"}, {"set-cookie", "b=2; Path=/"}, {"x-multi", "a, b"}}
+	if !reflect.DeepEqual(data.Entries, want) {
+		t.Errorf("entries = %v, want %v", data.Entries, want)
+	}
+	if len(data.Values) != 3 || data.Values[1] != "b=2; Path=/" {
+		t.Errorf("values = %v, want 3 values with set-cookie kept apart", data.Values)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Spec compliance: Headers multi-value append
 // ---------------------------------------------------------------------------
@@ -2220,6 +2435,64 @@ func TestHeaders_SymbolToStringTag(t *testing.T) {
 // Spec compliance: Headers constructor from array of pairs
 // ---------------------------------------------------------------------------
 
+func TestHeaders_ConstructorFromObjectSorted(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const h = new Headers({ b: "2", "X-Custom": "x", a: "1", "Content-Type": "text/plain" });
+    const seen = [];
+    h.forEach((v, k) => seen.push(k + "=" + v));
+    const entries = [...h];
+    const keys = [...h.keys()];
+    const values = [...h.values()];
+    h.append("Accept", "*/*");
+    return Response.json({
+      entries,
+      keys,
+      values,
+      forEach: seen,
+      afterAppend: [...h.keys()],
+      combined: new Headers({ "X-A": "1", "x-a": "2" }).get("x-a"),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Entries     [][2]string `json:"entries"`
+		Keys        []string    `json:"keys"`
+		Values      []string    `json:"values"`
+		ForEach     []string    `json:"forEach"`
+		AfterAppend []string    `json:"afterAppend"`
+		Combined    string      `json:"combined"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	wantEntries := [][2]string{{"a", "1"}, {"b", "2"}, {"content-type", "text/plain"}, {"x-custom", "x"}}
+	if !reflect.DeepEqual(data.Entries, wantEntries) {
+		t.Errorf("entries = %v, want %v", data.Entries, wantEntries)
+	}
+	if got := strings.Join(data.Keys, ","); got != "a,b,content-type,x-custom" {
+		t.Errorf("keys = %s", got)
+	}
+	if got := strings.Join(data.Values, ","); got != "1,2,text/plain,x" {
+		t.Errorf("values = %s", got)
+	}
+	if got := strings.Join(data.ForEach, ","); got != "a=1,b=2,content-type=text/plain,x-custom=x" {
+		t.Errorf("forEach = %s", got)
+	}
+	if got := strings.Join(data.AfterAppend, ","); got != "a,accept,b,content-type,x-custom" {
+		t.Errorf("keys after append = %s, want the new header sorted in", got)
+	}
+	if data.Combined != "1, 2" {
+		t.Errorf("case-insensitive duplicate keys = %q, want %q", data.Combined, "1, 2")
+	}
+}
+
 func TestHeaders_ConstructorFromArray(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -2261,6 +2534,55 @@ func TestHeaders_ConstructorFromArray(t *testing.T) {
 	}
 }
 
+func TestHeaders_ConstructorFromIterable(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const fromMap = new Headers(new Map([['X-Map', 'm'], ['Accept', 'text/plain']]));
+    function* pairs() {
+      yield ['X-Gen', 'one'];
+      yield ['x-gen', 'two'];
+    }
+    const fromGen = new Headers(pairs());
+    let badPair = '';
+    try {
+      new Headers(new Map([['ok', '1']]).keys());
+    } catch (e) {
+      badPair = e.name;
+    }
+    return Response.json({
+      map: fromMap.get('x-map'),
+      accept: fromMap.get('accept'),
+      gen: fromGen.get('X-Gen'),
+      badPair,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Map     string `json:"map"`
+		Accept  string `json:"accept"`
+		Gen     string `json:"gen"`
+		BadPair string `json:"badPair"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Map != "m" || data.Accept != "text/plain" {
+		t.Errorf("from Map: x-map = %q, accept = %q", data.Map, data.Accept)
+	}
+	if data.Gen != "one, two" {
+		t.Errorf("from generator: x-gen = %q, want %q", data.Gen, "one, two")
+	}
+	if data.BadPair != "TypeError" {
+		t.Errorf("non-pair entries threw %q, want TypeError", data.BadPair)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Spec compliance: URL property setters update href
 // ---------------------------------------------------------------------------
@@ -2309,6 +2631,51 @@ func TestURL_PropertySetters(t *testing.T) {
 	}
 }
 
+func TestURL_SetPathnameEncodes(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const set = (base, path) => {
+      const url = new URL(base);
+      url.pathname = path;
+      return url.href;
+    };
+    return Response.json({
+      space: set("https://example.com/old?q=1#h", "/a b/c"),
+      special: set("https://example.com/", '/x"y<z>{w}/caf\u00e9?#\x60'),
+      noSlash: set("https://example.com/", "relative/path"),
+      backslash: set("https://example.com/", "\\a\\b"),
+      dots: set("https://example.com/", "/a/./b/../c/%2e%2E/d"),
+      escaped: set("https://example.com/", "/already%20encoded%2F"),
+      reparsed: new URL(set("https://example.com/", "/a b")).pathname,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"space":     "https://example.com/a%20b/c?q=1#h",
+		"special":   "https://example.com/x%22y%3Cz%3E%7Bw%7D/caf%C3%A9%3F%23%60",
+		"noSlash":   "https://example.com/relative/path",
+		"backslash": "https://example.com/a/b",
+		"dots":      "https://example.com/a/d",
+		"escaped":   "https://example.com/already%20encoded%2F",
+		"reparsed":  "/a%20b",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %q, want %q", k, data[k], v)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Spec compliance: URL.search setter updates searchParams
 // ---------------------------------------------------------------------------
@@ -2496,6 +2863,98 @@ func TestURL_SetPort(t *testing.T) {
 	}
 }
 
+func TestURL_Origin(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const ws = new URL('ws://example.com:80/chat');
+    const https = new URL('https://example.com:443/a');
+    const custom = new URL('http://example.com:8080/');
+    const file = new URL('file:///tmp/x.txt');
+    const blob = new URL('blob:https://example.com/uuid');
+    const moved = new URL('https://example.com:8443/');
+    moved.port = '443';
+    return Response.json({
+      ws: ws.origin, wsPort: ws.port,
+      https: https.origin, httpsHost: https.host,
+      custom: custom.origin,
+      file: file.origin,
+      blob: blob.origin,
+      moved: moved.origin,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"ws":        "ws://example.com",
+		"wsPort":    "",
+		"https":     "https://example.com",
+		"httpsHost": "example.com",
+		"custom":    "http://example.com:8080",
+		"file":      "null",
+		"blob":      "https://example.com",
+		"moved":     "https://example.com",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %q, want %q", k, data[k], v)
+		}
+	}
+}
+
+func TestURL_OpaquePathSchemes(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const pick = (u) => ({
+      href: u.href, protocol: u.protocol, pathname: u.pathname,
+      host: u.host, hostname: u.hostname, origin: u.origin,
+      search: u.search, hash: u.hash,
+    });
+    const mail = new URL("mailto:user@example.com?subject=hi");
+    const data = new URL("data:text/plain,hi#frag");
+    mail.pathname = "other@example.com";
+    return Response.json({ mail: pick(mail), data: pick(data) });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]map[string]string{
+		"mail": {
+			"href": "mailto:user@example.com?subject=hi", "protocol": "mailto:",
+			"pathname": "user@example.com", "host": "", "hostname": "", "origin": "null",
+			"search": "?subject=hi", "hash": "",
+		},
+		"data": {
+			"href": "data:text/plain,hi#frag", "protocol": "data:",
+			"pathname": "text/plain,hi", "host": "", "hostname": "", "origin": "null",
+			"search": "", "hash": "#frag",
+		},
+	}
+	for name, fields := range want {
+		for k, v := range fields {
+			if got := data[name][k]; got != v {
+				t.Errorf("%s.%s = %q, want %q", name, k, got, v)
+			}
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Spec compliance: URL constructor accepts URL object input
 // ---------------------------------------------------------------------------
@@ -2593,6 +3052,50 @@ func TestRequest_ForbiddenMethodThrows(t *testing.T) {
 	}
 }
 
+func TestRequest_MethodNormalization(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const thrown = (method) => {
+      try { new Request('http://x.com', { method }); return ''; }
+      catch (e) { return e.constructor.name; }
+    };
+    return Response.json({
+      post: new Request('http://x.com', { method: 'post' }).method,
+      del: new Request('http://x.com', { method: 'Delete' }).method,
+      foo: new Request('http://x.com', { method: 'foo' }).method,
+      patch: new Request('http://x.com', { method: 'patch' }).method,
+      trace: thrown('trace'),
+      connect: thrown('Connect'),
+      invalid: thrown('GET POST'),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		"post":    "POST",
+		"del":     "DELETE",
+		"foo":     "foo",
+		"patch":   "patch",
+		"trace":   "TypeError",
+		"connect": "TypeError",
+		"invalid": "TypeError",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %q, want %q", k, data[k], v)
+		}
+	}
+}
+
 func TestRequest_DefaultProperties(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -3036,6 +3539,50 @@ func TestResponse_BodyUsedAfterText(t *testing.T) {
 	}
 }
 
+func TestResponse_NullBodyStatus(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const attempt = (body, status) => {
+      try {
+        return new Response(body, { status }).status;
+      } catch (e) {
+        return e.name;
+      }
+    };
+    return Response.json({
+      body204: attempt("body", 204),
+      body304: attempt("body", 304),
+      empty204: attempt("", 204),
+      body103: attempt("body", 103),
+      null204: attempt(null, 204),
+      undefined304: attempt(undefined, 304),
+      body200: attempt("body", 200),
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, key := range []string{"body204", "body304", "empty204", "body103"} {
+		if data[key] != "TypeError" {
+			t.Errorf("%s = %v, want TypeError", key, data[key])
+		}
+	}
+	want := map[string]float64{"null204": 204, "undefined304": 304, "body200": 200}
+	for key, status := range want {
+		if data[key] != status {
+			t.Errorf("%s = %v, want %v", key, data[key], status)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Spec compliance: TextEncoder / TextDecoder
 // ---------------------------------------------------------------------------
@@ -3124,6 +3671,51 @@ func TestTextEncoder_EncodeIntoPartial(t *testing.T) {
 	}
 }
 
+func TestTextEncoder_EncodeIntoMultiByteBoundary(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const enc = new TextEncoder();
+    const buf = new Uint8Array(2);
+    const euro = enc.encodeInto('\u20ac', buf);
+    const mixed = enc.encodeInto('a\u{1F600}', new Uint8Array(4));
+    const pair = enc.encodeInto('\u{1F600}b', new Uint8Array(5));
+    return Response.json({
+      euro: [euro.read, euro.written],
+      untouched: buf[0] === 0 && buf[1] === 0,
+      mixed: [mixed.read, mixed.written],
+      pair: [pair.read, pair.written],
+    });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Euro      [2]int `json:"euro"`
+		Untouched bool   `json:"untouched"`
+		Mixed     [2]int `json:"mixed"`
+		Pair      [2]int `json:"pair"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Euro != [2]int{0, 0} {
+		t.Errorf("3-byte char into 2-byte buffer: read/written = %v, want [0 0]", data.Euro)
+	}
+	if !data.Untouched {
+		t.Error("no partial sequence should be written to the destination")
+	}
+	if data.Mixed != [2]int{1, 1} {
+		t.Errorf("'a' + emoji into 4 bytes: read/written = %v, want [1 1]", data.Mixed)
+	}
+	if data.Pair != [2]int{3, 5} {
+		t.Errorf("emoji + 'b' into 5 bytes: read/written = %v, want [3 5]", data.Pair)
+	}
+}
+
 func TestTextEncoder_SymbolToStringTag(t *testing.T) {
 	e := newTestEngine(t)
 
@@ -3171,3 +3763,336 @@ func TestTextDecoder_SymbolToStringTag(t *testing.T) {
 		t.Errorf("tag = %q, want '[object TextDecoder]'", data.Tag)
 	}
 }
+
+func TestTextDecoder_LabelAliases(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const labels = ["UTF8", "utf8", "unicode-1-1-utf-8", " Utf-8\n", "unicode11utf8", "x-unicode20utf8"];
+    const encodings = {};
+    for (const l of labels) {
+      const d = new TextDecoder(l);
+      encodings[l] = d.encoding + ":" + d.decode(new Uint8Array([0xC3, 0xA9]));
+    }
+    const invalid = {};
+    for (const l of ["utf-9", ""]) {
+      try { new TextDecoder(l); invalid[l] = "no error"; }
+      catch (e) { invalid[l] = e.constructor.name; }
+    }
+    let stream = "";
+    try { new TextDecoderStream("bogus"); stream = "no error"; } catch (e) { stream = e.constructor.name; }
+    return Response.json({ encodings, invalid, stream });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Encodings map[string]string `json:"encodings"`
+		Invalid   map[string]string `json:"invalid"`
+		Stream    string            `json:"stream"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(data.Encodings) != 6 {
+		t.Errorf("encodings = %v, want 6 labels", data.Encodings)
+	}
+	for label, got := range data.Encodings {
+		if got != "utf-8:\u00e9" {
+			t.Errorf("TextDecoder(%q) = %q, want utf-8:\u00e9", label, got)
+		}
+	}
+	for label, got := range data.Invalid {
+		if got != "RangeError" {
+			t.Errorf("TextDecoder(%q) threw %q, want RangeError", label, got)
+		}
+	}
+	if data.Stream != "RangeError" {
+		t.Errorf("TextDecoderStream(\"bogus\") threw %q, want RangeError", data.Stream)
+	}
+}
+
+func TestResponse_JSONCharset(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    const text = '{"msg":"h\u00e9llo \u20ac \ud83d\ude00"}';
+    const utf16le = (s, bom) => {
+      const out = bom ? [0xFF, 0xFE] : [];
+      for (let i = 0; i < s.length; i++) {
+        const c = s.charCodeAt(i);
+        out.push(c & 0xFF, c >> 8);
+      }
+      return new Uint8Array(out);
+    };
+    const utf8bom = new Uint8Array([0xEF, 0xBB, 0xBF, ...new TextEncoder().encode(text)]);
+    const le = await new Response(utf16le(text, false), {
+      headers: { "content-type": "application/json; charset=utf-16le" },
+    }).json();
+    const leBOM = await new Request("http://localhost/", {
+      method: "POST",
+      body: utf16le(text, true),
+      headers: { "content-type": 'application/json; charset="UTF-16"' },
+    }).json();
+    const bom = await new Response(utf8bom, {
+      headers: { "content-type": "application/json" },
+    }).json();
+    const latin1 = await new Response(new Uint8Array([0x7B, 0x22, 0x61, 0x22, 0x3A, 0x22, 0xE9, 0x80, 0x22, 0x7D]), {
+      headers: { "content-type": "application/json; charset=windows-1252" },
+    }).json();
+    const blob = await new Response(new Blob([utf16le(text, false)]), {
+      headers: { "content-type": "application/json; charset=utf-16le" },
+    }).json();
+    return Response.json({ le: le.msg, leBOM: leBOM.msg, bom: bom.msg, latin1: latin1.a, blob: blob.msg });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data map[string]string
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := "h\u00e9llo \u20ac \U0001F600"
+	for _, k := range []string{"le", "leBOM", "bom", "blob"} {
+		if data[k] != want {
+			t.Errorf("%s = %q, want %q", k, data[k], want)
+		}
+	}
+	if data["latin1"] != "\u00e9\u20ac" {
+		t.Errorf("latin1 = %q, want %q", data["latin1"], "\u00e9\u20ac")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Response.json: BigInt handling
+// ---------------------------------------------------------------------------
+
+func TestResponse_JsonBigIntThrowsTypeError(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    try {
+      Response.json({ n: 10n });
+      return Response.json({ threw: false });
+    } catch (e) {
+      return Response.json({ threw: true, isTypeError: e instanceof TypeError, message: e.message });
+    }
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Threw       bool   `json:"threw"`
+		IsTypeError bool   `json:"isTypeError"`
+		Message     string `json:"message"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatal(err)
+	}
+	if !data.Threw || !data.IsTypeError {
+		t.Fatalf("Response.json with BigInt: threw=%v isTypeError=%v, want TypeError", data.Threw, data.IsTypeError)
+	}
+	if !strings.Contains(data.Message, "BigInt") {
+		t.Errorf("message = %q, want mention of BigInt", data.Message)
+	}
+}
+
+func TestResponse_JsonBigIntToJSON(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    BigInt.prototype.toJSON = function() { return this.toString(); };
+    try {
+      const r = Response.json({ n: 10n });
+      return new Response(await r.text());
+    } finally {
+      delete BigInt.prototype.toJSON;
+    }
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	if got := string(r.Response.Body); got != `{"n":"10"}` {
+		t.Errorf("body = %s, want {\"n\":\"10\"}", got)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Response.json: circular references
+// ---------------------------------------------------------------------------
+
+func TestResponse_JsonCircularThrowsTypeError(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const obj = { name: "root", child: {} };
+    obj.child.parent = obj;
+    try {
+      Response.json(obj);
+      return Response.json({ threw: false });
+    } catch (e) {
+      return Response.json({ threw: true, isTypeError: e instanceof TypeError, message: e.message });
+    }
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Threw       bool   `json:"threw"`
+		IsTypeError bool   `json:"isTypeError"`
+		Message     string `json:"message"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatal(err)
+	}
+	if !data.Threw || !data.IsTypeError {
+		t.Fatalf("Response.json with cycle: threw=%v isTypeError=%v, want TypeError", data.Threw, data.IsTypeError)
+	}
+	if !strings.Contains(data.Message, "Converting circular structure to JSON") {
+		t.Errorf("message = %q, want 'Converting circular structure to JSON'", data.Message)
+	}
+}
+
+func TestResponse_JsonSharedReferenceAllowed(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const shared = { v: 1 };
+    return Response.json({ a: shared, b: [shared, shared] });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	if got := string(r.Response.Body); got != `{"a":{"v":1},"b":[{"v":1},{"v":1}]}` {
+		t.Errorf("body = %s", got)
+	}
+}
+
+func TestResponse_JsonInitContentTypeAndStatus(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const status = (s) => {
+      try { return Response.json({}, { status: s }).status; } catch (e) { return e.constructor.name; }
+    };
+    const custom = Response.json({ ok: true }, {
+      status: 201,
+      headers: { "Content-Type": "application/vnd.api+json" },
+    });
+    const fromHeaders = Response.json(null, {
+      headers: new Headers([["content-type", "application/problem+json"], ["x-extra", "1"]]),
+    });
+    return Response.json({
+      custom: custom.headers.get("content-type"),
+      customStatus: custom.status,
+      fromHeaders: fromHeaders.headers.get("content-type"),
+      extra: fromHeaders.headers.get("x-extra"),
+      fallback: Response.json(1, { headers: { "x-a": "b" } }).headers.get("content-type"),
+      zero: status(0),
+      info: status(101),
+      high: status(600),
+      low: status(200),
+      top: status(599),
+    }, { headers: { "content-type": "application/json; charset=utf-8" } });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	if got := r.Response.Headers["content-type"]; got != "application/json; charset=utf-8" {
+		t.Errorf("outer content-type = %q", got)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]any{
+		"custom":       "application/vnd.api+json",
+		"customStatus": float64(201),
+		"fromHeaders":  "application/problem+json",
+		"extra":        "1",
+		"fallback":     "application/json",
+		"zero":         "RangeError",
+		"info":         "RangeError",
+		"high":         "RangeError",
+		"low":          float64(200),
+		"top":          float64(599),
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("%s = %v, want %v", k, data[k], v)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// WorkerResponse.HeaderList: repeated headers
+// ---------------------------------------------------------------------------
+
+func TestResponse_HeaderListPreservesSetCookie(t *testing.T) {
+	e := newTestEngine(t)
+
+	source := `export default {
+  fetch(request, env) {
+    const headers = new Headers();
+    headers.set("content-type", "text/plain");
+    headers.append("x-multi", "1");
+    headers.append("set-cookie", "a=1; Path=/");
+    headers.append("Set-Cookie", "b=2; Expires=Wed, 21 Oct 2026 07:28:00 GMT");
+    headers.set("x-last", "yes");
+    headers.append("x-multi", "2");
+    headers.append("x-replaced", "old");
+    headers.append("x-dropped", "gone");
+    headers.set("X-Replaced", "new");
+    headers.delete("x-dropped");
+    return new Response("ok", { headers });
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+
+	want := [][2]string{
+		{"content-type", "text/plain"},
+		{"x-multi", "1"},
+		{"set-cookie", "a=1; Path=/"},
+		{"set-cookie", "b=2; Expires=Wed, 21 Oct 2026 07:28:00 GMT"},
+		{"x-last", "yes"},
+		{"x-multi", "2"},
+		{"x-replaced", "new"},
+	}
+	got := r.Response.HeaderList
+	if len(got) != len(want) {
+		t.Fatalf("HeaderList = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("HeaderList[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// The flat map keeps its joined form for existing callers.
+	if ct := r.Response.Headers["content-type"]; ct != "text/plain" {
+		t.Errorf("Headers[content-type] = %q, want text/plain", ct)
+	}
+}
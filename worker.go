@@ -1,10 +1,31 @@
 package worker
 
-import "github.com/cryguy/worker/v2/internal/core"
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cryguy/worker/v2/internal/core"
+)
+
+// ErrEngineShutdown is the WorkerResult error for executions started after
+// Shutdown was called.
+var ErrEngineShutdown = errors.New("worker: engine is shut down")
+
+// defaultShutdownTimeout bounds how long Shutdown waits for in-flight
+// executions before disposing of the pools anyway.
+const defaultShutdownTimeout = 30 * time.Second
 
 // Engine wraps a backend JS engine (QuickJS by default, V8 with -tags v8).
 type Engine struct {
 	backend core.EngineBackend
+
+	// mu guards closing so that no execution is admitted once the
+	// shutdown has started waiting on active.
+	mu      sync.Mutex
+	closing bool
+	active  sync.WaitGroup
 }
 
 // NewEngine creates a new Engine with the given config and source loader.
@@ -14,21 +35,65 @@ func NewEngine(cfg EngineConfig, loader SourceLoader) *Engine {
 
 // Execute runs the worker's fetch handler for the given request.
 func (e *Engine) Execute(siteID, deployKey string, env *Env, req *WorkerRequest) *WorkerResult {
-	return e.backend.Execute(siteID, deployKey, env, req)
+	if !e.begin() {
+		return &WorkerResult{Error: ErrEngineShutdown}
+	}
+	defer e.active.Done()
+	r := e.backend.Execute(siteID, deployKey, env, req)
+	if r != nil && r.WaitUntil != nil {
+		r.WaitUntil = e.trackWaitUntil(r.WaitUntil)
+	}
+	return r
+}
+
+// trackWaitUntil counts the background waitUntil work of an execution as
+// in flight, so Shutdown waits for it. The caller must still hold its own
+// e.active slot.
+func (e *Engine) trackWaitUntil(src <-chan WaitUntilResult) <-chan WaitUntilResult {
+	e.active.Add(1)
+	out := make(chan WaitUntilResult, 1)
+	go func() {
+		defer e.active.Done()
+		out <- <-src
+	}()
+	return out
 }
 
 // ExecuteScheduled runs the worker's scheduled handler.
 func (e *Engine) ExecuteScheduled(siteID, deployKey string, env *Env, cron string) *WorkerResult {
-	return e.backend.ExecuteScheduled(siteID, deployKey, env, cron)
+	if !e.begin() {
+		return &WorkerResult{Error: ErrEngineShutdown}
+	}
+	defer e.active.Done()
+	return e.backend.ExecuteScheduled(siteID, deployKey, env, cron, nil)
+}
+
+// ExecuteScheduledWithCF runs the worker's scheduled handler with cf as
+// the event's cf object, for trigger metadata such as the colo or region
+// that fired it. cf must be JSON-encodable.
+func (e *Engine) ExecuteScheduledWithCF(siteID, deployKey string, env *Env, cron string, cf map[string]any) *WorkerResult {
+	if !e.begin() {
+		return &WorkerResult{Error: ErrEngineShutdown}
+	}
+	defer e.active.Done()
+	return e.backend.ExecuteScheduled(siteID, deployKey, env, cron, cf)
 }
 
 // ExecuteTail runs the worker's tail handler.
 func (e *Engine) ExecuteTail(siteID, deployKey string, env *Env, events []TailEvent) *WorkerResult {
+	if !e.begin() {
+		return &WorkerResult{Error: ErrEngineShutdown}
+	}
+	defer e.active.Done()
 	return e.backend.ExecuteTail(siteID, deployKey, env, events)
 }
 
 // ExecuteFunction calls a named exported function on the worker module.
 func (e *Engine) ExecuteFunction(siteID, deployKey string, env *Env, fnName string, args ...any) *WorkerResult {
+	if !e.begin() {
+		return &WorkerResult{Error: ErrEngineShutdown}
+	}
+	defer e.active.Done()
 	return e.backend.ExecuteFunction(siteID, deployKey, env, fnName, args...)
 }
 
@@ -37,19 +102,99 @@ func (e *Engine) EnsureSource(siteID, deployKey string) error {
 	return e.backend.EnsureSource(siteID, deployKey)
 }
 
+// Warm loads the source for the given site/deploy and creates its worker
+// pool ahead of traffic, returning once every pooled worker has evaluated
+// the module. Calling it after a deploy moves that cold-start cost off the
+// first request.
+func (e *Engine) Warm(siteID, deployKey string) error {
+	if !e.begin() {
+		return ErrEngineShutdown
+	}
+	defer e.active.Done()
+	return e.backend.Warm(siteID, deployKey)
+}
+
+// RefreshSource reloads the source for the given site/deploy from the
+// loader. If the loader reports the same content hash as the cached source,
+// or a LastModified no newer than the cached one, the existing pool is kept
+// and no recompilation happens; otherwise the new source replaces it and
+// the pool is rebuilt on next use. It returns whether the source changed.
+func (e *Engine) RefreshSource(ctx context.Context, siteID, deployKey string) (bool, error) {
+	if !e.begin() {
+		return false, ErrEngineShutdown
+	}
+	defer e.active.Done()
+	return e.backend.RefreshSource(ctx, siteID, deployKey)
+}
+
 // CompileAndCache compiles the source and caches the bytecode.
 func (e *Engine) CompileAndCache(siteID, deployKey, source string) ([]byte, error) {
 	return e.backend.CompileAndCache(siteID, deployKey, source)
 }
 
+// SourceHash returns the hex SHA-256 of the source cached for the given
+// site/deploy, or false if none is cached. Because a pool is rebuilt
+// whenever its source changes, the hash can serve as a content-addressed
+// deploy key.
+func (e *Engine) SourceHash(siteID, deployKey string) (string, bool) {
+	meta, ok := e.backend.SourceMeta(siteID, deployKey)
+	return meta.Hash, ok
+}
+
+// SourceMeta returns the metadata of the source cached for the given
+// site/deploy, as reported by a ContextSourceLoader or computed by the
+// engine, or false if none is cached.
+func (e *Engine) SourceMeta(siteID, deployKey string) (SourceMeta, bool) {
+	return e.backend.SourceMeta(siteID, deployKey)
+}
+
 // InvalidatePool marks the pool for the given site as invalid.
 func (e *Engine) InvalidatePool(siteID, deployKey string) {
 	e.backend.InvalidatePool(siteID, deployKey)
 }
 
-// Shutdown disposes of all pools and workers.
+// Shutdown stops accepting executions, waits up to 30 seconds for the ones
+// in flight to finish and then disposes of all pools and workers.
 func (e *Engine) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	_ = e.ShutdownContext(ctx)
+}
+
+// ShutdownContext stops accepting executions and waits for the ones in
+// flight to finish before disposing of all pools and workers. New
+// executions fail with ErrEngineShutdown. If ctx ends first the pools are
+// disposed regardless and ctx.Err() is returned.
+func (e *Engine) ShutdownContext(ctx context.Context) error {
+	e.mu.Lock()
+	e.closing = true
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.active.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
 	e.backend.Shutdown()
+	return err
+}
+
+// begin admits an execution, returning false once shutdown has started.
+// Each admitted execution must call e.active.Done when it returns.
+func (e *Engine) begin() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closing {
+		return false
+	}
+	e.active.Add(1)
+	return true
 }
 
 // SetDispatcher sets the worker dispatcher for service bindings.
@@ -61,3 +206,8 @@ func (e *Engine) SetDispatcher(d WorkerDispatcher) {
 func (e *Engine) MaxResponseBytes() int {
 	return e.backend.MaxResponseBytes()
 }
+
+// Stats returns a usage snapshot of each site's worker pool.
+func (e *Engine) Stats() []PoolStats {
+	return e.backend.Stats()
+}
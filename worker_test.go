@@ -3,6 +3,7 @@ package worker
 import (
 	"encoding/json"
 	"fmt"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
@@ -869,6 +870,81 @@ func TestAssets_ModifiedRequestURL(t *testing.T) {
 	}
 }
 
+func TestAssets_ConditionalAndRange(t *testing.T) {
+	e := newTestEngine(t)
+
+	const etag = `"v1"`
+	fetcher := &routingAssetsFetcher{fn: func(req *WorkerRequest) (*WorkerResponse, error) {
+		if req.Headers["if-none-match"] == etag {
+			return &WorkerResponse{StatusCode: 304, Headers: map[string]string{"etag": etag}}, nil
+		}
+		if rng := req.Headers["range"]; rng == "bytes=0-3" {
+			return &WorkerResponse{
+				StatusCode: 206,
+				Headers:    map[string]string{"content-range": "bytes 0-3/10", "etag": etag},
+				Body:       []byte("0123"),
+			}, nil
+		}
+		return &WorkerResponse{StatusCode: 200, Headers: map[string]string{"etag": etag}, Body: []byte("0123456789")}, nil
+	}}
+	env := &Env{
+		Vars: make(map[string]string), Secrets: make(map[string]string),
+		Assets: fetcher,
+	}
+
+	source := `export default {
+  async fetch(request, env) {
+    const notModified = await env.ASSETS.fetch(request);
+    const partial = await env.ASSETS.fetch("http://localhost/file.txt", {
+      headers: { "Range": "bytes=0-3" },
+    });
+    return Response.json({
+      status: notModified.status,
+      etag: notModified.headers.get("etag"),
+      bodyNull: notModified.body === null,
+      partialStatus: partial.status,
+      contentRange: partial.headers.get("content-range"),
+      partialBody: await partial.text(),
+    });
+  },
+};`
+
+	req := getReq("http://localhost/file.txt")
+	req.Headers["If-None-Match"] = etag
+	r := execJS(t, e, source, env, req)
+	assertOK(t, r)
+
+	var data struct {
+		Status        int    `json:"status"`
+		ETag          string `json:"etag"`
+		BodyNull      bool   `json:"bodyNull"`
+		PartialStatus int    `json:"partialStatus"`
+		ContentRange  string `json:"contentRange"`
+		PartialBody   string `json:"partialBody"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Status != 304 {
+		t.Errorf("status = %d, want 304", data.Status)
+	}
+	if data.ETag != etag {
+		t.Errorf("etag = %q, want %q", data.ETag, etag)
+	}
+	if !data.BodyNull {
+		t.Error("304 body should be null")
+	}
+	if data.PartialStatus != 206 {
+		t.Errorf("partial status = %d, want 206", data.PartialStatus)
+	}
+	if data.ContentRange != "bytes 0-3/10" {
+		t.Errorf("content-range = %q", data.ContentRange)
+	}
+	if data.PartialBody != "0123" {
+		t.Errorf("partial body = %q, want 0123", data.PartialBody)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // 5. Environment Variables
 // ---------------------------------------------------------------------------
@@ -937,6 +1013,59 @@ func TestEnv_MultipleVarsAndSecrets(t *testing.T) {
 	}
 }
 
+func TestEnv_ObjectKeysListsBindings(t *testing.T) {
+	e := newTestEngine(t)
+
+	env := &Env{
+		Vars:    map[string]string{"GREETING": "hi"},
+		Secrets: map[string]string{"API_TOKEN": "tok-123"},
+		KV:      map[string]KVStore{"CACHE": newMockKVStore()},
+	}
+
+	source := `export default {
+  fetch(request, env) {
+    return Response.json({
+      keys: Object.keys(env).sort(),
+      json: JSON.stringify(env),
+      walked: JSON.stringify([
+        Object.entries(env), Object.values(env), { ...env }, Object.assign({}, env),
+        (() => { const out = []; for (const k in env) out.push(env[k]); return out; })(),
+      ]),
+      secret: env.API_TOKEN,
+    });
+  },
+};`
+
+	r := execJS(t, e, source, env, getReq("http://localhost/"))
+	assertOK(t, r)
+
+	var data struct {
+		Keys   []string `json:"keys"`
+		JSON   string   `json:"json"`
+		Walked string   `json:"walked"`
+		Secret string   `json:"secret"`
+	}
+	if err := json.Unmarshal(r.Response.Body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	keys := strings.Join(data.Keys, ",")
+	if !strings.Contains(keys, "GREETING") || !strings.Contains(keys, "CACHE") {
+		t.Errorf("Object.keys(env) = %v, want GREETING and CACHE", data.Keys)
+	}
+	if strings.Contains(keys, "API_TOKEN") {
+		t.Errorf("Object.keys(env) = %v, secret should not be enumerable", data.Keys)
+	}
+	if strings.Contains(data.JSON, "tok-123") {
+		t.Errorf("JSON.stringify(env) leaked secret: %s", data.JSON)
+	}
+	if strings.Contains(data.Walked, "tok-123") {
+		t.Errorf("walking env leaked secret: %s", data.Walked)
+	}
+	if data.Secret != "tok-123" {
+		t.Errorf("env.API_TOKEN = %q, want tok-123", data.Secret)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // 6. Outbound Fetch — SSRF Protection
 // ---------------------------------------------------------------------------
@@ -1321,6 +1450,84 @@ func TestEdge_InfiniteLoop(t *testing.T) {
 	t.Logf("infinite loop error: %v (duration: %v)", r.Error, r.Duration)
 }
 
+func TestEdge_PromiseResolvedAfterDeadline(t *testing.T) {
+	cfg := testCfg()
+	cfg.ExecutionTimeout = 300
+	e := NewEngine(cfg, nilSourceLoader{})
+	t.Cleanup(func() { e.Shutdown() })
+
+	// A long microtask chain followed by a timer that only fires well
+	// after the deadline.
+	source := `export default {
+  fetch(request, env) {
+    let p = Promise.resolve(0);
+    for (let i = 0; i < 10000; i++) p = p.then(n => n + 1);
+    return p.then(() => new Promise(resolve => {
+      setTimeout(() => resolve(new Response("late")), 5000);
+    }));
+  },
+};`
+
+	siteID := "late-promise"
+	if _, err := e.CompileAndCache(siteID, "deploy1", source); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	r := e.Execute(siteID, "deploy1", defaultEnv(), getReq("http://localhost/"))
+	if r.Error == nil {
+		t.Fatal("expected timeout error")
+	}
+	if !strings.Contains(r.Error.Error(), "worker execution timed out") {
+		t.Errorf("error = %v, expected 'worker execution timed out'", r.Error)
+	}
+	if r.Duration.Seconds() > 2 {
+		t.Errorf("duration = %v, expected the request to stop near the 300ms deadline", r.Duration)
+	}
+
+	// The timed-out worker is discarded; the site keeps serving.
+	okSource := `export default { fetch() { return new Response("ok"); } };`
+	if _, err := e.CompileAndCache(siteID, "deploy2", okSource); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	r = e.Execute(siteID, "deploy2", defaultEnv(), getReq("http://localhost/"))
+	assertOK(t, r)
+}
+
+func TestExecute_CPUTime(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("per-thread CPU time is only measured on linux")
+	}
+	e := newTestEngine(t)
+
+	source := `export default {
+  async fetch(request, env) {
+    if (new URL(request.url).pathname === "/sleep") {
+      await new Promise(r => setTimeout(r, 300));
+      return new Response("slept");
+    }
+    let x = 0;
+    const end = Date.now() + 200;
+    while (Date.now() < end) x = (x * 31 + 7) % 1000003;
+    return new Response(String(x));
+  },
+};`
+
+	r := execJS(t, e, source, defaultEnv(), getReq("http://localhost/busy"))
+	assertOK(t, r)
+	if r.CPUTime <= 0 {
+		t.Errorf("CPUTime = %v, want > 0 for a CPU-bound handler", r.CPUTime)
+	}
+	if r.CPUTime > r.Duration {
+		t.Errorf("CPUTime = %v exceeds Duration = %v", r.CPUTime, r.Duration)
+	}
+
+	r = execJS(t, e, source, defaultEnv(), getReq("http://localhost/sleep"))
+	assertOK(t, r)
+	if r.CPUTime > r.Duration/2 {
+		t.Errorf("CPUTime = %v for a handler idle on a timer, Duration = %v", r.CPUTime, r.Duration)
+	}
+}
+
 func TestEdge_UncaughtException(t *testing.T) {
 	e := newTestEngine(t)
 